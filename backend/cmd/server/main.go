@@ -2,19 +2,34 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log"
+	"net/url"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/guixu633/agent/backend/internal/config"
 	"github.com/guixu633/agent/backend/internal/database"
+	"github.com/guixu633/agent/backend/internal/generator"
+	budgetHandler "github.com/guixu633/agent/backend/internal/handler/budget"
+	conversationHandler "github.com/guixu633/agent/backend/internal/handler/conversation"
 	imageHandler "github.com/guixu633/agent/backend/internal/handler/image"
+	jobHandler "github.com/guixu633/agent/backend/internal/handler/job"
+	storageOpHandler "github.com/guixu633/agent/backend/internal/handler/storageop"
 	workspaceHandler "github.com/guixu633/agent/backend/internal/handler/workspace"
 	"github.com/guixu633/agent/backend/internal/oss"
 	"github.com/guixu633/agent/backend/internal/repository"
+	"github.com/guixu633/agent/backend/internal/s3"
+	budgetService "github.com/guixu633/agent/backend/internal/service/budget"
 	imageService "github.com/guixu633/agent/backend/internal/service/image"
+	jobService "github.com/guixu633/agent/backend/internal/service/job"
+	reconcileService "github.com/guixu633/agent/backend/internal/service/reconcile"
+	storageOpService "github.com/guixu633/agent/backend/internal/service/storageop"
 	workspaceService "github.com/guixu633/agent/backend/internal/service/workspace"
+	"github.com/guixu633/agent/backend/internal/storage"
 	"google.golang.org/genai"
 )
 
@@ -24,12 +39,6 @@ const (
 )
 
 func main() {
-	// 初始化 GenAI 客户端
-	genaiClient, err := initGenAIClient()
-	if err != nil {
-		log.Fatalf("初始化 GenAI 客户端失败: %v", err)
-	}
-
 	// 加载统一配置
 	configPath := os.Getenv("CONFIG_PATH")
 	if configPath == "" {
@@ -40,11 +49,35 @@ func main() {
 		log.Fatalf("加载配置文件失败: %v", err)
 	}
 
-	// 初始化 OSS 客户端（从统一配置加载）
-	ossClient, err := oss.NewClient(configPath)
+	// 子命令：reconcile 执行一次存储一致性巡检后退出
+	if len(os.Args) > 1 && os.Args[1] == "reconcile" {
+		if err := runReconcile(appConfig, configPath, os.Args[2:]); err != nil {
+			log.Fatalf("存储一致性巡检失败: %v", err)
+		}
+		return
+	}
+
+	// 子命令：migrate 执行数据库迁移命令后退出
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(appConfig, os.Args[2:]); err != nil {
+			log.Fatalf("数据库迁移失败: %v", err)
+		}
+		return
+	}
+
+	// 初始化模型注册表
+	registry, err := initRegistry(appConfig.Models, appConfig.Resilience)
+	if err != nil {
+		log.Fatalf("初始化模型注册表失败: %v", err)
+	}
+
+	// 初始化图片存储（按配置选择 OSS 或本地磁盘）
+	store, err := initStorage(appConfig.Storage, configPath)
 	if err != nil {
-		log.Fatalf("初始化 OSS 客户端失败: %v", err)
+		log.Fatalf("初始化存储失败: %v", err)
 	}
+	layout := storage.NewLayout(appConfig.Storage.ImagePrefix)
+	urlTTL := time.Duration(appConfig.Storage.URLTTL) * time.Second
 
 	// 初始化数据库连接
 	dsn := appConfig.Postgres.GetDSN()
@@ -62,14 +95,51 @@ func main() {
 	// 初始化 Repository 层
 	workspaceRepo := repository.NewWorkspaceRepository()
 	imageRepo := repository.NewImageRepository()
+	jobRepo := repository.NewJobRepository()
+	conversationRepo := repository.NewConversationRepository()
+	runRepo := repository.NewGenerationRunRepository()
+	budgetRepo := repository.NewBudgetRepository()
+	storageOpRepo := repository.NewStorageOpRepository()
 
 	// 初始化服务层
-	imgService := imageService.NewService(genaiClient, ossClient, imageRepo, workspaceRepo)
-	wsService := workspaceService.NewService(ossClient, workspaceRepo)
+	bgService := budgetService.NewService(budgetRepo, workspaceRepo, runRepo)
+	imgService := imageService.NewService(imageService.Deps{
+		Registry:         registry,
+		Store:            store,
+		Layout:           layout,
+		URLTTL:           urlTTL,
+		ImageRepo:        imageRepo,
+		WorkspaceRepo:    workspaceRepo,
+		ConversationRepo: conversationRepo,
+		RunRepo:          runRepo,
+		StorageOpRepo:    storageOpRepo,
+		BudgetService:    bgService,
+	})
+	wsService := workspaceService.NewService(store, layout, workspaceRepo, runRepo)
+	jbService := jobService.NewService(imgService, jobRepo, workspaceRepo, appConfig.Jobs, appConfig.Models)
+	rcService := reconcileService.NewService(store, layout, imageRepo, workspaceRepo, conversationRepo, storageOpRepo, appConfig.Reconcile)
+	soService := storageOpService.NewService(store, storageOpRepo, imageRepo, appConfig.StorageOps)
+
+	// 启动异步生成任务调度器
+	if err := jbService.Start(context.Background()); err != nil {
+		log.Fatalf("启动生成任务调度器失败: %v", err)
+	}
+
+	// 启动待执行存储操作的后台任务（删除图片文件等，失败时重试）
+	soService.Start(context.Background())
+
+	// 启动存储一致性定期巡检
+	if appConfig.Reconcile.Enabled {
+		rcService.Start(context.Background())
+	}
 
 	// 初始化处理器层
 	imgHandler := imageHandler.NewHandler(imgService)
 	wsHandler := workspaceHandler.NewHandler(wsService)
+	jbHandler := jobHandler.NewHandler(jbService)
+	convHandler := conversationHandler.NewHandler(imgService)
+	bgHandler := budgetHandler.NewHandler(bgService)
+	soHandler := storageOpHandler.NewHandler(soService)
 
 	// 创建 Gin 路由
 	r := gin.Default()
@@ -83,6 +153,15 @@ func main() {
 		AllowCredentials: true,
 	}))
 
+	// 本地存储的文件通过静态路由访问
+	if localStore, ok := store.(*storage.LocalStore); ok {
+		routePath, err := localStoreRoute(appConfig.Storage.Local.BaseURL)
+		if err != nil {
+			log.Fatalf("解析本地存储访问 URL 失败: %v", err)
+		}
+		r.Static(routePath, localStore.Root())
+	}
+
 	// 注册路由
 	api := r.Group("/api")
 	{
@@ -93,16 +172,50 @@ func main() {
 		api.GET("/workspace/current", wsHandler.GetCurrent) // 获取当前工作区
 		api.PUT("/workspace/current", wsHandler.SetCurrent) // 设置当前工作区（切换工作区）
 		api.POST("/workspace/switch", wsHandler.SetCurrent) // 切换工作区（别名，与 PUT /workspace/current 相同）
+		api.GET("/workspace/usage", wsHandler.Usage)        // 查询工作区用量（按天和模型汇总）
+		api.GET("/workspace/budget", bgHandler.List)        // 列出工作区预算及当前用量
+		api.PUT("/workspace/budget", bgHandler.Set)         // 设置工作区预算（每日/每月限额）
+		api.DELETE("/workspace/budget", bgHandler.Delete)   // 删除工作区预算
+
+		// 模型相关接口
+		api.GET("/models", imgHandler.ListModels)          // 列出可用模型
+		api.GET("/models/stats", imgHandler.ProviderStats) // 模型供应商调用计数（监控）
 
 		// 图片相关接口
 		imageGroup := api.Group("/image")
 		{
-			imageGroup.GET("/list", imgHandler.List)          // 列出工作区图片接口
-			imageGroup.GET("/detail", imgHandler.GetDetail)   // 获取图片详情接口
-			imageGroup.POST("/upload", imgHandler.Upload)     // 图片上传接口
-			imageGroup.POST("/generate", imgHandler.Generate) // 图片生成接口
-			imageGroup.DELETE("", imgHandler.Delete)          // 删除图片接口
-			imageGroup.POST("/rename", imgHandler.Rename)     // 重命名图片接口
+			imageGroup.GET("/list", imgHandler.List)                       // 列出工作区图片接口
+			imageGroup.GET("/search", imgHandler.Search)                   // 全文搜索图片接口
+			imageGroup.GET("/tags", imgHandler.ListTags)                   // 列出工作区标签及图片数量
+			imageGroup.POST("/tags", imgHandler.AddTags)                   // 为图片添加标签
+			imageGroup.DELETE("/tags", imgHandler.RemoveTags)              // 移除图片标签
+			imageGroup.GET("/detail", imgHandler.GetDetail)                // 获取图片详情接口
+			imageGroup.GET("/raw/:id", imgHandler.Raw)                     // 通过后端读取图片原图
+			imageGroup.GET("/thumb/:id", imgHandler.Thumb)                 // 通过后端读取图片缩略图
+			imageGroup.POST("/upload", imgHandler.Upload)                  // 图片上传接口
+			imageGroup.POST("/generate", imgHandler.Generate)              // 图片生成接口
+			imageGroup.POST("/generate/stream", imgHandler.GenerateStream) // 图片流式生成接口（SSE）
+			imageGroup.DELETE("", imgHandler.Delete)                       // 删除图片接口
+			imageGroup.POST("/rename", imgHandler.Rename)                  // 重命名图片接口
+			imageGroup.POST("/jobs", jbHandler.Create)                     // 提交异步生成任务
+			imageGroup.GET("/jobs/:id", jbHandler.Get)                     // 获取生成任务状态
+			imageGroup.DELETE("/jobs/:id", jbHandler.Cancel)               // 取消生成任务
+			imageGroup.GET("/runs/:id", imgHandler.GetRun)                 // 获取模型调用记录
+		}
+
+		// 多轮对话相关接口
+		conversationGroup := api.Group("/conversation")
+		{
+			conversationGroup.GET("", convHandler.List)                   // 列出工作区的对话
+			conversationGroup.GET("/:id", convHandler.Get)                // 获取对话详情
+			conversationGroup.POST("/:id/continue", convHandler.Continue) // 继续对话
+		}
+
+		// 管理接口
+		adminGroup := api.Group("/admin")
+		{
+			adminGroup.GET("/storage-ops", soHandler.List)             // 列出待执行的存储操作
+			adminGroup.POST("/storage-ops/:id/retry", soHandler.Retry) // 重新执行失败的存储操作
 		}
 	}
 
@@ -125,6 +238,68 @@ func main() {
 	}
 }
 
+// initRegistry 初始化模型注册表
+// 仅在配置了 gemini 供应商的模型时才初始化 GenAI 客户端，便于离线使用 fake 供应商开发
+// 每个供应商的生成器都包装了重试和熔断
+func initRegistry(modelsConfig config.ModelsConfig, resilienceConfig config.ResilienceConfig) (*generator.Registry, error) {
+	providers := map[string]generator.ImageGenerator{
+		"fake": generator.NewFakeGenerator(),
+	}
+
+	for _, m := range modelsConfig.Items {
+		if m.Provider != "gemini" {
+			continue
+		}
+		genaiClient, err := initGenAIClient()
+		if err != nil {
+			return nil, fmt.Errorf("初始化 GenAI 客户端失败: %w", err)
+		}
+		providers["gemini"] = generator.NewGeminiGenerator(genaiClient)
+		break
+	}
+
+	for name, g := range providers {
+		providers[name] = generator.NewResilientGenerator(g, resilienceConfig)
+	}
+
+	return generator.NewRegistry(modelsConfig, providers)
+}
+
+// initStorage 根据配置创建图片存储
+func initStorage(storageConfig config.StorageConfig, configPath string) (storage.BlobStore, error) {
+	switch storageConfig.Backend {
+	case storage.BackendOSS:
+		// OSS 客户端从统一配置加载
+		ossClient, err := oss.NewClient(configPath)
+		if err != nil {
+			return nil, fmt.Errorf("初始化 OSS 客户端失败: %w", err)
+		}
+		return ossClient, nil
+	case storage.BackendLocal:
+		return storage.NewLocalStore(storageConfig.Local.Root, storageConfig.Local.BaseURL)
+	case storage.BackendS3:
+		s3Client, err := s3.NewClient(storageConfig.S3)
+		if err != nil {
+			return nil, fmt.Errorf("初始化 S3 客户端失败: %w", err)
+		}
+		return s3Client, nil
+	}
+	return nil, fmt.Errorf("不支持的存储后端: %s", storageConfig.Backend)
+}
+
+// localStoreRoute 返回本地存储静态文件路由的路径（访问 URL 的路径部分）
+func localStoreRoute(baseURL string) (string, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return "", err
+	}
+	routePath := strings.TrimSuffix(u.Path, "/")
+	if routePath == "" {
+		return "", fmt.Errorf("访问 URL 必须包含路径: %s", baseURL)
+	}
+	return routePath, nil
+}
+
 // initGenAIClient 初始化 GenAI 客户端
 func initGenAIClient() (*genai.Client, error) {
 	configPath := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS")
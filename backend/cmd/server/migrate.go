@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strconv"
+
+	"github.com/guixu633/agent/backend/internal/config"
+	"github.com/guixu633/agent/backend/internal/database"
+)
+
+// migrateUsage 子命令用法
+const migrateUsage = `用法: server migrate <命令>
+  up              执行所有未执行的迁移
+  down [N]        回滚最近执行的 N 个迁移（默认 1 个）
+  status          查看各版本的执行状态
+  goto VERSION    迁移到指定版本（回滚更大的版本，执行不大于该版本的未执行迁移；0 表示回滚所有迁移）
+  create NAME     在 -dir 目录中创建下一个版本的迁移文件和回滚文件`
+
+// runMigrate 执行数据库迁移命令
+// 用法: server migrate [-dir path] <up | down [N] | status | goto VERSION | create NAME>
+func runMigrate(appConfig *config.Config, args []string) error {
+	flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	dir := flags.String("dir", "internal/database/migrations", "迁移文件目录（只用于 create，其他命令使用编译时内嵌的迁移文件）")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	args = flags.Args()
+	if len(args) == 0 {
+		return fmt.Errorf("缺少命令\n%s", migrateUsage)
+	}
+
+	if args[0] == "create" {
+		if len(args) != 2 {
+			return fmt.Errorf("create 需要迁移名称\n%s", migrateUsage)
+		}
+		upPath, downPath, err := database.CreateMigration(*dir, args[1])
+		if err != nil {
+			return err
+		}
+		fmt.Printf("已创建 %s\n已创建 %s\n", upPath, downPath)
+		return nil
+	}
+
+	if err := database.InitDB(appConfig.Postgres.GetDSN()); err != nil {
+		return fmt.Errorf("初始化数据库连接失败: %w", err)
+	}
+	defer database.CloseDB()
+
+	migrator, err := database.NewMigrator(database.DB)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+
+	switch args[0] {
+	case "up":
+		executed, err := migrator.Up(ctx)
+		printMigrations("已执行", executed)
+		if err == nil && len(executed) == 0 {
+			fmt.Println("没有需要执行的迁移")
+		}
+		return err
+	case "down":
+		n := 1
+		if len(args) > 1 {
+			if n, err = strconv.Atoi(args[1]); err != nil || n <= 0 {
+				return fmt.Errorf("回滚数量必须是正整数: %s", args[1])
+			}
+		}
+		rolledBack, err := migrator.Down(ctx, n)
+		printMigrations("已回滚", rolledBack)
+		return err
+	case "goto":
+		if len(args) != 2 {
+			return fmt.Errorf("goto 需要目标版本\n%s", migrateUsage)
+		}
+		version, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil || version < 0 {
+			return fmt.Errorf("目标版本必须是非负整数: %s", args[1])
+		}
+		executed, rolledBack, err := migrator.Goto(ctx, version)
+		printMigrations("已回滚", rolledBack)
+		printMigrations("已执行", executed)
+		return err
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, status := range statuses {
+			state := "未执行"
+			if status.Applied {
+				state = "已执行 " + status.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			switch {
+			case status.Missing:
+				state += "（没有对应的迁移文件）"
+			case status.Modified:
+				state += "（执行后文件被修改）"
+			}
+			fmt.Printf("%03d %-40s %s\n", status.Version, status.Name, state)
+		}
+		return nil
+	default:
+		return fmt.Errorf("未知命令: %s\n%s", args[0], migrateUsage)
+	}
+}
+
+// printMigrations 输出执行或回滚的迁移
+func printMigrations(action string, migrations []database.Migration) {
+	for _, migration := range migrations {
+		fmt.Printf("%s %03d_%s\n", action, migration.Version, migration.Name)
+	}
+}
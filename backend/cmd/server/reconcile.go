@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/guixu633/agent/backend/internal/config"
+	"github.com/guixu633/agent/backend/internal/database"
+	"github.com/guixu633/agent/backend/internal/repository"
+	reconcileService "github.com/guixu633/agent/backend/internal/service/reconcile"
+	"github.com/guixu633/agent/backend/internal/storage"
+)
+
+// runReconcile 执行一次存储与数据库的一致性巡检并输出报告
+// 孤立文件只登记为待执行存储操作，由运行中的服务确认没有被引用后删除
+// 用法: server reconcile [-dry-run] [-workspace name] [-json]
+func runReconcile(appConfig *config.Config, configPath string, args []string) error {
+	flags := flag.NewFlagSet("reconcile", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "只报告不修复")
+	workspace := flags.String("workspace", "", "只检查指定工作区（默认检查所有工作区）")
+	asJSON := flags.Bool("json", false, "以 JSON 格式输出报告")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	store, err := initStorage(appConfig.Storage, configPath)
+	if err != nil {
+		return fmt.Errorf("初始化存储失败: %w", err)
+	}
+	if err := database.InitDB(appConfig.Postgres.GetDSN()); err != nil {
+		return fmt.Errorf("初始化数据库连接失败: %w", err)
+	}
+	defer database.CloseDB()
+
+	service := reconcileService.NewService(
+		store,
+		storage.NewLayout(appConfig.Storage.ImagePrefix),
+		repository.NewImageRepository(),
+		repository.NewWorkspaceRepository(),
+		repository.NewConversationRepository(),
+		repository.NewStorageOpRepository(),
+		appConfig.Reconcile,
+	)
+	report, err := service.Run(context.Background(), reconcileService.Options{Workspace: *workspace, DryRun: *dryRun})
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	}
+
+	for _, issue := range report.Issues {
+		status := "未修复"
+		switch {
+		case issue.Repaired:
+			status = "已修复"
+		case issue.Error != "":
+			status = "修复失败: " + issue.Error
+		}
+		fmt.Printf("[%s] %s %s (%s)\n", issue.Kind, issue.Workspace, issue.Path, status)
+	}
+	fmt.Printf("检查了 %d 个工作区、%d 个文件、%d 条图片记录: 孤立文件 %d 个，原图丢失 %d 个，缺少缩略图 %d 个，修复失败 %d 个\n",
+		report.Workspaces, report.Objects, report.Images,
+		report.Count(reconcileService.IssueOrphanObject),
+		report.Count(reconcileService.IssueMissingObject),
+		report.Count(reconcileService.IssueMissingThumbnail),
+		report.Failed())
+	if report.Failed() > 0 {
+		return fmt.Errorf("%d 个问题修复失败", report.Failed())
+	}
+	return nil
+}
@@ -8,8 +8,14 @@ import (
 
 // Config 统一配置结构
 type Config struct {
-	OSS     OSSConfig     `json:"oss"`
-	Postgres PostgresConfig `json:"postgres"`
+	Storage    StorageConfig    `json:"storage"`
+	OSS        OSSConfig        `json:"oss"`
+	Postgres   PostgresConfig   `json:"postgres"`
+	Models     ModelsConfig     `json:"models"`
+	Jobs       JobsConfig       `json:"jobs"`
+	Resilience ResilienceConfig `json:"resilience"`
+	Reconcile  ReconcileConfig  `json:"reconcile"`
+	StorageOps StorageOpsConfig `json:"storage_ops"`
 }
 
 // OSSConfig OSS 配置
@@ -21,6 +27,34 @@ type OSSConfig struct {
 	ImagePrefix     string `json:"image_prefix"`
 }
 
+// StorageConfig 图片存储配置
+type StorageConfig struct {
+	Backend     string             `json:"backend"`      // 存储后端: "oss"（默认）| "local" | "s3"
+	ImagePrefix string             `json:"image_prefix"` // 图片根目录，默认沿用 oss.image_prefix，都未配置时为 "image"
+	Local       LocalStorageConfig `json:"local"`        // 本地磁盘存储配置（backend 为 local 时有效）
+	S3          S3StorageConfig    `json:"s3"`           // S3 兼容存储配置（backend 为 s3 时有效）
+	// 图片访问 URL 的有效期（秒）。大于 0 时每次读取都生成带签名的临时 URL（支持私有存储桶）；
+	// 0 表示返回永久的公开 URL（存储桶需公开读）。本地磁盘存储不支持签名，始终返回公开 URL
+	URLTTL int `json:"url_ttl"`
+}
+
+// LocalStorageConfig 本地磁盘存储配置
+type LocalStorageConfig struct {
+	Root    string `json:"root"`     // 存储目录
+	BaseURL string `json:"base_url"` // 文件访问 URL 前缀，其路径部分同时作为静态文件路由，如 "http://localhost:8080/files"
+}
+
+// S3StorageConfig S3 兼容存储配置（AWS S3、MinIO、Cloudflare R2 等）
+type S3StorageConfig struct {
+	Endpoint        string `json:"endpoint"`          // 服务地址，如 "http://localhost:9000"；为空时使用 AWS S3 的默认地址
+	Region          string `json:"region"`            // 区域，默认 "us-east-1"（R2 使用 "auto"）
+	Bucket          string `json:"bucket"`            // 存储桶
+	AccessKeyID     string `json:"access_key_id"`     // 访问密钥 ID
+	SecretAccessKey string `json:"secret_access_key"` // 访问密钥
+	PathStyle       bool   `json:"path_style"`        // 是否使用路径风格地址（<endpoint>/<bucket>/<key>），MinIO 通常需要开启
+	PublicBaseURL   string `json:"public_base_url"`   // 对象访问 URL 前缀（如 CDN 域名），为空时根据 endpoint 和 bucket 生成
+}
+
 // PostgresConfig PostgreSQL 配置
 type PostgresConfig struct {
 	Host     string `json:"host"`
@@ -32,6 +66,144 @@ type PostgresConfig struct {
 	TimeZone string `json:"timezone"`
 }
 
+// ModelsConfig 模型注册表配置
+type ModelsConfig struct {
+	Default string        `json:"default"` // 默认模型名称（请求未指定模型时使用）
+	Items   []ModelConfig `json:"items"`   // 允许使用的模型列表
+}
+
+// ModelConfig 单个模型配置
+type ModelConfig struct {
+	Name         string            `json:"name"`         // 模型名称，如 "gemini-3-pro-image-preview"
+	DisplayName  string            `json:"display_name"` // 展示名称
+	Provider     string            `json:"provider"`     // 模型供应商: "gemini" | "fake"
+	Capabilities ModelCapabilities `json:"capabilities"` // 模型能力
+	Defaults     ModelDefaults     `json:"defaults"`     // 请求未指定时使用的默认参数
+	// 该模型同时运行的异步任务数上限（0 表示只受 jobs.workers 限制）
+	MaxConcurrency int `json:"max_concurrency"`
+	// 价格表，用于估算每次调用的成本（未配置时成本记为 0）
+	Pricing ModelPricing `json:"pricing"`
+}
+
+// ModelPricing 模型价格（美元）
+// 成本 = 各类 token 数 / 1,000,000 × 对应单价 + 输出图片数 × 每张图片价格
+type ModelPricing struct {
+	PromptPerMillion     float64 `json:"prompt_per_million"`     // 每百万输入 token 价格
+	CandidatesPerMillion float64 `json:"candidates_per_million"` // 每百万输出 token 价格
+	ThoughtsPerMillion   float64 `json:"thoughts_per_million"`   // 每百万思考 token 价格
+	PerImage             float64 `json:"per_image"`              // 每张输出图片的附加价格（图片 token 单价高于输出 token 单价时的差额）
+}
+
+// ModelCapabilities 模型能力
+type ModelCapabilities struct {
+	ImageOutput        bool     `json:"image_output"`         // 是否支持输出图片
+	WebSearch          bool     `json:"web_search"`           // 是否支持联网搜索
+	MaxReferenceImages int      `json:"max_reference_images"` // 最多参考图片数量（0 表示不限制）
+	AspectRatios       []string `json:"aspect_ratios"`        // 支持的宽高比（为空表示不支持指定）
+	ImageSizes         []string `json:"image_sizes"`          // 支持的输出分辨率（为空表示不支持指定）
+	MaxCandidates      int      `json:"max_candidates"`       // 最多候选结果数量（0 表示只支持 1 个）
+}
+
+// ModelDefaults 模型默认参数
+type ModelDefaults struct {
+	EnableWebSearch bool `json:"enable_web_search"` // 默认是否启用联网搜索
+}
+
+// JobsConfig 异步生成任务配置
+type JobsConfig struct {
+	Workers           int `json:"workers"`            // 同时运行的任务数上限
+	PollInterval      int `json:"poll_interval"`      // 轮询排队任务的间隔（秒）
+	HeartbeatInterval int `json:"heartbeat_interval"` // 运行中任务刷新心跳的间隔（秒）
+	HeartbeatTimeout  int `json:"heartbeat_timeout"`  // 心跳超过多久未刷新视为实例已退出，任务重新排队（秒）
+}
+
+// ReconcileConfig 存储与数据库一致性巡检配置
+type ReconcileConfig struct {
+	Enabled  bool `json:"enabled"`  // 是否在服务中定期巡检
+	Interval int  `json:"interval"` // 巡检间隔（秒）
+	DryRun   bool `json:"dry_run"`  // 只报告不修复
+	MinAge   int  `json:"min_age"`  // 无数据库记录的文件至少存在多久才视为孤立文件（秒），避免误删正在上传的图片
+}
+
+// StorageOpsConfig 待执行存储操作（如删除图片文件）的后台重试配置
+type StorageOpsConfig struct {
+	PollInterval   int `json:"poll_interval"`   // 轮询待执行操作的间隔（秒）
+	BatchSize      int `json:"batch_size"`      // 每次轮询最多处理的操作数
+	MaxAttempts    int `json:"max_attempts"`    // 最多尝试次数，超过后标记为 failed
+	InitialBackoff int `json:"initial_backoff"` // 第一次重试前的退避时间（秒），之后每次翻倍
+	MaxBackoff     int `json:"max_backoff"`     // 退避时间上限（秒）
+	Lease          int `json:"lease"`           // 领取操作后的租约时间（秒），超时未处理完的操作会被其他实例重新领取
+}
+
+// ResilienceConfig 上游模型调用的重试和熔断配置（每个供应商独立熔断）
+type ResilienceConfig struct {
+	MaxRetries       int `json:"max_retries"`        // 失败后最多重试次数（负数表示不重试）
+	InitialBackoffMs int `json:"initial_backoff_ms"` // 第一次重试前的退避时间（毫秒），之后每次翻倍并加入随机抖动
+	MaxBackoffMs     int `json:"max_backoff_ms"`     // 退避时间上限（毫秒）
+	CallTimeout      int `json:"call_timeout"`       // 单次调用超时（秒），同时受请求 context 的截止时间限制
+	BreakerThreshold int `json:"breaker_threshold"`  // 连续失败多少次后熔断（负数表示不熔断）
+	BreakerCooldown  int `json:"breaker_cooldown"`   // 熔断后多久允许一次试探调用（秒）
+}
+
+const (
+	DefaultImageModel = "gemini-3-pro-image-preview"
+
+	DefaultStorageBackend      = "oss"
+	DefaultLocalStorageRoot    = "data/storage"
+	DefaultLocalStorageBaseURL = "/files"
+	DefaultS3Region            = "us-east-1"
+
+	DefaultJobWorkers           = 4
+	DefaultJobPollInterval      = 5
+	DefaultJobHeartbeatInterval = 10
+	DefaultJobHeartbeatTimeout  = 60
+
+	DefaultReconcileInterval = 6 * 60 * 60
+	DefaultReconcileMinAge   = 60 * 60
+
+	DefaultStorageOpPollInterval   = 5
+	DefaultStorageOpBatchSize      = 100
+	DefaultStorageOpMaxAttempts    = 10
+	DefaultStorageOpInitialBackoff = 10
+	DefaultStorageOpMaxBackoff     = 60 * 60
+	DefaultStorageOpLease          = 5 * 60
+
+	DefaultMaxRetries       = 2
+	DefaultInitialBackoffMs = 500
+	DefaultMaxBackoffMs     = 8000
+	DefaultCallTimeout      = 180
+	DefaultBreakerThreshold = 5
+	DefaultBreakerCooldown  = 30
+)
+
+// DefaultModelsConfig 默认模型注册表（配置文件未配置 models 时使用）
+func DefaultModelsConfig() ModelsConfig {
+	return ModelsConfig{
+		Default: DefaultImageModel,
+		Items: []ModelConfig{
+			{
+				Name:        DefaultImageModel,
+				DisplayName: "Gemini 3 Pro Image",
+				Provider:    "gemini",
+				Capabilities: ModelCapabilities{
+					ImageOutput:        true,
+					WebSearch:          true,
+					MaxReferenceImages: 14,
+					AspectRatios:       []string{"1:1", "2:3", "3:2", "3:4", "4:3", "4:5", "5:4", "9:16", "16:9", "21:9"},
+					ImageSizes:         []string{"1K", "2K", "4K"},
+					MaxCandidates:      1,
+				},
+				Pricing: ModelPricing{
+					PromptPerMillion:     2,
+					CandidatesPerMillion: 12,
+					ThoughtsPerMillion:   12,
+					PerImage:             0.12,
+				},
+			},
+		},
+	}
+}
+
 // LoadConfig 加载配置文件
 func LoadConfig(configPath string) (*Config, error) {
 	if configPath == "" {
@@ -48,12 +220,104 @@ func LoadConfig(configPath string) (*Config, error) {
 		return nil, fmt.Errorf("解析配置文件失败: %w", err)
 	}
 
+	// 存储默认配置
+	if config.Storage.Backend == "" {
+		config.Storage.Backend = DefaultStorageBackend
+	}
+	if config.Storage.ImagePrefix == "" {
+		config.Storage.ImagePrefix = config.OSS.ImagePrefix
+	}
+	if config.Storage.Local.Root == "" {
+		config.Storage.Local.Root = DefaultLocalStorageRoot
+	}
+	if config.Storage.Local.BaseURL == "" {
+		config.Storage.Local.BaseURL = DefaultLocalStorageBaseURL
+	}
+	if config.Storage.S3.Region == "" {
+		config.Storage.S3.Region = DefaultS3Region
+	}
+
+	// 未配置模型注册表时使用默认模型
+	if len(config.Models.Items) == 0 {
+		config.Models = DefaultModelsConfig()
+	}
+	if config.Models.Default == "" {
+		config.Models.Default = config.Models.Items[0].Name
+	}
+
+	// 异步任务默认配置
+	if config.Jobs.Workers <= 0 {
+		config.Jobs.Workers = DefaultJobWorkers
+	}
+	if config.Jobs.PollInterval <= 0 {
+		config.Jobs.PollInterval = DefaultJobPollInterval
+	}
+	if config.Jobs.HeartbeatInterval <= 0 {
+		config.Jobs.HeartbeatInterval = DefaultJobHeartbeatInterval
+	}
+	if config.Jobs.HeartbeatTimeout <= config.Jobs.HeartbeatInterval {
+		config.Jobs.HeartbeatTimeout = max(DefaultJobHeartbeatTimeout, 3*config.Jobs.HeartbeatInterval)
+	}
+
+	// 一致性巡检默认配置
+	if config.Reconcile.Interval <= 0 {
+		config.Reconcile.Interval = DefaultReconcileInterval
+	}
+	if config.Reconcile.MinAge <= 0 {
+		config.Reconcile.MinAge = DefaultReconcileMinAge
+	}
+
+	// 待执行存储操作默认配置
+	if config.StorageOps.PollInterval <= 0 {
+		config.StorageOps.PollInterval = DefaultStorageOpPollInterval
+	}
+	if config.StorageOps.BatchSize <= 0 {
+		config.StorageOps.BatchSize = DefaultStorageOpBatchSize
+	}
+	if config.StorageOps.MaxAttempts <= 0 {
+		config.StorageOps.MaxAttempts = DefaultStorageOpMaxAttempts
+	}
+	if config.StorageOps.InitialBackoff <= 0 {
+		config.StorageOps.InitialBackoff = DefaultStorageOpInitialBackoff
+	}
+	if config.StorageOps.MaxBackoff <= 0 {
+		config.StorageOps.MaxBackoff = DefaultStorageOpMaxBackoff
+	}
+	if config.StorageOps.Lease <= 0 {
+		config.StorageOps.Lease = DefaultStorageOpLease
+	}
+
+	// 重试和熔断默认配置
+	config.Resilience.applyDefaults()
+
 	return &config, nil
 }
 
+// applyDefaults 为未配置的重试和熔断参数设置默认值
+// max_retries 和 breaker_threshold 为 0 时使用默认值，需要关闭时配置为负数
+func (c *ResilienceConfig) applyDefaults() {
+	if c.MaxRetries == 0 {
+		c.MaxRetries = DefaultMaxRetries
+	}
+	if c.InitialBackoffMs <= 0 {
+		c.InitialBackoffMs = DefaultInitialBackoffMs
+	}
+	if c.MaxBackoffMs <= 0 {
+		c.MaxBackoffMs = DefaultMaxBackoffMs
+	}
+	if c.CallTimeout <= 0 {
+		c.CallTimeout = DefaultCallTimeout
+	}
+	if c.BreakerThreshold == 0 {
+		c.BreakerThreshold = DefaultBreakerThreshold
+	}
+	if c.BreakerCooldown <= 0 {
+		c.BreakerCooldown = DefaultBreakerCooldown
+	}
+}
+
 // GetDSN 获取 PostgreSQL 连接字符串
 func (c *PostgresConfig) GetDSN() string {
 	return fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s TimeZone=%s",
 		c.Host, c.Port, c.User, c.Password, c.DBName, c.SSLMode, c.TimeZone)
 }
-
@@ -1,118 +1,577 @@
 package database
 
 import (
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"database/sql/driver"
+	"embed"
 	"fmt"
+	"io/fs"
+	"log"
+	"maps"
 	"os"
+	"path"
 	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
+	"unicode"
 )
 
-// RunMigrations 执行数据库迁移
+// migrationsFS 内嵌的迁移文件（编译进二进制，与运行目录无关）
+//
+//go:embed migrations/*.sql
+var migrationsFS embed.FS
+
+// migrationLockID 执行迁移时持有的 PostgreSQL advisory lock ID（多个实例同时启动时只有一个执行迁移）
+const migrationLockID int64 = 0x6167656e74 // "agent"
+
+// migrationFilePattern 迁移文件名格式：<版本号>_<名称>.up.sql 和 <版本号>_<名称>.down.sql，
+// 如 001_create_tables.up.sql（执行）和 001_create_tables.down.sql（回滚，可选）
+var migrationFilePattern = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+// migrationNamePattern 迁移名称格式
+var migrationNamePattern = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+// Migration 一个版本的迁移
+type Migration struct {
+	Version  int64  // 版本号（文件名的数字前缀）
+	Name     string // 名称（文件名去掉版本号和后缀）
+	Filename string // 执行迁移的文件名
+	UpSQL    string
+	DownSQL  string // 回滚 SQL（没有回滚文件时为空）
+	Checksum string // 执行迁移文件内容的 SHA-256（十六进制），用于发现执行后被修改的迁移文件
+}
+
+// MigrationStatus 一个版本的迁移状态
+type MigrationStatus struct {
+	Version   int64
+	Name      string
+	Applied   bool
+	AppliedAt time.Time // 执行时间（未执行时为零值）
+	Modified  bool      // 执行后迁移文件被修改（校验和不一致）
+	Missing   bool      // 数据库中已执行但没有对应的迁移文件
+}
+
+// appliedMigration schema_migrations 表中的一条记录
+type appliedMigration struct {
+	Name      string
+	Checksum  string
+	AppliedAt time.Time
+}
+
+// Migrator 数据库迁移执行器
+// 已执行的版本记录在 schema_migrations 表中，每个版本在独立的事务中执行（或回滚）并记录
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+}
+
+// NewMigrator 创建迁移执行器，迁移文件从内嵌的 migrations 目录加载
+func NewMigrator(db *sql.DB) (*Migrator, error) {
+	migrations, err := loadMigrations(migrationsFS, "migrations")
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{
+		db:         db,
+		migrations: migrations,
+	}, nil
+}
+
+// RunMigrations 执行数据库迁移（执行所有未执行的版本）
+// 之前的版本每次启动都重新执行所有迁移文件，这些文件都是幂等的，
+// 因此已有数据库首次使用 schema_migrations 时重新执行一遍即可完成记录
 func RunMigrations() error {
 	if DB == nil {
 		return fmt.Errorf("数据库未初始化")
 	}
 
-	// 迁移文件列表（按顺序执行）
-	migrationFiles := []string{
-		"001_create_tables.sql",
-		"002_add_is_current_to_workspaces.sql",
-		"003_add_image_generation_info.sql",
+	migrator, err := NewMigrator(DB)
+	if err != nil {
+		return err
+	}
+	applied, err := migrator.Up(context.Background())
+	if err != nil {
+		return err
 	}
+	for _, m := range applied {
+		log.Printf("已执行数据库迁移: %s", m.Filename)
+	}
+	return nil
+}
 
-	// 尝试多个可能的路径前缀
-	possiblePrefixes := []string{
-		filepath.Join("internal", "database", "migrations"),
-		filepath.Join("backend", "internal", "database", "migrations"),
-		"./internal/database/migrations",
+// loadMigrations 加载目录中的迁移文件，按版本号排序
+func loadMigrations(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, fmt.Errorf("读取迁移目录失败: %w", err)
 	}
 
-	for _, migrationFile := range migrationFiles {
-		var data []byte
-		var err error
-		var found bool
+	byVersion := make(map[int64]*Migration)
+	downFiles := make(map[int64]string)
+	for _, entry := range entries {
+		if entry.IsDir() || path.Ext(entry.Name()) != ".sql" {
+			continue
+		}
+		matches := migrationFilePattern.FindStringSubmatch(entry.Name())
+		if matches == nil {
+			return nil, fmt.Errorf("迁移文件名格式错误: %s（应为 <版本号>_<名称>.up.sql 或 <版本号>_<名称>.down.sql）", entry.Name())
+		}
+		version, err := strconv.ParseInt(matches[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("迁移文件版本号错误: %s: %w", entry.Name(), err)
+		}
+		data, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("读取迁移文件失败: %s: %w", entry.Name(), err)
+		}
 
-		for _, prefix := range possiblePrefixes {
-			migrationPath := filepath.Join(prefix, migrationFile)
-			data, err = os.ReadFile(migrationPath)
-			if err == nil {
-				found = true
-				break
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: matches[2]}
+			byVersion[version] = migration
+		}
+		if migration.Name != matches[2] {
+			return nil, fmt.Errorf("迁移版本号重复: %s 与版本 %d 的其他文件名称不一致", entry.Name(), version)
+		}
+		if matches[3] == "down" {
+			if _, ok := downFiles[version]; ok {
+				return nil, fmt.Errorf("迁移版本号重复: %s", entry.Name())
 			}
+			downFiles[version] = entry.Name()
+			migration.DownSQL = string(data)
+			continue
 		}
+		if migration.Filename != "" {
+			return nil, fmt.Errorf("迁移版本号重复: %s 和 %s", migration.Filename, entry.Name())
+		}
+		migration.Filename = entry.Name()
+		migration.UpSQL = string(data)
+		migration.Checksum = fmt.Sprintf("%x", sha256.Sum256(data))
+	}
 
-		if !found {
-			return fmt.Errorf("读取迁移文件失败: %s", migrationFile)
+	migrations := make([]Migration, 0, len(byVersion))
+	for version, migration := range byVersion {
+		if migration.Filename == "" {
+			return nil, fmt.Errorf("回滚文件 %s 没有对应的迁移文件", downFiles[version])
 		}
+		migrations = append(migrations, *migration)
+	}
+	slices.SortFunc(migrations, func(a, b Migration) int {
+		return cmp.Compare(a.Version, b.Version)
+	})
+	return migrations, nil
+}
 
-		// 分割 SQL 语句（按分号分割，但需要处理触发器中的分号）
-		sqlStatements := splitSQLStatements(string(data))
+// Migrations 返回所有迁移（按版本号排序）
+func (m *Migrator) Migrations() []Migration {
+	return m.migrations
+}
 
-		// 执行每个 SQL 语句
-		for _, stmt := range sqlStatements {
-			stmt = strings.TrimSpace(stmt)
-			if stmt == "" {
+// Up 按版本号顺序执行所有未执行的迁移，返回本次执行的迁移
+// 执行期间持有 advisory lock，其他实例等待锁释放后发现没有需要执行的迁移
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	executed := make([]Migration, 0)
+	err := m.withLock(ctx, func(conn *sql.Conn, applied map[int64]appliedMigration) error {
+		for _, migration := range m.migrations {
+			if _, ok := applied[migration.Version]; ok {
 				continue
 			}
-
-			_, err := DB.Exec(stmt)
-			if err != nil {
-				return fmt.Errorf("执行迁移失败 (文件: %s): %w\nSQL: %s", migrationFile, err, stmt)
+			if err := m.apply(ctx, conn, migration, false); err != nil {
+				return err
 			}
+			executed = append(executed, migration)
 		}
+		return nil
+	})
+	return executed, err
+}
+
+// Down 按版本号从大到小回滚最近执行的 n 个迁移，返回本次回滚的迁移
+func (m *Migrator) Down(ctx context.Context, n int) ([]Migration, error) {
+	if n <= 0 {
+		return nil, fmt.Errorf("回滚数量必须大于 0")
 	}
 
-	return nil
+	rolledBack := make([]Migration, 0, n)
+	err := m.withLock(ctx, func(conn *sql.Conn, applied map[int64]appliedMigration) error {
+		versions := slices.Sorted(maps.Keys(applied))
+		slices.Reverse(versions)
+		for _, version := range versions[:min(n, len(versions))] {
+			migration, err := m.rollbackMigration(version)
+			if err != nil {
+				return err
+			}
+			if err := m.apply(ctx, conn, migration, true); err != nil {
+				return err
+			}
+			rolledBack = append(rolledBack, migration)
+		}
+		return nil
+	})
+	return rolledBack, err
 }
 
-// splitSQLStatements 分割 SQL 语句
-// 简单实现：按分号分割，但保留在 $$ 块内的分号
-func splitSQLStatements(sql string) []string {
-	var statements []string
-	var current strings.Builder
-	inDollarQuote := false
-	var dollarTag string
-
-	for i := 0; i < len(sql); i++ {
-		char := sql[i]
-
-		// 检测 $$ 开始
-		if i < len(sql)-1 && sql[i] == '$' && sql[i+1] == '$' {
-			// 提取 $tag$ 格式
-			if !inDollarQuote {
-				inDollarQuote = true
-				dollarTag = "$$"
-				i++ // 跳过第二个 $
-				current.WriteString("$$")
+// Goto 迁移到指定版本：回滚所有大于该版本的已执行迁移，再执行所有不大于该版本的未执行迁移
+// 版本为 0 时回滚所有迁移
+func (m *Migrator) Goto(ctx context.Context, version int64) (executed []Migration, rolledBack []Migration, err error) {
+	if version != 0 && !slices.ContainsFunc(m.migrations, func(migration Migration) bool { return migration.Version == version }) {
+		return nil, nil, fmt.Errorf("迁移版本 %d 不存在", version)
+	}
+
+	executed = make([]Migration, 0)
+	rolledBack = make([]Migration, 0)
+	err = m.withLock(ctx, func(conn *sql.Conn, applied map[int64]appliedMigration) error {
+		versions := slices.Sorted(maps.Keys(applied))
+		slices.Reverse(versions)
+		for _, v := range versions {
+			if v <= version {
 				continue
-			} else if dollarTag == "$$" {
-				inDollarQuote = false
-				dollarTag = ""
-				current.WriteString("$$")
-				i++ // 跳过第二个 $
+			}
+			migration, err := m.rollbackMigration(v)
+			if err != nil {
+				return err
+			}
+			if err := m.apply(ctx, conn, migration, true); err != nil {
+				return err
+			}
+			rolledBack = append(rolledBack, migration)
+		}
+
+		for _, migration := range m.migrations {
+			if _, ok := applied[migration.Version]; ok || migration.Version > version {
 				continue
 			}
+			if err := m.apply(ctx, conn, migration, false); err != nil {
+				return err
+			}
+			executed = append(executed, migration)
+		}
+		return nil
+	})
+	return executed, rolledBack, err
+}
+
+// Status 返回所有迁移的执行状态（包括数据库中已执行但没有对应文件的版本），按版本号排序
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	if err := m.ensureTable(ctx, m.db); err != nil {
+		return nil, err
+	}
+	applied, err := m.appliedVersions(ctx, m.db)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		status := MigrationStatus{Version: migration.Version, Name: migration.Name}
+		if record, ok := applied[migration.Version]; ok {
+			status.Applied = true
+			status.AppliedAt = record.AppliedAt
+			status.Modified = record.Checksum != migration.Checksum
+			delete(applied, migration.Version)
 		}
+		statuses = append(statuses, status)
+	}
+	for version, record := range applied {
+		statuses = append(statuses, MigrationStatus{
+			Version:   version,
+			Name:      record.Name,
+			Applied:   true,
+			AppliedAt: record.AppliedAt,
+			Missing:   true,
+		})
+	}
+	slices.SortFunc(statuses, func(a, b MigrationStatus) int {
+		return cmp.Compare(a.Version, b.Version)
+	})
+	return statuses, nil
+}
 
-		current.WriteByte(char)
+// rollbackMigration 返回回滚指定版本所需的迁移，没有迁移文件或回滚文件时返回错误
+func (m *Migrator) rollbackMigration(version int64) (Migration, error) {
+	for _, migration := range m.migrations {
+		if migration.Version != version {
+			continue
+		}
+		if strings.TrimSpace(migration.DownSQL) == "" {
+			return Migration{}, fmt.Errorf("迁移 %s 没有回滚文件，无法回滚", migration.Filename)
+		}
+		return migration, nil
+	}
+	return Migration{}, fmt.Errorf("迁移版本 %d 没有对应的迁移文件，无法回滚", version)
+}
+
+// withLock 获取一个专用连接并在该连接上持有 advisory lock（锁与会话绑定，后续操作都使用该连接），
+// 检查已执行的迁移文件没有被修改后执行 fn
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sql.Conn, applied map[int64]appliedMigration) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("获取数据库连接失败: %w", err)
+	}
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, migrationLockID); err != nil {
+		conn.Close()
+		return fmt.Errorf("获取迁移锁失败: %w", err)
+	}
+	defer m.unlock(conn)
 
-		// 如果不在 $$ 块内，遇到分号就分割
-		if !inDollarQuote && char == ';' {
-			stmt := current.String()
-			if strings.TrimSpace(stmt) != "" {
-				statements = append(statements, stmt)
+	if err := m.ensureTable(ctx, conn); err != nil {
+		return err
+	}
+	applied, err := m.appliedVersions(ctx, conn)
+	if err != nil {
+		return err
+	}
+	if err := m.verify(applied); err != nil {
+		return err
+	}
+	return fn(conn, applied)
+}
+
+// unlock 释放 advisory lock 并归还连接
+// 请求被取消时仍然释放锁；释放失败时关闭连接也会释放会话持有的锁
+func (m *Migrator) unlock(conn *sql.Conn) {
+	if _, err := conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, migrationLockID); err != nil {
+		log.Printf("释放迁移锁失败: %v", err)
+		conn.Raw(func(any) error { return driver.ErrBadConn })
+	}
+	conn.Close()
+}
+
+// querier 可执行 SQL 查询的对象（*sql.DB 或 *sql.Conn）
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+// ensureTable 确保 schema_migrations 表存在
+func (m *Migrator) ensureTable(ctx context.Context, db querier) error {
+	_, err := db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version BIGINT PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			checksum VARCHAR(64) NOT NULL,
+			applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("创建 schema_migrations 表失败: %w", err)
+	}
+	return nil
+}
+
+// appliedVersions 返回已执行的版本
+func (m *Migrator) appliedVersions(ctx context.Context, db querier) (map[int64]appliedMigration, error) {
+	rows, err := db.QueryContext(ctx, `SELECT version, name, checksum, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("查询已执行的迁移失败: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int64]appliedMigration)
+	for rows.Next() {
+		var version int64
+		var record appliedMigration
+		if err := rows.Scan(&version, &record.Name, &record.Checksum, &record.AppliedAt); err != nil {
+			return nil, fmt.Errorf("扫描已执行的迁移失败: %w", err)
+		}
+		applied[version] = record
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("遍历已执行的迁移失败: %w", err)
+	}
+
+	return applied, nil
+}
+
+// verify 检查已执行的迁移文件没有被修改
+// 数据库中有而文件中没有的版本（如回滚到旧版本的程序）只记录日志
+func (m *Migrator) verify(applied map[int64]appliedMigration) error {
+	known := make(map[int64]bool, len(m.migrations))
+	for _, migration := range m.migrations {
+		known[migration.Version] = true
+		record, ok := applied[migration.Version]
+		if ok && record.Checksum != migration.Checksum {
+			return fmt.Errorf("迁移文件 %s 在执行后被修改（校验和不一致），请新增迁移文件而不是修改已执行的文件", migration.Filename)
+		}
+	}
+	for version := range applied {
+		if !known[version] {
+			log.Printf("数据库中已执行的迁移版本 %d 没有对应的迁移文件", version)
+		}
+	}
+	return nil
+}
+
+// apply 在一个事务中执行（down 为 true 时回滚）迁移并更新 schema_migrations 表
+func (m *Migrator) apply(ctx context.Context, conn *sql.Conn, migration Migration, down bool) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("开启事务失败: %w", err)
+	}
+	defer tx.Rollback()
+
+	action, script := "执行", migration.UpSQL
+	if down {
+		action, script = "回滚", migration.DownSQL
+	}
+	for _, stmt := range splitSQLStatements(script) {
+		stmt = strings.TrimSpace(stmt)
+		if stmt == "" {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("%s迁移失败 (文件: %s): %w\nSQL: %s", action, migration.Filename, err, stmt)
+		}
+	}
+
+	if down {
+		_, err = tx.ExecContext(ctx, `DELETE FROM schema_migrations WHERE version = $1`, migration.Version)
+	} else {
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO schema_migrations (version, name, checksum)
+			VALUES ($1, $2, $3)
+		`, migration.Version, migration.Name, migration.Checksum)
+	}
+	if err != nil {
+		return fmt.Errorf("记录迁移版本失败 (文件: %s): %w", migration.Filename, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("提交事务失败 (文件: %s): %w", migration.Filename, err)
+	}
+	return nil
+}
+
+// CreateMigration 在 dir 目录中创建下一个版本的迁移文件和回滚文件，返回创建的文件路径
+// 名称中的空格和连字符转换为下划线，只允许小写字母、数字和下划线
+func CreateMigration(dir, name string) (string, string, error) {
+	name = strings.ToLower(strings.NewReplacer(" ", "_", "-", "_").Replace(strings.TrimSpace(name)))
+	if !migrationNamePattern.MatchString(name) {
+		return "", "", fmt.Errorf("迁移名称只能包含小写字母、数字和下划线: %s", name)
+	}
+
+	migrations, err := loadMigrations(os.DirFS(dir), ".")
+	if err != nil {
+		return "", "", err
+	}
+	version := int64(1)
+	if len(migrations) > 0 {
+		version = migrations[len(migrations)-1].Version + 1
+	}
+
+	base := fmt.Sprintf("%03d_%s", version, name)
+	upPath := filepath.Join(dir, base+".up.sql")
+	downPath := filepath.Join(dir, base+".down.sql")
+	files := map[string]string{
+		upPath:   "-- " + name + "\n",
+		downPath: "-- 回滚 " + name + "\n",
+	}
+	for filePath, content := range files {
+		// O_EXCL：不覆盖已有文件
+		f, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if err != nil {
+			return "", "", fmt.Errorf("创建迁移文件失败: %w", err)
+		}
+		_, err = f.WriteString(content)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return "", "", fmt.Errorf("写入迁移文件失败: %w", err)
+		}
+	}
+	return upPath, downPath, nil
+}
+
+// splitSQLStatements 按分号分割 SQL 语句（每条语句保留结尾的分号，只有注释的语句被跳过）
+// 字符串、带引号的标识符、注释和美元符号引用（$$ 或 $tag$，如函数体）中的分号不分割
+func splitSQLStatements(sql string) []string {
+	var statements []string
+	start := 0
+	hasCode := false // 当前语句中是否有注释以外的内容
+
+	for i := 0; i < len(sql); {
+		switch {
+		case sql[i] == '\'' || sql[i] == '"':
+			// 字符串或带引号的标识符（两个连续引号表示转义，相当于结束后立即开始新的引用）
+			hasCode = true
+			end := strings.IndexByte(sql[i+1:], sql[i])
+			if end < 0 {
+				i = len(sql)
+			} else {
+				i += end + 2
+			}
+		case strings.HasPrefix(sql[i:], "--"):
+			end := strings.IndexByte(sql[i:], '\n')
+			if end < 0 {
+				i = len(sql)
+			} else {
+				i += end + 1
+			}
+		case strings.HasPrefix(sql[i:], "/*"):
+			end := strings.Index(sql[i+2:], "*/")
+			if end < 0 {
+				i = len(sql)
+			} else {
+				i += end + 4
+			}
+		case sql[i] == '$' && dollarQuoteTag(sql, i) != "":
+			hasCode = true
+			tag := dollarQuoteTag(sql, i)
+			end := strings.Index(sql[i+len(tag):], tag)
+			if end < 0 {
+				i = len(sql)
+			} else {
+				i += len(tag) + end + len(tag)
+			}
+		case sql[i] == ';':
+			if hasCode {
+				statements = append(statements, sql[start:i+1])
 			}
-			current.Reset()
+			start = i + 1
+			hasCode = false
+			i++
+		default:
+			if !unicode.IsSpace(rune(sql[i])) {
+				hasCode = true
+			}
+			i++
 		}
 	}
 
 	// 添加最后一个语句
-	if current.Len() > 0 {
-		stmt := current.String()
-		if strings.TrimSpace(stmt) != "" {
-			statements = append(statements, stmt)
+	if hasCode {
+		statements = append(statements, sql[start:])
+	}
+	return statements
+}
+
+// dollarQuoteTag 返回从 i 开始的美元符号引用标签（如 $$、$fn$），不是引用开始时返回空字符串
+// 标签不能以数字开头（$1 是参数占位符），$ 前面是标识符字符时是标识符的一部分
+func dollarQuoteTag(sql string, i int) string {
+	if i > 0 && isIdentifierChar(sql[i-1]) {
+		return ""
+	}
+	for j := i + 1; j < len(sql); j++ {
+		switch {
+		case sql[j] == '$':
+			return sql[i : j+1]
+		case !isIdentifierChar(sql[j]) || (j == i+1 && sql[j] >= '0' && sql[j] <= '9'):
+			return ""
 		}
 	}
+	return ""
+}
 
-	return statements
+// isIdentifierChar 判断字符是否可以出现在标识符中（非 ASCII 字符按标识符处理）
+func isIdentifierChar(c byte) bool {
+	return c == '_' || c >= 0x80 ||
+		(c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
 }
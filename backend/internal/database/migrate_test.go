@@ -0,0 +1,139 @@
+package database
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	t.Run("内嵌的迁移文件", func(t *testing.T) {
+		migrations, err := loadMigrations(migrationsFS, "migrations")
+		assert.NoError(t, err)
+		assert.NotEmpty(t, migrations)
+		for i, migration := range migrations {
+			assert.Equal(t, int64(i+1), migration.Version, migration.Filename)
+			assert.Len(t, migration.Checksum, 64)
+			assert.NotEmpty(t, strings.TrimSpace(migration.DownSQL), migration.Filename)
+		}
+		assert.Equal(t, "create_tables", migrations[0].Name)
+		assert.Equal(t, "001_create_tables.up.sql", migrations[0].Filename)
+	})
+
+	t.Run("按版本号排序", func(t *testing.T) {
+		migrations, err := loadMigrations(fstest.MapFS{
+			"migrations/10_add_index.up.sql":       {Data: []byte("CREATE INDEX a ON t (a);")},
+			"migrations/002_add_column.up.sql":     {Data: []byte("ALTER TABLE t ADD COLUMN a INT;")},
+			"migrations/002_add_column.down.sql":   {Data: []byte("ALTER TABLE t DROP COLUMN a;")},
+			"migrations/001_create_table.up.sql":   {Data: []byte("CREATE TABLE t (id INT);")},
+			"migrations/001_create_table.down.sql": {Data: []byte("DROP TABLE t;")},
+			"migrations/README.md":                 {Data: []byte("忽略非 SQL 文件")},
+		}, "migrations")
+		assert.NoError(t, err)
+		versions := make([]int64, 0, len(migrations))
+		for _, migration := range migrations {
+			versions = append(versions, migration.Version)
+		}
+		assert.Equal(t, []int64{1, 2, 10}, versions)
+		assert.Equal(t, "add_index", migrations[2].Name)
+		assert.Equal(t, "ALTER TABLE t DROP COLUMN a;", migrations[1].DownSQL)
+		assert.Empty(t, migrations[2].DownSQL)
+	})
+
+	t.Run("版本号重复", func(t *testing.T) {
+		_, err := loadMigrations(fstest.MapFS{
+			"migrations/001_create_table.up.sql": {Data: []byte("")},
+			"migrations/1_create_other.up.sql":   {Data: []byte("")},
+		}, "migrations")
+		assert.ErrorContains(t, err, "迁移版本号重复")
+	})
+
+	t.Run("回滚文件没有对应的迁移文件", func(t *testing.T) {
+		_, err := loadMigrations(fstest.MapFS{
+			"migrations/001_create_table.down.sql": {Data: []byte("")},
+		}, "migrations")
+		assert.ErrorContains(t, err, "没有对应的迁移文件")
+	})
+
+	t.Run("文件名格式错误", func(t *testing.T) {
+		_, err := loadMigrations(fstest.MapFS{
+			"migrations/001_create_table.sql": {Data: []byte("")},
+		}, "migrations")
+		assert.ErrorContains(t, err, "迁移文件名格式错误")
+	})
+}
+
+func TestCreateMigration(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "007_create_table.up.sql"), []byte("CREATE TABLE t (id INT);"), 0o644))
+
+	upPath, downPath, err := CreateMigration(dir, "Add image-tags")
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "008_add_image_tags.up.sql"), upPath)
+	assert.Equal(t, filepath.Join(dir, "008_add_image_tags.down.sql"), downPath)
+
+	migrations, err := loadMigrations(os.DirFS(dir), ".")
+	assert.NoError(t, err)
+	assert.Len(t, migrations, 2)
+
+	_, _, err = CreateMigration(dir, "add;tags")
+	assert.ErrorContains(t, err, "迁移名称只能包含")
+}
+
+func TestSplitSQLStatements(t *testing.T) {
+	tests := []struct {
+		name string
+		sql  string
+		want []string
+	}{
+		{
+			name: "按分号分割",
+			sql:  "CREATE TABLE t (id INT);\nINSERT INTO t VALUES (1);\n",
+			want: []string{"CREATE TABLE t (id INT);", "INSERT INTO t VALUES (1);"},
+		},
+		{
+			name: "最后一条语句没有分号",
+			sql:  "SELECT 1; SELECT 2",
+			want: []string{"SELECT 1;", "SELECT 2"},
+		},
+		{
+			name: "$$ 函数体",
+			sql:  "CREATE FUNCTION f() RETURNS TRIGGER AS $$\nBEGIN\n    RETURN NEW;\nEND;\n$$ language 'plpgsql';\nSELECT 1;",
+			want: []string{"CREATE FUNCTION f() RETURNS TRIGGER AS $$\nBEGIN\n    RETURN NEW;\nEND;\n$$ language 'plpgsql';", "SELECT 1;"},
+		},
+		{
+			name: "带标签的美元符号引用",
+			sql:  "DO $fn$ BEGIN EXECUTE $q$SELECT 1;$q$; END $fn$; SELECT 2;",
+			want: []string{"DO $fn$ BEGIN EXECUTE $q$SELECT 1;$q$; END $fn$;", "SELECT 2;"},
+		},
+		{
+			name: "参数占位符不是美元符号引用",
+			sql:  "PREPARE p AS SELECT $1; SELECT 2;",
+			want: []string{"PREPARE p AS SELECT $1;", "SELECT 2;"},
+		},
+		{
+			name: "字符串和带引号的标识符",
+			sql:  "INSERT INTO \"a;b\" VALUES ('x;y', 'it''s;');\nSELECT 1;",
+			want: []string{"INSERT INTO \"a;b\" VALUES ('x;y', 'it''s;');", "SELECT 1;"},
+		},
+		{
+			name: "注释中的分号",
+			sql:  "-- 注释; 不分割\nSELECT 1; /* 块注释; */ SELECT 2;\n-- UPDATE t SET a = 1;\n",
+			want: []string{"-- 注释; 不分割\nSELECT 1;", "/* 块注释; */ SELECT 2;"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			statements := splitSQLStatements(tt.sql)
+			for i := range statements {
+				statements[i] = strings.TrimSpace(statements[i])
+			}
+			assert.Equal(t, tt.want, statements)
+		})
+	}
+}
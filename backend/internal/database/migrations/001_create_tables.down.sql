@@ -0,0 +1,6 @@
+-- 删除 images 和 workspaces 表（触发器随表一起删除）
+DROP TABLE IF EXISTS images;
+DROP TABLE IF EXISTS workspaces;
+
+-- 删除更新时间触发器函数
+DROP FUNCTION IF EXISTS update_updated_at_column();
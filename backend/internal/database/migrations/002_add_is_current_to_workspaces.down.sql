@@ -0,0 +1,2 @@
+-- 删除 workspaces 表的 is_current 字段（索引随字段一起删除）
+ALTER TABLE workspaces DROP COLUMN IF EXISTS is_current;
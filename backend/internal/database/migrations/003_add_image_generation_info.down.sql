@@ -0,0 +1,5 @@
+-- 删除图片生成信息字段（索引随字段一起删除）
+ALTER TABLE images DROP COLUMN IF EXISTS message_list;
+ALTER TABLE images DROP COLUMN IF EXISTS ref_images;
+ALTER TABLE images DROP COLUMN IF EXISTS prompt;
+ALTER TABLE images DROP COLUMN IF EXISTS source_type;
@@ -0,0 +1,2 @@
+-- 删除 generation_jobs 表
+DROP TABLE IF EXISTS generation_jobs;
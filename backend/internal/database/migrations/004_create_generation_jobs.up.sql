@@ -0,0 +1,26 @@
+-- 创建 generation_jobs 表（异步生成任务）
+CREATE TABLE IF NOT EXISTS generation_jobs (
+    id BIGSERIAL PRIMARY KEY,
+    workspace_id BIGINT NOT NULL REFERENCES workspaces(id) ON DELETE CASCADE,
+    model VARCHAR(255) NOT NULL,
+    -- 任务状态: queued | running | succeeded | failed | cancelled
+    status VARCHAR(20) NOT NULL DEFAULT 'queued',
+    request JSONB NOT NULL DEFAULT '{}'::jsonb,
+    result JSONB,
+    error TEXT NOT NULL DEFAULT '',
+    started_at TIMESTAMP,
+    finished_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- 创建索引
+CREATE INDEX IF NOT EXISTS idx_generation_jobs_workspace_id ON generation_jobs(workspace_id);
+CREATE INDEX IF NOT EXISTS idx_generation_jobs_status ON generation_jobs(status, id);
+
+-- 为 generation_jobs 表创建更新时间触发器
+DROP TRIGGER IF EXISTS update_generation_jobs_updated_at ON generation_jobs;
+CREATE TRIGGER update_generation_jobs_updated_at
+    BEFORE UPDATE ON generation_jobs
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
@@ -0,0 +1,3 @@
+-- 删除 conversation_turns 和 conversations 表
+DROP TABLE IF EXISTS conversation_turns;
+DROP TABLE IF EXISTS conversations;
@@ -0,0 +1,34 @@
+-- 创建 conversations 表（多轮对话会话）
+CREATE TABLE IF NOT EXISTS conversations (
+    id BIGSERIAL PRIMARY KEY,
+    workspace_id BIGINT NOT NULL REFERENCES workspaces(id) ON DELETE CASCADE,
+    title VARCHAR(255) NOT NULL DEFAULT '',
+    -- 会话使用的模型（继续对话未指定模型时沿用）
+    model VARCHAR(255) NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- 创建 conversation_turns 表（对话中的每一轮）
+CREATE TABLE IF NOT EXISTS conversation_turns (
+    id BIGSERIAL PRIMARY KEY,
+    conversation_id BIGINT NOT NULL REFERENCES conversations(id) ON DELETE CASCADE,
+    -- 轮次序号，从 0 开始
+    turn_index INTEGER NOT NULL,
+    -- 角色: user | model
+    role VARCHAR(20) NOT NULL,
+    -- 有序片段: [{type, text, path, mime_type, thought_signature}]，图片只保存 OSS 路径
+    parts JSONB NOT NULL DEFAULT '[]'::jsonb,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(conversation_id, turn_index)
+);
+
+-- 创建索引
+CREATE INDEX IF NOT EXISTS idx_conversations_workspace_id ON conversations(workspace_id, updated_at DESC);
+
+-- 为 conversations 表创建更新时间触发器
+DROP TRIGGER IF EXISTS update_conversations_updated_at ON conversations;
+CREATE TRIGGER update_conversations_updated_at
+    BEFORE UPDATE ON conversations
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
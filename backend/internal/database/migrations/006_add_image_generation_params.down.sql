@@ -0,0 +1,4 @@
+-- 删除图片生成参数字段
+ALTER TABLE images DROP COLUMN IF EXISTS candidate_index;
+ALTER TABLE images DROP COLUMN IF EXISTS generation_params;
+ALTER TABLE images DROP COLUMN IF EXISTS model;
@@ -0,0 +1,5 @@
+-- 添加图片生成参数字段（用于复现生成结果）
+ALTER TABLE images ADD COLUMN IF NOT EXISTS model VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE images ADD COLUMN IF NOT EXISTS generation_params JSONB NOT NULL DEFAULT '{}'::jsonb;
+-- 同一次生成返回多个候选结果时，记录图片所属的候选序号
+ALTER TABLE images ADD COLUMN IF NOT EXISTS candidate_index INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,5 @@
+-- 删除图片与审计记录的关联（索引随字段一起删除）
+ALTER TABLE images DROP COLUMN IF EXISTS generation_run_id;
+
+-- 删除 generation_runs 表
+DROP TABLE IF EXISTS generation_runs;
@@ -0,0 +1,35 @@
+-- 创建 generation_runs 表（每次模型调用的审计记录）
+-- 图片数据不内联，生成的图片通过 images.generation_run_id 关联
+CREATE TABLE IF NOT EXISTS generation_runs (
+    id BIGSERIAL PRIMARY KEY,
+    workspace_id BIGINT NOT NULL REFERENCES workspaces(id) ON DELETE CASCADE,
+    model VARCHAR(255) NOT NULL,
+    -- 调用状态: succeeded | failed
+    status VARCHAR(20) NOT NULL,
+    -- 实际发送的生成配置
+    config JSONB NOT NULL DEFAULT '{}'::jsonb,
+    prompt TEXT NOT NULL DEFAULT '',
+    ref_images JSONB NOT NULL DEFAULT '[]'::jsonb,
+    history_turns INTEGER NOT NULL DEFAULT 0,
+    -- 响应摘要：各候选结果的文本和图片占位（不含图片数据）
+    response JSONB NOT NULL DEFAULT '[]'::jsonb,
+    finish_reasons JSONB NOT NULL DEFAULT '[]'::jsonb,
+    safety_ratings JSONB NOT NULL DEFAULT '[]'::jsonb,
+    prompt_feedback JSONB,
+    grounding_metadata JSONB NOT NULL DEFAULT '[]'::jsonb,
+    model_version VARCHAR(255) NOT NULL DEFAULT '',
+    prompt_tokens INTEGER NOT NULL DEFAULT 0,
+    candidates_tokens INTEGER NOT NULL DEFAULT 0,
+    thoughts_tokens INTEGER NOT NULL DEFAULT 0,
+    total_tokens INTEGER NOT NULL DEFAULT 0,
+    latency_ms INTEGER NOT NULL DEFAULT 0,
+    error TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- 创建索引
+CREATE INDEX IF NOT EXISTS idx_generation_runs_workspace_id ON generation_runs(workspace_id, created_at);
+
+-- 关联生成的图片与审计记录
+ALTER TABLE images ADD COLUMN IF NOT EXISTS generation_run_id BIGINT REFERENCES generation_runs(id) ON DELETE SET NULL;
+CREATE INDEX IF NOT EXISTS idx_images_generation_run_id ON images(generation_run_id);
@@ -0,0 +1,3 @@
+-- 删除模型调用的图片数量和估算成本字段
+ALTER TABLE generation_runs DROP COLUMN IF EXISTS cost;
+ALTER TABLE generation_runs DROP COLUMN IF EXISTS image_count;
@@ -0,0 +1,3 @@
+-- 记录每次模型调用生成的图片数量和估算成本（按调用时的价格表计算，价格调整不影响历史记录）
+ALTER TABLE generation_runs ADD COLUMN IF NOT EXISTS image_count INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE generation_runs ADD COLUMN IF NOT EXISTS cost NUMERIC(14, 6) NOT NULL DEFAULT 0;
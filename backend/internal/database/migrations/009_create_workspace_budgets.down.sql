@@ -0,0 +1,2 @@
+-- 删除 workspace_budgets 表
+DROP TABLE IF EXISTS workspace_budgets;
@@ -0,0 +1,23 @@
+-- 创建 workspace_budgets 表（工作区的用量预算）
+CREATE TABLE IF NOT EXISTS workspace_budgets (
+    id BIGSERIAL PRIMARY KEY,
+    workspace_id BIGINT NOT NULL REFERENCES workspaces(id) ON DELETE CASCADE,
+    -- 统计周期: daily | monthly（按自然日、自然月计算）
+    period VARCHAR(20) NOT NULL,
+    -- 限制的指标: runs（成功生成次数）| tokens（总 token 数）| cost（估算成本，美元）
+    metric VARCHAR(20) NOT NULL,
+    -- 硬限制：周期内用量达到该值后拒绝生成
+    limit_value NUMERIC(18, 6) NOT NULL,
+    -- 软限制比例：用量达到 limit_value * warn_ratio 时在生成结果中返回提醒
+    warn_ratio NUMERIC(5, 4) NOT NULL DEFAULT 0.8,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(workspace_id, period, metric)
+);
+
+-- 为 workspace_budgets 表创建更新时间触发器
+DROP TRIGGER IF EXISTS update_workspace_budgets_updated_at ON workspace_budgets;
+CREATE TRIGGER update_workspace_budgets_updated_at
+    BEFORE UPDATE ON workspace_budgets
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
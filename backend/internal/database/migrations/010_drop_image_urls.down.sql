@@ -0,0 +1,3 @@
+-- 恢复图片访问 URL 字段（已有记录的 URL 为空，读取时仍根据路径生成）
+ALTER TABLE images ADD COLUMN IF NOT EXISTS oss_url VARCHAR(512) NOT NULL DEFAULT '';
+ALTER TABLE images ADD COLUMN IF NOT EXISTS thumbnail_url VARCHAR(512) NOT NULL DEFAULT '';
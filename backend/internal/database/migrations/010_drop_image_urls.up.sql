@@ -0,0 +1,3 @@
+-- 图片访问 URL 改为读取时根据路径生成（支持私有存储桶的签名 URL），数据库只保存对象路径
+ALTER TABLE images DROP COLUMN IF EXISTS oss_url;
+ALTER TABLE images DROP COLUMN IF EXISTS thumbnail_url;
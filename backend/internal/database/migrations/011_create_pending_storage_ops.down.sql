@@ -0,0 +1,2 @@
+-- 删除 pending_storage_ops 表（未执行的存储操作会丢失，残留文件由一致性巡检清理）
+DROP TABLE IF EXISTS pending_storage_ops;
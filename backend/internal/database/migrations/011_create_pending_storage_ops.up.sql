@@ -0,0 +1,25 @@
+-- 创建 pending_storage_ops 表（待执行的存储操作，由后台任务重试直到成功）
+-- 与 images 表的修改在同一事务中写入，保证删除记录后存储中的文件最终会被删除
+CREATE TABLE IF NOT EXISTS pending_storage_ops (
+    id BIGSERIAL PRIMARY KEY,
+    -- 操作类型: delete
+    op VARCHAR(20) NOT NULL DEFAULT 'delete',
+    object_key TEXT NOT NULL,
+    -- 状态: pending（等待执行或重试）| failed（超过最大重试次数，需要人工处理）
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    attempts INT NOT NULL DEFAULT 0,
+    last_error TEXT NOT NULL DEFAULT '',
+    next_attempt_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- 创建索引
+CREATE INDEX IF NOT EXISTS idx_pending_storage_ops_status ON pending_storage_ops(status, next_attempt_at);
+
+-- 为 pending_storage_ops 表创建更新时间触发器
+DROP TRIGGER IF EXISTS update_pending_storage_ops_updated_at ON pending_storage_ops;
+CREATE TRIGGER update_pending_storage_ops_updated_at
+    BEFORE UPDATE ON pending_storage_ops
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
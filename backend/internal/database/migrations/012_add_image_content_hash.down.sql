@@ -0,0 +1,3 @@
+-- 删除图片内容哈希（内容哈希索引随字段一起删除）
+DROP INDEX IF EXISTS idx_images_thumbnail_path;
+ALTER TABLE images DROP COLUMN IF EXISTS content_hash;
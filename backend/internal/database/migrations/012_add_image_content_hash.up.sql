@@ -0,0 +1,7 @@
+-- 为 images 表添加内容哈希（SHA-256，十六进制），用于上传时去重
+-- 内容相同的图片记录共享同一个存储对象，删除记录时只有最后一个引用被删除后才删除文件
+ALTER TABLE images ADD COLUMN IF NOT EXISTS content_hash VARCHAR(64) NOT NULL DEFAULT '';
+
+-- 创建索引
+CREATE INDEX IF NOT EXISTS idx_images_content_hash ON images(workspace_id, content_hash);
+CREATE INDEX IF NOT EXISTS idx_images_thumbnail_path ON images(thumbnail_path);
@@ -0,0 +1,4 @@
+-- 删除图片列表分页的复合索引
+DROP INDEX IF EXISTS idx_images_workspace_size;
+DROP INDEX IF EXISTS idx_images_workspace_updated;
+DROP INDEX IF EXISTS idx_images_workspace_created;
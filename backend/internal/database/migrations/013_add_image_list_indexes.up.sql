@@ -0,0 +1,5 @@
+-- 图片列表按 (排序字段, id) 游标分页的复合索引（同一索引支持正序和倒序）
+-- 按文件名排序使用 UNIQUE(workspace_id, name) 约束的索引
+CREATE INDEX IF NOT EXISTS idx_images_workspace_created ON images(workspace_id, created_at, id);
+CREATE INDEX IF NOT EXISTS idx_images_workspace_updated ON images(workspace_id, updated_at, id);
+CREATE INDEX IF NOT EXISTS idx_images_workspace_size ON images(workspace_id, size, id);
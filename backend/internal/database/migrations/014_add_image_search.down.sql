@@ -0,0 +1,7 @@
+-- 删除图片全文搜索
+DROP INDEX IF EXISTS idx_images_search_vector;
+DROP TRIGGER IF EXISTS update_images_search_vector ON images;
+DROP FUNCTION IF EXISTS update_image_search_vector();
+ALTER TABLE images DROP COLUMN IF EXISTS search_vector;
+DROP FUNCTION IF EXISTS image_search_vector(TEXT, TEXT, JSONB);
+DROP FUNCTION IF EXISTS image_search_tokens(TEXT);
@@ -0,0 +1,96 @@
+-- 图片全文搜索：按文件名、提示词和对话文本建立 tsvector 索引
+-- PostgreSQL 自带的分词器不能切分中文，这里在入库前把文本转换为以空格分隔的词元，再用 simple 配置建立索引：
+--   中日韩字符逐字切分，并额外生成相邻两字的组合（二元组），查询时按二元组匹配
+--   其他字母和数字按连续的字母数字切分，转为小写
+--   标点符号和空白作为分隔符
+-- 查询时服务端按相同规则切分查询词（见 service/image/search.go），两处规则需要保持一致
+CREATE OR REPLACE FUNCTION image_search_tokens(input TEXT)
+RETURNS TEXT AS $$
+DECLARE
+    ch TEXT;
+    cp INTEGER;
+    word TEXT := '';
+    prev TEXT := '';
+    tokens TEXT[] := '{}';
+BEGIN
+    FOREACH ch IN ARRAY string_to_array(lower(coalesce(input, '')), NULL) LOOP
+        cp := ascii(ch);
+        IF cp BETWEEN 12352 AND 12543      -- 平假名、片假名 U+3040–U+30FF
+            OR cp BETWEEN 13312 AND 19903  -- CJK 扩展 A U+3400–U+4DBF
+            OR cp BETWEEN 19968 AND 40959  -- CJK 统一汉字 U+4E00–U+9FFF
+            OR cp BETWEEN 44032 AND 55215  -- 韩文音节 U+AC00–U+D7AF
+            OR cp BETWEEN 63744 AND 64255  -- CJK 兼容汉字 U+F900–U+FAFF
+            OR cp BETWEEN 131072 AND 196607 -- CJK 扩展 B 及之后 U+20000–U+2FFFF
+        THEN
+            IF word <> '' THEN
+                tokens := tokens || word;
+                word := '';
+            END IF;
+            tokens := tokens || ch;
+            IF prev <> '' THEN
+                tokens := tokens || (prev || ch);
+            END IF;
+            prev := ch;
+        ELSIF (cp < 128 AND ch !~ '[0-9a-z]')
+            OR cp BETWEEN 128 AND 191      -- Latin-1 控制字符和符号 U+0080–U+00BF
+            OR cp BETWEEN 8192 AND 8303    -- 通用标点 U+2000–U+206F
+            OR cp BETWEEN 12288 AND 12351  -- CJK 符号和标点 U+3000–U+303F
+            OR cp BETWEEN 65280 AND 65295  -- 全角标点 U+FF00–U+FF0F
+            OR cp BETWEEN 65306 AND 65312  -- U+FF1A–U+FF20
+            OR cp BETWEEN 65339 AND 65344  -- U+FF3B–U+FF40
+            OR cp BETWEEN 65371 AND 65381  -- U+FF5B–U+FF65
+        THEN
+            IF word <> '' THEN
+                tokens := tokens || word;
+                word := '';
+            END IF;
+            prev := '';
+        ELSE
+            word := word || ch;
+            prev := '';
+        END IF;
+    END LOOP;
+    IF word <> '' THEN
+        tokens := tokens || word;
+    END IF;
+    RETURN array_to_string(tokens, ' ');
+END;
+$$ LANGUAGE plpgsql IMMUTABLE;
+
+-- 计算图片的搜索向量：文件名权重 A，提示词权重 B，对话中的文本消息权重 C
+CREATE OR REPLACE FUNCTION image_search_vector(image_name TEXT, image_prompt TEXT, messages JSONB)
+RETURNS tsvector AS $$
+    SELECT setweight(to_tsvector('simple', image_search_tokens(image_name)), 'A')
+        || setweight(to_tsvector('simple', image_search_tokens(image_prompt)), 'B')
+        || setweight(to_tsvector('simple', image_search_tokens((
+            SELECT string_agg(message->>'content', ' ')
+            FROM jsonb_array_elements(
+                CASE WHEN jsonb_typeof(messages) = 'array' THEN messages ELSE '[]'::jsonb END
+            ) AS message
+            WHERE message->>'type' = 'text'
+        ))), 'C');
+$$ LANGUAGE sql IMMUTABLE;
+
+ALTER TABLE images ADD COLUMN IF NOT EXISTS search_vector tsvector NOT NULL DEFAULT ''::tsvector;
+
+-- 插入或修改文件名、提示词、对话时更新搜索向量
+CREATE OR REPLACE FUNCTION update_image_search_vector()
+RETURNS TRIGGER AS $$
+BEGIN
+    NEW.search_vector = image_search_vector(NEW.name, NEW.prompt, NEW.message_list);
+    RETURN NEW;
+END;
+$$ language 'plpgsql';
+
+DROP TRIGGER IF EXISTS update_images_search_vector ON images;
+CREATE TRIGGER update_images_search_vector
+    BEFORE INSERT OR UPDATE OF name, prompt, message_list ON images
+    FOR EACH ROW
+    EXECUTE FUNCTION update_image_search_vector();
+
+-- 为已有图片填充搜索向量（临时禁用更新时间触发器，避免修改 updated_at）
+ALTER TABLE images DISABLE TRIGGER update_images_updated_at;
+UPDATE images SET search_vector = image_search_vector(name, prompt, message_list);
+ALTER TABLE images ENABLE TRIGGER update_images_updated_at;
+
+CREATE INDEX IF NOT EXISTS idx_images_search_vector ON images USING GIN (search_vector);
@@ -0,0 +1,3 @@
+-- 删除标签相关表
+DROP TABLE IF EXISTS image_tags;
+DROP TABLE IF EXISTS tags;
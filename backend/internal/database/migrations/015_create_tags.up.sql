@@ -0,0 +1,19 @@
+-- 创建 tags 表（标签按工作区隔离，同一工作区内名称唯一）
+CREATE TABLE IF NOT EXISTS tags (
+    id BIGSERIAL PRIMARY KEY,
+    workspace_id BIGINT NOT NULL REFERENCES workspaces(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(workspace_id, name)
+);
+
+-- 创建 image_tags 表（图片与标签的多对多关系，删除图片或标签时级联删除）
+CREATE TABLE IF NOT EXISTS image_tags (
+    image_id BIGINT NOT NULL REFERENCES images(id) ON DELETE CASCADE,
+    tag_id BIGINT NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (image_id, tag_id)
+);
+
+-- 按标签查询图片（主键索引支持按图片查询标签）
+CREATE INDEX IF NOT EXISTS idx_image_tags_tag_id ON image_tags(tag_id);
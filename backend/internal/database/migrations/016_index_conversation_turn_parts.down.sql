@@ -0,0 +1,2 @@
+-- 删除对话轮次片段的 GIN 索引
+DROP INDEX IF EXISTS idx_conversation_turns_parts;
@@ -0,0 +1,2 @@
+-- 对话轮次片段的 GIN 索引，用于判断图片路径是否仍被对话历史引用（parts @> '[{"path": ...}]'）
+CREATE INDEX IF NOT EXISTS idx_conversation_turns_parts ON conversation_turns USING GIN (parts jsonb_path_ops);
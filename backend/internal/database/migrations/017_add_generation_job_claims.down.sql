@@ -0,0 +1,3 @@
+-- 删除任务领取信息
+ALTER TABLE generation_jobs DROP COLUMN IF EXISTS heartbeat_at;
+ALTER TABLE generation_jobs DROP COLUMN IF EXISTS claimed_by;
@@ -0,0 +1,4 @@
+-- 记录运行中任务由哪个服务实例领取及最近一次心跳时间
+-- 多个实例同时调度时，只有心跳超时的运行中任务才会被重新排队
+ALTER TABLE generation_jobs ADD COLUMN IF NOT EXISTS claimed_by VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE generation_jobs ADD COLUMN IF NOT EXISTS heartbeat_at TIMESTAMP;
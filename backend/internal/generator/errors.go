@@ -0,0 +1,11 @@
+package generator
+
+import "errors"
+
+// 上游调用错误，各供应商实现将自身的错误包装为以下错误，便于上层统一处理
+var (
+	// ErrQuotaExceeded 模型供应商的配额或速率限制已用尽
+	ErrQuotaExceeded = errors.New("模型配额已用尽")
+	// ErrUpstreamUnavailable 模型服务暂时不可用
+	ErrUpstreamUnavailable = errors.New("模型服务暂时不可用")
+)
@@ -0,0 +1,179 @@
+package generator
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"hash/fnv"
+	"image"
+	"image/color"
+	"image/png"
+	"sync"
+)
+
+// FakeGenerator 确定性的图片生成器，用于离线开发和测试
+// 未设置 Parts 时，根据提示词生成一段文本和一张纯色 PNG 图片，相同输入总是得到相同输出
+// 请求多个候选结果时，每个候选结果使用不同的颜色（设置了 Parts 时各候选结果相同）
+type FakeGenerator struct {
+	Parts []Part // 固定返回的片段（可选）
+	Err   error  // 固定返回的错误（可选）
+	// 前 len(Failures) 次调用依次返回的错误（可选，用于模拟上游的临时故障），nil 表示该次调用正常返回
+	Failures []error
+
+	// 以下字段用于模拟模型拒绝生成的情况
+	PromptFeedback *PromptFeedback // 固定返回的输入反馈（可选，设置了拦截原因时不返回候选结果）
+	FinishReason   string          // 候选结果的结束原因（可选，默认 "STOP"）
+	SafetyRatings  []SafetyRating  // 候选结果的安全评级（可选）
+
+	mu       sync.Mutex
+	requests []*Request
+}
+
+// NewFakeGenerator 创建确定性图片生成器实例
+func NewFakeGenerator() *FakeGenerator {
+	return &FakeGenerator{}
+}
+
+// Generate 返回确定性的生成结果
+func (g *FakeGenerator) Generate(ctx context.Context, req *Request) (*Response, error) {
+	g.mu.Lock()
+	g.requests = append(g.requests, req)
+	var failure error
+	if len(g.Failures) > 0 {
+		failure = g.Failures[0]
+		g.Failures = g.Failures[1:]
+	}
+	g.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if failure != nil {
+		return nil, failure
+	}
+	if g.Err != nil {
+		return nil, g.Err
+	}
+
+	if g.PromptFeedback != nil && g.PromptFeedback.BlockReason != "" {
+		return &Response{PromptFeedback: g.PromptFeedback}, nil
+	}
+
+	count := req.Options.CandidateCount
+	if count <= 0 {
+		count = 1
+	}
+	finishReason := g.FinishReason
+	if finishReason == "" {
+		finishReason = "STOP"
+	}
+
+	resp := &Response{
+		Candidates:     make([]Candidate, 0, count),
+		PromptFeedback: g.PromptFeedback,
+	}
+	for i := 0; i < count; i++ {
+		if g.Parts != nil {
+			parts := make([]Part, len(g.Parts))
+			copy(parts, g.Parts)
+			resp.Candidates = append(resp.Candidates, Candidate{Index: i, Parts: parts, FinishReason: finishReason, SafetyRatings: g.SafetyRatings})
+			continue
+		}
+
+		seed := req.Prompt
+		if i > 0 {
+			seed = fmt.Sprintf("%s#%d", req.Prompt, i)
+		}
+		data, err := fakeImage(seed)
+		if err != nil {
+			return nil, err
+		}
+
+		resp.Candidates = append(resp.Candidates, Candidate{
+			Index:         i,
+			FinishReason:  finishReason,
+			SafetyRatings: g.SafetyRatings,
+			Parts: []Part{
+				{
+					Type: PartTypeText,
+					Text: fmt.Sprintf("fake: %s (%d 张参考图片)", req.Prompt, len(req.Images)),
+				},
+				{
+					Type:     PartTypeImage,
+					Data:     data,
+					MimeType: "image/png",
+				},
+			},
+		})
+	}
+
+	// 用量按字符数粗略估算，保证相同输入得到相同结果
+	promptTokens := len([]rune(req.Prompt))
+	candidatesTokens := 0
+	for _, c := range resp.Candidates {
+		for _, part := range c.Parts {
+			candidatesTokens += len([]rune(part.Text)) + len(part.Data)/1024
+		}
+	}
+	resp.Usage = &Usage{
+		PromptTokens:     promptTokens,
+		CandidatesTokens: candidatesTokens,
+		TotalTokens:      promptTokens + candidatesTokens,
+	}
+	return resp, nil
+}
+
+// GenerateStream 按顺序逐个回调确定性的生成结果
+func (g *FakeGenerator) GenerateStream(ctx context.Context, req *Request, onPart PartHandler) (*Response, error) {
+	resp, err := g.Generate(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Response{Usage: resp.Usage, PromptFeedback: resp.PromptFeedback}
+	for _, candidate := range resp.Candidates {
+		c := result.Candidate(candidate.Index)
+		c.FinishReason = candidate.FinishReason
+		c.SafetyRatings = candidate.SafetyRatings
+		for _, part := range candidate.Parts {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			if err := onPart(candidate.Index, part); err != nil {
+				return nil, err
+			}
+			result.AppendPart(candidate.Index, part)
+		}
+	}
+	return result, nil
+}
+
+// Requests 返回已收到的请求（按调用顺序）
+func (g *FakeGenerator) Requests() []*Request {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	requests := make([]*Request, len(g.requests))
+	copy(requests, g.requests)
+	return requests
+}
+
+// fakeImage 根据文本生成一张 64x64 的纯色 PNG 图片
+func fakeImage(seed string) ([]byte, error) {
+	h := fnv.New32a()
+	h.Write([]byte(seed))
+	sum := h.Sum32()
+	c := color.RGBA{R: uint8(sum >> 16), G: uint8(sum >> 8), B: uint8(sum), A: 255}
+
+	img := image.NewRGBA(image.Rect(0, 0, 64, 64))
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 64; x++ {
+			img.Set(x, y, c)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, fmt.Errorf("编码图片失败: %w", err)
+	}
+	return buf.Bytes(), nil
+}
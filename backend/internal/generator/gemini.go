@@ -0,0 +1,245 @@
+package generator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"google.golang.org/genai"
+)
+
+const (
+	DefaultGeminiModel = "gemini-3-pro-image-preview"
+)
+
+// GeminiGenerator 基于 Google GenAI SDK 的图片生成器
+type GeminiGenerator struct {
+	client *genai.Client
+}
+
+// NewGeminiGenerator 创建 Gemini 图片生成器实例
+func NewGeminiGenerator(client *genai.Client) *GeminiGenerator {
+	return &GeminiGenerator{
+		client: client,
+	}
+}
+
+// Generate 调用 Gemini 模型生成内容
+func (g *GeminiGenerator) Generate(ctx context.Context, req *Request) (*Response, error) {
+	modelName := req.Options.Model
+	if modelName == "" {
+		modelName = DefaultGeminiModel
+	}
+
+	resp, err := g.client.Models.GenerateContent(ctx, modelName, g.buildContents(req), g.buildConfig(req))
+	if err != nil {
+		return nil, fmt.Errorf("调用 Gemini API 失败: %w", classifyError(err))
+	}
+
+	result := &Response{}
+	for _, candidate := range resp.Candidates {
+		c := result.Candidate(int(candidate.Index))
+		c.Parts = append(c.Parts, g.convertParts(candidate)...)
+	}
+	g.mergeMetadata(result, resp)
+	return result, nil
+}
+
+// GenerateStream 调用 Gemini 流式接口生成内容
+// ctx 取消（如客户端断开连接）时上游调用随之取消
+func (g *GeminiGenerator) GenerateStream(ctx context.Context, req *Request, onPart PartHandler) (*Response, error) {
+	modelName := req.Options.Model
+	if modelName == "" {
+		modelName = DefaultGeminiModel
+	}
+
+	result := &Response{}
+	for resp, err := range g.client.Models.GenerateContentStream(ctx, modelName, g.buildContents(req), g.buildConfig(req)) {
+		if err != nil {
+			return nil, fmt.Errorf("调用 Gemini API 失败: %w", classifyError(err))
+		}
+		for _, candidate := range resp.Candidates {
+			index := int(candidate.Index)
+			for _, part := range g.convertParts(candidate) {
+				if err := onPart(index, part); err != nil {
+					return nil, err
+				}
+				result.AppendPart(index, part)
+			}
+		}
+		g.mergeMetadata(result, resp)
+	}
+
+	return result, nil
+}
+
+// classifyError 将 Gemini API 的错误包装为 ErrQuotaExceeded 或 ErrUpstreamUnavailable
+// 无法识别的错误原样返回
+func classifyError(err error) error {
+	var apiErr genai.APIError
+	if !errors.As(err, &apiErr) {
+		return err
+	}
+	switch {
+	case apiErr.Code == http.StatusTooManyRequests || apiErr.Status == "RESOURCE_EXHAUSTED":
+		return fmt.Errorf("%w: %w", ErrQuotaExceeded, err)
+	case apiErr.Code >= http.StatusInternalServerError || apiErr.Status == "UNAVAILABLE":
+		return fmt.Errorf("%w: %w", ErrUpstreamUnavailable, err)
+	}
+	return err
+}
+
+// convertParts 将候选结果的内容转换为有序片段（跳过思考过程）
+func (g *GeminiGenerator) convertParts(candidate *genai.Candidate) []Part {
+	parts := make([]Part, 0)
+	if candidate.Content == nil {
+		return parts
+	}
+
+	for _, part := range candidate.Content.Parts {
+		if part.Thought {
+			continue
+		}
+		if part.Text != "" {
+			parts = append(parts, Part{
+				Type:             PartTypeText,
+				Text:             part.Text,
+				ThoughtSignature: part.ThoughtSignature,
+			})
+		}
+		if part.InlineData != nil {
+			parts = append(parts, Part{
+				Type:             PartTypeImage,
+				Data:             part.InlineData.Data,
+				MimeType:         part.InlineData.MIMEType,
+				ThoughtSignature: part.ThoughtSignature,
+			})
+		}
+	}
+	return parts
+}
+
+// mergeMetadata 合并响应中的元数据（结束原因、安全评级、引用信息、用量等）
+// 流式响应中元数据分散在各个分片里，后到的非空值覆盖先到的值
+func (g *GeminiGenerator) mergeMetadata(result *Response, resp *genai.GenerateContentResponse) {
+	for _, candidate := range resp.Candidates {
+		c := result.Candidate(int(candidate.Index))
+		if candidate.FinishReason != "" {
+			c.FinishReason = string(candidate.FinishReason)
+			c.FinishMessage = candidate.FinishMessage
+		}
+		if len(candidate.SafetyRatings) > 0 {
+			c.SafetyRatings = convertSafetyRatings(candidate.SafetyRatings)
+		}
+		if candidate.GroundingMetadata != nil {
+			if data, err := json.Marshal(candidate.GroundingMetadata); err == nil {
+				c.GroundingMetadata = data
+			}
+		}
+	}
+
+	if resp.PromptFeedback != nil {
+		result.PromptFeedback = &PromptFeedback{
+			BlockReason:        string(resp.PromptFeedback.BlockReason),
+			BlockReasonMessage: resp.PromptFeedback.BlockReasonMessage,
+			SafetyRatings:      convertSafetyRatings(resp.PromptFeedback.SafetyRatings),
+		}
+	}
+	if resp.UsageMetadata != nil {
+		result.Usage = &Usage{
+			PromptTokens:     int(resp.UsageMetadata.PromptTokenCount),
+			CandidatesTokens: int(resp.UsageMetadata.CandidatesTokenCount),
+			ThoughtsTokens:   int(resp.UsageMetadata.ThoughtsTokenCount),
+			TotalTokens:      int(resp.UsageMetadata.TotalTokenCount),
+		}
+	}
+	if resp.ModelVersion != "" {
+		result.ModelVersion = resp.ModelVersion
+	}
+}
+
+// convertSafetyRatings 转换安全评级
+func convertSafetyRatings(ratings []*genai.SafetyRating) []SafetyRating {
+	result := make([]SafetyRating, 0, len(ratings))
+	for _, rating := range ratings {
+		result = append(result, SafetyRating{
+			Category:    string(rating.Category),
+			Probability: string(rating.Probability),
+			Blocked:     rating.Blocked,
+		})
+	}
+	return result
+}
+
+// buildContents 构建请求内容
+// 对话历史按 user/model 角色逐轮回放，最后追加本轮的提示词和参考图片
+func (g *GeminiGenerator) buildContents(req *Request) []*genai.Content {
+	contents := make([]*genai.Content, 0, len(req.History)+1)
+	for _, turn := range req.History {
+		role := genai.Role(genai.RoleUser)
+		if turn.Role == RoleModel {
+			role = genai.RoleModel
+		}
+
+		parts := make([]*genai.Part, 0, len(turn.Parts))
+		for _, part := range turn.Parts {
+			var p *genai.Part
+			switch part.Type {
+			case PartTypeText:
+				p = genai.NewPartFromText(part.Text)
+			case PartTypeImage:
+				p = genai.NewPartFromBytes(part.Data, part.MimeType)
+			default:
+				continue
+			}
+			p.ThoughtSignature = part.ThoughtSignature
+			parts = append(parts, p)
+		}
+		if len(parts) > 0 {
+			contents = append(contents, genai.NewContentFromParts(parts, role))
+		}
+	}
+
+	parts := []*genai.Part{genai.NewPartFromText(req.Prompt)}
+	for _, img := range req.Images {
+		parts = append(parts, genai.NewPartFromBytes(img.Data, img.MimeType))
+	}
+	return append(contents, genai.NewContentFromParts(parts, genai.RoleUser))
+}
+
+// buildConfig 构建生成配置
+// 未设置的选项不写入配置，使用模型默认值；没有任何选项时返回 nil
+func (g *GeminiGenerator) buildConfig(req *Request) *genai.GenerateContentConfig {
+	opts := req.Options
+	config := &genai.GenerateContentConfig{
+		Temperature:        opts.Temperature,
+		Seed:               opts.Seed,
+		CandidateCount:     int32(opts.CandidateCount),
+		ResponseModalities: opts.ResponseModalities,
+	}
+	empty := opts.Temperature == nil && opts.Seed == nil && opts.CandidateCount == 0 && len(opts.ResponseModalities) == 0
+
+	if opts.AspectRatio != "" || opts.ImageSize != "" {
+		config.ImageConfig = &genai.ImageConfig{
+			AspectRatio: opts.AspectRatio,
+			ImageSize:   opts.ImageSize,
+		}
+		empty = false
+	}
+
+	if opts.EnableWebSearch {
+		config.Tools = []*genai.Tool{
+			{
+				GoogleSearch: &genai.GoogleSearch{},
+			},
+		}
+		empty = false
+	}
+
+	if empty {
+		return nil
+	}
+	return config
+}
@@ -0,0 +1,167 @@
+package generator
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// PartType 生成内容片段类型
+type PartType string
+
+const (
+	PartTypeText  PartType = "text"
+	PartTypeImage PartType = "image"
+)
+
+// Role 对话角色
+type Role string
+
+const (
+	RoleUser  Role = "user"
+	RoleModel Role = "model"
+)
+
+// ReferenceImage 参考图片（二进制数据）
+type ReferenceImage struct {
+	Data     []byte // 图片数据
+	MimeType string // 图片 MIME 类型
+}
+
+// 响应模态
+const (
+	ModalityText  = "TEXT"
+	ModalityImage = "IMAGE"
+)
+
+// Options 生成选项
+// 零值字段表示使用模型的默认配置
+type Options struct {
+	Model              string   `json:"model"`                         // 模型名称（为空时由具体实现决定默认模型）
+	EnableWebSearch    bool     `json:"enable_web_search"`             // 是否启用联网搜索
+	AspectRatio        string   `json:"aspect_ratio,omitempty"`        // 输出图片宽高比，如 "16:9"
+	ImageSize          string   `json:"image_size,omitempty"`          // 输出图片分辨率，如 "2K"
+	CandidateCount     int      `json:"candidate_count,omitempty"`     // 候选结果数量
+	Temperature        *float32 `json:"temperature,omitempty"`         // 采样温度
+	Seed               *int32   `json:"seed,omitempty"`                // 随机种子
+	ResponseModalities []string `json:"response_modalities,omitempty"` // 响应模态: "TEXT" | "IMAGE"
+}
+
+// Turn 对话历史中的一轮（用户输入或模型输出）
+type Turn struct {
+	Role  Role   // 角色: "user" | "model"
+	Parts []Part // 按原始顺序排列的片段
+}
+
+// Request 生成请求（与具体模型供应商无关）
+type Request struct {
+	History []Turn           // 之前的对话历史（按时间顺序，可选）
+	Prompt  string           // 本轮提示词
+	Images  []ReferenceImage // 本轮参考图片
+	Options Options          // 生成选项
+}
+
+// Part 生成结果中的一个有序片段
+type Part struct {
+	Type     PartType // 片段类型: "text" | "image"
+	Text     string   // 文本内容 (Type="text" 时有效)
+	Data     []byte   // 图片数据 (Type="image" 时有效)
+	MimeType string   // 图片 MIME 类型 (Type="image" 时有效)
+	// 模型返回的思考签名，多轮对话回放历史时需要原样带回
+	ThoughtSignature []byte
+}
+
+// SafetyRating 安全评级
+type SafetyRating struct {
+	Category    string `json:"category"`          // 危害类别，如 "HARM_CATEGORY_SEXUALLY_EXPLICIT"
+	Probability string `json:"probability"`       // 危害概率，如 "NEGLIGIBLE"
+	Blocked     bool   `json:"blocked,omitempty"` // 是否因该类别被拦截
+}
+
+// PromptFeedback 对输入内容的反馈（输入被拦截时有效）
+type PromptFeedback struct {
+	BlockReason        string         `json:"block_reason,omitempty"`         // 拦截原因，如 "SAFETY"
+	BlockReasonMessage string         `json:"block_reason_message,omitempty"` // 拦截原因说明
+	SafetyRatings      []SafetyRating `json:"safety_ratings,omitempty"`       // 安全评级
+}
+
+// Usage token 用量
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`     // 输入 token 数
+	CandidatesTokens int `json:"candidates_tokens"` // 输出 token 数（所有候选结果）
+	ThoughtsTokens   int `json:"thoughts_tokens"`   // 思考过程 token 数
+	TotalTokens      int `json:"total_tokens"`      // 总 token 数
+}
+
+// Candidate 一个候选结果
+type Candidate struct {
+	Index             int             // 候选序号，从 0 开始
+	Parts             []Part          // 按模型返回顺序排列的片段
+	FinishReason      string          // 结束原因，如 "STOP"、"SAFETY"
+	FinishMessage     string          // 结束原因说明
+	SafetyRatings     []SafetyRating  // 安全评级
+	GroundingMetadata json.RawMessage // 联网搜索的引用信息（原始 JSON，可选）
+}
+
+// Response 生成结果
+type Response struct {
+	Candidates     []Candidate     // 按序号排列的候选结果
+	PromptFeedback *PromptFeedback // 对输入内容的反馈（可选）
+	Usage          *Usage          // token 用量（可选）
+	ModelVersion   string          // 实际响应的模型版本（可选）
+}
+
+// PartHandler 流式生成时每收到一个片段调用一次（candidate 为候选序号），返回错误会终止生成
+type PartHandler func(candidate int, part Part) error
+
+// ImageGenerator 图片生成器接口
+// 屏蔽具体模型供应商的差异，image.Service 只依赖该接口
+type ImageGenerator interface {
+	// Generate 一次性生成，返回完整结果
+	Generate(ctx context.Context, req *Request) (*Response, error)
+	// GenerateStream 流式生成，按到达顺序回调片段（文本片段可能是增量），结束后返回汇总结果
+	GenerateStream(ctx context.Context, req *Request, onPart PartHandler) (*Response, error)
+}
+
+// Candidate 返回指定序号的候选结果，不存在时创建（保持按序号排列）
+func (r *Response) Candidate(index int) *Candidate {
+	for i := range r.Candidates {
+		if r.Candidates[i].Index == index {
+			return &r.Candidates[i]
+		}
+	}
+
+	pos := len(r.Candidates)
+	for pos > 0 && r.Candidates[pos-1].Index > index {
+		pos--
+	}
+	r.Candidates = append(r.Candidates, Candidate{})
+	copy(r.Candidates[pos+1:], r.Candidates[pos:])
+	r.Candidates[pos] = Candidate{Index: index}
+	return &r.Candidates[pos]
+}
+
+// AppendPart 将片段追加到指定候选结果中，相邻的文本片段合并为一个
+func (r *Response) AppendPart(candidate int, part Part) {
+	c := r.Candidate(candidate)
+	if part.Type == PartTypeText && len(c.Parts) > 0 {
+		last := &c.Parts[len(c.Parts)-1]
+		if last.Type == PartTypeText {
+			last.Text += part.Text
+			if last.ThoughtSignature == nil {
+				last.ThoughtSignature = part.ThoughtSignature
+			}
+			return
+		}
+	}
+	c.Parts = append(c.Parts, part)
+}
+
+// Empty 判断结果是否不包含任何片段
+func (r *Response) Empty() bool {
+	for _, c := range r.Candidates {
+		if len(c.Parts) > 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,106 @@
+package generator
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/guixu633/agent/backend/internal/config"
+)
+
+// ErrUnknownModel 请求的模型不在注册表中
+var ErrUnknownModel = errors.New("不支持的模型")
+
+// Registry 模型注册表
+// 维护允许使用的模型及其能力，并按模型的供应商分发到对应的图片生成器
+type Registry struct {
+	defaultModel string
+	models       []config.ModelConfig
+	byName       map[string]config.ModelConfig
+	providers    map[string]ImageGenerator
+}
+
+// NewRegistry 创建模型注册表
+// providers: 供应商名称到图片生成器的映射，每个模型的 Provider 必须在其中
+func NewRegistry(cfg config.ModelsConfig, providers map[string]ImageGenerator) (*Registry, error) {
+	r := &Registry{
+		defaultModel: cfg.Default,
+		models:       make([]config.ModelConfig, 0, len(cfg.Items)),
+		byName:       make(map[string]config.ModelConfig, len(cfg.Items)),
+		providers:    providers,
+	}
+
+	for _, m := range cfg.Items {
+		if m.Name == "" {
+			return nil, fmt.Errorf("模型名称不能为空")
+		}
+		if _, ok := r.byName[m.Name]; ok {
+			return nil, fmt.Errorf("模型 %s 重复配置", m.Name)
+		}
+		if _, ok := providers[m.Provider]; !ok {
+			return nil, fmt.Errorf("模型 %s 的供应商 %s 未注册", m.Name, m.Provider)
+		}
+		r.models = append(r.models, m)
+		r.byName[m.Name] = m
+	}
+
+	if len(r.models) == 0 {
+		return nil, fmt.Errorf("至少需要配置一个模型")
+	}
+	if r.defaultModel == "" {
+		r.defaultModel = r.models[0].Name
+	}
+	if _, ok := r.byName[r.defaultModel]; !ok {
+		return nil, fmt.Errorf("默认模型 %s 不在模型列表中", r.defaultModel)
+	}
+
+	return r, nil
+}
+
+// Default 返回默认模型名称
+func (r *Registry) Default() string {
+	return r.defaultModel
+}
+
+// Models 返回所有已注册的模型（按配置顺序）
+func (r *Registry) Models() []config.ModelConfig {
+	models := make([]config.ModelConfig, len(r.models))
+	copy(models, r.models)
+	return models
+}
+
+// Resolve 根据模型名称获取模型配置和对应的图片生成器
+// name 为空时返回默认模型
+func (r *Registry) Resolve(name string) (config.ModelConfig, ImageGenerator, error) {
+	if name == "" {
+		name = r.defaultModel
+	}
+	m, ok := r.byName[name]
+	if !ok {
+		return config.ModelConfig{}, nil, fmt.Errorf("%w: %s", ErrUnknownModel, name)
+	}
+	return m, r.providers[m.Provider], nil
+}
+
+// Stats 返回各供应商的调用计数（只包含带重试和熔断的生成器），按供应商名称排序
+func (r *Registry) Stats() []ProviderStats {
+	names := make([]string, 0, len(r.providers))
+	for name := range r.providers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	stats := make([]ProviderStats, 0, len(names))
+	for _, name := range names {
+		if g, ok := r.providers[name].(*ResilientGenerator); ok {
+			stats = append(stats, ProviderStats{Provider: name, ResilienceStats: g.Stats()})
+		}
+	}
+	return stats
+}
+
+// ProviderStats 一个供应商的调用计数
+type ProviderStats struct {
+	Provider string
+	ResilienceStats
+}
@@ -0,0 +1,243 @@
+package generator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/guixu633/agent/backend/internal/config"
+)
+
+// ErrCircuitOpen 供应商连续失败已熔断，请求被直接拒绝
+var ErrCircuitOpen = fmt.Errorf("%w: 已熔断", ErrUpstreamUnavailable)
+
+// 熔断器状态
+const (
+	BreakerClosed   = "closed"    // 正常调用
+	BreakerOpen     = "open"      // 熔断中，直接拒绝调用
+	BreakerHalfOpen = "half_open" // 冷却结束，允许一次试探调用
+)
+
+// ResilienceStats 调用计数（进程启动以来的累计值）
+type ResilienceStats struct {
+	Calls        int64  `json:"calls"`         // 请求次数（不含重试）
+	Attempts     int64  `json:"attempts"`      // 实际调用上游的次数（含重试）
+	Successes    int64  `json:"successes"`     // 成功的请求次数
+	Failures     int64  `json:"failures"`      // 重试后仍失败的请求次数
+	Retries      int64  `json:"retries"`       // 重试次数
+	Timeouts     int64  `json:"timeouts"`      // 单次调用超时次数
+	Rejected     int64  `json:"rejected"`      // 熔断期间被拒绝的请求次数
+	BreakerState string `json:"breaker_state"` // 熔断器当前状态
+}
+
+// ResilientGenerator 为图片生成器增加重试、退避、超时和熔断
+// 只有配额用尽、上游不可用和单次调用超时会重试并计入熔断；
+// 流式生成已经回调过片段后不再重试，避免客户端收到重复内容
+type ResilientGenerator struct {
+	next             ImageGenerator
+	maxRetries       int
+	initialBackoff   time.Duration
+	maxBackoff       time.Duration
+	callTimeout      time.Duration
+	breakerThreshold int
+	breakerCooldown  time.Duration
+
+	now   func() time.Time                                 // 当前时间（测试时可替换）
+	sleep func(ctx context.Context, d time.Duration) error // 退避等待（测试时可替换）
+
+	mu               sync.Mutex
+	stats            ResilienceStats
+	state            string
+	consecutiveFails int
+	openedAt         time.Time
+	probing          bool // 半开状态下是否已有试探调用在进行
+}
+
+// NewResilientGenerator 创建带重试和熔断的图片生成器
+func NewResilientGenerator(next ImageGenerator, cfg config.ResilienceConfig) *ResilientGenerator {
+	return &ResilientGenerator{
+		next:             next,
+		maxRetries:       cfg.MaxRetries,
+		initialBackoff:   time.Duration(cfg.InitialBackoffMs) * time.Millisecond,
+		maxBackoff:       time.Duration(cfg.MaxBackoffMs) * time.Millisecond,
+		callTimeout:      time.Duration(cfg.CallTimeout) * time.Second,
+		breakerThreshold: cfg.BreakerThreshold,
+		breakerCooldown:  time.Duration(cfg.BreakerCooldown) * time.Second,
+		now:              time.Now,
+		sleep:            sleepContext,
+		state:            BreakerClosed,
+	}
+}
+
+// Generate 一次性生成，失败时按配置重试
+func (g *ResilientGenerator) Generate(ctx context.Context, req *Request) (*Response, error) {
+	return g.do(ctx, func(callCtx context.Context) (*Response, bool, error) {
+		resp, err := g.next.Generate(callCtx, req)
+		return resp, true, err
+	})
+}
+
+// GenerateStream 流式生成，尚未回调任何片段时失败才会重试
+func (g *ResilientGenerator) GenerateStream(ctx context.Context, req *Request, onPart PartHandler) (*Response, error) {
+	return g.do(ctx, func(callCtx context.Context) (*Response, bool, error) {
+		emitted := false
+		resp, err := g.next.GenerateStream(callCtx, req, func(candidate int, part Part) error {
+			emitted = true
+			return onPart(candidate, part)
+		})
+		return resp, !emitted, err
+	})
+}
+
+// Stats 返回调用计数和熔断器状态
+func (g *ResilientGenerator) Stats() ResilienceStats {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	stats := g.stats
+	stats.BreakerState = g.state
+	if g.state == BreakerOpen && !g.now().Before(g.openedAt.Add(g.breakerCooldown)) {
+		stats.BreakerState = BreakerHalfOpen
+	}
+	return stats
+}
+
+// do 执行一次请求：检查熔断器，调用失败且可以重试时退避后重试
+// call 返回的 bool 表示失败后是否允许重试
+func (g *ResilientGenerator) do(ctx context.Context, call func(callCtx context.Context) (*Response, bool, error)) (*Response, error) {
+	g.count(func(s *ResilienceStats) { s.Calls++ })
+
+	for attempt := 0; ; attempt++ {
+		if err := g.acquire(); err != nil {
+			// 重试期间被熔断时计为失败
+			if attempt == 0 {
+				g.count(func(s *ResilienceStats) { s.Rejected++ })
+			} else {
+				g.count(func(s *ResilienceStats) { s.Failures++ })
+			}
+			return nil, err
+		}
+
+		resp, retryable, err := g.attempt(ctx, call)
+		upstreamFailure := err != nil && ctx.Err() == nil && isUpstreamFailure(err)
+		g.record(err == nil, upstreamFailure)
+		if err == nil {
+			g.count(func(s *ResilienceStats) { s.Successes++ })
+			return resp, nil
+		}
+
+		if !retryable || !upstreamFailure || attempt >= g.maxRetries {
+			g.count(func(s *ResilienceStats) { s.Failures++ })
+			return nil, err
+		}
+
+		g.count(func(s *ResilienceStats) { s.Retries++ })
+		if err := g.sleep(ctx, g.backoff(attempt)); err != nil {
+			g.count(func(s *ResilienceStats) { s.Failures++ })
+			return nil, err
+		}
+	}
+}
+
+// attempt 在单次调用超时内调用上游
+// 超时由本层引起（请求 context 仍然有效）时包装为 ErrUpstreamUnavailable，便于重试和统计
+func (g *ResilientGenerator) attempt(ctx context.Context, call func(callCtx context.Context) (*Response, bool, error)) (*Response, bool, error) {
+	g.count(func(s *ResilienceStats) { s.Attempts++ })
+
+	callCtx := ctx
+	if g.callTimeout > 0 {
+		var cancel context.CancelFunc
+		callCtx, cancel = context.WithTimeout(ctx, g.callTimeout)
+		defer cancel()
+	}
+
+	resp, retryable, err := call(callCtx)
+	if err != nil && ctx.Err() == nil && errors.Is(callCtx.Err(), context.DeadlineExceeded) {
+		g.count(func(s *ResilienceStats) { s.Timeouts++ })
+		err = fmt.Errorf("%w: 调用超时 (%s): %w", ErrUpstreamUnavailable, g.callTimeout, err)
+	}
+	return resp, retryable, err
+}
+
+// acquire 检查熔断器是否允许本次调用
+func (g *ResilientGenerator) acquire() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	switch g.state {
+	case BreakerOpen:
+		if g.now().Before(g.openedAt.Add(g.breakerCooldown)) {
+			return ErrCircuitOpen
+		}
+		g.state = BreakerHalfOpen
+		g.probing = true
+		return nil
+	case BreakerHalfOpen:
+		if g.probing {
+			return ErrCircuitOpen
+		}
+		g.probing = true
+	}
+	return nil
+}
+
+// record 根据调用结果更新熔断器状态
+// 只有上游故障计入连续失败，其他错误（如请求被取消）只结束试探
+func (g *ResilientGenerator) record(success bool, upstreamFailure bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	wasProbe := g.state == BreakerHalfOpen
+	g.probing = false
+	switch {
+	case success:
+		g.state = BreakerClosed
+		g.consecutiveFails = 0
+	case upstreamFailure:
+		g.consecutiveFails++
+		if wasProbe || (g.breakerThreshold > 0 && g.consecutiveFails >= g.breakerThreshold) {
+			g.state = BreakerOpen
+			g.openedAt = g.now()
+		}
+	}
+}
+
+// backoff 计算第 attempt 次重试前的等待时间：指数退避，在 [d/2, d] 范围内随机抖动
+func (g *ResilientGenerator) backoff(attempt int) time.Duration {
+	d := g.initialBackoff
+	for i := 0; i < attempt && d < g.maxBackoff; i++ {
+		d *= 2
+	}
+	d = min(d, g.maxBackoff)
+	if d <= 0 {
+		return 0
+	}
+	half := d / 2
+	return half + rand.N(d-half+1)
+}
+
+// count 更新调用计数
+func (g *ResilientGenerator) count(update func(s *ResilienceStats)) {
+	g.mu.Lock()
+	update(&g.stats)
+	g.mu.Unlock()
+}
+
+// isUpstreamFailure 判断错误是否为上游故障（可以重试并计入熔断）
+func isUpstreamFailure(err error) bool {
+	return errors.Is(err, ErrQuotaExceeded) || errors.Is(err, ErrUpstreamUnavailable)
+}
+
+// sleepContext 等待指定时间，ctx 取消时提前返回
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
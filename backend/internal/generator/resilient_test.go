@@ -0,0 +1,167 @@
+package generator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/guixu633/agent/backend/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResilientGeneratorRetry(t *testing.T) {
+	quota := fmt.Errorf("%w: 429", ErrQuotaExceeded)
+	unavailable := fmt.Errorf("%w: 503", ErrUpstreamUnavailable)
+
+	t.Run("临时故障重试后成功", func(t *testing.T) {
+		fake := &FakeGenerator{Failures: []error{quota, unavailable}}
+		g, sleeps := newTestResilientGenerator(fake, config.ResilienceConfig{MaxRetries: 2})
+
+		resp, err := g.Generate(context.Background(), &Request{Prompt: "猫"})
+		assert.NoError(t, err)
+		assert.False(t, resp.Empty())
+		assert.Len(t, fake.Requests(), 3)
+
+		// 指数退避：每次等待时间在 [d/2, d] 范围内，d 从 100ms 开始翻倍
+		assert.Len(t, *sleeps, 2)
+		assert.GreaterOrEqual(t, (*sleeps)[0], 50*time.Millisecond)
+		assert.LessOrEqual(t, (*sleeps)[0], 100*time.Millisecond)
+		assert.GreaterOrEqual(t, (*sleeps)[1], 100*time.Millisecond)
+		assert.LessOrEqual(t, (*sleeps)[1], 200*time.Millisecond)
+
+		stats := g.Stats()
+		assert.Equal(t, ResilienceStats{Calls: 1, Attempts: 3, Successes: 1, Retries: 2, BreakerState: BreakerClosed}, stats)
+	})
+
+	t.Run("重试次数用尽", func(t *testing.T) {
+		fake := &FakeGenerator{Err: unavailable}
+		g, _ := newTestResilientGenerator(fake, config.ResilienceConfig{MaxRetries: 2})
+
+		_, err := g.Generate(context.Background(), &Request{Prompt: "猫"})
+		assert.ErrorIs(t, err, ErrUpstreamUnavailable)
+		assert.Len(t, fake.Requests(), 3)
+		assert.Equal(t, int64(1), g.Stats().Failures)
+	})
+
+	t.Run("其他错误不重试", func(t *testing.T) {
+		invalid := errors.New("invalid argument")
+		fake := &FakeGenerator{Err: invalid}
+		g, _ := newTestResilientGenerator(fake, config.ResilienceConfig{MaxRetries: 2})
+
+		_, err := g.Generate(context.Background(), &Request{Prompt: "猫"})
+		assert.ErrorIs(t, err, invalid)
+		assert.Len(t, fake.Requests(), 1)
+	})
+
+	t.Run("流式生成未输出片段前重试", func(t *testing.T) {
+		fake := &FakeGenerator{Failures: []error{quota}}
+		g, _ := newTestResilientGenerator(fake, config.ResilienceConfig{MaxRetries: 1})
+
+		parts := 0
+		_, err := g.GenerateStream(context.Background(), &Request{Prompt: "猫"}, func(int, Part) error {
+			parts++
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, 2, parts)
+		assert.Len(t, fake.Requests(), 2)
+	})
+
+	t.Run("单次调用超时", func(t *testing.T) {
+		g, _ := newTestResilientGenerator(blockingGenerator{}, config.ResilienceConfig{MaxRetries: 1})
+		g.callTimeout = 10 * time.Millisecond
+
+		_, err := g.Generate(context.Background(), &Request{Prompt: "猫"})
+		assert.ErrorIs(t, err, ErrUpstreamUnavailable)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		stats := g.Stats()
+		assert.Equal(t, int64(2), stats.Timeouts)
+		assert.Equal(t, int64(1), stats.Retries)
+	})
+
+	t.Run("请求取消时不重试", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		fake := &FakeGenerator{}
+		g, _ := newTestResilientGenerator(fake, config.ResilienceConfig{MaxRetries: 2})
+
+		_, err := g.Generate(ctx, &Request{Prompt: "猫"})
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.Len(t, fake.Requests(), 1)
+		assert.Zero(t, g.Stats().Timeouts)
+	})
+}
+
+func TestResilientGeneratorCircuitBreaker(t *testing.T) {
+	unavailable := fmt.Errorf("%w: 503", ErrUpstreamUnavailable)
+	fake := &FakeGenerator{Failures: []error{unavailable, unavailable, unavailable}}
+	g, _ := newTestResilientGenerator(fake, config.ResilienceConfig{MaxRetries: -1, BreakerThreshold: 2, BreakerCooldown: 30})
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	g.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	// 连续失败达到阈值后熔断
+	for i := 0; i < 2; i++ {
+		_, err := g.Generate(ctx, &Request{Prompt: "猫"})
+		assert.ErrorIs(t, err, ErrUpstreamUnavailable)
+	}
+	assert.Equal(t, BreakerOpen, g.Stats().BreakerState)
+
+	// 熔断期间直接拒绝，不调用上游
+	_, err := g.Generate(ctx, &Request{Prompt: "猫"})
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+	assert.ErrorIs(t, err, ErrUpstreamUnavailable)
+	assert.Len(t, fake.Requests(), 2)
+	assert.Equal(t, int64(1), g.Stats().Rejected)
+
+	// 冷却结束后允许试探，试探失败重新熔断
+	now = now.Add(31 * time.Second)
+	assert.Equal(t, BreakerHalfOpen, g.Stats().BreakerState)
+	_, err = g.Generate(ctx, &Request{Prompt: "猫"})
+	assert.ErrorIs(t, err, ErrUpstreamUnavailable)
+	assert.NotErrorIs(t, err, ErrCircuitOpen)
+	assert.Equal(t, BreakerOpen, g.Stats().BreakerState)
+
+	// 再次冷却后试探成功，恢复正常
+	now = now.Add(31 * time.Second)
+	_, err = g.Generate(ctx, &Request{Prompt: "猫"})
+	assert.NoError(t, err)
+	assert.Equal(t, BreakerClosed, g.Stats().BreakerState)
+	assert.Len(t, fake.Requests(), 4)
+}
+
+// newTestResilientGenerator 创建不实际等待的测试生成器，返回记录退避时间的切片
+// 未指定的参数使用固定的测试值：退避 100ms 起、上限 1s，不熔断
+func newTestResilientGenerator(next ImageGenerator, cfg config.ResilienceConfig) (*ResilientGenerator, *[]time.Duration) {
+	if cfg.InitialBackoffMs == 0 {
+		cfg.InitialBackoffMs = 100
+	}
+	if cfg.MaxBackoffMs == 0 {
+		cfg.MaxBackoffMs = 1000
+	}
+	if cfg.BreakerThreshold == 0 {
+		cfg.BreakerThreshold = -1
+	}
+
+	g := NewResilientGenerator(next, cfg)
+	sleeps := make([]time.Duration, 0)
+	g.sleep = func(ctx context.Context, d time.Duration) error {
+		sleeps = append(sleeps, d)
+		return ctx.Err()
+	}
+	return g, &sleeps
+}
+
+// blockingGenerator 一直等待到 ctx 结束的生成器，用于模拟上游无响应
+type blockingGenerator struct{}
+
+func (blockingGenerator) Generate(ctx context.Context, _ *Request) (*Response, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (g blockingGenerator) GenerateStream(ctx context.Context, req *Request, _ PartHandler) (*Response, error) {
+	return g.Generate(ctx, req)
+}
@@ -0,0 +1,105 @@
+package budget
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/guixu633/agent/backend/internal/model"
+	"github.com/guixu633/agent/backend/internal/service/budget"
+	"github.com/guixu633/agent/backend/pkg/response"
+)
+
+// Handler 工作区预算处理器
+type Handler struct {
+	budgetService *budget.Service
+}
+
+// NewHandler 创建工作区预算处理器实例
+func NewHandler(budgetService *budget.Service) *Handler {
+	return &Handler{
+		budgetService: budgetService,
+	}
+}
+
+// List 列出工作区预算
+// @Summary 列出工作区预算
+// @Description 获取工作区的每日、每月预算及当前周期的用量
+// @Tags budget
+// @Produce json
+// @Param workspace query string true "工作区名称"
+// @Success 200 {object} response.Response{data=model.ListBudgetsResponse}
+// @Router /api/workspace/budget [get]
+func (h *Handler) List(c *gin.Context) {
+	var req model.ListBudgetsRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		response.ErrorWithStatus(c, http.StatusBadRequest, 400, "请求参数错误: "+err.Error())
+		return
+	}
+
+	result, err := h.budgetService.ListBudgets(c.Request.Context(), req.Workspace)
+	if err != nil {
+		response.Error(c, 500, "获取工作区预算失败: "+err.Error())
+		return
+	}
+
+	response.Success(c, result)
+}
+
+// Set 设置工作区预算
+// @Summary 设置工作区预算
+// @Description 按周期（daily/monthly）限制生成次数、token 数或估算成本，已有相同周期和指标的预算时覆盖
+// @Tags budget
+// @Accept json
+// @Produce json
+// @Param request body model.SetBudgetRequest true "设置预算请求"
+// @Success 200 {object} response.Response{data=model.SetBudgetResponse}
+// @Router /api/workspace/budget [put]
+func (h *Handler) Set(c *gin.Context) {
+	var req model.SetBudgetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.ErrorWithStatus(c, http.StatusBadRequest, 400, "请求参数错误: "+err.Error())
+		return
+	}
+
+	result, err := h.budgetService.SetBudget(c.Request.Context(), &req)
+	if err != nil {
+		if errors.Is(err, budget.ErrInvalidBudget) {
+			response.ErrorWithStatus(c, http.StatusBadRequest, 400, "请求参数错误: "+err.Error())
+			return
+		}
+		response.Error(c, 500, "设置工作区预算失败: "+err.Error())
+		return
+	}
+
+	response.Success(c, result)
+}
+
+// Delete 删除工作区预算
+// @Summary 删除工作区预算
+// @Description 删除指定周期和指标的预算
+// @Tags budget
+// @Accept json
+// @Produce json
+// @Param request body model.DeleteBudgetRequest true "删除预算请求"
+// @Success 200 {object} response.Response
+// @Router /api/workspace/budget [delete]
+func (h *Handler) Delete(c *gin.Context) {
+	var req model.DeleteBudgetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.ErrorWithStatus(c, http.StatusBadRequest, 400, "请求参数错误: "+err.Error())
+		return
+	}
+
+	err := h.budgetService.DeleteBudget(c.Request.Context(), &req)
+	if err != nil {
+		if errors.Is(err, budget.ErrBudgetNotFound) {
+			response.ErrorWithStatus(c, http.StatusNotFound, 404, err.Error())
+			return
+		}
+		response.Error(c, 500, "删除工作区预算失败: "+err.Error())
+		return
+	}
+
+	response.Success(c, nil)
+}
@@ -0,0 +1,134 @@
+package conversation
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/guixu633/agent/backend/internal/model"
+	"github.com/guixu633/agent/backend/internal/service/image"
+	"github.com/guixu633/agent/backend/pkg/response"
+)
+
+// Handler 对话处理器
+type Handler struct {
+	imageService *image.Service
+}
+
+// NewHandler 创建对话处理器实例
+func NewHandler(imageService *image.Service) *Handler {
+	return &Handler{
+		imageService: imageService,
+	}
+}
+
+// List 列出工作区的对话
+// @Summary 列出对话
+// @Description 列出工作区的多轮对话会话，最近更新的在前
+// @Tags conversation
+// @Produce json
+// @Param workspace query string true "工作区名称"
+// @Success 200 {object} response.Response{data=model.ListConversationsResponse}
+// @Router /api/conversation [get]
+func (h *Handler) List(c *gin.Context) {
+	var req model.ListConversationsRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		response.ErrorWithStatus(c, http.StatusBadRequest, 400, "请求参数错误: "+err.Error())
+		return
+	}
+
+	result, err := h.imageService.ListConversations(c.Request.Context(), req.Workspace)
+	if err != nil {
+		response.Error(c, 500, "列出对话失败: "+err.Error())
+		return
+	}
+
+	response.Success(c, result)
+}
+
+// Get 获取对话详情
+// @Summary 获取对话详情
+// @Description 获取对话的全部轮次，包括每轮的用户输入、参考图片和生成的图片
+// @Tags conversation
+// @Produce json
+// @Param id path int true "对话 ID"
+// @Success 200 {object} response.Response{data=model.GetConversationResponse}
+// @Router /api/conversation/{id} [get]
+func (h *Handler) Get(c *gin.Context) {
+	id, ok := parseID(c)
+	if !ok {
+		return
+	}
+
+	result, err := h.imageService.GetConversation(c.Request.Context(), id)
+	if err != nil {
+		if errors.Is(err, image.ErrConversationNotFound) {
+			response.ErrorWithStatus(c, http.StatusNotFound, 404, err.Error())
+			return
+		}
+		response.Error(c, 500, "获取对话失败: "+err.Error())
+		return
+	}
+
+	response.Success(c, result)
+}
+
+// Continue 继续对话
+// @Summary 继续对话
+// @Description 将之前的轮次作为历史发送给模型，在上一轮的结果上继续编辑
+// @Tags conversation
+// @Accept json
+// @Produce json
+// @Param id path int true "对话 ID"
+// @Param request body model.ContinueConversationRequest true "本轮输入"
+// @Success 200 {object} response.Response{data=model.ImageGenerateResponse}
+// @Router /api/conversation/{id}/continue [post]
+func (h *Handler) Continue(c *gin.Context) {
+	id, ok := parseID(c)
+	if !ok {
+		return
+	}
+
+	var req model.ContinueConversationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.ErrorWithStatus(c, http.StatusBadRequest, 400, "请求参数错误: "+err.Error())
+		return
+	}
+
+	result, err := h.imageService.ContinueConversation(c.Request.Context(), id, &req)
+	if err != nil {
+		if errors.Is(err, image.ErrConversationNotFound) {
+			response.ErrorWithStatus(c, http.StatusNotFound, 404, err.Error())
+			return
+		}
+		if image.IsInvalidRequest(err) {
+			response.ErrorWithStatus(c, http.StatusBadRequest, 400, "继续对话失败: "+err.Error())
+			return
+		}
+		if status, code, ok := image.GenerationFailure(err); ok {
+			if failure := image.FailureDetail(err); failure != nil {
+				response.ErrorWithData(c, status, code, "继续对话失败: "+err.Error(), failure)
+			} else if detail := image.BudgetDetail(err); detail != nil {
+				response.ErrorWithData(c, status, code, "继续对话失败: "+err.Error(), detail)
+			} else {
+				response.ErrorWithStatus(c, status, code, "继续对话失败: "+err.Error())
+			}
+			return
+		}
+		response.Error(c, 500, "继续对话失败: "+err.Error())
+		return
+	}
+
+	response.Success(c, result)
+}
+
+// parseID 解析路径中的对话 ID，失败时写入错误响应
+func parseID(c *gin.Context) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		response.ErrorWithStatus(c, http.StatusBadRequest, 400, "对话 ID 格式错误")
+		return 0, false
+	}
+	return id, true
+}
@@ -1,6 +1,8 @@
 package image
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"path/filepath"
@@ -33,6 +35,7 @@ func NewHandler(imageService *image.Service) *Handler {
 // @Produce json
 // @Param file formData file true "图片文件"
 // @Param workspace formData string true "工作区名称"
+// @Param on_conflict formData string false "已有同名图片时的处理方式: rename（默认，自动添加序号）| reject | replace"
 // @Success 200 {object} response.Response{data=model.ImageUploadResponse}
 // @Router /api/image/upload [post]
 func (h *Handler) Upload(c *gin.Context) {
@@ -69,8 +72,16 @@ func (h *Handler) Upload(c *gin.Context) {
 	}
 
 	// 调用服务层上传
-	result, err := h.imageService.UploadImage(c.Request.Context(), src, filename, workspace)
+	result, err := h.imageService.UploadImage(c.Request.Context(), src, filename, workspace, c.PostForm("on_conflict"))
 	if err != nil {
+		if image.IsInvalidRequest(err) {
+			response.ErrorWithStatus(c, http.StatusBadRequest, 400, err.Error())
+			return
+		}
+		if errors.Is(err, image.ErrImageExists) {
+			response.ErrorWithStatus(c, http.StatusConflict, 409, err.Error())
+			return
+		}
 		response.Error(c, 500, "上传图片失败: "+err.Error())
 		return
 	}
@@ -97,31 +108,144 @@ func (h *Handler) Generate(c *gin.Context) {
 	// 调用服务层
 	result, err := h.imageService.GenerateImage(c.Request.Context(), &req)
 	if err != nil {
-		response.Error(c, 500, "生成图片失败: "+err.Error())
+		writeGenerateError(c, err)
 		return
 	}
 
 	response.Success(c, result)
 }
 
-// List 列出工作区的所有图片
+// GenerateStream 流式生成图片
+// @Summary 流式生成图片
+// @Description 以 Server-Sent Events 推送生成进度：text（文本增量）、image（图片已保存）、done（汇总结果）、error（生成失败，携带业务错误码和拦截原因）
+// @Tags image
+// @Accept json
+// @Produce text/event-stream
+// @Param request body model.ImageGenerateRequest true "生成请求"
+// @Success 200 {object} model.GenerateStreamEvent
+// @Router /api/image/generate/stream [post]
+func (h *Handler) GenerateStream(c *gin.Context) {
+	var req model.ImageGenerateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.ErrorWithStatus(c, http.StatusBadRequest, 400, "请求参数错误: "+err.Error())
+		return
+	}
+
+	// 第一个事件到达时才切换为 SSE 响应，之前的错误仍以 JSON 返回
+	ctx := c.Request.Context()
+	started := false
+	emit := func(event *model.GenerateStreamEvent) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !started {
+			started = true
+			c.Header("Content-Type", "text/event-stream")
+			c.Header("Cache-Control", "no-cache")
+			c.Header("Connection", "keep-alive")
+			c.Header("X-Accel-Buffering", "no")
+		}
+		c.SSEvent(event.Type, event)
+		c.Writer.Flush()
+		return nil
+	}
+
+	// 调用服务层（客户端断开时 ctx 被取消，上游调用随之终止）
+	err := h.imageService.GenerateImageStream(ctx, &req, emit)
+	if err == nil {
+		return
+	}
+	if !started {
+		writeGenerateError(c, err)
+		return
+	}
+	if ctx.Err() == nil {
+		_, code, _ := image.GenerationFailure(err)
+		emit(&model.GenerateStreamEvent{
+			Type:    model.StreamEventError,
+			Error:   "生成图片失败: " + err.Error(),
+			Code:    code,
+			Failure: image.FailureDetail(err),
+		})
+	}
+}
+
+// writeGenerateError 根据生成失败的原因写入错误响应
+// 请求不合法返回 400；模型拒绝生成或上游调用失败时返回对应的状态码、业务错误码和拦截原因
+func writeGenerateError(c *gin.Context, err error) {
+	message := "生成图片失败: " + err.Error()
+	if image.IsInvalidRequest(err) {
+		response.ErrorWithStatus(c, http.StatusBadRequest, 400, message)
+		return
+	}
+	if status, code, ok := image.GenerationFailure(err); ok {
+		if failure := image.FailureDetail(err); failure != nil {
+			response.ErrorWithData(c, status, code, message, failure)
+		} else if detail := image.BudgetDetail(err); detail != nil {
+			response.ErrorWithData(c, status, code, message, detail)
+		} else {
+			response.ErrorWithStatus(c, status, code, message)
+		}
+		return
+	}
+	response.Error(c, 500, message)
+}
+
+// ListModels 列出可用模型
+// @Summary 列出可用模型
+// @Description 获取服务端允许使用的模型及其能力和默认参数
+// @Tags image
+// @Produce json
+// @Success 200 {object} response.Response{data=model.ListModelsResponse}
+// @Router /api/models [get]
+func (h *Handler) ListModels(c *gin.Context) {
+	response.Success(c, h.imageService.ListModels(c.Request.Context()))
+}
+
+// ProviderStats 获取模型供应商的调用计数
+// @Summary 获取模型调用计数
+// @Description 获取各模型供应商的请求、重试、超时、熔断拒绝次数和熔断器当前状态，用于监控
+// @Tags image
+// @Produce json
+// @Success 200 {object} response.Response{data=model.ProviderStatsResponse}
+// @Router /api/models/stats [get]
+func (h *Handler) ProviderStats(c *gin.Context) {
+	response.Success(c, h.imageService.ProviderStats(c.Request.Context()))
+}
+
+// List 分页列出工作区的图片
 // @Summary 列出工作区图片
-// @Description 获取指定工作区的所有图片列表
+// @Description 分页获取指定工作区的图片列表，支持排序和按来源、MIME 类型、创建时间、文件大小、标签过滤
 // @Tags image
 // @Produce json
 // @Param workspace query string true "工作区名称"
+// @Param cursor query string false "分页游标（上一页响应中的 next_cursor）"
+// @Param limit query int false "每页数量，默认 50，最大 200"
+// @Param sort query string false "排序字段: created（默认）| updated | name | size"
+// @Param order query string false "排序方向: desc（默认）| asc"
+// @Param source_type query string false "来源类型: upload | generate"
+// @Param mime_type query string false "MIME 类型，如 image/png"
+// @Param created_after query string false "创建时间下限（包含），RFC 3339 或 YYYY-MM-DD"
+// @Param created_before query string false "创建时间上限（不包含），RFC 3339 或 YYYY-MM-DD"
+// @Param min_size query int false "文件大小下限（字节）"
+// @Param max_size query int false "文件大小上限（字节）"
+// @Param tag query []string false "标签（可重复指定，需要包含所有标签）" collectionFormat(multi)
 // @Success 200 {object} response.Response{data=model.ListWorkspaceImagesResponse}
 // @Router /api/image/list [get]
 func (h *Handler) List(c *gin.Context) {
-	workspace := c.Query("workspace")
-	if workspace == "" {
-		response.ErrorWithStatus(c, http.StatusBadRequest, 400, "工作区名称不能为空")
+	var req model.ListWorkspaceImagesRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		response.ErrorWithStatus(c, http.StatusBadRequest, 400, "请求参数错误: "+err.Error())
 		return
 	}
 
 	// 调用服务层
-	result, err := h.imageService.ListWorkspaceImages(c.Request.Context(), workspace)
+	result, err := h.imageService.ListWorkspaceImages(c.Request.Context(), &req)
 	if err != nil {
+		if image.IsInvalidRequest(err) {
+			response.ErrorWithStatus(c, http.StatusBadRequest, 400, err.Error())
+			return
+		}
 		response.Error(c, 500, "获取图片列表失败: "+err.Error())
 		return
 	}
@@ -129,6 +253,128 @@ func (h *Handler) List(c *gin.Context) {
 	response.Success(c, result)
 }
 
+// Search 全文搜索工作区的图片
+// @Summary 搜索图片
+// @Description 按文件名、提示词和对话文本全文搜索工作区的图片（支持中文），按相关度排序并返回匹配片段
+// @Tags image
+// @Produce json
+// @Param workspace query string true "工作区名称"
+// @Param q query string true "搜索词"
+// @Param limit query int false "每页数量，默认 20，最大 100"
+// @Param offset query int false "跳过的结果数量"
+// @Success 200 {object} response.Response{data=model.SearchImagesResponse}
+// @Router /api/image/search [get]
+func (h *Handler) Search(c *gin.Context) {
+	var req model.SearchImagesRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		response.ErrorWithStatus(c, http.StatusBadRequest, 400, "请求参数错误: "+err.Error())
+		return
+	}
+
+	// 调用服务层
+	result, err := h.imageService.SearchImages(c.Request.Context(), &req)
+	if err != nil {
+		if image.IsInvalidRequest(err) {
+			response.ErrorWithStatus(c, http.StatusBadRequest, 400, err.Error())
+			return
+		}
+		response.Error(c, 500, "搜索图片失败: "+err.Error())
+		return
+	}
+
+	response.Success(c, result)
+}
+
+// AddTags 为图片添加标签
+// @Summary 添加图片标签
+// @Description 为工作区中的一张或多张图片添加标签，不存在的标签自动创建
+// @Tags image
+// @Accept json
+// @Produce json
+// @Param request body model.TagImagesRequest true "添加标签请求"
+// @Success 200 {object} response.Response{data=model.TagImagesResponse}
+// @Router /api/image/tags [post]
+func (h *Handler) AddTags(c *gin.Context) {
+	var req model.TagImagesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.ErrorWithStatus(c, http.StatusBadRequest, 400, "请求参数错误: "+err.Error())
+		return
+	}
+
+	// 调用服务层
+	result, err := h.imageService.AddTags(c.Request.Context(), &req)
+	if err != nil {
+		writeTagError(c, "添加图片标签失败: ", err)
+		return
+	}
+
+	response.Success(c, result)
+}
+
+// RemoveTags 移除图片的标签
+// @Summary 移除图片标签
+// @Description 移除工作区中一张或多张图片的标签
+// @Tags image
+// @Accept json
+// @Produce json
+// @Param request body model.TagImagesRequest true "移除标签请求"
+// @Success 200 {object} response.Response{data=model.TagImagesResponse}
+// @Router /api/image/tags [delete]
+func (h *Handler) RemoveTags(c *gin.Context) {
+	var req model.TagImagesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.ErrorWithStatus(c, http.StatusBadRequest, 400, "请求参数错误: "+err.Error())
+		return
+	}
+
+	// 调用服务层
+	result, err := h.imageService.RemoveTags(c.Request.Context(), &req)
+	if err != nil {
+		writeTagError(c, "移除图片标签失败: ", err)
+		return
+	}
+
+	response.Success(c, result)
+}
+
+// writeTagError 写入修改标签失败的错误响应
+// 标签不合法返回 400，图片不存在或不属于该工作区返回 404
+func writeTagError(c *gin.Context, prefix string, err error) {
+	switch {
+	case image.IsInvalidRequest(err):
+		response.ErrorWithStatus(c, http.StatusBadRequest, 400, err.Error())
+	case errors.Is(err, image.ErrImageNotFound):
+		response.ErrorWithStatus(c, http.StatusNotFound, 404, err.Error())
+	default:
+		response.Error(c, 500, prefix+err.Error())
+	}
+}
+
+// ListTags 列出工作区的标签
+// @Summary 列出工作区标签
+// @Description 获取工作区中正在使用的标签及使用每个标签的图片数量，按数量倒序排列
+// @Tags image
+// @Produce json
+// @Param workspace query string true "工作区名称"
+// @Success 200 {object} response.Response{data=model.ListTagsResponse}
+// @Router /api/image/tags [get]
+func (h *Handler) ListTags(c *gin.Context) {
+	var req model.ListTagsRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		response.ErrorWithStatus(c, http.StatusBadRequest, 400, "请求参数错误: "+err.Error())
+		return
+	}
+
+	// 调用服务层
+	result, err := h.imageService.ListTags(c.Request.Context(), req.Workspace)
+	if err != nil {
+		response.Error(c, 500, "获取标签列表失败: "+err.Error())
+		return
+	}
+
+	response.Success(c, result)
+}
+
 // Delete 删除图片
 // @Summary 删除图片
 // @Description 删除指定的图片
@@ -146,7 +392,7 @@ func (h *Handler) Delete(c *gin.Context) {
 	}
 
 	// 调用服务层
-	err := h.imageService.DeleteImage(c.Request.Context(), req.Path)
+	err := h.imageService.DeleteImage(c.Request.Context(), &req)
 	if err != nil {
 		response.Error(c, 500, "删除图片失败: "+err.Error())
 		return
@@ -174,6 +420,10 @@ func (h *Handler) Rename(c *gin.Context) {
 	// 调用服务层
 	result, err := h.imageService.RenameImage(c.Request.Context(), &req)
 	if err != nil {
+		if errors.Is(err, image.ErrImageExists) {
+			response.ErrorWithStatus(c, http.StatusConflict, 409, err.Error())
+			return
+		}
 		response.Error(c, 500, "重命名图片失败: "+err.Error())
 		return
 	}
@@ -211,3 +461,83 @@ func (h *Handler) GetDetail(c *gin.Context) {
 
 	response.Success(c, result)
 }
+
+// GetRun 获取模型调用审计记录
+// @Summary 获取模型调用记录
+// @Description 获取一次模型调用的完整记录，包括请求配置、响应摘要、结束原因、安全评级、token 用量、耗时和生成的图片
+// @Tags image
+// @Produce json
+// @Param id path int true "调用记录 ID"
+// @Success 200 {object} response.Response{data=model.GetGenerationRunResponse}
+// @Router /api/image/runs/{id} [get]
+func (h *Handler) GetRun(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		response.ErrorWithStatus(c, http.StatusBadRequest, 400, "调用记录 ID 格式错误")
+		return
+	}
+
+	result, err := h.imageService.GetGenerationRun(c.Request.Context(), id)
+	if err != nil {
+		if errors.Is(err, image.ErrRunNotFound) {
+			response.ErrorWithStatus(c, http.StatusNotFound, 404, err.Error())
+			return
+		}
+		response.Error(c, 500, "获取模型调用记录失败: "+err.Error())
+		return
+	}
+
+	response.Success(c, result)
+}
+
+// Raw 通过后端读取图片原图
+// @Summary 读取图片原图
+// @Description 通过后端读取图片原图（存储桶无需公开），支持 ETag、Last-Modified、If-None-Match 和 Range 请求
+// @Tags image
+// @Produce octet-stream
+// @Param id path int true "图片 ID"
+// @Success 200 {file} binary
+// @Success 206 {file} binary
+// @Success 304
+// @Router /api/image/raw/{id} [get]
+func (h *Handler) Raw(c *gin.Context) {
+	h.serveImage(c, h.imageService.OpenImage)
+}
+
+// Thumb 通过后端读取图片缩略图
+// @Summary 读取图片缩略图
+// @Description 通过后端读取图片缩略图，缓存和范围请求的处理与原图相同
+// @Tags image
+// @Produce octet-stream
+// @Param id path int true "图片 ID"
+// @Success 200 {file} binary
+// @Success 304
+// @Router /api/image/thumb/{id} [get]
+func (h *Handler) Thumb(c *gin.Context) {
+	h.serveImage(c, h.imageService.OpenThumbnail)
+}
+
+// serveImage 打开图片并输出内容，条件请求和范围请求由 http.ServeContent 处理
+func (h *Handler) serveImage(c *gin.Context, open func(context.Context, int64) (*image.ImageContent, error)) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		response.ErrorWithStatus(c, http.StatusBadRequest, 400, "图片 ID 格式错误")
+		return
+	}
+
+	content, err := open(c.Request.Context(), id)
+	if err != nil {
+		if errors.Is(err, image.ErrImageNotFound) {
+			response.ErrorWithStatus(c, http.StatusNotFound, 404, err.Error())
+			return
+		}
+		response.Error(c, 500, "读取图片失败: "+err.Error())
+		return
+	}
+	defer content.Content.Close()
+
+	c.Header("ETag", content.ETag)
+	c.Header("Cache-Control", fmt.Sprintf("private, max-age=%d", int(image.ImageCacheMaxAge.Seconds())))
+	c.Header("Content-Type", content.MimeType)
+	http.ServeContent(c.Writer, c.Request, content.Name, content.LastModified, content.Content)
+}
@@ -0,0 +1,121 @@
+package job
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/guixu633/agent/backend/internal/model"
+	"github.com/guixu633/agent/backend/internal/service/image"
+	"github.com/guixu633/agent/backend/internal/service/job"
+	"github.com/guixu633/agent/backend/pkg/response"
+)
+
+// Handler 异步生成任务处理器
+type Handler struct {
+	jobService *job.Service
+}
+
+// NewHandler 创建异步生成任务处理器实例
+func NewHandler(jobService *job.Service) *Handler {
+	return &Handler{
+		jobService: jobService,
+	}
+}
+
+// Create 提交生成任务
+// @Summary 提交生成任务
+// @Description 提交异步图片生成任务，立即返回任务 ID，通过 GET /api/image/jobs/:id 查询进度
+// @Tags job
+// @Accept json
+// @Produce json
+// @Param request body model.ImageGenerateRequest true "生成请求"
+// @Success 200 {object} response.Response{data=model.CreateJobResponse}
+// @Router /api/image/jobs [post]
+func (h *Handler) Create(c *gin.Context) {
+	var req model.ImageGenerateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.ErrorWithStatus(c, http.StatusBadRequest, 400, "请求参数错误: "+err.Error())
+		return
+	}
+
+	result, err := h.jobService.CreateJob(c.Request.Context(), &req)
+	if err != nil {
+		if image.IsInvalidRequest(err) {
+			response.ErrorWithStatus(c, http.StatusBadRequest, 400, "提交生成任务失败: "+err.Error())
+			return
+		}
+		response.Error(c, 500, "提交生成任务失败: "+err.Error())
+		return
+	}
+
+	response.Success(c, result)
+}
+
+// Get 获取生成任务
+// @Summary 获取生成任务
+// @Description 获取任务状态（queued/running/succeeded/failed/cancelled），成功时包含生成结果
+// @Tags job
+// @Produce json
+// @Param id path int true "任务 ID"
+// @Success 200 {object} response.Response{data=model.GetJobResponse}
+// @Router /api/image/jobs/{id} [get]
+func (h *Handler) Get(c *gin.Context) {
+	id, ok := parseID(c)
+	if !ok {
+		return
+	}
+
+	result, err := h.jobService.GetJob(c.Request.Context(), id)
+	if err != nil {
+		if errors.Is(err, job.ErrJobNotFound) {
+			response.ErrorWithStatus(c, http.StatusNotFound, 404, err.Error())
+			return
+		}
+		response.Error(c, 500, "获取生成任务失败: "+err.Error())
+		return
+	}
+
+	response.Success(c, result)
+}
+
+// Cancel 取消生成任务
+// @Summary 取消生成任务
+// @Description 取消排队中或运行中的任务
+// @Tags job
+// @Produce json
+// @Param id path int true "任务 ID"
+// @Success 200 {object} response.Response
+// @Router /api/image/jobs/{id} [delete]
+func (h *Handler) Cancel(c *gin.Context) {
+	id, ok := parseID(c)
+	if !ok {
+		return
+	}
+
+	err := h.jobService.CancelJob(c.Request.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, job.ErrJobNotFound):
+			response.ErrorWithStatus(c, http.StatusNotFound, 404, err.Error())
+		case errors.Is(err, job.ErrJobFinished):
+			response.ErrorWithStatus(c, http.StatusConflict, 409, "取消生成任务失败: "+err.Error())
+		default:
+			response.Error(c, 500, "取消生成任务失败: "+err.Error())
+		}
+		return
+	}
+
+	response.Success(c, nil)
+}
+
+// parseID 解析路径中的任务 ID，失败时写入错误响应
+func parseID(c *gin.Context) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		response.ErrorWithStatus(c, http.StatusBadRequest, 400, "任务 ID 格式错误")
+		return 0, false
+	}
+	return id, true
+}
@@ -0,0 +1,80 @@
+package storageop
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/guixu633/agent/backend/internal/model"
+	"github.com/guixu633/agent/backend/internal/service/storageop"
+	"github.com/guixu633/agent/backend/pkg/response"
+)
+
+// Handler 待执行存储操作管理处理器
+type Handler struct {
+	storageOpService *storageop.Service
+}
+
+// NewHandler 创建待执行存储操作管理处理器实例
+func NewHandler(storageOpService *storageop.Service) *Handler {
+	return &Handler{
+		storageOpService: storageOpService,
+	}
+}
+
+// List 列出待执行存储操作
+// @Summary 列出待执行存储操作
+// @Description 查看等待执行、重试中以及多次失败后放弃的存储操作（如删除图片文件）
+// @Tags admin
+// @Produce json
+// @Param status query string false "按状态过滤: pending | failed"
+// @Param limit query int false "返回数量上限，默认 100，最大 1000"
+// @Success 200 {object} response.Response{data=model.ListStorageOpsResponse}
+// @Router /api/admin/storage-ops [get]
+func (h *Handler) List(c *gin.Context) {
+	var req model.ListStorageOpsRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		response.ErrorWithStatus(c, http.StatusBadRequest, 400, "请求参数错误: "+err.Error())
+		return
+	}
+
+	result, err := h.storageOpService.ListOps(c.Request.Context(), &req)
+	if err != nil {
+		if errors.Is(err, storageop.ErrInvalidStatus) {
+			response.ErrorWithStatus(c, http.StatusBadRequest, 400, "请求参数错误: "+err.Error())
+			return
+		}
+		response.Error(c, 500, "获取存储操作失败: "+err.Error())
+		return
+	}
+
+	response.Success(c, result)
+}
+
+// Retry 重新执行失败的存储操作
+// @Summary 重新执行失败的存储操作
+// @Description 将超过最大重试次数的操作重新排队，后台任务下次轮询时执行
+// @Tags admin
+// @Produce json
+// @Param id path int true "操作 ID"
+// @Success 200 {object} response.Response
+// @Router /api/admin/storage-ops/{id}/retry [post]
+func (h *Handler) Retry(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		response.ErrorWithStatus(c, http.StatusBadRequest, 400, "操作 ID 格式错误")
+		return
+	}
+
+	if err := h.storageOpService.RetryOp(c.Request.Context(), id); err != nil {
+		if errors.Is(err, storageop.ErrStorageOpNotFound) {
+			response.ErrorWithStatus(c, http.StatusNotFound, 404, err.Error())
+			return
+		}
+		response.Error(c, 500, "重新执行存储操作失败: "+err.Error())
+		return
+	}
+
+	response.Success(c, nil)
+}
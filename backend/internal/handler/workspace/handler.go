@@ -1,6 +1,7 @@
 package workspace
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -70,7 +71,7 @@ func (h *Handler) Create(c *gin.Context) {
 // @Accept json
 // @Produce json
 // @Param request body model.DeleteWorkspaceRequest true "删除工作区请求"
-// @Success 200 {object} response.Response
+// @Success 200 {object} response.Response{data=model.DeleteWorkspaceResponse}
 // @Router /api/workspace [delete]
 func (h *Handler) Delete(c *gin.Context) {
 	var req model.DeleteWorkspaceRequest
@@ -79,13 +80,18 @@ func (h *Handler) Delete(c *gin.Context) {
 		return
 	}
 
-	err := h.workspaceService.DeleteWorkspace(c.Request.Context(), &req)
+	result, err := h.workspaceService.DeleteWorkspace(c.Request.Context(), &req)
 	if err != nil {
+		if result != nil {
+			// 附带已删除和删除失败的文件数
+			response.ErrorWithData(c, http.StatusInternalServerError, 500, "删除工作区失败: "+err.Error(), result)
+			return
+		}
 		response.Error(c, 500, "删除工作区失败: "+err.Error())
 		return
 	}
 
-	response.Success(c, nil)
+	response.Success(c, result)
 }
 
 // SetCurrent 设置当前工作区
@@ -130,3 +136,32 @@ func (h *Handler) GetCurrent(c *gin.Context) {
 	response.Success(c, result)
 }
 
+// Usage 查询工作区用量
+// @Summary 查询工作区用量
+// @Description 按天和模型汇总工作区的模型调用次数、token 用量、输出图片数量和估算成本
+// @Tags workspace
+// @Produce json
+// @Param workspace query string true "工作区名称"
+// @Param from query string false "开始日期（含），格式 YYYY-MM-DD，默认 29 天前"
+// @Param to query string false "结束日期（含），格式 YYYY-MM-DD，默认今天"
+// @Success 200 {object} response.Response{data=model.WorkspaceUsageResponse}
+// @Router /api/workspace/usage [get]
+func (h *Handler) Usage(c *gin.Context) {
+	var req model.WorkspaceUsageRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		response.ErrorWithStatus(c, http.StatusBadRequest, 400, "请求参数错误: "+err.Error())
+		return
+	}
+
+	result, err := h.workspaceService.GetUsage(c.Request.Context(), &req)
+	if err != nil {
+		if errors.Is(err, workspace.ErrInvalidUsageRange) {
+			response.ErrorWithStatus(c, http.StatusBadRequest, 400, "请求参数错误: "+err.Error())
+			return
+		}
+		response.Error(c, 500, "查询工作区用量失败: "+err.Error())
+		return
+	}
+
+	response.Success(c, result)
+}
@@ -0,0 +1,54 @@
+package model
+
+// Budget 工作区在某个周期、某个指标上的预算及当前用量
+type Budget struct {
+	Period      string  `json:"period"`       // 统计周期: daily | monthly
+	Metric      string  `json:"metric"`       // 限制的指标: runs | tokens | cost
+	Limit       float64 `json:"limit"`        // 硬限制，周期内用量达到该值后拒绝生成
+	WarnRatio   float64 `json:"warn_ratio"`   // 软限制比例，用量达到 limit * warn_ratio 时提醒
+	Used        float64 `json:"used"`         // 当前周期的用量
+	PeriodStart string  `json:"period_start"` // 当前周期的开始日期 YYYY-MM-DD
+	UpdatedAt   string  `json:"updated_at"`   // 最后修改时间
+}
+
+// ListBudgetsRequest 列出工作区预算请求
+type ListBudgetsRequest struct {
+	Workspace string `form:"workspace" binding:"required"` // 工作区名称
+}
+
+// ListBudgetsResponse 列出工作区预算响应
+type ListBudgetsResponse struct {
+	Workspace string   `json:"workspace"`
+	Budgets   []Budget `json:"budgets"`
+}
+
+// SetBudgetRequest 设置工作区预算请求（同一周期、指标已有预算时覆盖）
+type SetBudgetRequest struct {
+	Workspace string   `json:"workspace" binding:"required"` // 工作区名称
+	Period    string   `json:"period" binding:"required"`    // 统计周期: daily | monthly
+	Metric    string   `json:"metric" binding:"required"`    // 限制的指标: runs（成功生成次数）| tokens（总 token 数）| cost（估算成本，美元）
+	Limit     float64  `json:"limit"`                        // 硬限制，必须大于 0
+	WarnRatio *float64 `json:"warn_ratio,omitempty"`         // 软限制比例，取值 (0, 1]，默认 0.8
+}
+
+// SetBudgetResponse 设置工作区预算响应
+type SetBudgetResponse struct {
+	Budget Budget `json:"budget"`
+}
+
+// DeleteBudgetRequest 删除工作区预算请求
+type DeleteBudgetRequest struct {
+	Workspace string `json:"workspace" binding:"required"` // 工作区名称
+	Period    string `json:"period" binding:"required"`    // 统计周期
+	Metric    string `json:"metric" binding:"required"`    // 限制的指标
+}
+
+// BudgetWarning 预算提醒：用量达到软限制，或预算已用尽时的详细信息
+type BudgetWarning struct {
+	Period  string  `json:"period"`  // 统计周期
+	Metric  string  `json:"metric"`  // 限制的指标
+	Limit   float64 `json:"limit"`   // 硬限制
+	Used    float64 `json:"used"`    // 当前周期的用量（含本次生成）
+	Ratio   float64 `json:"ratio"`   // 用量占硬限制的比例
+	Message string  `json:"message"` // 提醒内容
+}
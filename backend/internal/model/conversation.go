@@ -0,0 +1,55 @@
+package model
+
+// ConversationInfo 对话会话信息
+type ConversationInfo struct {
+	ID        int64  `json:"id"`         // 会话 ID
+	Title     string `json:"title"`      // 标题（取自第一轮提示词）
+	Model     string `json:"model"`      // 会话使用的模型
+	TurnCount int    `json:"turn_count"` // 轮次数量（用户和模型各算一轮）
+	CreatedAt string `json:"created_at"` // 创建时间
+	UpdatedAt string `json:"updated_at"` // 最后更新时间
+}
+
+// ConversationPart 对话轮次中的一个片段
+type ConversationPart struct {
+	Type     string `json:"type"`               // 类型: "text" | "image"
+	Text     string `json:"text,omitempty"`     // 文本内容 (Type="text" 时有效)
+	Path     string `json:"path,omitempty"`     // OSS 中的图片路径 (Type="image" 时有效)
+	URL      string `json:"url,omitempty"`      // 图片访问 URL (Type="image" 时有效)
+	MimeType string `json:"mimeType,omitempty"` // 图片 MIME 类型 (Type="image" 时有效)
+}
+
+// ConversationTurn 对话中的一轮
+type ConversationTurn struct {
+	Index     int                `json:"index"`      // 轮次序号，从 0 开始
+	Role      string             `json:"role"`       // 角色: "user" | "model"
+	Parts     []ConversationPart `json:"parts"`      // 有序的内容片段
+	CreatedAt string             `json:"created_at"` // 创建时间
+}
+
+// ListConversationsRequest 列出对话请求
+type ListConversationsRequest struct {
+	Workspace string `form:"workspace" binding:"required"` // 工作区名称
+}
+
+// ListConversationsResponse 列出对话响应
+type ListConversationsResponse struct {
+	Conversations []ConversationInfo `json:"conversations"` // 会话列表（最近更新的在前）
+}
+
+// GetConversationResponse 获取对话详情响应
+type GetConversationResponse struct {
+	Conversation ConversationInfo   `json:"conversation"` // 会话信息
+	Turns        []ConversationTurn `json:"turns"`        // 全部轮次（按时间顺序）
+}
+
+// ContinueConversationRequest 继续对话请求
+type ContinueConversationRequest struct {
+	Prompt          string   `json:"prompt" binding:"required"`
+	Images          []string `json:"images"`                      // 本轮新增的参考图片（OSS 路径）
+	Model           string   `json:"model,omitempty"`             // 模型名称（可选，默认沿用会话的模型）
+	EnableWebSearch *bool    `json:"enable_web_search,omitempty"` // 是否启用联网搜索（可选）
+
+	// 生成参数（可选，与其他字段平铺在同一层级）
+	GenerationParams
+}
@@ -16,8 +16,28 @@ type Message struct {
 	URL     string      `json:"url,omitempty"`     // 图片 URL (type="image" 时有效)
 }
 
+// GenerationParams 生成参数（均为可选，未指定时使用模型的默认配置）
+type GenerationParams struct {
+	AspectRatio        string   `json:"aspect_ratio,omitempty"`        // 输出图片宽高比，如 "16:9"
+	ImageSize          string   `json:"image_size,omitempty"`          // 输出图片分辨率，如 "2K"
+	CandidateCount     int      `json:"candidate_count,omitempty"`     // 候选结果数量
+	Temperature        *float32 `json:"temperature,omitempty"`         // 采样温度 (0-2)
+	Seed               *int32   `json:"seed,omitempty"`                // 随机种子
+	ResponseModalities []string `json:"response_modalities,omitempty"` // 响应模态: "TEXT" | "IMAGE"
+}
+
 // ImageGenerateResponse 图片生成响应
 type ImageGenerateResponse struct {
+	Parts          []GeneratePart      `json:"parts"`                     // 有序的内容片段（第一个候选结果）
+	Candidates     []GenerateCandidate `json:"candidates"`                // 全部候选结果
+	RunID          int64               `json:"run_id,omitempty"`          // 模型调用审计记录 ID
+	ConversationID int64               `json:"conversation_id,omitempty"` // 本轮所属的对话 ID（用于继续对话）
+	Warnings       []BudgetWarning     `json:"warnings,omitempty"`        // 用量达到预算软限制时的提醒
+}
+
+// GenerateCandidate 一个候选结果
+type GenerateCandidate struct {
+	Index int            `json:"index"` // 候选序号，从 0 开始
 	Parts []GeneratePart `json:"parts"` // 有序的内容片段
 }
 
@@ -30,10 +50,39 @@ type GeneratePart struct {
 
 // GeneratedImage 生成的图片信息
 type GeneratedImage struct {
-	Data     string `json:"data,omitempty"` // Base64 编码的图片数据（可选，用于兼容）
-	MimeType string `json:"mimeType"`       // 图片 MIME 类型
-	Path     string `json:"path,omitempty"` // OSS 中的图片路径
-	URL      string `json:"url,omitempty"`  // 图片访问 URL
+	Data         string `json:"data,omitempty"`          // Base64 编码的图片数据（可选，用于兼容）
+	MimeType     string `json:"mimeType"`                // 图片 MIME 类型
+	Path         string `json:"path,omitempty"`          // OSS 中的图片路径
+	URL          string `json:"url,omitempty"`           // 图片访问 URL
+	ThumbnailURL string `json:"thumbnail_url,omitempty"` // 缩略图访问 URL
+}
+
+// 流式生成事件类型
+const (
+	StreamEventText  = "text"  // 文本增量
+	StreamEventImage = "image" // 图片已保存
+	StreamEventDone  = "done"  // 生成完成，携带汇总结果
+	StreamEventError = "error" // 生成失败
+)
+
+// GenerateStreamEvent 流式生成事件（通过 SSE 推送，事件名与 Type 相同）
+type GenerateStreamEvent struct {
+	Type      string                 `json:"type"`              // 事件类型: "text" | "image" | "done" | "error"
+	Candidate int                    `json:"candidate"`         // 片段所属的候选序号 (Type="text"|"image" 时有效)
+	Index     int                    `json:"index"`             // 片段在候选结果中的位置索引 (Type="text"|"image" 时有效)
+	Text      string                 `json:"text,omitempty"`    // 文本增量 (Type="text" 时有效)
+	Image     *GeneratedImage        `json:"image,omitempty"`   // 已保存的图片信息 (Type="image" 时有效)
+	Result    *ImageGenerateResponse `json:"result,omitempty"`  // 汇总结果 (Type="done" 时有效)
+	Error     string                 `json:"error,omitempty"`   // 错误信息 (Type="error" 时有效)
+	Code      int                    `json:"code,omitempty"`    // 业务错误码 (Type="error" 且模型拒绝生成或上游调用失败时有效)
+	Failure   *GenerateFailure       `json:"failure,omitempty"` // 模型拒绝生成的原因 (Type="error" 时可选)
+}
+
+// GenerateFailure 模型拒绝生成的原因（安全拦截、引用拦截、超出最大 token 数）
+type GenerateFailure struct {
+	Reason   string `json:"reason"`             // 模型返回的拦截原因或结束原因，如 "SAFETY"、"RECITATION"
+	Category string `json:"category,omitempty"` // 触发拦截的危害类别，如 "HARM_CATEGORY_DANGEROUS_CONTENT"
+	Message  string `json:"message,omitempty"`  // 模型返回的原因说明
 }
 
 // ImageUploadRequest 图片上传请求
@@ -43,22 +92,44 @@ type ImageUploadRequest struct {
 
 // ImageUploadResponse 图片上传响应
 type ImageUploadResponse struct {
-	Path string `json:"path"` // OSS 中的图片路径
-	URL  string `json:"url"`  // 图片访问 URL
+	ID           int64  `json:"id"`                     // 图片 ID
+	Name         string `json:"name"`                   // 图片文件名（同名冲突时可能自动添加了序号）
+	Path         string `json:"path"`                   // OSS 中的图片路径
+	URL          string `json:"url"`                    // 图片访问 URL
+	Deduplicated bool   `json:"deduplicated,omitempty"` // 工作区中已有相同内容的图片，复用了已有文件
+	Replaced     bool   `json:"replaced,omitempty"`     // 替换了已有同名图片的内容
 }
 
 // ImageGenerateRequest 图片生成请求
 type ImageGenerateRequest struct {
 	Prompt          string    `json:"prompt" binding:"required"`
-	Images          []string  `json:"images"`             // OSS 中的图片路径列表
-	Workspace       string    `json:"workspace"`          // 工作区名称（可选，用于生成图片存储）
-	Messages        []Message `json:"messages,omitempty"` // 完整的对话历史 (可选，用于记录)
-	EnableWebSearch bool      `json:"enable_web_search"`  // 是否启用联网搜索（默认 false）
+	Images          []string  `json:"images"`                      // OSS 中的图片路径列表
+	Workspace       string    `json:"workspace"`                   // 工作区名称（可选，用于生成图片存储）
+	Messages        []Message `json:"messages,omitempty"`          // 之前的对话历史 (可选，未指定 conversation_id 时作为文本历史发送给模型)
+	ConversationID  int64     `json:"conversation_id,omitempty"`   // 继续的对话 ID（可选，为空时创建新对话）
+	Model           string    `json:"model,omitempty"`             // 模型名称（可选，默认使用服务端配置的默认模型）
+	EnableWebSearch *bool     `json:"enable_web_search,omitempty"` // 是否启用联网搜索（可选，默认使用模型的默认配置）
+
+	// 生成参数（可选，与其他字段平铺在同一层级）
+	GenerationParams
 }
 
 // ListWorkspaceImagesRequest 列出工作区图片请求
 type ListWorkspaceImagesRequest struct {
 	Workspace string `form:"workspace" binding:"required"` // 工作区名称
+	Cursor    string `form:"cursor"`                       // 分页游标（上一页响应中的 next_cursor，为空时从第一页开始）
+	Limit     int    `form:"limit"`                        // 每页数量，默认 50，最大 200
+	Sort      string `form:"sort"`                         // 排序字段: created（默认）| updated | name | size
+	Order     string `form:"order"`                        // 排序方向: desc（默认）| asc
+
+	// 过滤条件（可选）
+	SourceType    string   `form:"source_type"`    // 来源类型: upload | generate
+	MimeType      string   `form:"mime_type"`      // MIME 类型，如 image/png
+	CreatedAfter  string   `form:"created_after"`  // 创建时间下限（包含），RFC 3339 格式或 YYYY-MM-DD（北京时间）
+	CreatedBefore string   `form:"created_before"` // 创建时间上限（不包含），格式同上
+	MinSize       int64    `form:"min_size"`       // 文件大小下限（包含，字节）
+	MaxSize       int64    `form:"max_size"`       // 文件大小上限（包含，字节）
+	Tags          []string `form:"tag"`            // 标签（可重复指定，需要包含所有标签）
 }
 
 // ImageInfo 图片信息
@@ -71,24 +142,94 @@ type ImageInfo struct {
 	Size         int64     `json:"size"`                   // 文件大小（字节）
 	Updated      string    `json:"updated"`                // 最后更新时间（ISO 8601 格式）
 	SourceType   string    `json:"source_type"`            // 来源类型: "upload" | "generate"
+	Tags         []string  `json:"tags,omitempty"`         // 标签（按名称排序）
 	Prompt       string    `json:"prompt,omitempty"`       // 生成时的提示词
 	RefImages    []string  `json:"ref_images,omitempty"`   // 生成时的引用图片
 	MessageList  []Message `json:"message_list,omitempty"` // 生成时的对话历史
+
+	Model            string            `json:"model,omitempty"`             // 生成时使用的模型
+	GenerationParams *GenerationParams `json:"generation_params,omitempty"` // 生成时使用的参数
+	CandidateIndex   int               `json:"candidate_index,omitempty"`   // 所属的候选序号
+	GenerationRunID  int64             `json:"generation_run_id,omitempty"` // 模型调用审计记录 ID
 }
 
 // ListWorkspaceImagesResponse 列出工作区图片响应
 type ListWorkspaceImagesResponse struct {
-	Images []ImageInfo `json:"images"` // 图片列表
+	Images     []ImageInfo `json:"images"`                // 图片列表
+	NextCursor string      `json:"next_cursor,omitempty"` // 下一页游标（没有更多图片时为空）
+}
+
+// SearchImagesRequest 全文搜索图片请求
+type SearchImagesRequest struct {
+	Workspace string `form:"workspace" binding:"required"` // 工作区名称
+	Query     string `form:"q" binding:"required"`         // 搜索词（匹配文件名、提示词和对话文本）
+	Limit     int    `form:"limit"`                        // 每页数量，默认 20，最大 100
+	Offset    int    `form:"offset"`                       // 跳过的结果数量
+}
+
+// SearchHighlight 搜索结果中匹配的片段
+type SearchHighlight struct {
+	Field   string `json:"field"`   // 匹配的字段: "name" | "prompt" | "message"
+	Snippet string `json:"snippet"` // 包含匹配内容的片段，匹配部分用 <mark></mark> 标记，其余内容已做 HTML 转义
+}
+
+// ImageSearchResult 图片搜索结果
+type ImageSearchResult struct {
+	ImageInfo
+	Score      float64           `json:"score"`      // 相关度，越大越相关
+	Highlights []SearchHighlight `json:"highlights"` // 匹配的片段
+}
+
+// SearchImagesResponse 全文搜索图片响应
+type SearchImagesResponse struct {
+	Results []ImageSearchResult `json:"results"`  // 按相关度排序的搜索结果
+	HasMore bool                `json:"has_more"` // 是否还有更多结果
+}
+
+// TagImagesRequest 为图片添加或移除标签请求
+type TagImagesRequest struct {
+	Workspace string   `json:"workspace" binding:"required"`       // 工作区名称
+	ImageIDs  []int64  `json:"image_ids" binding:"required,min=1"` // 图片 ID 列表（需要都属于该工作区）
+	Tags      []string `json:"tags" binding:"required,min=1"`      // 标签名称列表
+}
+
+// ImageTags 图片及其标签
+type ImageTags struct {
+	ID   int64    `json:"id"`   // 图片 ID
+	Tags []string `json:"tags"` // 修改后的标签（按名称排序）
+}
+
+// TagImagesResponse 为图片添加或移除标签响应
+type TagImagesResponse struct {
+	Images []ImageTags `json:"images"` // 各图片修改后的标签
+}
+
+// ListTagsRequest 列出工作区标签请求
+type ListTagsRequest struct {
+	Workspace string `form:"workspace" binding:"required"` // 工作区名称
+}
+
+// TagInfo 标签信息
+type TagInfo struct {
+	Name  string `json:"name"`  // 标签名称
+	Count int64  `json:"count"` // 使用该标签的图片数量
+}
+
+// ListTagsResponse 列出工作区标签响应
+type ListTagsResponse struct {
+	Tags []TagInfo `json:"tags"` // 正在使用的标签，按图片数量倒序排列
 }
 
 // DeleteImageRequest 删除图片请求
 type DeleteImageRequest struct {
 	Path string `json:"path" binding:"required"` // OSS 中的图片路径
+	ID   int64  `json:"id,omitempty"`            // 图片 ID（可选，内容相同的图片共享路径，指定 ID 时只删除该记录）
 }
 
 // RenameImageRequest 重命名图片请求
 type RenameImageRequest struct {
 	Path      string `json:"path" binding:"required"`      // OSS 中的图片路径
+	ID        int64  `json:"id,omitempty"`                 // 图片 ID（可选，内容相同的图片共享路径，指定 ID 时只重命名该记录）
 	NewName   string `json:"new_name" binding:"required"`  // 新文件名
 	Workspace string `json:"workspace" binding:"required"` // 工作区名称
 }
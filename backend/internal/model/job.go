@@ -0,0 +1,24 @@
+package model
+
+// GenerationJob 异步生成任务
+type GenerationJob struct {
+	ID         int64          `json:"id"`                    // 任务 ID
+	Status     string         `json:"status"`                // 任务状态: "queued" | "running" | "succeeded" | "failed" | "cancelled"
+	Model      string         `json:"model"`                 // 使用的模型
+	Prompt     string         `json:"prompt"`                // 提示词
+	Parts      []GeneratePart `json:"parts,omitempty"`       // 生成结果 (Status="succeeded" 时有效)
+	Error      string         `json:"error,omitempty"`       // 错误信息 (Status="failed" 时有效)
+	CreatedAt  string         `json:"created_at"`            // 提交时间
+	StartedAt  string         `json:"started_at,omitempty"`  // 开始运行时间
+	FinishedAt string         `json:"finished_at,omitempty"` // 结束时间
+}
+
+// CreateJobResponse 提交生成任务响应
+type CreateJobResponse struct {
+	Job GenerationJob `json:"job"`
+}
+
+// GetJobResponse 获取生成任务响应
+type GetJobResponse struct {
+	Job GenerationJob `json:"job"`
+}
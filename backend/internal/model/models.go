@@ -0,0 +1,49 @@
+package model
+
+// ModelCapabilities 模型能力
+type ModelCapabilities struct {
+	ImageOutput        bool     `json:"image_output"`         // 是否支持输出图片
+	WebSearch          bool     `json:"web_search"`           // 是否支持联网搜索
+	MaxReferenceImages int      `json:"max_reference_images"` // 最多参考图片数量（0 表示不限制）
+	AspectRatios       []string `json:"aspect_ratios"`        // 支持的宽高比（为空表示不支持指定）
+	ImageSizes         []string `json:"image_sizes"`          // 支持的输出分辨率（为空表示不支持指定）
+	MaxCandidates      int      `json:"max_candidates"`       // 最多候选结果数量
+}
+
+// ModelDefaults 模型默认参数
+type ModelDefaults struct {
+	EnableWebSearch bool `json:"enable_web_search"` // 默认是否启用联网搜索
+}
+
+// ModelInfo 模型信息
+type ModelInfo struct {
+	Name         string            `json:"name"`         // 模型名称
+	DisplayName  string            `json:"display_name"` // 展示名称
+	Provider     string            `json:"provider"`     // 模型供应商
+	Capabilities ModelCapabilities `json:"capabilities"` // 模型能力
+	Defaults     ModelDefaults     `json:"defaults"`     // 默认参数
+}
+
+// ListModelsResponse 列出可用模型响应
+type ListModelsResponse struct {
+	Default string      `json:"default"` // 默认模型名称
+	Models  []ModelInfo `json:"models"`  // 可用模型列表
+}
+
+// ProviderStats 模型供应商的调用计数（进程启动以来的累计值）
+type ProviderStats struct {
+	Provider     string `json:"provider"`      // 模型供应商
+	Calls        int64  `json:"calls"`         // 请求次数（不含重试）
+	Attempts     int64  `json:"attempts"`      // 实际调用上游的次数（含重试）
+	Successes    int64  `json:"successes"`     // 成功的请求次数
+	Failures     int64  `json:"failures"`      // 重试后仍失败的请求次数
+	Retries      int64  `json:"retries"`       // 重试次数
+	Timeouts     int64  `json:"timeouts"`      // 单次调用超时次数
+	Rejected     int64  `json:"rejected"`      // 熔断期间被拒绝的请求次数
+	BreakerState string `json:"breaker_state"` // 熔断器状态: "closed" | "open" | "half_open"
+}
+
+// ProviderStatsResponse 模型供应商调用计数响应
+type ProviderStatsResponse struct {
+	Providers []ProviderStats `json:"providers"` // 按供应商名称排序
+}
@@ -0,0 +1,40 @@
+package model
+
+import "encoding/json"
+
+// TokenUsage token 用量
+type TokenUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`     // 输入 token 数
+	CandidatesTokens int `json:"candidates_tokens"` // 输出 token 数
+	ThoughtsTokens   int `json:"thoughts_tokens"`   // 思考过程 token 数
+	TotalTokens      int `json:"total_tokens"`      // 总 token 数
+}
+
+// GenerationRun 一次模型调用的审计记录
+type GenerationRun struct {
+	ID                int64           `json:"id"`                        // 记录 ID
+	Model             string          `json:"model"`                     // 使用的模型
+	Status            string          `json:"status"`                    // 调用状态: "pending"（进行中） | "succeeded" | "failed"
+	Config            json.RawMessage `json:"config"`                    // 实际发送的生成配置
+	Prompt            string          `json:"prompt"`                    // 提示词
+	RefImages         []string        `json:"ref_images"`                // 参考图片（OSS 路径）
+	HistoryTurns      int             `json:"history_turns"`             // 发送的历史轮次数量
+	Response          json.RawMessage `json:"response"`                  // 响应摘要（各候选结果的文本和图片占位）
+	FinishReasons     json.RawMessage `json:"finish_reasons"`            // 各候选结果的结束原因
+	SafetyRatings     json.RawMessage `json:"safety_ratings"`            // 各候选结果的安全评级
+	PromptFeedback    json.RawMessage `json:"prompt_feedback,omitempty"` // 输入反馈（输入被拦截时有效）
+	GroundingMetadata json.RawMessage `json:"grounding_metadata"`        // 各候选结果的联网搜索引用信息
+	ModelVersion      string          `json:"model_version,omitempty"`   // 实际响应的模型版本
+	Usage             TokenUsage      `json:"usage"`                     // token 用量
+	ImageCount        int             `json:"image_count"`               // 输出图片数量
+	Cost              float64         `json:"cost"`                      // 估算成本（美元，按调用时的价格表计算）
+	LatencyMs         int64           `json:"latency_ms"`                // 调用耗时（毫秒）
+	Error             string          `json:"error,omitempty"`           // 错误信息 (Status="failed" 时有效)
+	Images            []ImageInfo     `json:"images"`                    // 本次调用生成并保存的图片
+	CreatedAt         string          `json:"created_at"`                // 记录时间
+}
+
+// GetGenerationRunResponse 获取模型调用审计记录响应
+type GetGenerationRunResponse struct {
+	Run GenerationRun `json:"run"`
+}
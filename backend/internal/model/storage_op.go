@@ -0,0 +1,26 @@
+package model
+
+// StorageOp 待执行的存储操作
+type StorageOp struct {
+	ID            int64  `json:"id"`                   // 操作 ID
+	Op            string `json:"op"`                   // 操作类型: "delete"
+	ObjectKey     string `json:"object_key"`           // 对象路径
+	Status        string `json:"status"`               // 状态: "pending" | "failed"
+	Attempts      int    `json:"attempts"`             // 已尝试次数
+	LastError     string `json:"last_error,omitempty"` // 最近一次失败的原因
+	NextAttemptAt string `json:"next_attempt_at"`      // 下次尝试时间 (Status="pending" 时有效)
+	CreatedAt     string `json:"created_at"`           // 登记时间
+}
+
+// ListStorageOpsRequest 列出存储操作请求
+type ListStorageOpsRequest struct {
+	Status string `form:"status"` // 按状态过滤: "pending" | "failed"，为空时列出所有状态
+	Limit  int    `form:"limit"`  // 返回数量上限，默认 100，最大 1000
+}
+
+// ListStorageOpsResponse 列出存储操作响应
+type ListStorageOpsResponse struct {
+	Pending int64       `json:"pending"` // 等待执行或重试的操作数
+	Failed  int64       `json:"failed"`  // 超过最大重试次数的操作数
+	Items   []StorageOp `json:"items"`
+}
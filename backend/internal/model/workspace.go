@@ -2,9 +2,9 @@ package model
 
 // Workspace 工作区
 type Workspace struct {
-	Name      string `json:"name"`        // 工作区名称
-	IsCurrent bool   `json:"is_current"`  // 是否为当前工作区
-	CreatedAt string `json:"created_at"`  // 创建时间（可选）
+	Name      string `json:"name"`       // 工作区名称
+	IsCurrent bool   `json:"is_current"` // 是否为当前工作区
+	CreatedAt string `json:"created_at"` // 创建时间（可选）
 }
 
 // ListWorkspacesResponse 列出工作区响应
@@ -27,6 +27,13 @@ type DeleteWorkspaceRequest struct {
 	Name string `json:"name" binding:"required"` // 工作区名称
 }
 
+// DeleteWorkspaceResponse 删除工作区响应（存储中文件的删除结果）
+type DeleteWorkspaceResponse struct {
+	DeletedObjects int      `json:"deleted_objects"`       // 删除的文件数
+	FailedObjects  int      `json:"failed_objects"`        // 删除失败的文件数
+	FailedKeys     []string `json:"failed_keys,omitempty"` // 删除失败的文件路径
+}
+
 // SetCurrentWorkspaceRequest 设置当前工作区请求
 type SetCurrentWorkspaceRequest struct {
 	Name string `json:"name" binding:"required"` // 工作区名称
@@ -41,3 +48,39 @@ type SetCurrentWorkspaceResponse struct {
 type GetCurrentWorkspaceResponse struct {
 	Workspace *Workspace `json:"workspace"` // 如果为 nil 表示没有当前工作区
 }
+
+// WorkspaceUsageRequest 查询工作区用量请求
+type WorkspaceUsageRequest struct {
+	Workspace string `form:"workspace" binding:"required"` // 工作区名称
+	From      string `form:"from"`                         // 开始日期（含），格式 YYYY-MM-DD，默认 29 天前
+	To        string `form:"to"`                           // 结束日期（含），格式 YYYY-MM-DD，默认今天
+}
+
+// UsageSummary 用量汇总
+type UsageSummary struct {
+	Runs             int64   `json:"runs"`              // 模型调用次数
+	FailedRuns       int64   `json:"failed_runs"`       // 失败的调用次数
+	PromptTokens     int64   `json:"prompt_tokens"`     // 输入 token 数
+	CandidatesTokens int64   `json:"candidates_tokens"` // 输出 token 数
+	ThoughtsTokens   int64   `json:"thoughts_tokens"`   // 思考过程 token 数
+	TotalTokens      int64   `json:"total_tokens"`      // 总 token 数
+	ImageCount       int64   `json:"image_count"`       // 输出图片数量
+	Cost             float64 `json:"cost"`              // 估算成本（美元）
+}
+
+// UsageItem 某天使用某个模型的用量
+type UsageItem struct {
+	Date  string `json:"date"`  // 日期 YYYY-MM-DD
+	Model string `json:"model"` // 模型名称
+	UsageSummary
+}
+
+// WorkspaceUsageResponse 工作区用量响应
+type WorkspaceUsageResponse struct {
+	Workspace string       `json:"workspace"` // 工作区名称
+	From      string       `json:"from"`      // 开始日期（含）
+	To        string       `json:"to"`        // 结束日期（含）
+	Currency  string       `json:"currency"`  // 成本的货币单位
+	Items     []UsageItem  `json:"items"`     // 按日期、模型排列的用量
+	Total     UsageSummary `json:"total"`     // 日期范围内的总用量
+}
@@ -1,14 +1,18 @@
 package oss
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"net/http"
 	"os"
-	"strings"
+	"strconv"
 	"time"
 
 	"github.com/aliyun/aliyun-oss-go-sdk/oss"
+	"github.com/guixu633/agent/backend/internal/storage"
 )
 
 // Config OSS 配置
@@ -20,11 +24,11 @@ type Config struct {
 	ImagePrefix     string `json:"image_prefix"` // 图片存储前缀，如 "image/"
 }
 
-// Client OSS 客户端
+// Client OSS 客户端，实现 storage.BlobStore
 type Client struct {
-	bucket   *oss.Bucket
-	config   *Config
-	baseURL  string // OSS 基础 URL，用于生成访问链接
+	bucket  *oss.Bucket
+	config  *Config
+	baseURL string // OSS 基础 URL，用于生成访问链接
 }
 
 // NewClient 创建 OSS 客户端
@@ -123,259 +127,196 @@ func createClientFromConfig(config *Config) (*Client, error) {
 	}, nil
 }
 
-// UploadImage 上传图片到 OSS
-// file: 要上传的文件
-// filename: 文件名（可选，如果不提供则使用原始文件名）
-// workspace: 工作区名称
-// 返回: OSS 中的路径（相对于 bucket 根目录）
-func (c *Client) UploadImage(file io.Reader, filename string, workspace string) (string, error) {
-	// 如果没有提供文件名，生成一个基于时间戳的文件名
-	if filename == "" {
-		filename = fmt.Sprintf("%d%s", time.Now().UnixNano(), ".jpg")
-	}
-
-	// 构建路径: image/workspace/filename
-	prefix := strings.TrimSuffix(c.config.ImagePrefix, "/")
-	if prefix == "" {
-		prefix = "image"
-	}
-	objectKey := fmt.Sprintf("%s/%s/%s", prefix, workspace, filename)
-	// 确保路径使用正斜杠
-	objectKey = strings.ReplaceAll(objectKey, "\\", "/")
-
-	// 上传文件
-	err := c.bucket.PutObject(objectKey, file)
-	if err != nil {
-		return "", fmt.Errorf("上传文件到 OSS 失败: %w", err)
+// Put 上传对象
+func (c *Client) Put(ctx context.Context, key string, r io.Reader) error {
+	if err := c.bucket.PutObject(key, r, oss.WithContext(ctx)); err != nil {
+		return fmt.Errorf("上传文件到 OSS 失败: %w", err)
 	}
-
-	return objectKey, nil
+	return nil
 }
 
-// UploadFile 上传文件到 OSS 指定路径
-// path: OSS 中的完整路径
-func (c *Client) UploadFile(reader io.Reader, path string) error {
-	err := c.bucket.PutObject(path, reader)
-	if err != nil {
+// PutIfAbsent 仅在对象不存在时上传（禁止覆盖同名对象）
+func (c *Client) PutIfAbsent(ctx context.Context, key string, r io.Reader) error {
+	if err := c.bucket.PutObject(key, r, oss.ForbidOverWrite(true), oss.WithContext(ctx)); err != nil {
+		if isAlreadyExists(err) {
+			return fmt.Errorf("%w: %s", storage.ErrExists, key)
+		}
 		return fmt.Errorf("上传文件到 OSS 失败: %w", err)
 	}
 	return nil
 }
 
-// ListWorkspaces 列出所有工作区（查看 /image 下的目录）
-func (c *Client) ListWorkspaces() ([]string, error) {
-	prefix := strings.TrimSuffix(c.config.ImagePrefix, "/")
-	if prefix == "" {
-		prefix = "image"
-	}
-	searchPrefix := prefix + "/"
-
-	// 列出所有对象，使用分隔符 "/" 来获取目录
-	lsRes, err := c.bucket.ListObjects(oss.Prefix(searchPrefix), oss.Delimiter("/"))
+// Get 下载对象
+func (c *Client) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	body, err := c.bucket.GetObject(key, oss.WithContext(ctx))
 	if err != nil {
-		return nil, fmt.Errorf("列出工作区失败: %w", err)
-	}
-
-	workspaces := make([]string, 0)
-	for _, commonPrefix := range lsRes.CommonPrefixes {
-		// 提取工作区名称（去掉 image/ 前缀和末尾的 /）
-		workspaceName := strings.TrimPrefix(commonPrefix, searchPrefix)
-		workspaceName = strings.TrimSuffix(workspaceName, "/")
-		if workspaceName != "" {
-			workspaces = append(workspaces, workspaceName)
+		if isNotFound(err) {
+			return nil, fmt.Errorf("%w: %s", storage.ErrNotFound, key)
 		}
+		return nil, fmt.Errorf("从 OSS 下载文件失败: %w", err)
 	}
-
-	return workspaces, nil
+	return body, nil
 }
 
-// CreateWorkspace 创建工作区（创建一个目录）
-func (c *Client) CreateWorkspace(name string) error {
-	prefix := strings.TrimSuffix(c.config.ImagePrefix, "/")
-	if prefix == "" {
-		prefix = "image"
+// GetRange 下载对象的一部分
+func (c *Client) GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	byteRange := fmt.Sprintf("%d-", offset)
+	if length >= 0 {
+		byteRange = fmt.Sprintf("%d-%d", offset, offset+length-1)
 	}
-	// 创建一个空对象作为目录标记
-	objectKey := fmt.Sprintf("%s/%s/.keep", prefix, name)
-	objectKey = strings.ReplaceAll(objectKey, "\\", "/")
-
-	// 创建一个空内容
-	err := c.bucket.PutObject(objectKey, strings.NewReader(""))
+	body, err := c.bucket.GetObject(key, oss.NormalizedRange(byteRange), oss.WithContext(ctx))
 	if err != nil {
-		return fmt.Errorf("创建工作区失败: %w", err)
+		if isNotFound(err) {
+			return nil, fmt.Errorf("%w: %s", storage.ErrNotFound, key)
+		}
+		return nil, fmt.Errorf("从 OSS 下载文件失败: %w", err)
 	}
-
-	return nil
+	return body, nil
 }
 
-// DeleteWorkspace 删除工作区（删除目录下的所有文件）
-func (c *Client) DeleteWorkspace(name string) error {
-	prefix := strings.TrimSuffix(c.config.ImagePrefix, "/")
-	if prefix == "" {
-		prefix = "image"
-	}
-	workspacePrefix := fmt.Sprintf("%s/%s/", prefix, name)
-	workspacePrefix = strings.ReplaceAll(workspacePrefix, "\\", "/")
-
-	// 列出工作区下的所有对象
-	lsRes, err := c.bucket.ListObjects(oss.Prefix(workspacePrefix))
+// Stat 获取对象的大小和修改时间
+func (c *Client) Stat(ctx context.Context, key string) (*storage.Object, error) {
+	header, err := c.bucket.GetObjectMeta(key, oss.WithContext(ctx))
 	if err != nil {
-		return fmt.Errorf("列出工作区文件失败: %w", err)
+		if isNotFound(err) {
+			return nil, fmt.Errorf("%w: %s", storage.ErrNotFound, key)
+		}
+		return nil, fmt.Errorf("获取 OSS 文件信息失败: %w", err)
 	}
 
-	// 删除所有对象
-	objects := make([]string, 0, len(lsRes.Objects))
-	for _, object := range lsRes.Objects {
-		objects = append(objects, object.Key)
+	size, err := strconv.ParseInt(header.Get("Content-Length"), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("解析 OSS 文件大小失败: %w", err)
 	}
+	lastModified, _ := http.ParseTime(header.Get("Last-Modified"))
+	return &storage.Object{Key: key, Size: size, LastModified: lastModified}, nil
+}
 
-	if len(objects) > 0 {
-		_, err = c.bucket.DeleteObjects(objects)
-		if err != nil {
-			return fmt.Errorf("删除工作区文件失败: %w", err)
+// Copy 在 bucket 内复制对象
+func (c *Client) Copy(ctx context.Context, srcKey, dstKey string) error {
+	if _, err := c.bucket.CopyObject(srcKey, dstKey, oss.WithContext(ctx)); err != nil {
+		if isNotFound(err) {
+			return fmt.Errorf("%w: %s", storage.ErrNotFound, srcKey)
 		}
+		return fmt.Errorf("复制 OSS 文件失败: %w", err)
 	}
-
 	return nil
 }
 
-// GetImageURL 获取图片的访问 URL
-// path: OSS 中的路径（相对于 bucket 根目录）
-// 返回: 完整的访问 URL
-func (c *Client) GetImageURL(path string) string {
-	return fmt.Sprintf("%s/%s", c.baseURL, path)
-}
-
-// DownloadImage 从 OSS 下载图片
-// path: OSS 中的路径（相对于 bucket 根目录）
-// 返回: 图片数据
-func (c *Client) DownloadImage(path string) ([]byte, error) {
-	body, err := c.bucket.GetObject(path)
-	if err != nil {
-		return nil, fmt.Errorf("从 OSS 下载文件失败: %w", err)
-	}
-	defer body.Close()
-
-	data, err := io.ReadAll(body)
-	if err != nil {
-		return nil, fmt.Errorf("读取文件内容失败: %w", err)
+// CopyIfAbsent 仅在目标对象不存在时复制（禁止覆盖同名对象）
+func (c *Client) CopyIfAbsent(ctx context.Context, srcKey, dstKey string) error {
+	if _, err := c.bucket.CopyObject(srcKey, dstKey, oss.ForbidOverWrite(true), oss.WithContext(ctx)); err != nil {
+		if isAlreadyExists(err) {
+			return fmt.Errorf("%w: %s", storage.ErrExists, dstKey)
+		}
+		if isNotFound(err) {
+			return fmt.Errorf("%w: %s", storage.ErrNotFound, srcKey)
+		}
+		return fmt.Errorf("复制 OSS 文件失败: %w", err)
 	}
-
-	return data, nil
+	return nil
 }
 
-// GetImageURLOrDownload 获取图片 URL 或下载图片数据
-// 如果模型支持 URL，返回 URL；否则下载图片数据
-// path: OSS 中的路径
-// useURL: 是否使用 URL（如果模型支持）
-// 返回: URL（如果 useURL=true）或图片数据（如果 useURL=false）
-func (c *Client) GetImageURLOrDownload(path string, useURL bool) (string, []byte, error) {
-	if useURL {
-		url := c.GetImageURL(path)
-		return url, nil, nil
-	}
-
-	data, err := c.DownloadImage(path)
-	if err != nil {
-		return "", nil, err
+// Delete 删除对象（对象不存在时 OSS 同样返回成功）
+func (c *Client) Delete(ctx context.Context, key string) error {
+	if err := c.bucket.DeleteObject(key, oss.WithContext(ctx)); err != nil {
+		return fmt.Errorf("删除 OSS 文件失败: %w", err)
 	}
-
-	return "", data, nil
+	return nil
 }
 
-// ImageInfo 图片信息
-type ImageInfo struct {
-	Path    string `json:"path"`    // OSS 中的路径
-	URL     string `json:"url"`     // 图片访问 URL
-	Name    string `json:"name"`    // 文件名
-	Size    int64  `json:"size"`    // 文件大小（字节）
-	Updated string `json:"updated"` // 最后更新时间（ISO 8601 格式）
-}
+// DeletePrefix 删除路径以 prefix 开头的所有对象
+// 每列出一页（最多 1000 个对象）就批量删除这一页，删除后从该页的 marker 继续列出
+func (c *Client) DeletePrefix(ctx context.Context, prefix string, progress storage.DeleteProgress) (*storage.DeleteResult, error) {
+	result := &storage.DeleteResult{}
+	marker := ""
+	for {
+		lsRes, err := c.bucket.ListObjects(oss.Prefix(prefix), oss.Marker(marker), oss.MaxKeys(storage.DeleteBatchSize), oss.WithContext(ctx))
+		if err != nil {
+			return result, fmt.Errorf("列出 OSS 文件失败: %w", err)
+		}
 
-// ListWorkspaceImages 列出工作区的所有图片
-// workspace: 工作区名称
-// 返回: 图片信息列表
-func (c *Client) ListWorkspaceImages(workspace string) ([]ImageInfo, error) {
-	prefix := strings.TrimSuffix(c.config.ImagePrefix, "/")
-	if prefix == "" {
-		prefix = "image"
-	}
-	workspacePrefix := fmt.Sprintf("%s/%s/", prefix, workspace)
-	workspacePrefix = strings.ReplaceAll(workspacePrefix, "\\", "/")
+		keys := make([]string, 0, len(lsRes.Objects))
+		for _, object := range lsRes.Objects {
+			keys = append(keys, object.Key)
+		}
+		if len(keys) > 0 {
+			// 非静默模式返回删除成功的对象，未返回的视为删除失败
+			delRes, err := c.bucket.DeleteObjects(keys, oss.WithContext(ctx))
+			if err != nil {
+				return result, fmt.Errorf("批量删除 OSS 文件失败: %w", err)
+			}
+			deleted := make(map[string]bool, len(delRes.DeletedObjects))
+			for _, key := range delRes.DeletedObjects {
+				deleted[key] = true
+			}
+			for _, key := range keys {
+				if deleted[key] {
+					result.Deleted++
+				} else {
+					result.Failed = append(result.Failed, key)
+				}
+			}
+			if progress != nil {
+				progress(*result)
+			}
+		}
 
-	// 列出工作区下的所有对象
-	lsRes, err := c.bucket.ListObjects(oss.Prefix(workspacePrefix))
-	if err != nil {
-		return nil, fmt.Errorf("列出工作区图片失败: %w", err)
+		if !lsRes.IsTruncated {
+			return result, nil
+		}
+		marker = lsRes.NextMarker
 	}
+}
 
-	images := make([]ImageInfo, 0)
-	for _, object := range lsRes.Objects {
-		// 跳过目录标记文件（如 .keep）
-		if strings.HasSuffix(object.Key, "/.keep") {
-			continue
+// List 列出路径以 prefix 开头的所有对象（自动翻页）
+func (c *Client) List(ctx context.Context, prefix string) ([]storage.Object, error) {
+	objects := make([]storage.Object, 0)
+	marker := ""
+	for {
+		lsRes, err := c.bucket.ListObjects(oss.Prefix(prefix), oss.Marker(marker), oss.MaxKeys(1000), oss.WithContext(ctx))
+		if err != nil {
+			return nil, fmt.Errorf("列出 OSS 文件失败: %w", err)
 		}
-
-		// 提取文件名
-		fileName := strings.TrimPrefix(object.Key, workspacePrefix)
-		if fileName == "" {
-			continue
+		for _, object := range lsRes.Objects {
+			objects = append(objects, storage.Object{
+				Key:          object.Key,
+				Size:         object.Size,
+				LastModified: object.LastModified,
+			})
 		}
-
-		// 构建图片信息
-		imageInfo := ImageInfo{
-			Path:    object.Key,
-			URL:     c.GetImageURL(object.Key),
-			Name:    fileName,
-			Size:    object.Size,
-			Updated: object.LastModified.Format(time.RFC3339),
+		if !lsRes.IsTruncated {
+			return objects, nil
 		}
-
-		images = append(images, imageInfo)
+		marker = lsRes.NextMarker
 	}
+}
 
-	return images, nil
+// URL 返回对象的访问 URL
+func (c *Client) URL(key string) string {
+	return fmt.Sprintf("%s/%s", c.baseURL, key)
 }
 
-// DeleteImage 删除图片
-// path: OSS 中的路径（相对于 bucket 根目录）
-func (c *Client) DeleteImage(path string) error {
-	err := c.bucket.DeleteObject(path)
+// SignURL 返回带签名的临时下载 URL（用于私有 bucket）
+func (c *Client) SignURL(_ context.Context, key string, ttl time.Duration) (string, error) {
+	url, err := c.bucket.SignURL(key, oss.HTTPGet, int64(ttl/time.Second))
 	if err != nil {
-		return fmt.Errorf("删除图片失败: %w", err)
+		return "", fmt.Errorf("生成 OSS 签名 URL 失败: %w", err)
 	}
-	return nil
+	return url, nil
 }
 
-// RenameImage 重命名图片（通过复制到新路径然后删除旧文件实现）
-// oldPath: 旧路径（相对于 bucket 根目录）
-// newName: 新文件名
-// workspace: 工作区名称
-// 返回: 新路径
-func (c *Client) RenameImage(oldPath string, newName string, workspace string) (string, error) {
-	prefix := strings.TrimSuffix(c.config.ImagePrefix, "/")
-	if prefix == "" {
-		prefix = "image"
-	}
-	
-	// 构建新路径
-	newPath := fmt.Sprintf("%s/%s/%s", prefix, workspace, newName)
-	newPath = strings.ReplaceAll(newPath, "\\", "/")
-	
-	// 复制文件到新路径
-	_, err := c.bucket.CopyObject(oldPath, newPath)
-	if err != nil {
-		return "", fmt.Errorf("复制图片失败: %w", err)
-	}
-	
-	// 删除旧文件
-	err = c.bucket.DeleteObject(oldPath)
-	if err != nil {
-		// 如果删除失败，尝试删除新文件以回滚
-		c.bucket.DeleteObject(newPath)
-		return "", fmt.Errorf("删除旧图片失败: %w", err)
-	}
-	
-	return newPath, nil
+// isAlreadyExists 判断 OSS 错误是否为禁止覆盖时目标对象已存在
+func isAlreadyExists(err error) bool {
+	var serviceErr oss.ServiceError
+	return errors.As(err, &serviceErr) && serviceErr.Code == "FileAlreadyExists"
 }
 
+// isNotFound 判断 OSS 错误是否为对象不存在
+func isNotFound(err error) bool {
+	var serviceErr oss.ServiceError
+	if errors.As(err, &serviceErr) {
+		return serviceErr.StatusCode == http.StatusNotFound
+	}
+	return false
+}
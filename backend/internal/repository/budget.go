@@ -0,0 +1,139 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/guixu633/agent/backend/internal/database"
+)
+
+// 预算统计周期
+const (
+	BudgetPeriodDaily   = "daily"
+	BudgetPeriodMonthly = "monthly"
+)
+
+// 预算限制的指标
+const (
+	BudgetMetricRuns   = "runs"   // 成功生成次数
+	BudgetMetricTokens = "tokens" // 总 token 数
+	BudgetMetricCost   = "cost"   // 估算成本（美元）
+)
+
+// Budget 工作区预算数据库模型
+type Budget struct {
+	ID          int64     `json:"id"`
+	WorkspaceID int64     `json:"workspace_id"`
+	Period      string    `json:"period"`
+	Metric      string    `json:"metric"`
+	Limit       float64   `json:"limit"`      // 硬限制
+	WarnRatio   float64   `json:"warn_ratio"` // 软限制比例
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// BudgetRepository 工作区预算仓库接口
+type BudgetRepository interface {
+	ListByWorkspace(ctx context.Context, workspaceID int64) ([]*Budget, error)
+	// Upsert 创建或更新工作区在某个周期、某个指标上的预算
+	Upsert(ctx context.Context, budget *Budget) (*Budget, error)
+	// Delete 删除预算，返回是否存在并被删除
+	Delete(ctx context.Context, workspaceID int64, period, metric string) (bool, error)
+}
+
+type budgetRepository struct {
+	db *sql.DB
+}
+
+// NewBudgetRepository 创建工作区预算仓库实例
+func NewBudgetRepository() BudgetRepository {
+	return &budgetRepository{
+		db: database.DB,
+	}
+}
+
+const budgetColumns = `id, workspace_id, period, metric, limit_value, warn_ratio, created_at, updated_at`
+
+// scanBudget 扫描一行预算
+func scanBudget(row interface{ Scan(dest ...any) error }) (*Budget, error) {
+	var budget Budget
+	if err := row.Scan(
+		&budget.ID,
+		&budget.WorkspaceID,
+		&budget.Period,
+		&budget.Metric,
+		&budget.Limit,
+		&budget.WarnRatio,
+		&budget.CreatedAt,
+		&budget.UpdatedAt,
+	); err != nil {
+		return nil, err
+	}
+	return &budget, nil
+}
+
+// ListByWorkspace 列出工作区的所有预算（按周期、指标排序）
+func (r *budgetRepository) ListByWorkspace(ctx context.Context, workspaceID int64) ([]*Budget, error) {
+	query := `SELECT ` + budgetColumns + ` FROM workspace_budgets WHERE workspace_id = $1 ORDER BY period ASC, metric ASC`
+
+	rows, err := r.db.QueryContext(ctx, query, workspaceID)
+	if err != nil {
+		return nil, fmt.Errorf("查询预算失败: %w", err)
+	}
+	defer rows.Close()
+
+	budgets := make([]*Budget, 0)
+	for rows.Next() {
+		budget, err := scanBudget(rows)
+		if err != nil {
+			return nil, fmt.Errorf("扫描预算数据失败: %w", err)
+		}
+		budgets = append(budgets, budget)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("遍历预算数据失败: %w", err)
+	}
+
+	return budgets, nil
+}
+
+// Upsert 创建或更新预算
+func (r *budgetRepository) Upsert(ctx context.Context, budget *Budget) (*Budget, error) {
+	query := `
+		INSERT INTO workspace_budgets (workspace_id, period, metric, limit_value, warn_ratio, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+		ON CONFLICT (workspace_id, period, metric)
+		DO UPDATE SET limit_value = EXCLUDED.limit_value, warn_ratio = EXCLUDED.warn_ratio
+		RETURNING ` + budgetColumns
+
+	result, err := scanBudget(r.db.QueryRowContext(ctx, query,
+		budget.WorkspaceID,
+		budget.Period,
+		budget.Metric,
+		budget.Limit,
+		budget.WarnRatio,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("保存预算失败: %w", err)
+	}
+	return result, nil
+}
+
+// Delete 删除预算
+func (r *budgetRepository) Delete(ctx context.Context, workspaceID int64, period, metric string) (bool, error) {
+	query := `DELETE FROM workspace_budgets WHERE workspace_id = $1 AND period = $2 AND metric = $3`
+
+	result, err := r.db.ExecContext(ctx, query, workspaceID, period, metric)
+	if err != nil {
+		return false, fmt.Errorf("删除预算失败: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("获取删除结果失败: %w", err)
+	}
+	return rowsAffected > 0, nil
+}
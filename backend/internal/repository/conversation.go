@@ -0,0 +1,289 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/guixu633/agent/backend/internal/database"
+)
+
+// 对话角色
+const (
+	TurnRoleUser  = "user"
+	TurnRoleModel = "model"
+)
+
+// TurnPart 对话轮次中的一个片段
+type TurnPart struct {
+	Type             string `json:"type"`                        // 片段类型: "text" | "image"
+	Text             string `json:"text,omitempty"`              // 文本内容 (type="text" 时有效)
+	Path             string `json:"path,omitempty"`              // 图片 OSS 路径 (type="image" 时有效)
+	MimeType         string `json:"mime_type,omitempty"`         // 图片 MIME 类型 (type="image" 时有效)
+	ThoughtSignature []byte `json:"thought_signature,omitempty"` // 模型返回的思考签名
+}
+
+// ConversationTurn 对话轮次数据库模型
+type ConversationTurn struct {
+	ID             int64      `json:"id"`
+	ConversationID int64      `json:"conversation_id"`
+	TurnIndex      int        `json:"turn_index"`
+	Role           string     `json:"role"`
+	Parts          []TurnPart `json:"parts"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+// Conversation 对话会话数据库模型
+type Conversation struct {
+	ID          int64     `json:"id"`
+	WorkspaceID int64     `json:"workspace_id"`
+	Title       string    `json:"title"`
+	Model       string    `json:"model"`
+	TurnCount   int       `json:"turn_count"` // 轮次数量（只读，查询时统计）
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// ConversationRepository 对话仓库接口
+type ConversationRepository interface {
+	Create(ctx context.Context, conv *Conversation) (*Conversation, error)
+	GetByID(ctx context.Context, id int64) (*Conversation, error)
+	ListByWorkspaceName(ctx context.Context, workspaceName string) ([]*Conversation, error)
+	ListTurns(ctx context.Context, conversationID int64) ([]*ConversationTurn, error)
+	AppendTurns(ctx context.Context, conversationID int64, turns []*ConversationTurn) error
+	ListImagePaths(ctx context.Context, prefix string) ([]string, error)
+}
+
+type conversationRepository struct {
+	db *sql.DB
+}
+
+// NewConversationRepository 创建对话仓库实例
+func NewConversationRepository() ConversationRepository {
+	return &conversationRepository{
+		db: database.DB,
+	}
+}
+
+const conversationColumns = `c.id, c.workspace_id, c.title, c.model,
+		       (SELECT COUNT(*) FROM conversation_turns t WHERE t.conversation_id = c.id),
+		       c.created_at, c.updated_at`
+
+// scanConversation 扫描一行对话数据
+func scanConversation(row interface{ Scan(dest ...any) error }) (*Conversation, error) {
+	var conv Conversation
+	if err := row.Scan(
+		&conv.ID,
+		&conv.WorkspaceID,
+		&conv.Title,
+		&conv.Model,
+		&conv.TurnCount,
+		&conv.CreatedAt,
+		&conv.UpdatedAt,
+	); err != nil {
+		return nil, err
+	}
+	return &conv, nil
+}
+
+// Create 创建对话会话
+func (r *conversationRepository) Create(ctx context.Context, conv *Conversation) (*Conversation, error) {
+	query := `
+		INSERT INTO conversations (workspace_id, title, model, created_at, updated_at)
+		VALUES ($1, $2, $3, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+		RETURNING id, workspace_id, title, model, 0, created_at, updated_at
+	`
+
+	result, err := scanConversation(r.db.QueryRowContext(ctx, query, conv.WorkspaceID, conv.Title, conv.Model))
+	if err != nil {
+		return nil, fmt.Errorf("创建对话失败: %w", err)
+	}
+	return result, nil
+}
+
+// GetByID 根据 ID 获取对话会话
+func (r *conversationRepository) GetByID(ctx context.Context, id int64) (*Conversation, error) {
+	query := `SELECT ` + conversationColumns + ` FROM conversations c WHERE c.id = $1`
+
+	conv, err := scanConversation(r.db.QueryRowContext(ctx, query, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("获取对话失败: %w", err)
+	}
+	return conv, nil
+}
+
+// ListByWorkspaceName 根据工作区名称列出对话会话（最近更新的在前）
+func (r *conversationRepository) ListByWorkspaceName(ctx context.Context, workspaceName string) ([]*Conversation, error) {
+	query := `
+		SELECT ` + conversationColumns + `
+		FROM conversations c
+		INNER JOIN workspaces w ON c.workspace_id = w.id
+		WHERE w.name = $1
+		ORDER BY c.updated_at DESC, c.id DESC
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, workspaceName)
+	if err != nil {
+		return nil, fmt.Errorf("列出对话失败: %w", err)
+	}
+	defer rows.Close()
+
+	conversations := make([]*Conversation, 0)
+	for rows.Next() {
+		conv, err := scanConversation(rows)
+		if err != nil {
+			return nil, fmt.Errorf("扫描对话数据失败: %w", err)
+		}
+		conversations = append(conversations, conv)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("遍历对话数据失败: %w", err)
+	}
+
+	return conversations, nil
+}
+
+// ListTurns 按顺序列出对话的所有轮次
+func (r *conversationRepository) ListTurns(ctx context.Context, conversationID int64) ([]*ConversationTurn, error) {
+	query := `
+		SELECT id, conversation_id, turn_index, role, parts, created_at
+		FROM conversation_turns
+		WHERE conversation_id = $1
+		ORDER BY turn_index ASC
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, conversationID)
+	if err != nil {
+		return nil, fmt.Errorf("列出对话轮次失败: %w", err)
+	}
+	defer rows.Close()
+
+	turns := make([]*ConversationTurn, 0)
+	for rows.Next() {
+		var turn ConversationTurn
+		var partsBytes []byte
+		if err := rows.Scan(
+			&turn.ID,
+			&turn.ConversationID,
+			&turn.TurnIndex,
+			&turn.Role,
+			&partsBytes,
+			&turn.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("扫描对话轮次失败: %w", err)
+		}
+		if len(partsBytes) > 0 {
+			if err := json.Unmarshal(partsBytes, &turn.Parts); err != nil {
+				return nil, fmt.Errorf("反序列化对话片段失败: %w", err)
+			}
+		}
+		turns = append(turns, &turn)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("遍历对话轮次失败: %w", err)
+	}
+
+	return turns, nil
+}
+
+// AppendTurns 在一个事务中追加对话轮次，并更新会话的更新时间
+// 轮次序号从当前最大序号之后依次分配
+func (r *conversationRepository) AppendTurns(ctx context.Context, conversationID int64, turns []*ConversationTurn) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("开始事务失败: %w", err)
+	}
+	defer tx.Rollback()
+
+	// 更新会话时间的同时锁定会话行，串行化同一会话的追加操作
+	result, err := tx.ExecContext(ctx, `UPDATE conversations SET updated_at = CURRENT_TIMESTAMP WHERE id = $1`, conversationID)
+	if err != nil {
+		return fmt.Errorf("更新对话失败: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("获取更新行数失败: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("对话 %d 不存在", conversationID)
+	}
+
+	var nextIndex int
+	err = tx.QueryRowContext(ctx, `
+		SELECT COALESCE(MAX(turn_index) + 1, 0) FROM conversation_turns WHERE conversation_id = $1
+	`, conversationID).Scan(&nextIndex)
+	if err != nil {
+		return fmt.Errorf("获取对话轮次失败: %w", err)
+	}
+
+	// 持有图片路径的锁，存储操作任务不会在确认路径未被引用后、删除文件前插入引用该路径的轮次
+	paths := make([]string, 0)
+	for _, turn := range turns {
+		for _, part := range turn.Parts {
+			paths = append(paths, part.Path)
+		}
+	}
+	if err := lockPaths(ctx, tx, paths); err != nil {
+		return err
+	}
+
+	for i, turn := range turns {
+		partsJSON, err := json.Marshal(turn.Parts)
+		if err != nil {
+			return fmt.Errorf("序列化对话片段失败: %w", err)
+		}
+		if turn.Parts == nil {
+			partsJSON = []byte("[]")
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO conversation_turns (conversation_id, turn_index, role, parts, created_at)
+			VALUES ($1, $2, $3, $4, CURRENT_TIMESTAMP)
+		`, conversationID, nextIndex+i, turn.Role, partsJSON)
+		if err != nil {
+			return fmt.Errorf("保存对话轮次失败: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("提交事务失败: %w", err)
+	}
+	return nil
+}
+
+// ListImagePaths 列出对话轮次中引用的、以 prefix 开头的图片路径（去重）
+func (r *conversationRepository) ListImagePaths(ctx context.Context, prefix string) ([]string, error) {
+	query := `
+		SELECT DISTINCT part->>'path'
+		FROM conversation_turns, jsonb_array_elements(parts) AS part
+		WHERE starts_with(part->>'path', $1)
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, prefix)
+	if err != nil {
+		return nil, fmt.Errorf("查询对话图片路径失败: %w", err)
+	}
+	defer rows.Close()
+
+	paths := make([]string, 0)
+	for rows.Next() {
+		var path string
+		if err := rows.Scan(&path); err != nil {
+			return nil, fmt.Errorf("扫描对话图片路径失败: %w", err)
+		}
+		paths = append(paths, path)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("遍历对话图片路径失败: %w", err)
+	}
+
+	return paths, nil
+}
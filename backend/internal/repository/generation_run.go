@@ -0,0 +1,400 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/guixu633/agent/backend/internal/database"
+)
+
+// 模型调用状态
+const (
+	RunStatusPending   = "pending" // 已通过预算检查、调用尚未结束（预占一次调用）
+	RunStatusSucceeded = "succeeded"
+	RunStatusFailed    = "failed"
+)
+
+// usageLockNamespace 工作区用量锁（事务级 advisory lock）的命名空间，与工作区 ID 的哈希值组成锁 ID
+const usageLockNamespace int32 = 0x757367 // "usg"
+
+// GenerationRun 模型调用审计记录数据库模型
+type GenerationRun struct {
+	ID                int64           `json:"id"`
+	WorkspaceID       int64           `json:"workspace_id"`
+	Model             string          `json:"model"`
+	Status            string          `json:"status"`
+	Config            json.RawMessage `json:"config"` // 生成配置（JSON）
+	Prompt            string          `json:"prompt"`
+	RefImages         []string        `json:"ref_images"`
+	HistoryTurns      int             `json:"history_turns"`
+	Response          json.RawMessage `json:"response"`           // 响应摘要（JSON，不含图片数据）
+	FinishReasons     json.RawMessage `json:"finish_reasons"`     // 各候选结果的结束原因（JSON）
+	SafetyRatings     json.RawMessage `json:"safety_ratings"`     // 各候选结果的安全评级（JSON）
+	PromptFeedback    json.RawMessage `json:"prompt_feedback"`    // 输入反馈（JSON，可选）
+	GroundingMetadata json.RawMessage `json:"grounding_metadata"` // 各候选结果的引用信息（JSON）
+	ModelVersion      string          `json:"model_version"`
+	PromptTokens      int             `json:"prompt_tokens"`
+	CandidatesTokens  int             `json:"candidates_tokens"`
+	ThoughtsTokens    int             `json:"thoughts_tokens"`
+	TotalTokens       int             `json:"total_tokens"`
+	ImageCount        int             `json:"image_count"` // 输出图片数量
+	Cost              float64         `json:"cost"`        // 估算成本（美元）
+	LatencyMs         int64           `json:"latency_ms"`
+	Error             string          `json:"error"`
+	CreatedAt         time.Time       `json:"created_at"`
+}
+
+// GenerationRunRepository 模型调用审计记录仓库接口
+type GenerationRunRepository interface {
+	Create(ctx context.Context, run *GenerationRun) (*GenerationRun, error)
+	// Reserve 持有工作区用量锁，调用 admit 检查用量，通过后创建状态为 pending 的调用记录
+	// admit 返回错误时不创建记录并原样返回该错误；同一工作区的并发预占按顺序执行
+	Reserve(ctx context.Context, run *GenerationRun, admit func(usageSince UsageSinceFunc) error) (*GenerationRun, error)
+	// Finish 用调用结果更新 pending 状态的调用记录（run.ID 为预占的记录）
+	Finish(ctx context.Context, run *GenerationRun) (*GenerationRun, error)
+	GetByID(ctx context.Context, id int64) (*GenerationRun, error)
+	// UsageByWorkspace 按天和模型汇总工作区在 [from, to] 日期范围内的用量（日期格式 YYYY-MM-DD）
+	UsageByWorkspace(ctx context.Context, workspaceID int64, from, to string) ([]*UsageRow, error)
+	// UsageSince 汇总工作区从 since 日期（含，格式 YYYY-MM-DD）至今的用量，用于预算检查
+	UsageSince(ctx context.Context, workspaceID int64, since string) (*UsageTotals, error)
+}
+
+// UsageSinceFunc 汇总工作区从 since 日期（含，格式 YYYY-MM-DD）至今的用量
+type UsageSinceFunc func(since string) (*UsageTotals, error)
+
+// UsageRow 一个工作区在某天使用某个模型的用量汇总
+type UsageRow struct {
+	Day              time.Time `json:"day"`
+	Model            string    `json:"model"`
+	Runs             int64     `json:"runs"`
+	FailedRuns       int64     `json:"failed_runs"`
+	PromptTokens     int64     `json:"prompt_tokens"`
+	CandidatesTokens int64     `json:"candidates_tokens"`
+	ThoughtsTokens   int64     `json:"thoughts_tokens"`
+	TotalTokens      int64     `json:"total_tokens"`
+	ImageCount       int64     `json:"image_count"`
+	Cost             float64   `json:"cost"`
+}
+
+// UsageTotals 一个工作区在一段时间内的用量合计
+type UsageTotals struct {
+	SucceededRuns int64   `json:"succeeded_runs"` // 成功的调用次数（含进行中的调用）
+	TotalTokens   int64   `json:"total_tokens"`
+	Cost          float64 `json:"cost"`
+}
+
+type generationRunRepository struct {
+	db *sql.DB
+}
+
+// NewGenerationRunRepository 创建模型调用审计记录仓库实例
+func NewGenerationRunRepository() GenerationRunRepository {
+	return &generationRunRepository{
+		db: database.DB,
+	}
+}
+
+const generationRunColumns = `id, workspace_id, model, status, config, prompt, ref_images, history_turns,
+		       response, finish_reasons, safety_ratings, prompt_feedback, grounding_metadata,
+		       model_version, prompt_tokens, candidates_tokens, thoughts_tokens, total_tokens,
+		       image_count, cost, latency_ms, error, created_at`
+
+// scanGenerationRun 扫描一行审计记录
+func scanGenerationRun(row interface{ Scan(dest ...any) error }) (*GenerationRun, error) {
+	var run GenerationRun
+	var config, refImages, response, finishReasons, safetyRatings, promptFeedback, groundingMetadata []byte
+	if err := row.Scan(
+		&run.ID,
+		&run.WorkspaceID,
+		&run.Model,
+		&run.Status,
+		&config,
+		&run.Prompt,
+		&refImages,
+		&run.HistoryTurns,
+		&response,
+		&finishReasons,
+		&safetyRatings,
+		&promptFeedback,
+		&groundingMetadata,
+		&run.ModelVersion,
+		&run.PromptTokens,
+		&run.CandidatesTokens,
+		&run.ThoughtsTokens,
+		&run.TotalTokens,
+		&run.ImageCount,
+		&run.Cost,
+		&run.LatencyMs,
+		&run.Error,
+		&run.CreatedAt,
+	); err != nil {
+		return nil, err
+	}
+
+	if len(refImages) > 0 {
+		if err := json.Unmarshal(refImages, &run.RefImages); err != nil {
+			return nil, fmt.Errorf("反序列化引用图片失败: %w", err)
+		}
+	}
+	run.Config = config
+	run.Response = response
+	run.FinishReasons = finishReasons
+	run.SafetyRatings = safetyRatings
+	run.PromptFeedback = promptFeedback
+	run.GroundingMetadata = groundingMetadata
+	return &run, nil
+}
+
+// jsonOrDefault 空 JSON 使用默认值
+func jsonOrDefault(data json.RawMessage, def string) []byte {
+	if len(data) == 0 {
+		return []byte(def)
+	}
+	return data
+}
+
+// Create 创建审计记录
+func (r *generationRunRepository) Create(ctx context.Context, run *GenerationRun) (*GenerationRun, error) {
+	return r.insert(ctx, r.db, run)
+}
+
+// Reserve 在事务中持有工作区用量锁，检查用量后创建 pending 状态的调用记录
+// 检查和创建在同一把锁内完成，并发请求不会都基于同一份用量通过预算检查
+func (r *generationRunRepository) Reserve(ctx context.Context, run *GenerationRun, admit func(usageSince UsageSinceFunc) error) (*GenerationRun, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("开启事务失败: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1, hashint8($2))`, usageLockNamespace, run.WorkspaceID); err != nil {
+		return nil, fmt.Errorf("锁定工作区用量失败: %w", err)
+	}
+	if err := admit(func(since string) (*UsageTotals, error) {
+		return usageSince(ctx, tx, run.WorkspaceID, since)
+	}); err != nil {
+		return nil, err
+	}
+
+	pending := *run
+	pending.Status = RunStatusPending
+	created, err := r.insert(ctx, tx, &pending)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("提交事务失败: %w", err)
+	}
+	return created, nil
+}
+
+// insert 插入一条审计记录
+func (r *generationRunRepository) insert(ctx context.Context, q rowQueryer, run *GenerationRun) (*GenerationRun, error) {
+	query := `
+		INSERT INTO generation_runs (
+			workspace_id, model, status, config, prompt, ref_images, history_turns,
+			response, finish_reasons, safety_ratings, prompt_feedback, grounding_metadata,
+			model_version, prompt_tokens, candidates_tokens, thoughts_tokens, total_tokens,
+			image_count, cost, latency_ms, error, created_at
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, CURRENT_TIMESTAMP)
+		RETURNING ` + generationRunColumns
+
+	refImagesJSON, err := marshalRefImages(run.RefImages)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := scanGenerationRun(q.QueryRowContext(ctx, query,
+		run.WorkspaceID,
+		run.Model,
+		run.Status,
+		jsonOrDefault(run.Config, "{}"),
+		run.Prompt,
+		refImagesJSON,
+		run.HistoryTurns,
+		jsonOrDefault(run.Response, "[]"),
+		jsonOrDefault(run.FinishReasons, "[]"),
+		jsonOrDefault(run.SafetyRatings, "[]"),
+		promptFeedbackOrNil(run.PromptFeedback),
+		jsonOrDefault(run.GroundingMetadata, "[]"),
+		run.ModelVersion,
+		run.PromptTokens,
+		run.CandidatesTokens,
+		run.ThoughtsTokens,
+		run.TotalTokens,
+		run.ImageCount,
+		run.Cost,
+		run.LatencyMs,
+		run.Error,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("创建审计记录失败: %w", err)
+	}
+	return result, nil
+}
+
+// Finish 用调用结果更新 pending 状态的调用记录（保留预占时的创建时间）
+func (r *generationRunRepository) Finish(ctx context.Context, run *GenerationRun) (*GenerationRun, error) {
+	query := `
+		UPDATE generation_runs
+		SET model = $2, status = $3, config = $4, prompt = $5, ref_images = $6, history_turns = $7,
+		    response = $8, finish_reasons = $9, safety_ratings = $10, prompt_feedback = $11, grounding_metadata = $12,
+		    model_version = $13, prompt_tokens = $14, candidates_tokens = $15, thoughts_tokens = $16, total_tokens = $17,
+		    image_count = $18, cost = $19, latency_ms = $20, error = $21
+		WHERE id = $1 AND status = $22
+		RETURNING ` + generationRunColumns
+
+	refImagesJSON, err := marshalRefImages(run.RefImages)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := scanGenerationRun(r.db.QueryRowContext(ctx, query,
+		run.ID,
+		run.Model,
+		run.Status,
+		jsonOrDefault(run.Config, "{}"),
+		run.Prompt,
+		refImagesJSON,
+		run.HistoryTurns,
+		jsonOrDefault(run.Response, "[]"),
+		jsonOrDefault(run.FinishReasons, "[]"),
+		jsonOrDefault(run.SafetyRatings, "[]"),
+		promptFeedbackOrNil(run.PromptFeedback),
+		jsonOrDefault(run.GroundingMetadata, "[]"),
+		run.ModelVersion,
+		run.PromptTokens,
+		run.CandidatesTokens,
+		run.ThoughtsTokens,
+		run.TotalTokens,
+		run.ImageCount,
+		run.Cost,
+		run.LatencyMs,
+		run.Error,
+		RunStatusPending,
+	))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("调用记录 %d 不存在或已结束", run.ID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("更新审计记录失败: %w", err)
+	}
+	return result, nil
+}
+
+// marshalRefImages 序列化引用图片（nil 保存为空数组）
+func marshalRefImages(refImages []string) ([]byte, error) {
+	if refImages == nil {
+		return []byte("[]"), nil
+	}
+	data, err := json.Marshal(refImages)
+	if err != nil {
+		return nil, fmt.Errorf("序列化引用图片失败: %w", err)
+	}
+	return data, nil
+}
+
+// promptFeedbackOrNil 输入反馈为空时保存为 NULL
+func promptFeedbackOrNil(data json.RawMessage) []byte {
+	if len(data) == 0 {
+		return nil
+	}
+	return data
+}
+
+// GetByID 根据 ID 获取审计记录
+func (r *generationRunRepository) GetByID(ctx context.Context, id int64) (*GenerationRun, error) {
+	query := `SELECT ` + generationRunColumns + ` FROM generation_runs WHERE id = $1`
+
+	run, err := scanGenerationRun(r.db.QueryRowContext(ctx, query, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("获取审计记录失败: %w", err)
+	}
+	return run, nil
+}
+
+// UsageByWorkspace 按天和模型汇总工作区的用量（按日期、模型排序）
+func (r *generationRunRepository) UsageByWorkspace(ctx context.Context, workspaceID int64, from, to string) ([]*UsageRow, error) {
+	query := `
+		SELECT DATE(created_at) AS day, model,
+		       COUNT(*),
+		       COUNT(*) FILTER (WHERE status = $4),
+		       COALESCE(SUM(prompt_tokens), 0),
+		       COALESCE(SUM(candidates_tokens), 0),
+		       COALESCE(SUM(thoughts_tokens), 0),
+		       COALESCE(SUM(total_tokens), 0),
+		       COALESCE(SUM(image_count), 0),
+		       COALESCE(SUM(cost), 0)
+		FROM generation_runs
+		WHERE workspace_id = $1 AND created_at >= $2::date AND created_at < $3::date + 1
+		GROUP BY day, model
+		ORDER BY day ASC, model ASC
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, workspaceID, from, to, RunStatusFailed)
+	if err != nil {
+		return nil, fmt.Errorf("汇总用量失败: %w", err)
+	}
+	defer rows.Close()
+
+	usage := make([]*UsageRow, 0)
+	for rows.Next() {
+		var row UsageRow
+		if err := rows.Scan(
+			&row.Day,
+			&row.Model,
+			&row.Runs,
+			&row.FailedRuns,
+			&row.PromptTokens,
+			&row.CandidatesTokens,
+			&row.ThoughtsTokens,
+			&row.TotalTokens,
+			&row.ImageCount,
+			&row.Cost,
+		); err != nil {
+			return nil, fmt.Errorf("扫描用量数据失败: %w", err)
+		}
+		usage = append(usage, &row)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("遍历用量数据失败: %w", err)
+	}
+
+	return usage, nil
+}
+
+// UsageSince 汇总工作区从 since 日期至今的用量（失败的调用同样计入 token 和成本）
+func (r *generationRunRepository) UsageSince(ctx context.Context, workspaceID int64, since string) (*UsageTotals, error) {
+	return usageSince(ctx, r.db, workspaceID, since)
+}
+
+// usageSince 汇总工作区从 since 日期至今的用量
+// 进行中的调用已预占一次生成次数；超过 1 小时仍未结束的视为进程中断遗留，不再计入
+func usageSince(ctx context.Context, q rowQueryer, workspaceID int64, since string) (*UsageTotals, error) {
+	query := `
+		SELECT COUNT(*) FILTER (WHERE status = $3 OR (status = $4 AND created_at > NOW() - INTERVAL '1 hour')),
+		       COALESCE(SUM(total_tokens), 0),
+		       COALESCE(SUM(cost), 0)
+		FROM generation_runs
+		WHERE workspace_id = $1 AND created_at >= $2::date
+	`
+
+	var totals UsageTotals
+	err := q.QueryRowContext(ctx, query, workspaceID, since, RunStatusSucceeded, RunStatusPending).Scan(
+		&totals.SucceededRuns,
+		&totals.TotalTokens,
+		&totals.Cost,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("汇总用量失败: %w", err)
+	}
+	return &totals, nil
+}
@@ -4,12 +4,23 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/guixu633/agent/backend/internal/database"
+	"github.com/lib/pq"
 )
 
+// ErrImageNameExists 工作区中已有同名图片（违反 UNIQUE(workspace_id, name) 约束）
+var ErrImageNameExists = errors.New("同名图片已存在")
+
+// ErrSharedObjectGone 要共享的已有文件不再被任何图片记录引用（可能已被存储操作任务删除）
+var ErrSharedObjectGone = errors.New("共享的文件已不再被引用")
+
 // Message 对话消息（与 model.Message 保持一致）
 type Message struct {
 	Role    string `json:"role"`              // 角色: "user" | "assistant"
@@ -24,29 +35,46 @@ type Image struct {
 	WorkspaceID   int64     `json:"workspace_id"`
 	Name          string    `json:"name"`
 	OSSPath       string    `json:"oss_path"`
-	OSSUrl        string    `json:"oss_url"`
 	ThumbnailPath string    `json:"thumbnail_path"`
-	ThumbnailUrl  string    `json:"thumbnail_url"`
 	Size          int64     `json:"size"`
 	MimeType      string    `json:"mime_type"`
 	SourceType    string    `json:"source_type"`
 	Prompt        string    `json:"prompt"`
 	RefImages     []string  `json:"ref_images"`
 	MessageList   []Message `json:"message_list"`
-	CreatedAt     time.Time `json:"created_at"`
-	UpdatedAt     time.Time `json:"updated_at"`
+	// 生成信息（source_type="generate" 时有效）
+	Model            string          `json:"model"`             // 使用的模型
+	GenerationParams json.RawMessage `json:"generation_params"` // 生成参数（JSON）
+	CandidateIndex   int             `json:"candidate_index"`   // 候选结果序号
+	GenerationRunID  *int64          `json:"generation_run_id"` // 关联的模型调用审计记录（可选）
+	ContentHash      string          `json:"content_hash"`      // 内容的 SHA-256（十六进制），用于上传去重
+	CreatedAt        time.Time       `json:"created_at"`
+	UpdatedAt        time.Time       `json:"updated_at"`
 }
 
 // ImageRepository 图片仓库接口
 type ImageRepository interface {
 	Create(ctx context.Context, img *Image) (*Image, error)
+	CreateShared(ctx context.Context, img *Image) (*Image, error)
 	GetByID(ctx context.Context, id int64) (*Image, error)
 	GetByOSSPath(ctx context.Context, ossPath string) (*Image, error)
+	GetByName(ctx context.Context, workspaceID int64, name string) (*Image, error)
+	ListByContentHash(ctx context.Context, workspaceID int64, contentHash string) ([]*Image, error)
 	ListByWorkspace(ctx context.Context, workspaceID int64) ([]*Image, error)
-	ListByWorkspaceName(ctx context.Context, workspaceName string) ([]*Image, error)
+	ListByWorkspaceName(ctx context.Context, workspaceName string, opts ImageListOptions) ([]*Image, error)
 	Update(ctx context.Context, id int64, updates map[string]interface{}) (*Image, error)
 	Delete(ctx context.Context, id int64) error
+	DeleteWithStorageOps(ctx context.Context, id int64, keys []string) error
+	UpdateWithStorageOps(ctx context.Context, id int64, updates map[string]interface{}, keys []string) (*Image, error)
+	ReplaceShared(ctx context.Context, id int64, updates map[string]interface{}, keys []string) (*Image, error)
+	LockPath(ctx context.Context, path string) (referenced bool, unlock func(), err error)
 	DeleteByOSSPath(ctx context.Context, ossPath string) error
+	ListByGenerationRun(ctx context.Context, runID int64) ([]*Image, error)
+	Search(ctx context.Context, workspaceName string, terms []string, limit, offset int) ([]*ImageSearchResult, error)
+	AddTags(ctx context.Context, workspaceID int64, imageIDs []int64, tags []string) error
+	RemoveTags(ctx context.Context, workspaceID int64, imageIDs []int64, tags []string) error
+	ListTags(ctx context.Context, workspaceID int64) ([]*TagCount, error)
+	ListTagsByImages(ctx context.Context, imageIDs []int64) (map[int64][]string, error)
 }
 
 type imageRepository struct {
@@ -60,21 +88,106 @@ func NewImageRepository() ImageRepository {
 	}
 }
 
+// imageDetailColumns 图片详情查询的字段（包含生成信息）
+const imageDetailColumns = `id, workspace_id, name, oss_path,
+		       thumbnail_path, size, mime_type,
+		       source_type, prompt, ref_images, message_list,
+		       model, generation_params, candidate_index, generation_run_id,
+		       content_hash, created_at, updated_at`
+
+// scanImageDetail 扫描一行图片详情数据
+func scanImageDetail(row interface{ Scan(dest ...any) error }) (*Image, error) {
+	var img Image
+	var refImagesBytes, messageListBytes, generationParamsBytes []byte
+	var generationRunID sql.NullInt64
+
+	if err := row.Scan(
+		&img.ID,
+		&img.WorkspaceID,
+		&img.Name,
+		&img.OSSPath,
+		&img.ThumbnailPath,
+		&img.Size,
+		&img.MimeType,
+		&img.SourceType,
+		&img.Prompt,
+		&refImagesBytes,
+		&messageListBytes,
+		&img.Model,
+		&generationParamsBytes,
+		&img.CandidateIndex,
+		&generationRunID,
+		&img.ContentHash,
+		&img.CreatedAt,
+		&img.UpdatedAt,
+	); err != nil {
+		return nil, err
+	}
+
+	if len(refImagesBytes) > 0 {
+		if err := json.Unmarshal(refImagesBytes, &img.RefImages); err != nil {
+			return nil, fmt.Errorf("反序列化引用图片失败: %w", err)
+		}
+	}
+	if len(messageListBytes) > 0 {
+		if err := json.Unmarshal(messageListBytes, &img.MessageList); err != nil {
+			return nil, fmt.Errorf("反序列化消息列表失败: %w", err)
+		}
+	}
+	img.GenerationParams = generationParamsBytes
+	if generationRunID.Valid {
+		img.GenerationRunID = &generationRunID.Int64
+	}
+
+	return &img, nil
+}
+
 // Create 创建图片记录
 func (r *imageRepository) Create(ctx context.Context, img *Image) (*Image, error) {
+	return createImage(ctx, r.db, img)
+}
+
+// CreateShared 创建与已有记录共享原图和缩略图的图片记录（内容相同的上传去重）
+// 持有路径锁并确认共享的文件仍被其他记录引用后再插入，避免存储操作任务在插入前删除文件；
+// 文件已不再被引用（可能已被删除）时返回 ErrSharedObjectGone
+func (r *imageRepository) CreateShared(ctx context.Context, img *Image) (*Image, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("开启事务失败: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := lockSharedPaths(ctx, tx, []string{img.OSSPath, img.ThumbnailPath}); err != nil {
+		return nil, err
+	}
+	created, err := createImage(ctx, tx, img)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("提交事务失败: %w", err)
+	}
+	return created, nil
+}
+
+// rowQueryer 可执行查询的对象（*sql.DB 或 *sql.Tx）
+type rowQueryer interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// createImage 插入图片记录
+func createImage(ctx context.Context, db rowQueryer, img *Image) (*Image, error) {
 	query := `
 		INSERT INTO images (
-			workspace_id, name, oss_path, oss_url, 
-			thumbnail_path, thumbnail_url, size, mime_type,
+			workspace_id, name, oss_path,
+			thumbnail_path, size, mime_type,
 			source_type, prompt, ref_images, message_list,
-			created_at, updated_at
+			model, generation_params, candidate_index, generation_run_id,
+			content_hash, created_at, updated_at
 		)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
-		RETURNING id, workspace_id, name, oss_path, oss_url, 
-		          thumbnail_path, thumbnail_url, size, mime_type,
-		          source_type, prompt, ref_images, message_list,
-		          created_at, updated_at
-	`
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+		RETURNING ` + imageDetailColumns
 
 	refImagesJSON, err := json.Marshal(img.RefImages)
 	if err != nil {
@@ -92,93 +205,48 @@ func (r *imageRepository) Create(ctx context.Context, img *Image) (*Image, error
 		messageListJSON = []byte("[]")
 	}
 
+	generationParamsJSON := []byte(img.GenerationParams)
+	if len(generationParamsJSON) == 0 {
+		generationParamsJSON = []byte("{}")
+	}
+
 	// 默认值处理
 	if img.SourceType == "" {
 		img.SourceType = "upload"
 	}
 
-	var result Image
-	var refImagesBytes, messageListBytes []byte
-
-	err = r.db.QueryRowContext(ctx, query,
+	result, err := scanImageDetail(db.QueryRowContext(ctx, query,
 		img.WorkspaceID,
 		img.Name,
 		img.OSSPath,
-		img.OSSUrl,
 		img.ThumbnailPath,
-		img.ThumbnailUrl,
 		img.Size,
 		img.MimeType,
 		img.SourceType,
 		img.Prompt,
 		refImagesJSON,
 		messageListJSON,
-	).Scan(
-		&result.ID,
-		&result.WorkspaceID,
-		&result.Name,
-		&result.OSSPath,
-		&result.OSSUrl,
-		&result.ThumbnailPath,
-		&result.ThumbnailUrl,
-		&result.Size,
-		&result.MimeType,
-		&result.SourceType,
-		&result.Prompt,
-		&refImagesBytes,
-		&messageListBytes,
-		&result.CreatedAt,
-		&result.UpdatedAt,
-	)
+		img.Model,
+		generationParamsJSON,
+		img.CandidateIndex,
+		img.GenerationRunID,
+		img.ContentHash,
+	))
+	if isUniqueViolation(err) {
+		return nil, fmt.Errorf("创建图片记录失败: %w", ErrImageNameExists)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("创建图片记录失败: %w", err)
 	}
 
-	if len(refImagesBytes) > 0 {
-		if err := json.Unmarshal(refImagesBytes, &result.RefImages); err != nil {
-			return nil, fmt.Errorf("反序列化引用图片失败: %w", err)
-		}
-	}
-	if len(messageListBytes) > 0 {
-		if err := json.Unmarshal(messageListBytes, &result.MessageList); err != nil {
-			return nil, fmt.Errorf("反序列化消息列表失败: %w", err)
-		}
-	}
-
-	return &result, nil
+	return result, nil
 }
 
 // GetByID 根据 ID 获取图片
 func (r *imageRepository) GetByID(ctx context.Context, id int64) (*Image, error) {
-	query := `
-		SELECT id, workspace_id, name, oss_path, oss_url,
-		       thumbnail_path, thumbnail_url, size, mime_type,
-		       source_type, prompt, ref_images, message_list,
-		       created_at, updated_at
-		FROM images
-		WHERE id = $1
-	`
+	query := `SELECT ` + imageDetailColumns + ` FROM images WHERE id = $1`
 
-	var img Image
-	var refImagesBytes, messageListBytes []byte
-
-	err := r.db.QueryRowContext(ctx, query, id).Scan(
-		&img.ID,
-		&img.WorkspaceID,
-		&img.Name,
-		&img.OSSPath,
-		&img.OSSUrl,
-		&img.ThumbnailPath,
-		&img.ThumbnailUrl,
-		&img.Size,
-		&img.MimeType,
-		&img.SourceType,
-		&img.Prompt,
-		&refImagesBytes,
-		&messageListBytes,
-		&img.CreatedAt,
-		&img.UpdatedAt,
-	)
+	img, err := scanImageDetail(r.db.QueryRowContext(ctx, query, id))
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -186,47 +254,15 @@ func (r *imageRepository) GetByID(ctx context.Context, id int64) (*Image, error)
 		return nil, fmt.Errorf("获取图片失败: %w", err)
 	}
 
-	if len(refImagesBytes) > 0 {
-		json.Unmarshal(refImagesBytes, &img.RefImages)
-	}
-	if len(messageListBytes) > 0 {
-		json.Unmarshal(messageListBytes, &img.MessageList)
-	}
-
-	return &img, nil
+	return img, nil
 }
 
 // GetByOSSPath 根据 OSS 路径获取图片
+// 内容相同的图片共享存储对象，多条记录路径相同时返回最早创建的一条
 func (r *imageRepository) GetByOSSPath(ctx context.Context, ossPath string) (*Image, error) {
-	query := `
-		SELECT id, workspace_id, name, oss_path, oss_url,
-		       thumbnail_path, thumbnail_url, size, mime_type,
-		       source_type, prompt, ref_images, message_list,
-		       created_at, updated_at
-		FROM images
-		WHERE oss_path = $1
-	`
+	query := `SELECT ` + imageDetailColumns + ` FROM images WHERE oss_path = $1 ORDER BY id ASC LIMIT 1`
 
-	var img Image
-	var refImagesBytes, messageListBytes []byte
-
-	err := r.db.QueryRowContext(ctx, query, ossPath).Scan(
-		&img.ID,
-		&img.WorkspaceID,
-		&img.Name,
-		&img.OSSPath,
-		&img.OSSUrl,
-		&img.ThumbnailPath,
-		&img.ThumbnailUrl,
-		&img.Size,
-		&img.MimeType,
-		&img.SourceType,
-		&img.Prompt,
-		&refImagesBytes,
-		&messageListBytes,
-		&img.CreatedAt,
-		&img.UpdatedAt,
-	)
+	img, err := scanImageDetail(r.db.QueryRowContext(ctx, query, ossPath))
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -234,29 +270,34 @@ func (r *imageRepository) GetByOSSPath(ctx context.Context, ossPath string) (*Im
 		return nil, fmt.Errorf("获取图片失败: %w", err)
 	}
 
-	if len(refImagesBytes) > 0 {
-		json.Unmarshal(refImagesBytes, &img.RefImages)
+	return img, nil
+}
+
+// GetByName 根据工作区和文件名获取图片
+func (r *imageRepository) GetByName(ctx context.Context, workspaceID int64, name string) (*Image, error) {
+	query := `SELECT ` + imageDetailColumns + ` FROM images WHERE workspace_id = $1 AND name = $2`
+
+	img, err := scanImageDetail(r.db.QueryRowContext(ctx, query, workspaceID, name))
+	if err == sql.ErrNoRows {
+		return nil, nil
 	}
-	if len(messageListBytes) > 0 {
-		json.Unmarshal(messageListBytes, &img.MessageList)
+	if err != nil {
+		return nil, fmt.Errorf("获取图片失败: %w", err)
 	}
 
-	return &img, nil
+	return img, nil
 }
 
-// ListByWorkspace 根据工作区 ID 列出图片
-// 注意：不查询 prompt, ref_images, message_list 字段以减少数据传输量，需要完整信息请使用 GetByID
-func (r *imageRepository) ListByWorkspace(ctx context.Context, workspaceID int64) ([]*Image, error) {
+// ListByContentHash 列出工作区中内容哈希相同的图片（按创建顺序）
+func (r *imageRepository) ListByContentHash(ctx context.Context, workspaceID int64, contentHash string) ([]*Image, error) {
 	query := `
-		SELECT id, workspace_id, name, oss_path, oss_url,
-		       thumbnail_path, thumbnail_url, size, mime_type,
-		       source_type, created_at, updated_at
+		SELECT ` + imageDetailColumns + `
 		FROM images
-		WHERE workspace_id = $1
-		ORDER BY created_at DESC
+		WHERE workspace_id = $1 AND content_hash = $2
+		ORDER BY id ASC
 	`
 
-	rows, err := r.db.QueryContext(ctx, query, workspaceID)
+	rows, err := r.db.QueryContext(ctx, query, workspaceID, contentHash)
 	if err != nil {
 		return nil, fmt.Errorf("列出图片失败: %w", err)
 	}
@@ -264,25 +305,11 @@ func (r *imageRepository) ListByWorkspace(ctx context.Context, workspaceID int64
 
 	images := make([]*Image, 0)
 	for rows.Next() {
-		var img Image
-		if err := rows.Scan(
-			&img.ID,
-			&img.WorkspaceID,
-			&img.Name,
-			&img.OSSPath,
-			&img.OSSUrl,
-			&img.ThumbnailPath,
-			&img.ThumbnailUrl,
-			&img.Size,
-			&img.MimeType,
-			&img.SourceType,
-			&img.CreatedAt,
-			&img.UpdatedAt,
-		); err != nil {
+		img, err := scanImageDetail(rows)
+		if err != nil {
 			return nil, fmt.Errorf("扫描图片数据失败: %w", err)
 		}
-
-		images = append(images, &img)
+		images = append(images, img)
 	}
 
 	if err := rows.Err(); err != nil {
@@ -292,20 +319,166 @@ func (r *imageRepository) ListByWorkspace(ctx context.Context, workspaceID int64
 	return images, nil
 }
 
-// ListByWorkspaceName 根据工作区名称列出图片
+// imageListColumns 图片列表查询的字段
 // 注意：不查询 prompt, ref_images, message_list 字段以减少数据传输量，需要完整信息请使用 GetByID
-func (r *imageRepository) ListByWorkspaceName(ctx context.Context, workspaceName string) ([]*Image, error) {
+const imageListColumns = `id, workspace_id, name, oss_path,
+		       thumbnail_path, size, mime_type,
+		       source_type, created_at, updated_at`
+
+// ListByWorkspace 根据工作区 ID 列出图片
+func (r *imageRepository) ListByWorkspace(ctx context.Context, workspaceID int64) ([]*Image, error) {
 	query := `
-		SELECT i.id, i.workspace_id, i.name, i.oss_path, i.oss_url,
-		       i.thumbnail_path, i.thumbnail_url, i.size, i.mime_type,
-		       i.source_type, i.created_at, i.updated_at
-		FROM images i
-		INNER JOIN workspaces w ON i.workspace_id = w.id
-		WHERE w.name = $1
-		ORDER BY i.created_at DESC
+		SELECT ` + imageListColumns + `
+		FROM images
+		WHERE workspace_id = $1
+		ORDER BY created_at DESC
 	`
+	return r.queryImageList(ctx, query, workspaceID)
+}
+
+// 图片列表的排序方式
+const (
+	ImageSortCreated = "created"
+	ImageSortUpdated = "updated"
+	ImageSortName    = "name"
+	ImageSortSize    = "size"
+)
+
+// imageSortColumns 排序方式对应的字段，以及游标值在 SQL 中的类型转换
+// 每种排序都以 id 作为第二排序字段，保证顺序稳定，由 (workspace_id, 排序字段, id) 复合索引支持
+var imageSortColumns = map[string]struct{ column, cast string }{
+	ImageSortCreated: {"created_at", "::timestamp"},
+	ImageSortUpdated: {"updated_at", "::timestamp"},
+	ImageSortName:    {"name", ""},
+	ImageSortSize:    {"size", "::bigint"},
+}
+
+// timestampLayout 游标和时间过滤条件中时间的格式（不带时区，与 TIMESTAMP 字段一致）
+const timestampLayout = "2006-01-02 15:04:05.999999"
+
+// ImageCursor 分页游标：上一页最后一条记录的排序字段值和 ID
+type ImageCursor struct {
+	Value string `json:"v"`
+	ID    int64  `json:"id"`
+}
+
+// NewImageCursor 根据一页的最后一条记录创建下一页的游标
+func NewImageCursor(img *Image, sort string) *ImageCursor {
+	cursor := &ImageCursor{ID: img.ID}
+	switch sort {
+	case ImageSortUpdated:
+		cursor.Value = img.UpdatedAt.Format(timestampLayout)
+	case ImageSortName:
+		cursor.Value = img.Name
+	case ImageSortSize:
+		cursor.Value = strconv.FormatInt(img.Size, 10)
+	default:
+		cursor.Value = img.CreatedAt.Format(timestampLayout)
+	}
+	return cursor
+}
+
+// Valid 判断游标值能否转换为排序字段的类型（游标来自客户端，可能被篡改）
+func (c *ImageCursor) Valid(sort string) bool {
+	switch sort {
+	case ImageSortCreated, ImageSortUpdated:
+		// 数据库不支持公元 0 年及之前的时间
+		t, err := time.Parse(timestampLayout, c.Value)
+		return err == nil && t.Year() >= 1
+	case ImageSortSize:
+		_, err := strconv.ParseInt(c.Value, 10, 64)
+		return err == nil
+	case ImageSortName:
+		// 数据库的文本中不能包含 NUL 字符
+		return !strings.ContainsRune(c.Value, 0)
+	default:
+		return false
+	}
+}
+
+// ImageListOptions 列出图片的排序、过滤和分页条件（零值表示不限制）
+type ImageListOptions struct {
+	Sort  string       // 排序方式: ImageSortCreated | ImageSortUpdated | ImageSortName | ImageSortSize
+	Desc  bool         // 是否倒序
+	After *ImageCursor // 从游标之后开始（为 nil 时从第一条开始）
+	Limit int
+
+	SourceType    string
+	MimeType      string
+	CreatedAfter  time.Time // 创建时间下限（包含），按数据库中的时间（不带时区）比较
+	CreatedBefore time.Time // 创建时间上限（不包含）
+	MinSize       int64     // 文件大小下限（包含，字节）
+	MaxSize       int64     // 文件大小上限（包含，字节）
+	Tags          []string  // 标签（需要包含所有标签，已去重）
+}
 
-	rows, err := r.db.QueryContext(ctx, query, workspaceName)
+// ListByWorkspaceName 根据工作区名称按排序方式分页列出图片
+// 使用游标（keyset）分页：按 (排序字段, id) 从上一页最后一条记录之后继续，翻页时不会因新增或删除记录而重复或遗漏
+func (r *imageRepository) ListByWorkspaceName(ctx context.Context, workspaceName string, opts ImageListOptions) ([]*Image, error) {
+	sortColumn, ok := imageSortColumns[opts.Sort]
+	if !ok {
+		return nil, fmt.Errorf("不支持的排序方式: %s", opts.Sort)
+	}
+
+	conditions := []string{"workspace_id = (SELECT id FROM workspaces WHERE name = $1)"}
+	args := []interface{}{workspaceName}
+	// addCondition 添加过滤条件，format 中的 %s 依次替换为参数占位符
+	addCondition := func(format string, values ...interface{}) {
+		placeholders := make([]interface{}, 0, len(values))
+		for _, value := range values {
+			args = append(args, value)
+			placeholders = append(placeholders, fmt.Sprintf("$%d", len(args)))
+		}
+		conditions = append(conditions, fmt.Sprintf(format, placeholders...))
+	}
+
+	if opts.SourceType != "" {
+		addCondition("source_type = %s", opts.SourceType)
+	}
+	if opts.MimeType != "" {
+		addCondition("mime_type = %s", opts.MimeType)
+	}
+	if !opts.CreatedAfter.IsZero() {
+		addCondition("created_at >= %s::timestamp", opts.CreatedAfter.Format(timestampLayout))
+	}
+	if !opts.CreatedBefore.IsZero() {
+		addCondition("created_at < %s::timestamp", opts.CreatedBefore.Format(timestampLayout))
+	}
+	if opts.MinSize > 0 {
+		addCondition("size >= %s", opts.MinSize)
+	}
+	if opts.MaxSize > 0 {
+		addCondition("size <= %s", opts.MaxSize)
+	}
+	if len(opts.Tags) > 0 {
+		addCondition(`id IN (
+			SELECT it.image_id FROM image_tags it JOIN tags t ON t.id = it.tag_id
+			WHERE t.workspace_id = images.workspace_id AND t.name = ANY(%s)
+			GROUP BY it.image_id HAVING COUNT(*) = %s
+		)`, pq.Array(opts.Tags), len(opts.Tags))
+	}
+
+	direction, comparison := "ASC", ">"
+	if opts.Desc {
+		direction, comparison = "DESC", "<"
+	}
+	if opts.After != nil {
+		addCondition("("+sortColumn.column+", id) "+comparison+" (%s"+sortColumn.cast+", %s)", opts.After.Value, opts.After.ID)
+	}
+
+	query := `
+		SELECT ` + imageListColumns + `
+		FROM images
+		WHERE ` + strings.Join(conditions, " AND ") + fmt.Sprintf(`
+		ORDER BY %s %s, id %s
+		LIMIT %d
+	`, sortColumn.column, direction, direction, opts.Limit)
+	return r.queryImageList(ctx, query, args...)
+}
+
+// queryImageList 执行查询并扫描图片列表（字段为 imageListColumns）
+func (r *imageRepository) queryImageList(ctx context.Context, query string, args ...interface{}) ([]*Image, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("列出图片失败: %w", err)
 	}
@@ -319,9 +492,7 @@ func (r *imageRepository) ListByWorkspaceName(ctx context.Context, workspaceName
 			&img.WorkspaceID,
 			&img.Name,
 			&img.OSSPath,
-			&img.OSSUrl,
 			&img.ThumbnailPath,
-			&img.ThumbnailUrl,
 			&img.Size,
 			&img.MimeType,
 			&img.SourceType,
@@ -342,12 +513,73 @@ func (r *imageRepository) ListByWorkspaceName(ctx context.Context, workspaceName
 }
 
 // Update 更新图片记录
-// 支持更新 name, oss_path, oss_url, thumbnail_path, thumbnail_url 字段
+// 支持更新 name, oss_path, thumbnail_path, size, mime_type, content_hash 字段
 func (r *imageRepository) Update(ctx context.Context, id int64, updates map[string]interface{}) (*Image, error) {
 	if len(updates) == 0 {
 		return r.GetByID(ctx, id)
 	}
 
+	query, args := buildImageUpdate(id, updates)
+	img, err := scanImageDetail(r.db.QueryRowContext(ctx, query, args...))
+	if err != nil {
+		return nil, fmt.Errorf("更新图片失败: %w", err)
+	}
+
+	return img, nil
+}
+
+// UpdateWithStorageOps 更新图片记录，并在同一事务中登记待删除的存储对象（如重命名后的旧文件）
+// 只登记更新后不再被任何图片记录或对话轮次引用的对象
+func (r *imageRepository) UpdateWithStorageOps(ctx context.Context, id int64, updates map[string]interface{}, keys []string) (*Image, error) {
+	return r.updateWithStorageOps(ctx, id, updates, keys, nil)
+}
+
+// ReplaceShared 将图片记录指向与其他记录共享的文件（updates 中的 oss_path 和 thumbnail_path），其余同 UpdateWithStorageOps
+// 与 CreateShared 一样持有路径锁并确认共享的文件仍被引用，否则返回 ErrSharedObjectGone
+func (r *imageRepository) ReplaceShared(ctx context.Context, id int64, updates map[string]interface{}, keys []string) (*Image, error) {
+	shared := make([]string, 0, 2)
+	for _, field := range []string{"oss_path", "thumbnail_path"} {
+		if path, ok := updates[field].(string); ok {
+			shared = append(shared, path)
+		}
+	}
+	return r.updateWithStorageOps(ctx, id, updates, keys, shared)
+}
+
+// updateWithStorageOps 更新图片记录并登记不再被引用的存储对象，shared 为更新后共享的已有文件
+func (r *imageRepository) updateWithStorageOps(ctx context.Context, id int64, updates map[string]interface{}, keys, shared []string) (*Image, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("开启事务失败: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := lockSharedPaths(ctx, tx, shared); err != nil {
+		return nil, err
+	}
+	if err := lockImageReferences(ctx, tx, keys); err != nil {
+		return nil, err
+	}
+	query, args := buildImageUpdate(id, updates)
+	img, err := scanImageDetail(tx.QueryRowContext(ctx, query, args...))
+	if err != nil {
+		if isUniqueViolation(err) {
+			return nil, fmt.Errorf("更新图片失败: %w", ErrImageNameExists)
+		}
+		return nil, fmt.Errorf("更新图片失败: %w", err)
+	}
+	if err := insertUnreferencedStorageOps(ctx, tx, keys); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("提交事务失败: %w", err)
+	}
+	return img, nil
+}
+
+// buildImageUpdate 构建更新图片记录的 SQL
+func buildImageUpdate(id int64, updates map[string]interface{}) (string, []interface{}) {
 	// 构建动态 SQL
 	query := "UPDATE images SET updated_at = CURRENT_TIMESTAMP"
 	args := []interface{}{}
@@ -366,25 +598,32 @@ func (r *imageRepository) Update(ctx context.Context, id int64, updates map[stri
 		argId++
 	}
 
-	if ossUrl, ok := updates["oss_url"].(string); ok {
-		query += fmt.Sprintf(", oss_url = $%d", argId)
-		args = append(args, ossUrl)
-		argId++
-	}
-
 	if thumbnailPath, ok := updates["thumbnail_path"].(string); ok {
 		query += fmt.Sprintf(", thumbnail_path = $%d", argId)
 		args = append(args, thumbnailPath)
 		argId++
 	}
 
-	if thumbnailUrl, ok := updates["thumbnail_url"].(string); ok {
-		query += fmt.Sprintf(", thumbnail_url = $%d", argId)
-		args = append(args, thumbnailUrl)
+	// 以下字段在替换同名图片的内容时更新
+	if size, ok := updates["size"].(int64); ok {
+		query += fmt.Sprintf(", size = $%d", argId)
+		args = append(args, size)
+		argId++
+	}
+
+	if mimeType, ok := updates["mime_type"].(string); ok {
+		query += fmt.Sprintf(", mime_type = $%d", argId)
+		args = append(args, mimeType)
+		argId++
+	}
+
+	if contentHash, ok := updates["content_hash"].(string); ok {
+		query += fmt.Sprintf(", content_hash = $%d", argId)
+		args = append(args, contentHash)
 		argId++
 	}
 
-	// source_type, prompt, ref_images, message_list 也可以支持更新，但目前需求主要是重命名
+	// source_type, prompt, ref_images, message_list 也可以支持更新，但目前需求主要是重命名和替换内容
 
 	// 添加 WHERE 子句
 	query += fmt.Sprintf(" WHERE id = $%d", argId)
@@ -392,50 +631,123 @@ func (r *imageRepository) Update(ctx context.Context, id int64, updates map[stri
 
 	// 添加 RETURNING 子句
 	query += `
-		RETURNING id, workspace_id, name, oss_path, oss_url,
-		          thumbnail_path, thumbnail_url, size, mime_type,
-		          source_type, prompt, ref_images, message_list,
-		          created_at, updated_at
-	`
+		RETURNING ` + imageDetailColumns
 
-	var img Image
-	var refImagesBytes, messageListBytes []byte
+	return query, args
+}
 
-	err := r.db.QueryRowContext(ctx, query, args...).Scan(
-		&img.ID,
-		&img.WorkspaceID,
-		&img.Name,
-		&img.OSSPath,
-		&img.OSSUrl,
-		&img.ThumbnailPath,
-		&img.ThumbnailUrl,
-		&img.Size,
-		&img.MimeType,
-		&img.SourceType,
-		&img.Prompt,
-		&refImagesBytes,
-		&messageListBytes,
-		&img.CreatedAt,
-		&img.UpdatedAt,
-	)
+// Delete 根据 ID 删除图片
+func (r *imageRepository) Delete(ctx context.Context, id int64) error {
+	return deleteImage(ctx, r.db, id)
+}
+
+// DeleteWithStorageOps 删除图片记录，并在同一事务中登记待删除的存储对象（原图和缩略图）
+// 内容相同的图片共享存储对象，只登记删除后引用数为 0 的对象
+func (r *imageRepository) DeleteWithStorageOps(ctx context.Context, id int64, keys []string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
 	if err != nil {
-		return nil, fmt.Errorf("更新图片失败: %w", err)
+		return fmt.Errorf("开启事务失败: %w", err)
 	}
+	defer tx.Rollback()
 
-	if len(refImagesBytes) > 0 {
-		json.Unmarshal(refImagesBytes, &img.RefImages)
+	if err := lockImageReferences(ctx, tx, keys); err != nil {
+		return err
 	}
-	if len(messageListBytes) > 0 {
-		json.Unmarshal(messageListBytes, &img.MessageList)
+	if err := deleteImage(ctx, tx, id); err != nil {
+		return err
+	}
+	if err := insertUnreferencedStorageOps(ctx, tx, keys); err != nil {
+		return err
 	}
 
-	return &img, nil
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("提交事务失败: %w", err)
+	}
+	return nil
 }
 
-// Delete 根据 ID 删除图片
-func (r *imageRepository) Delete(ctx context.Context, id int64) error {
+// imagePathReferencedQuery 查询对象路径是否被图片记录（作为原图或缩略图）或对话轮次的图片片段引用
+// 对话历史只保存图片路径，图片记录被删除或重命名后继续对话仍需读取原路径的文件
+const imagePathReferencedQuery = `
+	SELECT EXISTS(SELECT 1 FROM images WHERE oss_path = $1 OR thumbnail_path = $1)
+	    OR EXISTS(SELECT 1 FROM conversation_turns WHERE parts @> jsonb_build_array(jsonb_build_object('path', $1::text)))
+`
+
+// pathLockNamespace 对象路径锁（事务级 advisory lock）的命名空间，与路径的哈希值组成锁 ID
+const pathLockNamespace int32 = 0x696d67 // "img"
+
+// lockPaths 获取对象路径的锁，事务结束时释放（按路径排序加锁，避免死锁）
+func lockPaths(ctx context.Context, tx *sql.Tx, keys []string) error {
+	keys = slices.Compact(slices.Sorted(slices.Values(keys)))
+	for _, key := range keys {
+		if key == "" {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1, hashtext($2))`, pathLockNamespace, key); err != nil {
+			return fmt.Errorf("锁定存储路径失败: %w", err)
+		}
+	}
+	return nil
+}
+
+// lockSharedPaths 锁定要共享的已有文件路径，并确认它们仍被图片记录引用
+// 路径不再被引用时存储操作任务可能已删除文件，返回 ErrSharedObjectGone
+func lockSharedPaths(ctx context.Context, tx *sql.Tx, keys []string) error {
+	if err := lockPaths(ctx, tx, keys); err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if key == "" {
+			continue
+		}
+		var referenced bool
+		if err := tx.QueryRowContext(ctx, imagePathReferencedQuery, key).Scan(&referenced); err != nil {
+			return fmt.Errorf("查询图片路径失败: %w", err)
+		}
+		if !referenced {
+			return fmt.Errorf("%w: %s", ErrSharedObjectGone, key)
+		}
+	}
+	return nil
+}
+
+// lockImageReferences 锁定引用这些对象的所有图片记录
+// 并发删除共享同一对象的记录时依次执行，后提交的事务能看到先提交的删除，保证最后一个引用被删除时登记删除文件
+func lockImageReferences(ctx context.Context, tx *sql.Tx, keys []string) error {
+	for _, key := range keys {
+		if key == "" {
+			continue
+		}
+		query := `SELECT id FROM images WHERE oss_path = $1 OR thumbnail_path = $1 ORDER BY id FOR UPDATE`
+		if _, err := tx.ExecContext(ctx, query, key); err != nil {
+			return fmt.Errorf("锁定图片记录失败: %w", err)
+		}
+	}
+	return nil
+}
+
+// insertUnreferencedStorageOps 登记删除不再被任何图片记录或对话轮次引用的对象
+func insertUnreferencedStorageOps(ctx context.Context, tx *sql.Tx, keys []string) error {
+	unreferenced := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if key == "" {
+			continue
+		}
+		var referenced bool
+		if err := tx.QueryRowContext(ctx, imagePathReferencedQuery, key).Scan(&referenced); err != nil {
+			return fmt.Errorf("统计图片引用失败: %w", err)
+		}
+		if !referenced {
+			unreferenced = append(unreferenced, key)
+		}
+	}
+	return insertStorageOps(ctx, tx, unreferenced)
+}
+
+// deleteImage 根据 ID 删除图片记录
+func deleteImage(ctx context.Context, db execer, id int64) error {
 	query := `DELETE FROM images WHERE id = $1`
-	result, err := r.db.ExecContext(ctx, query, id)
+	result, err := db.ExecContext(ctx, query, id)
 	if err != nil {
 		return fmt.Errorf("删除图片失败: %w", err)
 	}
@@ -452,6 +764,24 @@ func (r *imageRepository) Delete(ctx context.Context, id int64) error {
 	return nil
 }
 
+// LockPath 开启事务并持有对象路径的锁，返回路径是否被图片记录或对话轮次引用，调用 unlock 释放锁
+// 存储操作任务在确认没有引用到删除文件期间持有锁，CreateShared 和 ReplaceShared 需要等待锁释放
+func (r *imageRepository) LockPath(ctx context.Context, path string) (referenced bool, unlock func(), err error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, nil, fmt.Errorf("开启事务失败: %w", err)
+	}
+	if err := lockPaths(ctx, tx, []string{path}); err != nil {
+		tx.Rollback()
+		return false, nil, err
+	}
+	if err := tx.QueryRowContext(ctx, imagePathReferencedQuery, path).Scan(&referenced); err != nil {
+		tx.Rollback()
+		return false, nil, fmt.Errorf("查询图片路径失败: %w", err)
+	}
+	return referenced, func() { tx.Rollback() }, nil
+}
+
 // DeleteByOSSPath 根据 OSS 路径删除图片
 func (r *imageRepository) DeleteByOSSPath(ctx context.Context, ossPath string) error {
 	query := `DELETE FROM images WHERE oss_path = $1`
@@ -471,3 +801,91 @@ func (r *imageRepository) DeleteByOSSPath(ctx context.Context, ossPath string) e
 
 	return nil
 }
+
+// ListByGenerationRun 列出由指定模型调用生成的图片（按候选序号排列）
+func (r *imageRepository) ListByGenerationRun(ctx context.Context, runID int64) ([]*Image, error) {
+	query := `
+		SELECT ` + imageDetailColumns + `
+		FROM images
+		WHERE generation_run_id = $1
+		ORDER BY candidate_index ASC, id ASC
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, runID)
+	if err != nil {
+		return nil, fmt.Errorf("列出图片失败: %w", err)
+	}
+	defer rows.Close()
+
+	images := make([]*Image, 0)
+	for rows.Next() {
+		img, err := scanImageDetail(rows)
+		if err != nil {
+			return nil, fmt.Errorf("扫描图片数据失败: %w", err)
+		}
+		images = append(images, img)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("遍历图片数据失败: %w", err)
+	}
+
+	return images, nil
+}
+
+// ImageSearchResult 全文搜索结果
+type ImageSearchResult struct {
+	*Image
+	Rank float64 // 相关度（ts_rank，文件名、提示词、对话文本的权重依次降低）
+}
+
+// rankedRow 扫描图片详情字段后再扫描相关度
+type rankedRow struct {
+	row  interface{ Scan(dest ...any) error }
+	rank *float64
+}
+
+func (r rankedRow) Scan(dest ...any) error {
+	return r.row.Scan(append(dest, r.rank)...)
+}
+
+// Search 在工作区中全文搜索图片（search_vector 由触发器根据文件名、提示词和对话文本维护），按相关度排序
+// terms 为按 image_search_tokens 相同规则切分后的查询词元，需要全部匹配
+func (r *imageRepository) Search(ctx context.Context, workspaceName string, terms []string, limit, offset int) ([]*ImageSearchResult, error) {
+	query := `
+		SELECT ` + imageDetailColumns + `, ts_rank(search_vector, query) AS rank
+		FROM images, plainto_tsquery('simple', $2) AS query
+		WHERE workspace_id = (SELECT id FROM workspaces WHERE name = $1)
+		  AND search_vector @@ query
+		ORDER BY rank DESC, created_at DESC, id DESC
+		LIMIT $3 OFFSET $4
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, workspaceName, strings.Join(terms, " "), limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("搜索图片失败: %w", err)
+	}
+	defer rows.Close()
+
+	results := make([]*ImageSearchResult, 0)
+	for rows.Next() {
+		var rank float64
+		img, err := scanImageDetail(rankedRow{row: rows, rank: &rank})
+		if err != nil {
+			return nil, fmt.Errorf("扫描图片数据失败: %w", err)
+		}
+		results = append(results, &ImageSearchResult{Image: img, Rank: rank})
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("遍历图片数据失败: %w", err)
+	}
+
+	return results, nil
+}
+
+// isUniqueViolation 判断错误是否为唯一约束冲突
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
@@ -0,0 +1,171 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+// ErrTagImageNotFound 要添加或移除标签的图片不存在或不属于该工作区
+var ErrTagImageNotFound = errors.New("图片不存在或不属于该工作区")
+
+// TagCount 工作区中的标签及使用该标签的图片数量
+type TagCount struct {
+	Name  string `json:"name"`
+	Count int64  `json:"count"`
+}
+
+// AddTags 为工作区中的多张图片添加标签（不存在的标签自动创建，已有的标签忽略）
+// imageIDs 和 tags 需要已去重；有图片不属于该工作区时返回 ErrTagImageNotFound，不做任何修改
+func (r *imageRepository) AddTags(ctx context.Context, workspaceID int64, imageIDs []int64, tags []string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("开启事务失败: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := checkWorkspaceImages(ctx, tx, workspaceID, imageIDs); err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO tags (workspace_id, name)
+		SELECT $1, unnest($2::text[])
+		ON CONFLICT (workspace_id, name) DO NOTHING
+	`
+	if _, err := tx.ExecContext(ctx, query, workspaceID, pq.Array(tags)); err != nil {
+		return fmt.Errorf("创建标签失败: %w", err)
+	}
+
+	query = `
+		INSERT INTO image_tags (image_id, tag_id)
+		SELECT image_id, t.id
+		FROM unnest($1::bigint[]) AS image_id, tags t
+		WHERE t.workspace_id = $2 AND t.name = ANY($3)
+		ON CONFLICT DO NOTHING
+	`
+	if _, err := tx.ExecContext(ctx, query, pq.Array(imageIDs), workspaceID, pq.Array(tags)); err != nil {
+		return fmt.Errorf("添加图片标签失败: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("提交事务失败: %w", err)
+	}
+	return nil
+}
+
+// RemoveTags 移除工作区中多张图片的标签（图片没有的标签忽略）
+// 标签本身保留，没有图片使用的标签不会出现在 ListTags 中
+func (r *imageRepository) RemoveTags(ctx context.Context, workspaceID int64, imageIDs []int64, tags []string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("开启事务失败: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := checkWorkspaceImages(ctx, tx, workspaceID, imageIDs); err != nil {
+		return err
+	}
+
+	query := `
+		DELETE FROM image_tags it
+		USING tags t
+		WHERE it.tag_id = t.id
+		  AND t.workspace_id = $1 AND t.name = ANY($2)
+		  AND it.image_id = ANY($3)
+	`
+	if _, err := tx.ExecContext(ctx, query, workspaceID, pq.Array(tags), pq.Array(imageIDs)); err != nil {
+		return fmt.Errorf("移除图片标签失败: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("提交事务失败: %w", err)
+	}
+	return nil
+}
+
+// checkWorkspaceImages 检查图片是否都属于该工作区
+func checkWorkspaceImages(ctx context.Context, tx *sql.Tx, workspaceID int64, imageIDs []int64) error {
+	var count int
+	query := `SELECT COUNT(*) FROM images WHERE id = ANY($1) AND workspace_id = $2`
+	if err := tx.QueryRowContext(ctx, query, pq.Array(imageIDs), workspaceID).Scan(&count); err != nil {
+		return fmt.Errorf("查询图片失败: %w", err)
+	}
+	if count != len(imageIDs) {
+		return ErrTagImageNotFound
+	}
+	return nil
+}
+
+// ListTags 列出工作区中正在使用的标签及图片数量，按数量倒序、名称正序排列
+func (r *imageRepository) ListTags(ctx context.Context, workspaceID int64) ([]*TagCount, error) {
+	query := `
+		SELECT t.name, COUNT(*) AS count
+		FROM tags t
+		JOIN image_tags it ON it.tag_id = t.id
+		WHERE t.workspace_id = $1
+		GROUP BY t.id, t.name
+		ORDER BY count DESC, t.name ASC
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, workspaceID)
+	if err != nil {
+		return nil, fmt.Errorf("列出标签失败: %w", err)
+	}
+	defer rows.Close()
+
+	tags := make([]*TagCount, 0)
+	for rows.Next() {
+		var tag TagCount
+		if err := rows.Scan(&tag.Name, &tag.Count); err != nil {
+			return nil, fmt.Errorf("扫描标签数据失败: %w", err)
+		}
+		tags = append(tags, &tag)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("遍历标签数据失败: %w", err)
+	}
+
+	return tags, nil
+}
+
+// ListTagsByImages 批量查询图片的标签，返回图片 ID 到标签名称（按名称排序）的映射，没有标签的图片不在结果中
+func (r *imageRepository) ListTagsByImages(ctx context.Context, imageIDs []int64) (map[int64][]string, error) {
+	tags := make(map[int64][]string)
+	if len(imageIDs) == 0 {
+		return tags, nil
+	}
+
+	query := `
+		SELECT it.image_id, t.name
+		FROM image_tags it
+		JOIN tags t ON t.id = it.tag_id
+		WHERE it.image_id = ANY($1)
+		ORDER BY it.image_id, t.name
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, pq.Array(imageIDs))
+	if err != nil {
+		return nil, fmt.Errorf("查询图片标签失败: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var imageID int64
+		var name string
+		if err := rows.Scan(&imageID, &name); err != nil {
+			return nil, fmt.Errorf("扫描标签数据失败: %w", err)
+		}
+		tags[imageID] = append(tags[imageID], name)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("遍历标签数据失败: %w", err)
+	}
+
+	return tags, nil
+}
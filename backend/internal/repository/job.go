@@ -0,0 +1,236 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/guixu633/agent/backend/internal/database"
+	"github.com/lib/pq"
+)
+
+// 生成任务状态
+const (
+	JobStatusQueued    = "queued"
+	JobStatusRunning   = "running"
+	JobStatusSucceeded = "succeeded"
+	JobStatusFailed    = "failed"
+	JobStatusCancelled = "cancelled"
+)
+
+// Job 生成任务数据库模型
+type Job struct {
+	ID          int64           `json:"id"`
+	WorkspaceID int64           `json:"workspace_id"`
+	Model       string          `json:"model"`
+	Status      string          `json:"status"`
+	Request     json.RawMessage `json:"request"` // 生成请求（JSON）
+	Result      json.RawMessage `json:"result"`  // 生成结果（JSON，成功时有效）
+	Error       string          `json:"error"`
+	ClaimedBy   string          `json:"claimed_by"` // 领取任务的服务实例（运行中时有效）
+	HeartbeatAt *time.Time      `json:"heartbeat_at"`
+	StartedAt   *time.Time      `json:"started_at"`
+	FinishedAt  *time.Time      `json:"finished_at"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+}
+
+// JobRepository 生成任务仓库接口
+type JobRepository interface {
+	Create(ctx context.Context, job *Job) (*Job, error)
+	GetByID(ctx context.Context, id int64) (*Job, error)
+	ClaimNext(ctx context.Context, claimedBy string, excludeModels []string) (*Job, error)
+	Heartbeat(ctx context.Context, claimedBy string, ids []int64) error
+	MarkFinished(ctx context.Context, id int64, claimedBy string, status string, result json.RawMessage, errMsg string) error
+	Cancel(ctx context.Context, id int64) (bool, error)
+	RequeueStale(ctx context.Context, timeout time.Duration) (int64, error)
+}
+
+type jobRepository struct {
+	db *sql.DB
+}
+
+// NewJobRepository 创建生成任务仓库实例
+func NewJobRepository() JobRepository {
+	return &jobRepository{
+		db: database.DB,
+	}
+}
+
+const jobColumns = `id, workspace_id, model, status, request, result, error,
+		       claimed_by, heartbeat_at, started_at, finished_at, created_at, updated_at`
+
+// scanJob 扫描一行任务数据
+func scanJob(row interface{ Scan(dest ...any) error }) (*Job, error) {
+	var job Job
+	var request, result []byte
+	var heartbeatAt, startedAt, finishedAt sql.NullTime
+	if err := row.Scan(
+		&job.ID,
+		&job.WorkspaceID,
+		&job.Model,
+		&job.Status,
+		&request,
+		&result,
+		&job.Error,
+		&job.ClaimedBy,
+		&heartbeatAt,
+		&startedAt,
+		&finishedAt,
+		&job.CreatedAt,
+		&job.UpdatedAt,
+	); err != nil {
+		return nil, err
+	}
+
+	job.Request = request
+	job.Result = result
+	if heartbeatAt.Valid {
+		job.HeartbeatAt = &heartbeatAt.Time
+	}
+	if startedAt.Valid {
+		job.StartedAt = &startedAt.Time
+	}
+	if finishedAt.Valid {
+		job.FinishedAt = &finishedAt.Time
+	}
+	return &job, nil
+}
+
+// Create 创建生成任务（状态为 queued）
+func (r *jobRepository) Create(ctx context.Context, job *Job) (*Job, error) {
+	query := `
+		INSERT INTO generation_jobs (workspace_id, model, status, request, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+		RETURNING ` + jobColumns
+
+	request := job.Request
+	if len(request) == 0 {
+		request = json.RawMessage("{}")
+	}
+
+	result, err := scanJob(r.db.QueryRowContext(ctx, query, job.WorkspaceID, job.Model, JobStatusQueued, []byte(request)))
+	if err != nil {
+		return nil, fmt.Errorf("创建生成任务失败: %w", err)
+	}
+	return result, nil
+}
+
+// GetByID 根据 ID 获取生成任务
+func (r *jobRepository) GetByID(ctx context.Context, id int64) (*Job, error) {
+	query := `SELECT ` + jobColumns + ` FROM generation_jobs WHERE id = $1`
+
+	job, err := scanJob(r.db.QueryRowContext(ctx, query, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("获取生成任务失败: %w", err)
+	}
+	return job, nil
+}
+
+// ClaimNext 领取最早提交的排队任务（跳过 excludeModels 中模型的任务），标记为运行中并记录领取的实例
+// 使用 FOR UPDATE SKIP LOCKED，多个实例同时调度时同一任务只会被一个实例领取；没有可领取的任务时返回 nil
+func (r *jobRepository) ClaimNext(ctx context.Context, claimedBy string, excludeModels []string) (*Job, error) {
+	query := `
+		UPDATE generation_jobs
+		SET status = $1, claimed_by = $2, heartbeat_at = CURRENT_TIMESTAMP, started_at = CURRENT_TIMESTAMP
+		WHERE id = (
+			SELECT id FROM generation_jobs
+			WHERE status = $3 AND model <> ALL($4)
+			ORDER BY id ASC
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING ` + jobColumns
+
+	// nil 切片会被转换为 NULL，需要传入空数组
+	job, err := scanJob(r.db.QueryRowContext(ctx, query, JobStatusRunning, claimedBy, JobStatusQueued, pq.Array(append([]string{}, excludeModels...))))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("领取排队任务失败: %w", err)
+	}
+	return job, nil
+}
+
+// Heartbeat 刷新本实例运行中任务的心跳时间
+func (r *jobRepository) Heartbeat(ctx context.Context, claimedBy string, ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	query := `
+		UPDATE generation_jobs
+		SET heartbeat_at = CURRENT_TIMESTAMP
+		WHERE id = ANY($1) AND status = $2 AND claimed_by = $3
+	`
+	if _, err := r.db.ExecContext(ctx, query, pq.Array(ids), JobStatusRunning, claimedBy); err != nil {
+		return fmt.Errorf("刷新任务心跳失败: %w", err)
+	}
+	return nil
+}
+
+// MarkFinished 记录运行中任务的最终状态和结果
+// 任务已被取消，或心跳超时后已被重新排队（可能已由其他实例领取）时不做修改
+func (r *jobRepository) MarkFinished(ctx context.Context, id int64, claimedBy string, status string, result json.RawMessage, errMsg string) error {
+	query := `
+		UPDATE generation_jobs
+		SET status = $1, result = $2, error = $3, finished_at = CURRENT_TIMESTAMP
+		WHERE id = $4 AND status = $5 AND claimed_by = $6
+	`
+
+	var resultBytes []byte
+	if len(result) > 0 {
+		resultBytes = result
+	}
+
+	_, err := r.db.ExecContext(ctx, query, status, resultBytes, errMsg, id, JobStatusRunning, claimedBy)
+	if err != nil {
+		return fmt.Errorf("更新任务结果失败: %w", err)
+	}
+	return nil
+}
+
+// Cancel 取消排队中或运行中的任务
+// 返回 false 表示任务已结束，无法取消
+func (r *jobRepository) Cancel(ctx context.Context, id int64) (bool, error) {
+	query := `
+		UPDATE generation_jobs
+		SET status = $1, finished_at = CURRENT_TIMESTAMP
+		WHERE id = $2 AND status IN ($3, $4)
+	`
+	result, err := r.db.ExecContext(ctx, query, JobStatusCancelled, id, JobStatusQueued, JobStatusRunning)
+	if err != nil {
+		return false, fmt.Errorf("取消任务失败: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("获取更新行数失败: %w", err)
+	}
+	return rowsAffected > 0, nil
+}
+
+// RequeueStale 将心跳超时的运行中任务重新排队（领取任务的实例已退出，如服务重启或崩溃）
+func (r *jobRepository) RequeueStale(ctx context.Context, timeout time.Duration) (int64, error) {
+	query := `
+		UPDATE generation_jobs
+		SET status = $1, claimed_by = '', heartbeat_at = NULL, started_at = NULL
+		WHERE status = $2
+		  AND (heartbeat_at IS NULL OR heartbeat_at < CURRENT_TIMESTAMP - $3 * INTERVAL '1 second')
+	`
+	result, err := r.db.ExecContext(ctx, query, JobStatusQueued, JobStatusRunning, timeout.Seconds())
+	if err != nil {
+		return 0, fmt.Errorf("恢复中断任务失败: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("获取更新行数失败: %w", err)
+	}
+	return rowsAffected, nil
+}
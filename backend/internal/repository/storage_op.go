@@ -0,0 +1,261 @@
+package repository
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/guixu633/agent/backend/internal/database"
+)
+
+// 存储操作类型
+const (
+	StorageOpDelete = "delete"
+)
+
+// 存储操作状态（执行成功的操作直接删除）
+const (
+	StorageOpStatusPending = "pending"
+	StorageOpStatusFailed  = "failed"
+)
+
+// StorageOp 待执行的存储操作数据库模型
+type StorageOp struct {
+	ID            int64     `json:"id"`
+	Op            string    `json:"op"`
+	ObjectKey     string    `json:"object_key"`
+	Status        string    `json:"status"`
+	Attempts      int       `json:"attempts"`
+	LastError     string    `json:"last_error"`
+	NextAttemptAt time.Time `json:"next_attempt_at"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// StorageOpRepository 待执行存储操作仓库接口
+type StorageOpRepository interface {
+	Enqueue(ctx context.Context, keys ...string) error
+	ClaimDue(ctx context.Context, limit int, lease time.Duration) ([]*StorageOp, error)
+	List(ctx context.Context, status string, limit int) ([]*StorageOp, error)
+	CountByStatus(ctx context.Context) (map[string]int64, error)
+	Complete(ctx context.Context, id int64) error
+	Retry(ctx context.Context, id int64, errMsg string, delay time.Duration) error
+	Fail(ctx context.Context, id int64, errMsg string) error
+	Requeue(ctx context.Context, id int64) (bool, error)
+}
+
+type storageOpRepository struct {
+	db *sql.DB
+}
+
+// NewStorageOpRepository 创建待执行存储操作仓库实例
+func NewStorageOpRepository() StorageOpRepository {
+	return &storageOpRepository{
+		db: database.DB,
+	}
+}
+
+const storageOpColumns = `id, op, object_key, status, attempts, last_error,
+		       next_attempt_at, created_at, updated_at`
+
+// scanStorageOp 扫描一行存储操作数据
+func scanStorageOp(row interface{ Scan(dest ...any) error }) (*StorageOp, error) {
+	var op StorageOp
+	if err := row.Scan(
+		&op.ID,
+		&op.Op,
+		&op.ObjectKey,
+		&op.Status,
+		&op.Attempts,
+		&op.LastError,
+		&op.NextAttemptAt,
+		&op.CreatedAt,
+		&op.UpdatedAt,
+	); err != nil {
+		return nil, err
+	}
+	return &op, nil
+}
+
+// execer 可执行 SQL 的对象（*sql.DB 或 *sql.Tx），用于在其他仓库的事务中登记存储操作
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// insertStorageOps 登记待删除的存储对象（空路径会被跳过）
+func insertStorageOps(ctx context.Context, db execer, keys []string) error {
+	for _, key := range keys {
+		if key == "" {
+			continue
+		}
+		_, err := db.ExecContext(ctx, `
+			INSERT INTO pending_storage_ops (op, object_key, status)
+			VALUES ($1, $2, $3)
+		`, StorageOpDelete, key, StorageOpStatusPending)
+		if err != nil {
+			return fmt.Errorf("登记存储操作失败: %w", err)
+		}
+	}
+	return nil
+}
+
+// Enqueue 登记待删除的存储对象
+func (r *storageOpRepository) Enqueue(ctx context.Context, keys ...string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("开启事务失败: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := insertStorageOps(ctx, tx, keys); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("提交事务失败: %w", err)
+	}
+	return nil
+}
+
+// ClaimDue 领取一批到达执行时间的待执行操作（按登记顺序），并将执行时间推迟 lease
+// 使用 FOR UPDATE SKIP LOCKED，多个实例同时处理时同一操作只会被一个实例领取；
+// 领取的实例在 lease 内没有完成、重试或标记失败（如实例退出）时，操作到期后会被重新领取
+func (r *storageOpRepository) ClaimDue(ctx context.Context, limit int, lease time.Duration) ([]*StorageOp, error) {
+	query := `
+		UPDATE pending_storage_ops
+		SET next_attempt_at = CURRENT_TIMESTAMP + $1 * INTERVAL '1 second'
+		WHERE id IN (
+			SELECT id FROM pending_storage_ops
+			WHERE status = $2 AND next_attempt_at <= CURRENT_TIMESTAMP
+			ORDER BY id ASC
+			LIMIT $3
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING ` + storageOpColumns
+	ops, err := r.query(ctx, query, lease.Seconds(), StorageOpStatusPending, limit)
+	if err != nil {
+		return nil, err
+	}
+	// RETURNING 不保证顺序
+	slices.SortFunc(ops, func(a, b *StorageOp) int { return cmp.Compare(a.ID, b.ID) })
+	return ops, nil
+}
+
+// List 列出存储操作（最新登记的在前），status 为空时列出所有状态
+func (r *storageOpRepository) List(ctx context.Context, status string, limit int) ([]*StorageOp, error) {
+	query := `
+		SELECT ` + storageOpColumns + `
+		FROM pending_storage_ops
+		WHERE ($1 = '' OR status = $1)
+		ORDER BY id DESC
+		LIMIT $2
+	`
+	return r.query(ctx, query, status, limit)
+}
+
+// query 执行查询并扫描存储操作列表
+func (r *storageOpRepository) query(ctx context.Context, query string, args ...any) ([]*StorageOp, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("列出存储操作失败: %w", err)
+	}
+	defer rows.Close()
+
+	ops := make([]*StorageOp, 0)
+	for rows.Next() {
+		op, err := scanStorageOp(rows)
+		if err != nil {
+			return nil, fmt.Errorf("扫描存储操作数据失败: %w", err)
+		}
+		ops = append(ops, op)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("遍历存储操作数据失败: %w", err)
+	}
+
+	return ops, nil
+}
+
+// CountByStatus 按状态统计存储操作数量
+func (r *storageOpRepository) CountByStatus(ctx context.Context) (map[string]int64, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT status, COUNT(*) FROM pending_storage_ops GROUP BY status`)
+	if err != nil {
+		return nil, fmt.Errorf("统计存储操作失败: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int64)
+	for rows.Next() {
+		var status string
+		var count int64
+		if err := rows.Scan(&status, &count); err != nil {
+			return nil, fmt.Errorf("扫描存储操作统计失败: %w", err)
+		}
+		counts[status] = count
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("遍历存储操作统计失败: %w", err)
+	}
+
+	return counts, nil
+}
+
+// Complete 删除执行成功的操作
+func (r *storageOpRepository) Complete(ctx context.Context, id int64) error {
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM pending_storage_ops WHERE id = $1`, id); err != nil {
+		return fmt.Errorf("删除存储操作失败: %w", err)
+	}
+	return nil
+}
+
+// Retry 记录失败原因，delay 后重试
+func (r *storageOpRepository) Retry(ctx context.Context, id int64, errMsg string, delay time.Duration) error {
+	query := `
+		UPDATE pending_storage_ops
+		SET attempts = attempts + 1, last_error = $1,
+		    next_attempt_at = CURRENT_TIMESTAMP + $2 * INTERVAL '1 millisecond'
+		WHERE id = $3
+	`
+	if _, err := r.db.ExecContext(ctx, query, errMsg, delay.Milliseconds(), id); err != nil {
+		return fmt.Errorf("更新存储操作失败: %w", err)
+	}
+	return nil
+}
+
+// Fail 记录失败原因并不再重试
+func (r *storageOpRepository) Fail(ctx context.Context, id int64, errMsg string) error {
+	query := `
+		UPDATE pending_storage_ops
+		SET attempts = attempts + 1, last_error = $1, status = $2
+		WHERE id = $3
+	`
+	if _, err := r.db.ExecContext(ctx, query, errMsg, StorageOpStatusFailed, id); err != nil {
+		return fmt.Errorf("更新存储操作失败: %w", err)
+	}
+	return nil
+}
+
+// Requeue 将失败的操作重新排队并清零重试次数
+// 返回 false 表示操作不存在或不处于失败状态
+func (r *storageOpRepository) Requeue(ctx context.Context, id int64) (bool, error) {
+	query := `
+		UPDATE pending_storage_ops
+		SET status = $1, attempts = 0, next_attempt_at = CURRENT_TIMESTAMP
+		WHERE id = $2 AND status = $3
+	`
+	result, err := r.db.ExecContext(ctx, query, StorageOpStatusPending, id, StorageOpStatusFailed)
+	if err != nil {
+		return false, fmt.Errorf("重新排队存储操作失败: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("获取更新行数失败: %w", err)
+	}
+	return rowsAffected > 0, nil
+}
@@ -0,0 +1,374 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	awss3 "github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/guixu633/agent/backend/internal/config"
+	"github.com/guixu633/agent/backend/internal/storage"
+)
+
+// Client S3 兼容存储客户端（AWS S3、MinIO、Cloudflare R2 等），实现 storage.BlobStore
+type Client struct {
+	client    *awss3.Client
+	presigner *awss3.PresignClient
+	bucket    string
+	baseURL   string // 对象访问 URL 前缀
+}
+
+// NewClient 创建 S3 客户端
+func NewClient(cfg config.S3StorageConfig) (*Client, error) {
+	if cfg.Bucket == "" {
+		return nil, errors.New("未配置 S3 存储桶")
+	}
+	region := cfg.Region
+	if region == "" {
+		region = config.DefaultS3Region
+	}
+
+	endpoint, err := normalizeEndpoint(cfg.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	options := awss3.Options{
+		Region:       region,
+		UsePathStyle: cfg.PathStyle,
+		// 只在接口要求时计算校验和，部分 S3 兼容服务不支持新版 SDK 默认附加的校验和
+		RequestChecksumCalculation: aws.RequestChecksumCalculationWhenRequired,
+		ResponseChecksumValidation: aws.ResponseChecksumValidationWhenRequired,
+	}
+	if endpoint != nil {
+		options.BaseEndpoint = aws.String(endpoint.String())
+	}
+	if cfg.AccessKeyID != "" || cfg.SecretAccessKey != "" {
+		options.Credentials = aws.NewCredentialsCache(credentials.NewStaticCredentialsProvider(cfg.AccessKeyID, cfg.SecretAccessKey, ""))
+	} else {
+		// 未配置密钥时匿名访问（公开读写的存储桶或本地测试）
+		options.Credentials = aws.AnonymousCredentials{}
+	}
+
+	baseURL := strings.TrimSuffix(cfg.PublicBaseURL, "/")
+	if baseURL == "" {
+		baseURL = defaultBaseURL(endpoint, region, cfg.Bucket, cfg.PathStyle)
+	}
+
+	client := awss3.New(options)
+	return &Client{
+		client:    client,
+		presigner: awss3.NewPresignClient(client),
+		bucket:    cfg.Bucket,
+		baseURL:   baseURL,
+	}, nil
+}
+
+// normalizeEndpoint 解析服务地址，未指定协议时使用 https；为空时返回 nil（使用 AWS 默认地址）
+func normalizeEndpoint(endpoint string) (*url.URL, error) {
+	endpoint = strings.TrimSuffix(strings.TrimSpace(endpoint), "/")
+	if endpoint == "" {
+		return nil, nil
+	}
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "https://" + endpoint
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("S3 服务地址不合法: %s", endpoint)
+	}
+	return u, nil
+}
+
+// defaultBaseURL 根据服务地址生成对象访问 URL 前缀
+// 路径风格: <endpoint>/<bucket>；虚拟主机风格: <scheme>://<bucket>.<host>
+func defaultBaseURL(endpoint *url.URL, region, bucket string, pathStyle bool) string {
+	if endpoint == nil {
+		endpoint = &url.URL{Scheme: "https", Host: fmt.Sprintf("s3.%s.amazonaws.com", region)}
+	}
+	if pathStyle {
+		return fmt.Sprintf("%s/%s", endpoint.String(), bucket)
+	}
+	u := *endpoint
+	u.Host = bucket + "." + u.Host
+	return u.String()
+}
+
+// Put 上传对象
+func (c *Client) Put(ctx context.Context, key string, r io.Reader) error {
+	return c.put(ctx, key, r, false)
+}
+
+// PutIfAbsent 仅在对象不存在时上传（If-None-Match: *）
+func (c *Client) PutIfAbsent(ctx context.Context, key string, r io.Reader) error {
+	return c.put(ctx, key, r, true)
+}
+
+// put 上传对象，ifAbsent 为 true 时带上条件写入头
+func (c *Client) put(ctx context.Context, key string, r io.Reader, ifAbsent bool) error {
+	// 签名需要计算请求体的摘要，不可回退的流先读入内存
+	body, ok := r.(io.ReadSeeker)
+	if !ok {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return fmt.Errorf("读取文件内容失败: %w", err)
+		}
+		body = bytes.NewReader(data)
+	}
+
+	input := &awss3.PutObjectInput{
+		Bucket: aws.String(c.bucket),
+		Key:    aws.String(key),
+		Body:   body,
+	}
+	if contentType := mime.TypeByExtension(path.Ext(key)); contentType != "" {
+		input.ContentType = aws.String(contentType)
+	}
+	if ifAbsent {
+		input.IfNoneMatch = aws.String("*")
+	}
+	if _, err := c.client.PutObject(ctx, input); err != nil {
+		if ifAbsent && isPreconditionFailed(err) {
+			return fmt.Errorf("%w: %s", storage.ErrExists, key)
+		}
+		return fmt.Errorf("上传文件到 S3 失败: %w", err)
+	}
+	return nil
+}
+
+// Get 下载对象
+func (c *Client) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	out, err := c.client.GetObject(ctx, &awss3.GetObjectInput{
+		Bucket: aws.String(c.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		if isNotFound(err) {
+			return nil, fmt.Errorf("%w: %s", storage.ErrNotFound, key)
+		}
+		return nil, fmt.Errorf("从 S3 下载文件失败: %w", err)
+	}
+	return out.Body, nil
+}
+
+// GetRange 下载对象的一部分
+func (c *Client) GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	byteRange := fmt.Sprintf("bytes=%d-", offset)
+	if length >= 0 {
+		byteRange = fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)
+	}
+	out, err := c.client.GetObject(ctx, &awss3.GetObjectInput{
+		Bucket: aws.String(c.bucket),
+		Key:    aws.String(key),
+		Range:  aws.String(byteRange),
+	})
+	if err != nil {
+		if isNotFound(err) {
+			return nil, fmt.Errorf("%w: %s", storage.ErrNotFound, key)
+		}
+		return nil, fmt.Errorf("从 S3 下载文件失败: %w", err)
+	}
+	return out.Body, nil
+}
+
+// Stat 获取对象的大小和修改时间
+func (c *Client) Stat(ctx context.Context, key string) (*storage.Object, error) {
+	out, err := c.client.HeadObject(ctx, &awss3.HeadObjectInput{
+		Bucket: aws.String(c.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		if isNotFound(err) {
+			return nil, fmt.Errorf("%w: %s", storage.ErrNotFound, key)
+		}
+		return nil, fmt.Errorf("获取 S3 文件信息失败: %w", err)
+	}
+	return &storage.Object{
+		Key:          key,
+		Size:         aws.ToInt64(out.ContentLength),
+		LastModified: aws.ToTime(out.LastModified),
+	}, nil
+}
+
+// Copy 在 bucket 内复制对象
+func (c *Client) Copy(ctx context.Context, srcKey, dstKey string) error {
+	_, err := c.client.CopyObject(ctx, &awss3.CopyObjectInput{
+		Bucket:     aws.String(c.bucket),
+		Key:        aws.String(dstKey),
+		CopySource: aws.String(escapeKey(c.bucket + "/" + srcKey)),
+	})
+	if err != nil {
+		if isNotFound(err) {
+			return fmt.Errorf("%w: %s", storage.ErrNotFound, srcKey)
+		}
+		return fmt.Errorf("复制 S3 文件失败: %w", err)
+	}
+	return nil
+}
+
+// CopyIfAbsent 仅在目标对象不存在时复制（If-None-Match: *）
+// 不支持条件复制的兼容存储返回 storage.ErrNotSupported
+func (c *Client) CopyIfAbsent(ctx context.Context, srcKey, dstKey string) error {
+	_, err := c.client.CopyObject(ctx, &awss3.CopyObjectInput{
+		Bucket:      aws.String(c.bucket),
+		Key:         aws.String(dstKey),
+		CopySource:  aws.String(escapeKey(c.bucket + "/" + srcKey)),
+		IfNoneMatch: aws.String("*"),
+	})
+	if err != nil {
+		switch {
+		case isPreconditionFailed(err):
+			return fmt.Errorf("%w: %s", storage.ErrExists, dstKey)
+		case isNotFound(err):
+			return fmt.Errorf("%w: %s", storage.ErrNotFound, srcKey)
+		case isNotImplemented(err):
+			return fmt.Errorf("%w: %v", storage.ErrNotSupported, err)
+		}
+		return fmt.Errorf("复制 S3 文件失败: %w", err)
+	}
+	return nil
+}
+
+// Delete 删除对象（对象不存在时 S3 同样返回成功）
+func (c *Client) Delete(ctx context.Context, key string) error {
+	_, err := c.client.DeleteObject(ctx, &awss3.DeleteObjectInput{
+		Bucket: aws.String(c.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil && !isNotFound(err) {
+		return fmt.Errorf("删除 S3 文件失败: %w", err)
+	}
+	return nil
+}
+
+// DeletePrefix 删除路径以 prefix 开头的所有对象
+// 每列出一页（最多 1000 个对象）就批量删除这一页，再用续页标记继续列出
+func (c *Client) DeletePrefix(ctx context.Context, prefix string, progress storage.DeleteProgress) (*storage.DeleteResult, error) {
+	result := &storage.DeleteResult{}
+	paginator := awss3.NewListObjectsV2Paginator(c.client, &awss3.ListObjectsV2Input{
+		Bucket:  aws.String(c.bucket),
+		Prefix:  aws.String(prefix),
+		MaxKeys: aws.Int32(storage.DeleteBatchSize),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return result, fmt.Errorf("列出 S3 文件失败: %w", err)
+		}
+		if len(page.Contents) == 0 {
+			continue
+		}
+
+		identifiers := make([]types.ObjectIdentifier, 0, len(page.Contents))
+		for _, object := range page.Contents {
+			identifiers = append(identifiers, types.ObjectIdentifier{Key: object.Key})
+		}
+		out, err := c.client.DeleteObjects(ctx, &awss3.DeleteObjectsInput{
+			Bucket: aws.String(c.bucket),
+			Delete: &types.Delete{Objects: identifiers, Quiet: aws.Bool(true)},
+		})
+		if err != nil {
+			return result, fmt.Errorf("批量删除 S3 文件失败: %w", err)
+		}
+
+		// 静默模式下只返回删除失败的对象
+		for _, failed := range out.Errors {
+			result.Failed = append(result.Failed, aws.ToString(failed.Key))
+		}
+		result.Deleted += len(identifiers) - len(out.Errors)
+		if progress != nil {
+			progress(*result)
+		}
+	}
+	return result, nil
+}
+
+// List 列出路径以 prefix 开头的所有对象（自动翻页，S3 按路径的字节序返回）
+func (c *Client) List(ctx context.Context, prefix string) ([]storage.Object, error) {
+	objects := make([]storage.Object, 0)
+	paginator := awss3.NewListObjectsV2Paginator(c.client, &awss3.ListObjectsV2Input{
+		Bucket: aws.String(c.bucket),
+		Prefix: aws.String(prefix),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("列出 S3 文件失败: %w", err)
+		}
+		for _, object := range page.Contents {
+			objects = append(objects, storage.Object{
+				Key:          aws.ToString(object.Key),
+				Size:         aws.ToInt64(object.Size),
+				LastModified: aws.ToTime(object.LastModified),
+			})
+		}
+	}
+	return objects, nil
+}
+
+// URL 返回对象的访问 URL（对路径的每一段进行转义）
+func (c *Client) URL(key string) string {
+	return c.baseURL + "/" + escapeKey(key)
+}
+
+// SignURL 返回带签名的临时下载 URL（用于私有存储桶，不使用 public_base_url）
+func (c *Client) SignURL(ctx context.Context, key string, ttl time.Duration) (string, error) {
+	req, err := c.presigner.PresignGetObject(ctx, &awss3.GetObjectInput{
+		Bucket: aws.String(c.bucket),
+		Key:    aws.String(key),
+	}, awss3.WithPresignExpires(ttl))
+	if err != nil {
+		return "", fmt.Errorf("生成 S3 签名 URL 失败: %w", err)
+	}
+	return req.URL, nil
+}
+
+// escapeKey 对对象路径的每一段进行 URL 转义
+func escapeKey(key string) string {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+// isPreconditionFailed 判断 S3 错误是否为条件写入失败（对象已存在或并发写入冲突）
+func isPreconditionFailed(err error) bool {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.ErrorCode() {
+		case "PreconditionFailed", "ConditionalRequestConflict":
+			return true
+		}
+	}
+	return false
+}
+
+// isNotImplemented 判断 S3 错误是否为存储不支持该请求（如不支持条件复制的兼容存储）
+func isNotImplemented(err error) bool {
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr) && apiErr.ErrorCode() == "NotImplemented"
+}
+
+// isNotFound 判断 S3 错误是否为对象不存在
+func isNotFound(err error) bool {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.ErrorCode() {
+		case "NoSuchKey", "NotFound":
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,336 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/guixu633/agent/backend/internal/config"
+	"github.com/guixu633/agent/backend/internal/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClient(t *testing.T) {
+	server := newFakeS3Server("images")
+	defer server.Close()
+
+	client, err := NewClient(config.S3StorageConfig{
+		Endpoint:        server.URL,
+		Bucket:          "images",
+		AccessKeyID:     "minio",
+		SecretAccessKey: "minio123",
+		PathStyle:       true,
+	})
+	assert.NoError(t, err)
+	ctx := context.Background()
+
+	assert.NoError(t, client.Put(ctx, "image/test/cat.png", strings.NewReader("cat")))
+	assert.NoError(t, client.Put(ctx, "image/test/dog.png", strings.NewReader("dog")))
+	assert.NoError(t, client.Put(ctx, "image/test/bird.png", io.MultiReader(strings.NewReader("bi"), strings.NewReader("rd"))))
+	assert.NoError(t, client.Put(ctx, "image/other/cat.png", strings.NewReader("other")))
+
+	t.Run("上传请求", func(t *testing.T) {
+		assert.Contains(t, server.header("image/test/cat.png").Get("Authorization"), "Credential=minio/")
+		assert.Equal(t, "image/png", server.header("image/test/cat.png").Get("Content-Type"))
+	})
+
+	t.Run("条件写入", func(t *testing.T) {
+		err := client.PutIfAbsent(ctx, "image/test/cat.png", strings.NewReader("kitten"))
+		assert.ErrorIs(t, err, storage.ErrExists)
+		data, err := storage.ReadAll(ctx, client, "image/test/cat.png")
+		assert.NoError(t, err)
+		assert.Equal(t, "cat", string(data))
+
+		assert.NoError(t, client.PutIfAbsent(ctx, "image/test/fox.png", strings.NewReader("fox")))
+		assert.Equal(t, "*", server.header("image/test/fox.png").Get("If-None-Match"))
+		assert.NoError(t, client.Delete(ctx, "image/test/fox.png"))
+	})
+
+	t.Run("读取对象", func(t *testing.T) {
+		data, err := storage.ReadAll(ctx, client, "image/test/bird.png")
+		assert.NoError(t, err)
+		assert.Equal(t, "bird", string(data))
+
+		_, err = client.Get(ctx, "image/test/missing.png")
+		assert.ErrorIs(t, err, storage.ErrNotFound)
+	})
+
+	t.Run("读取部分内容和对象信息", func(t *testing.T) {
+		body, err := client.GetRange(ctx, "image/test/bird.png", 1, 2)
+		assert.NoError(t, err)
+		data, _ := io.ReadAll(body)
+		body.Close()
+		assert.Equal(t, "ir", string(data))
+
+		body, err = client.GetRange(ctx, "image/test/bird.png", 2, -1)
+		assert.NoError(t, err)
+		data, _ = io.ReadAll(body)
+		body.Close()
+		assert.Equal(t, "rd", string(data))
+
+		object, err := client.Stat(ctx, "image/test/bird.png")
+		assert.NoError(t, err)
+		assert.Equal(t, int64(4), object.Size)
+		assert.True(t, fakeS3ModTime.Equal(object.LastModified))
+
+		_, err = client.Stat(ctx, "image/test/missing.png")
+		assert.ErrorIs(t, err, storage.ErrNotFound)
+	})
+
+	t.Run("按前缀列出对象", func(t *testing.T) {
+		// 测试服务器每页最多返回 2 个对象
+		objects, err := client.List(ctx, "image/test/")
+		assert.NoError(t, err)
+		assert.Len(t, objects, 3)
+		assert.Equal(t, "image/test/bird.png", objects[0].Key)
+		assert.Equal(t, int64(4), objects[0].Size)
+		assert.False(t, objects[0].LastModified.IsZero())
+		assert.Equal(t, "image/test/dog.png", objects[2].Key)
+
+		objects, err = client.List(ctx, "image/missing/")
+		assert.NoError(t, err)
+		assert.Empty(t, objects)
+	})
+
+	t.Run("复制和删除对象", func(t *testing.T) {
+		assert.NoError(t, client.Copy(ctx, "image/test/cat.png", "image/test/cat (2).png"))
+		data, err := storage.ReadAll(ctx, client, "image/test/cat (2).png")
+		assert.NoError(t, err)
+		assert.Equal(t, "cat", string(data))
+
+		assert.ErrorIs(t, client.Copy(ctx, "image/test/missing.png", "image/test/x.png"), storage.ErrNotFound)
+
+		assert.NoError(t, client.Delete(ctx, "image/test/cat (2).png"))
+		assert.NoError(t, client.Delete(ctx, "image/test/cat (2).png"))
+		_, err = client.Get(ctx, "image/test/cat (2).png")
+		assert.ErrorIs(t, err, storage.ErrNotFound)
+	})
+
+	t.Run("按前缀删除对象", func(t *testing.T) {
+		// 测试服务器拒绝删除 locked 对象；每页 2 个对象，分 2 批删除
+		assert.NoError(t, client.Put(ctx, "image/test/locked.png", strings.NewReader("locked")))
+		var progress []storage.DeleteResult
+		result, err := client.DeletePrefix(ctx, "image/test/", func(r storage.DeleteResult) {
+			progress = append(progress, r)
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, 3, result.Deleted)
+		assert.Equal(t, []string{"image/test/locked.png"}, result.Failed)
+		assert.Len(t, progress, 2)
+		assert.Equal(t, 2, progress[0].Deleted)
+
+		objects, err := client.List(ctx, "image/")
+		assert.NoError(t, err)
+		assert.Len(t, objects, 2)
+		assert.Equal(t, "image/other/cat.png", objects[0].Key)
+		assert.Equal(t, "image/test/locked.png", objects[1].Key)
+	})
+
+	t.Run("访问 URL", func(t *testing.T) {
+		assert.Equal(t, server.URL+"/images/image/test/cat%20%282%29.png", client.URL("image/test/cat (2).png"))
+	})
+
+	t.Run("签名 URL", func(t *testing.T) {
+		signed, err := client.SignURL(ctx, "image/other/cat.png", 10*time.Minute)
+		assert.NoError(t, err)
+		u, err := url.Parse(signed)
+		assert.NoError(t, err)
+		assert.Equal(t, "/images/image/other/cat.png", u.Path)
+		assert.Equal(t, "600", u.Query().Get("X-Amz-Expires"))
+		assert.NotEmpty(t, u.Query().Get("X-Amz-Signature"))
+
+		resp, err := http.Get(signed)
+		assert.NoError(t, err)
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		assert.Equal(t, "other", string(data))
+	})
+}
+
+func TestClientURL(t *testing.T) {
+	for _, tc := range []struct {
+		cfg  config.S3StorageConfig
+		want string
+	}{
+		{config.S3StorageConfig{Bucket: "images", Region: "ap-east-1"}, "https://images.s3.ap-east-1.amazonaws.com/image/a.png"},
+		{config.S3StorageConfig{Bucket: "images", Endpoint: "minio.local:9000", PathStyle: true}, "https://minio.local:9000/images/image/a.png"},
+		{config.S3StorageConfig{Bucket: "images", Endpoint: "https://account.r2.cloudflarestorage.com"}, "https://images.account.r2.cloudflarestorage.com/image/a.png"},
+		{config.S3StorageConfig{Bucket: "images", PublicBaseURL: "https://cdn.example.com/"}, "https://cdn.example.com/image/a.png"},
+	} {
+		client, err := NewClient(tc.cfg)
+		assert.NoError(t, err)
+		assert.Equal(t, tc.want, client.URL("image/a.png"))
+	}
+
+	_, err := NewClient(config.S3StorageConfig{})
+	assert.Error(t, err)
+}
+
+// fakeS3Server 进程内的 S3 测试服务器，只支持路径风格地址和客户端用到的接口
+type fakeS3Server struct {
+	*httptest.Server
+	bucket string
+
+	mu      sync.Mutex
+	objects map[string][]byte
+	headers map[string]http.Header // 每个对象最近一次上传请求的请求头
+}
+
+// fakeS3PageSize 列出对象时每页返回的数量（较小以覆盖翻页）
+const fakeS3PageSize = 2
+
+// fakeS3ModTime 测试服务器中所有对象的修改时间
+var fakeS3ModTime = time.Date(2025, 3, 18, 10, 0, 0, 0, time.UTC)
+
+func newFakeS3Server(bucket string) *fakeS3Server {
+	s := &fakeS3Server{bucket: bucket, objects: make(map[string][]byte), headers: make(map[string]http.Header)}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+func (s *fakeS3Server) header(key string) http.Header {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.headers[key]
+}
+
+func (s *fakeS3Server) handle(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucket != s.bucket {
+		writeS3Error(w, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodGet && key == "":
+		s.list(w, r.URL.Query())
+	case r.Method == http.MethodPost && r.URL.Query().Has("delete"):
+		s.deleteObjects(w, r)
+	case r.Method == http.MethodPut && r.Header.Get("X-Amz-Copy-Source") != "":
+		source, _ := url.PathUnescape(r.Header.Get("X-Amz-Copy-Source"))
+		_, srcKey, _ := strings.Cut(strings.TrimPrefix(source, "/"), "/")
+		data, ok := s.objects[srcKey]
+		if !ok {
+			writeS3Error(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		s.objects[key] = data
+		writeXML(w, struct {
+			XMLName xml.Name `xml:"CopyObjectResult"`
+			ETag    string
+		}{ETag: `"etag"`})
+	case r.Method == http.MethodPut:
+		if _, exists := s.objects[key]; exists && r.Header.Get("If-None-Match") == "*" {
+			writeS3Error(w, http.StatusPreconditionFailed, "PreconditionFailed")
+			return
+		}
+		data, _ := io.ReadAll(r.Body)
+		s.objects[key] = data
+		s.headers[key] = r.Header.Clone()
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		data, ok := s.objects[key]
+		if !ok {
+			writeS3Error(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		// 支持 HEAD 和 Range 请求
+		http.ServeContent(w, r, key, fakeS3ModTime, bytes.NewReader(data))
+	case r.Method == http.MethodDelete:
+		delete(s.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeS3Error(w, http.StatusNotImplemented, "NotImplemented")
+	}
+}
+
+// list 实现 ListObjectsV2，续页标记为上一页最后一个对象的路径
+func (s *fakeS3Server) list(w http.ResponseWriter, query url.Values) {
+	keys := make([]string, 0)
+	for key := range s.objects {
+		if strings.HasPrefix(key, query.Get("prefix")) && key > query.Get("continuation-token") {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	type content struct {
+		Key          string
+		Size         int64
+		LastModified string
+	}
+	result := struct {
+		XMLName               xml.Name `xml:"ListBucketResult"`
+		IsTruncated           bool
+		NextContinuationToken string `xml:",omitempty"`
+		Contents              []content
+	}{}
+	if len(keys) > fakeS3PageSize {
+		keys = keys[:fakeS3PageSize]
+		result.IsTruncated = true
+		result.NextContinuationToken = keys[len(keys)-1]
+	}
+	for _, key := range keys {
+		result.Contents = append(result.Contents, content{
+			Key:          key,
+			Size:         int64(len(s.objects[key])),
+			LastModified: fakeS3ModTime.Format(time.RFC3339),
+		})
+	}
+	writeXML(w, result)
+}
+
+// deleteObjects 实现批量删除
+func (s *fakeS3Server) deleteObjects(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Objects []struct {
+			Key string
+		} `xml:"Object"`
+	}
+	if err := xml.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeS3Error(w, http.StatusBadRequest, "MalformedXML")
+		return
+	}
+	type deleteError struct {
+		Key  string
+		Code string
+	}
+	result := struct {
+		XMLName xml.Name      `xml:"DeleteResult"`
+		Errors  []deleteError `xml:"Error"`
+	}{}
+	for _, object := range req.Objects {
+		if strings.Contains(object.Key, "locked") {
+			result.Errors = append(result.Errors, deleteError{Key: object.Key, Code: "AccessDenied"})
+			continue
+		}
+		delete(s.objects, object.Key)
+	}
+	writeXML(w, result)
+}
+
+func writeXML(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/xml")
+	xml.NewEncoder(w).Encode(v)
+}
+
+func writeS3Error(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	xml.NewEncoder(w).Encode(struct {
+		XMLName xml.Name `xml:"Error"`
+		Code    string
+		Message string
+	}{Code: code, Message: code})
+}
@@ -0,0 +1,364 @@
+package budget
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/guixu633/agent/backend/internal/model"
+	"github.com/guixu633/agent/backend/internal/repository"
+)
+
+const (
+	// defaultWarnRatio 未指定软限制比例时的默认值
+	defaultWarnRatio = 0.8
+	// dateLayout 周期开始日期的格式
+	dateLayout = "2006-01-02"
+)
+
+var (
+	// ErrBudgetExceeded 工作区预算已用尽，拒绝生成
+	ErrBudgetExceeded = errors.New("工作区预算已用尽")
+	// ErrInvalidBudget 预算配置不合法
+	ErrInvalidBudget = errors.New("预算配置不合法")
+	// ErrBudgetNotFound 预算不存在
+	ErrBudgetNotFound = errors.New("预算不存在")
+)
+
+// ExceededError 预算已用尽的详细信息
+type ExceededError struct {
+	Period string
+	Metric string
+	Limit  float64
+	Used   float64
+}
+
+func (e *ExceededError) Error() string {
+	return fmt.Sprintf("%s (%s%s已用 %s，上限 %s)", ErrBudgetExceeded.Error(),
+		periodLabel(e.Period), metricLabel(e.Metric), formatAmount(e.Metric, e.Used), formatAmount(e.Metric, e.Limit))
+}
+
+func (e *ExceededError) Unwrap() error {
+	return ErrBudgetExceeded
+}
+
+// Detail 转换为响应中的预算信息
+func (e *ExceededError) Detail() *model.BudgetWarning {
+	return &model.BudgetWarning{
+		Period:  e.Period,
+		Metric:  e.Metric,
+		Limit:   e.Limit,
+		Used:    e.Used,
+		Ratio:   e.Used / e.Limit,
+		Message: e.Error(),
+	}
+}
+
+// Service 工作区预算服务：管理预算配置，并在生成前检查用量、预占调用
+type Service struct {
+	budgetRepo    repository.BudgetRepository
+	workspaceRepo repository.WorkspaceRepository
+	runRepo       repository.GenerationRunRepository
+	now           func() time.Time // 当前时间（测试时可替换）
+}
+
+// NewService 创建工作区预算服务实例
+func NewService(budgetRepo repository.BudgetRepository, workspaceRepo repository.WorkspaceRepository, runRepo repository.GenerationRunRepository) *Service {
+	// 自然日、自然月与用量报表一致，按北京时间计算
+	loc := time.FixedZone("Asia/Shanghai", 8*3600)
+	return &Service{
+		budgetRepo:    budgetRepo,
+		workspaceRepo: workspaceRepo,
+		runRepo:       runRepo,
+		now:           func() time.Time { return time.Now().In(loc) },
+	}
+}
+
+// ListBudgets 列出工作区的预算及当前周期的用量
+func (s *Service) ListBudgets(ctx context.Context, workspace string) (*model.ListBudgetsResponse, error) {
+	ws, err := s.getWorkspace(ctx, workspace)
+	if err != nil {
+		return nil, err
+	}
+
+	status, err := s.load(ctx, ws.ID, func(since string) (*repository.UsageTotals, error) {
+		return s.runRepo.UsageSince(ctx, ws.ID, since)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	budgets := make([]model.Budget, 0, len(status.items))
+	for _, item := range status.items {
+		budgets = append(budgets, item.info())
+	}
+
+	return &model.ListBudgetsResponse{
+		Workspace: ws.Name,
+		Budgets:   budgets,
+	}, nil
+}
+
+// SetBudget 创建或更新工作区预算
+func (s *Service) SetBudget(ctx context.Context, req *model.SetBudgetRequest) (*model.SetBudgetResponse, error) {
+	if req.Period != repository.BudgetPeriodDaily && req.Period != repository.BudgetPeriodMonthly {
+		return nil, fmt.Errorf("%w: 不支持的统计周期 %s", ErrInvalidBudget, req.Period)
+	}
+	if req.Metric != repository.BudgetMetricRuns && req.Metric != repository.BudgetMetricTokens && req.Metric != repository.BudgetMetricCost {
+		return nil, fmt.Errorf("%w: 不支持的指标 %s", ErrInvalidBudget, req.Metric)
+	}
+	if req.Limit <= 0 {
+		return nil, fmt.Errorf("%w: 上限必须大于 0", ErrInvalidBudget)
+	}
+	warnRatio := defaultWarnRatio
+	if req.WarnRatio != nil {
+		warnRatio = *req.WarnRatio
+		if warnRatio <= 0 || warnRatio > 1 {
+			return nil, fmt.Errorf("%w: 软限制比例必须在 0 到 1 之间", ErrInvalidBudget)
+		}
+	}
+
+	ws, err := s.getWorkspace(ctx, req.Workspace)
+	if err != nil {
+		return nil, err
+	}
+
+	saved, err := s.budgetRepo.Upsert(ctx, &repository.Budget{
+		WorkspaceID: ws.ID,
+		Period:      req.Period,
+		Metric:      req.Metric,
+		Limit:       req.Limit,
+		WarnRatio:   warnRatio,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	start := periodStart(saved.Period, s.now())
+	totals, err := s.runRepo.UsageSince(ctx, ws.ID, start)
+	if err != nil {
+		return nil, err
+	}
+	item := budgetUsage{budget: saved, periodStart: start, used: usedAmount(saved.Metric, totals)}
+
+	return &model.SetBudgetResponse{
+		Budget: item.info(),
+	}, nil
+}
+
+// DeleteBudget 删除工作区预算
+func (s *Service) DeleteBudget(ctx context.Context, req *model.DeleteBudgetRequest) error {
+	ws, err := s.getWorkspace(ctx, req.Workspace)
+	if err != nil {
+		return err
+	}
+
+	deleted, err := s.budgetRepo.Delete(ctx, ws.ID, req.Period, req.Metric)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrBudgetNotFound
+	}
+	return nil
+}
+
+// Reserve 检查工作区当前周期的用量并预占一次调用，任意预算已用尽时返回 *ExceededError
+// 检查和创建进行中的调用记录在同一事务中完成并按工作区加锁，并发请求不会基于同一份用量同时通过检查。
+// 返回的 Status 用于生成完成后计算软限制提醒，Status.RunID 为预占的调用记录，调用结束后由调用方更新。
+func (s *Service) Reserve(ctx context.Context, run *repository.GenerationRun) (*Status, error) {
+	var status *Status
+	reserved, err := s.runRepo.Reserve(ctx, run, func(usageSince repository.UsageSinceFunc) error {
+		var err error
+		status, err = s.load(ctx, run.WorkspaceID, usageSince)
+		if err != nil {
+			return err
+		}
+		return status.check()
+	})
+	if err != nil {
+		return nil, err
+	}
+	status.RunID = reserved.ID
+	return status, nil
+}
+
+// load 读取工作区的预算及各周期的用量（同一周期只查询一次）
+func (s *Service) load(ctx context.Context, workspaceID int64, usageSince repository.UsageSinceFunc) (*Status, error) {
+	budgets, err := s.budgetRepo.ListByWorkspace(ctx, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := s.now()
+	totals := make(map[string]*repository.UsageTotals)
+	status := &Status{items: make([]budgetUsage, 0, len(budgets))}
+	for _, budget := range budgets {
+		start := periodStart(budget.Period, now)
+		if _, ok := totals[budget.Period]; !ok {
+			totals[budget.Period], err = usageSince(start)
+			if err != nil {
+				return nil, err
+			}
+		}
+		status.items = append(status.items, budgetUsage{
+			budget:      budget,
+			periodStart: start,
+			used:        usedAmount(budget.Metric, totals[budget.Period]),
+		})
+	}
+	return status, nil
+}
+
+// getWorkspace 根据名称获取工作区
+func (s *Service) getWorkspace(ctx context.Context, name string) (*repository.Workspace, error) {
+	ws, err := s.workspaceRepo.GetByName(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("获取工作区失败: %w", err)
+	}
+	if ws == nil {
+		return nil, fmt.Errorf("工作区 %s 不存在", name)
+	}
+	return ws, nil
+}
+
+// Usage 一次生成产生的用量
+type Usage struct {
+	Succeeded bool
+	Tokens    int64
+	Cost      float64
+}
+
+// Status 生成前检查得到的预算和用量
+type Status struct {
+	RunID int64 // 预占的调用记录 ID
+	items []budgetUsage
+}
+
+// check 任意预算已用尽时返回 *ExceededError
+func (st *Status) check() error {
+	for _, item := range st.items {
+		if item.used >= item.budget.Limit {
+			return &ExceededError{
+				Period: item.budget.Period,
+				Metric: item.budget.Metric,
+				Limit:  item.budget.Limit,
+				Used:   item.used,
+			}
+		}
+	}
+	return nil
+}
+
+// budgetUsage 一个预算及其当前周期的用量
+type budgetUsage struct {
+	budget      *repository.Budget
+	periodStart string
+	used        float64
+}
+
+// Warnings 计入本次生成的用量后，返回达到软限制的预算提醒（st 为 nil 时返回 nil）
+func (st *Status) Warnings(usage Usage) []model.BudgetWarning {
+	if st == nil {
+		return nil
+	}
+
+	var warnings []model.BudgetWarning
+	for _, item := range st.items {
+		used := item.used
+		switch item.budget.Metric {
+		case repository.BudgetMetricRuns:
+			if usage.Succeeded {
+				used++
+			}
+		case repository.BudgetMetricTokens:
+			used += float64(usage.Tokens)
+		case repository.BudgetMetricCost:
+			used += usage.Cost
+		}
+
+		limit := item.budget.Limit
+		if used < limit*item.budget.WarnRatio {
+			continue
+		}
+		ratio := used / limit
+		message := fmt.Sprintf("%s%s已使用 %.0f%%（%s / %s）", periodLabel(item.budget.Period), metricLabel(item.budget.Metric),
+			ratio*100, formatAmount(item.budget.Metric, used), formatAmount(item.budget.Metric, limit))
+		if used >= limit {
+			message += "，已达到上限，后续生成将被拒绝"
+		}
+		warnings = append(warnings, model.BudgetWarning{
+			Period:  item.budget.Period,
+			Metric:  item.budget.Metric,
+			Limit:   limit,
+			Used:    used,
+			Ratio:   ratio,
+			Message: message,
+		})
+	}
+	return warnings
+}
+
+// info 转换为响应中的预算信息
+func (item budgetUsage) info() model.Budget {
+	return model.Budget{
+		Period:      item.budget.Period,
+		Metric:      item.budget.Metric,
+		Limit:       item.budget.Limit,
+		WarnRatio:   item.budget.WarnRatio,
+		Used:        item.used,
+		PeriodStart: item.periodStart,
+		UpdatedAt:   item.budget.UpdatedAt.Format(time.RFC3339),
+	}
+}
+
+// periodStart 返回 now 所在周期的开始日期
+func periodStart(period string, now time.Time) string {
+	if period == repository.BudgetPeriodMonthly {
+		return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location()).Format(dateLayout)
+	}
+	return now.Format(dateLayout)
+}
+
+// usedAmount 从用量合计中取出预算指标对应的值
+func usedAmount(metric string, totals *repository.UsageTotals) float64 {
+	switch metric {
+	case repository.BudgetMetricRuns:
+		return float64(totals.SucceededRuns)
+	case repository.BudgetMetricTokens:
+		return float64(totals.TotalTokens)
+	case repository.BudgetMetricCost:
+		return totals.Cost
+	}
+	return 0
+}
+
+// periodLabel 统计周期的显示名称
+func periodLabel(period string) string {
+	if period == repository.BudgetPeriodMonthly {
+		return "本月"
+	}
+	return "今日"
+}
+
+// metricLabel 指标的显示名称
+func metricLabel(metric string) string {
+	switch metric {
+	case repository.BudgetMetricRuns:
+		return "生成次数"
+	case repository.BudgetMetricTokens:
+		return " token 用量"
+	case repository.BudgetMetricCost:
+		return "估算成本"
+	}
+	return metric
+}
+
+// formatAmount 格式化用量：成本保留 4 位小数（美元），次数和 token 数取整
+func formatAmount(metric string, v float64) string {
+	if metric == repository.BudgetMetricCost {
+		return fmt.Sprintf("$%.4f", v)
+	}
+	return fmt.Sprintf("%.0f", v)
+}
@@ -0,0 +1,165 @@
+package budget
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/guixu633/agent/backend/internal/model"
+	"github.com/guixu633/agent/backend/internal/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBudgets(t *testing.T) {
+	runRepo := &fakeGenerationRunRepository{totals: repository.UsageTotals{SucceededRuns: 3, TotalTokens: 900, Cost: 4.5}}
+	service := NewService(&fakeBudgetRepository{}, &fakeWorkspaceRepository{workspace: &repository.Workspace{ID: 7, Name: "test"}}, runRepo)
+	service.now = func() time.Time { return time.Date(2025, 3, 18, 10, 0, 0, 0, time.UTC) }
+	ctx := context.Background()
+
+	t.Run("设置预算", func(t *testing.T) {
+		resp, err := service.SetBudget(ctx, &model.SetBudgetRequest{Workspace: "test", Period: "monthly", Metric: "cost", Limit: 5})
+		assert.NoError(t, err)
+		assert.Equal(t, 0.8, resp.Budget.WarnRatio)
+		assert.Equal(t, 4.5, resp.Budget.Used)
+		assert.Equal(t, "2025-03-01", resp.Budget.PeriodStart)
+		assert.Equal(t, "2025-03-01", runRepo.since)
+
+		// 相同周期和指标覆盖已有预算
+		ratio := 0.5
+		_, err = service.SetBudget(ctx, &model.SetBudgetRequest{Workspace: "test", Period: "daily", Metric: "tokens", Limit: 1000, WarnRatio: &ratio})
+		assert.NoError(t, err)
+		_, err = service.SetBudget(ctx, &model.SetBudgetRequest{Workspace: "test", Period: "daily", Metric: "tokens", Limit: 2000, WarnRatio: &ratio})
+		assert.NoError(t, err)
+
+		list, err := service.ListBudgets(ctx, "test")
+		assert.NoError(t, err)
+		assert.Len(t, list.Budgets, 2)
+		assert.Equal(t, float64(2000), list.Budgets[1].Limit)
+		assert.Equal(t, "2025-03-18", list.Budgets[1].PeriodStart)
+	})
+
+	t.Run("预算配置不合法", func(t *testing.T) {
+		ratio := 1.5
+		for _, req := range []*model.SetBudgetRequest{
+			{Workspace: "test", Period: "weekly", Metric: "cost", Limit: 5},
+			{Workspace: "test", Period: "daily", Metric: "images", Limit: 5},
+			{Workspace: "test", Period: "daily", Metric: "cost", Limit: 0},
+			{Workspace: "test", Period: "daily", Metric: "cost", Limit: 5, WarnRatio: &ratio},
+		} {
+			_, err := service.SetBudget(ctx, req)
+			assert.ErrorIs(t, err, ErrInvalidBudget)
+		}
+	})
+
+	t.Run("检查预算", func(t *testing.T) {
+		status, err := service.Reserve(ctx, &repository.GenerationRun{WorkspaceID: 7})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), status.RunID)
+		assert.Equal(t, repository.RunStatusPending, runRepo.reserved[0].Status)
+
+		// 计入本次调用后：成本 4.6 / 5 超过 80%，token 1000 / 2000 达到 50%（按预算创建顺序）
+		warnings := status.Warnings(Usage{Succeeded: true, Tokens: 100, Cost: 0.1})
+		assert.Len(t, warnings, 2)
+		assert.Equal(t, "本月估算成本已使用 92%（$4.6000 / $5.0000）", warnings[0].Message)
+		assert.Equal(t, "今日 token 用量已使用 50%（1000 / 2000）", warnings[1].Message)
+
+		// 用量达到上限后拒绝生成，不预占调用
+		runRepo.totals.Cost = 5
+		_, err = service.Reserve(ctx, &repository.GenerationRun{WorkspaceID: 7})
+		assert.ErrorIs(t, err, ErrBudgetExceeded)
+		assert.EqualError(t, err, "工作区预算已用尽 (本月估算成本已用 $5.0000，上限 $5.0000)")
+		assert.Len(t, runRepo.reserved, 1)
+
+		// 没有预算的工作区不限制
+		status, err = service.Reserve(ctx, &repository.GenerationRun{WorkspaceID: 8})
+		assert.NoError(t, err)
+		assert.Empty(t, status.Warnings(Usage{Succeeded: true}))
+		assert.Len(t, runRepo.reserved, 2)
+	})
+
+	t.Run("删除预算", func(t *testing.T) {
+		err := service.DeleteBudget(ctx, &model.DeleteBudgetRequest{Workspace: "test", Period: "monthly", Metric: "cost"})
+		assert.NoError(t, err)
+		err = service.DeleteBudget(ctx, &model.DeleteBudgetRequest{Workspace: "test", Period: "monthly", Metric: "cost"})
+		assert.ErrorIs(t, err, ErrBudgetNotFound)
+	})
+}
+
+// fakeWorkspaceRepository 只包含一个工作区的内存仓库
+type fakeWorkspaceRepository struct {
+	repository.WorkspaceRepository
+	workspace *repository.Workspace
+}
+
+func (r *fakeWorkspaceRepository) GetByName(_ context.Context, name string) (*repository.Workspace, error) {
+	if name == r.workspace.Name {
+		return r.workspace, nil
+	}
+	return nil, nil
+}
+
+// fakeBudgetRepository 内存中的预算仓库
+type fakeBudgetRepository struct {
+	budgets []*repository.Budget
+}
+
+func (r *fakeBudgetRepository) ListByWorkspace(_ context.Context, workspaceID int64) ([]*repository.Budget, error) {
+	budgets := make([]*repository.Budget, 0)
+	for _, b := range r.budgets {
+		if b.WorkspaceID == workspaceID {
+			budgets = append(budgets, b)
+		}
+	}
+	return budgets, nil
+}
+
+func (r *fakeBudgetRepository) Upsert(_ context.Context, budget *repository.Budget) (*repository.Budget, error) {
+	for _, b := range r.budgets {
+		if b.WorkspaceID == budget.WorkspaceID && b.Period == budget.Period && b.Metric == budget.Metric {
+			b.Limit = budget.Limit
+			b.WarnRatio = budget.WarnRatio
+			return b, nil
+		}
+	}
+	saved := *budget
+	saved.ID = int64(len(r.budgets) + 1)
+	r.budgets = append(r.budgets, &saved)
+	return &saved, nil
+}
+
+func (r *fakeBudgetRepository) Delete(_ context.Context, workspaceID int64, period, metric string) (bool, error) {
+	for i, b := range r.budgets {
+		if b.WorkspaceID == workspaceID && b.Period == period && b.Metric == metric {
+			r.budgets = append(r.budgets[:i], r.budgets[i+1:]...)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// fakeGenerationRunRepository 返回固定用量合计的仓库，记录查询的开始日期和预占的调用
+type fakeGenerationRunRepository struct {
+	repository.GenerationRunRepository
+	totals   repository.UsageTotals
+	since    string
+	reserved []*repository.GenerationRun
+}
+
+func (r *fakeGenerationRunRepository) Reserve(ctx context.Context, run *repository.GenerationRun, admit func(usageSince repository.UsageSinceFunc) error) (*repository.GenerationRun, error) {
+	if err := admit(func(since string) (*repository.UsageTotals, error) {
+		return r.UsageSince(ctx, run.WorkspaceID, since)
+	}); err != nil {
+		return nil, err
+	}
+	reserved := *run
+	reserved.ID = int64(len(r.reserved) + 1)
+	reserved.Status = repository.RunStatusPending
+	r.reserved = append(r.reserved, &reserved)
+	return &reserved, nil
+}
+
+func (r *fakeGenerationRunRepository) UsageSince(_ context.Context, _ int64, since string) (*repository.UsageTotals, error) {
+	r.since = since
+	totals := r.totals
+	return &totals, nil
+}
@@ -0,0 +1,69 @@
+package image
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/guixu633/agent/backend/internal/repository"
+	"github.com/guixu633/agent/backend/internal/storage"
+)
+
+// ImageCacheMaxAge 通过后端读取的图片在浏览器中的缓存时长（过期后通过 ETag 重新验证）
+const ImageCacheMaxAge = time.Hour
+
+// ImageContent 通过后端读取的图片内容
+type ImageContent struct {
+	Name         string    // 文件名
+	MimeType     string    // MIME 类型
+	Size         int64     // 大小（字节）
+	LastModified time.Time // 存储中文件的修改时间
+	ETag         string    // 根据文件大小和修改时间生成的校验值
+	// Content 图片内容，读取时才从存储下载；调用方负责关闭
+	Content *storage.ObjectReader
+}
+
+// OpenImage 打开图片原图
+// 只获取文件信息，内容在读取时才从存储下载
+func (s *Service) OpenImage(ctx context.Context, id int64) (*ImageContent, error) {
+	return s.openImage(ctx, id, func(img *repository.Image) string { return img.OSSPath })
+}
+
+// OpenThumbnail 打开图片的缩略图，图片没有缩略图时返回 ErrImageNotFound
+func (s *Service) OpenThumbnail(ctx context.Context, id int64) (*ImageContent, error) {
+	return s.openImage(ctx, id, func(img *repository.Image) string { return img.ThumbnailPath })
+}
+
+// openImage 获取图片记录，打开 objectPath 返回的文件
+func (s *Service) openImage(ctx context.Context, id int64, objectPath func(*repository.Image) string) (*ImageContent, error) {
+	dbImage, err := s.imageRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("获取图片记录失败: %w", err)
+	}
+	if dbImage == nil {
+		return nil, ErrImageNotFound
+	}
+	key := objectPath(dbImage)
+	if key == "" {
+		return nil, ErrImageNotFound
+	}
+
+	object, err := s.store.Stat(ctx, key)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, fmt.Errorf("%w: %s", ErrImageNotFound, key)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("获取文件信息失败: %w", err)
+	}
+
+	return &ImageContent{
+		Name:         path.Base(key),
+		MimeType:     s.detectMimeType(key),
+		Size:         object.Size,
+		LastModified: object.LastModified,
+		ETag:         fmt.Sprintf(`"%x-%x"`, object.LastModified.UnixNano(), object.Size),
+		Content:      storage.NewObjectReader(ctx, s.store, key, object.Size),
+	}, nil
+}
@@ -0,0 +1,286 @@
+package image
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/guixu633/agent/backend/internal/generator"
+	"github.com/guixu633/agent/backend/internal/model"
+	"github.com/guixu633/agent/backend/internal/repository"
+	"github.com/guixu633/agent/backend/internal/storage"
+)
+
+const (
+	// conversationTitleLength 会话标题的最大长度（字符数）
+	conversationTitleLength = 50
+
+	// missingImageText 历史图片无法读取时代替图片发送的文本
+	missingImageText = "[图片已不可用]"
+	// emptyTurnText 没有可发送片段的轮次（如模型没有返回内容）代替发送的文本
+	emptyTurnText = "[无内容]"
+)
+
+// ListConversations 列出工作区的对话会话
+func (s *Service) ListConversations(ctx context.Context, workspace string) (*model.ListConversationsResponse, error) {
+	dbConversations, err := s.conversationRepo.ListByWorkspaceName(ctx, workspace)
+	if err != nil {
+		return nil, fmt.Errorf("列出对话失败: %w", err)
+	}
+
+	conversations := make([]model.ConversationInfo, 0, len(dbConversations))
+	for _, conv := range dbConversations {
+		conversations = append(conversations, s.convertConversation(conv))
+	}
+
+	return &model.ListConversationsResponse{
+		Conversations: conversations,
+	}, nil
+}
+
+// GetConversation 获取对话详情（包含全部轮次）
+func (s *Service) GetConversation(ctx context.Context, id int64) (*model.GetConversationResponse, error) {
+	conv, err := s.getConversation(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if conv == nil {
+		return nil, ErrConversationNotFound
+	}
+
+	dbTurns, err := s.conversationRepo.ListTurns(ctx, conv.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	turns := make([]model.ConversationTurn, 0, len(dbTurns))
+	for _, turn := range dbTurns {
+		parts := make([]model.ConversationPart, 0, len(turn.Parts))
+		for _, part := range turn.Parts {
+			p := model.ConversationPart{
+				Type:     part.Type,
+				Text:     part.Text,
+				Path:     part.Path,
+				MimeType: part.MimeType,
+			}
+			if p.URL, err = s.imageURL(ctx, part.Path); err != nil {
+				return nil, err
+			}
+			parts = append(parts, p)
+		}
+		turns = append(turns, model.ConversationTurn{
+			Index:     turn.TurnIndex,
+			Role:      turn.Role,
+			Parts:     parts,
+			CreatedAt: s.formatTime(turn.CreatedAt),
+		})
+	}
+
+	return &model.GetConversationResponse{
+		Conversation: s.convertConversation(conv),
+		Turns:        turns,
+	}, nil
+}
+
+// ContinueConversation 在已有对话上继续生成
+// 未指定模型时沿用会话的模型，生成结果保存到会话所属的工作区
+func (s *Service) ContinueConversation(ctx context.Context, id int64, req *model.ContinueConversationRequest) (*model.ImageGenerateResponse, error) {
+	return s.GenerateImage(ctx, &model.ImageGenerateRequest{
+		Prompt:           req.Prompt,
+		Images:           req.Images,
+		Model:            req.Model,
+		EnableWebSearch:  req.EnableWebSearch,
+		ConversationID:   id,
+		GenerationParams: req.GenerationParams,
+	})
+}
+
+// getConversation 获取对话会话，id 为 0 时返回 nil
+func (s *Service) getConversation(ctx context.Context, id int64) (*repository.Conversation, error) {
+	if id == 0 {
+		return nil, nil
+	}
+	conv, err := s.conversationRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if conv == nil {
+		return nil, fmt.Errorf("%w: %d", ErrConversationNotFound, id)
+	}
+	return conv, nil
+}
+
+// resolveWorkspace 获取生成图片存储的工作区
+// 继续对话时使用会话所属的工作区，请求中指定了其他工作区时报错
+func (s *Service) resolveWorkspace(ctx context.Context, workspace string, conv *repository.Conversation) (*repository.Workspace, error) {
+	if conv != nil {
+		ws, err := s.workspaceRepo.GetByID(ctx, conv.WorkspaceID)
+		if err != nil {
+			return nil, fmt.Errorf("获取工作区失败: %w", err)
+		}
+		if ws == nil {
+			return nil, fmt.Errorf("对话 %d 所属的工作区不存在", conv.ID)
+		}
+		if workspace != "" && workspace != ws.Name {
+			return nil, fmt.Errorf("%w: 对话 %d 不属于工作区 %s", ErrConversationMismatch, conv.ID, workspace)
+		}
+		return ws, nil
+	}
+
+	// 使用请求中的 workspace，如果没有则使用 "default"
+	if workspace == "" {
+		workspace = "default"
+	}
+	ws, err := s.workspaceRepo.GetByName(ctx, workspace)
+	if err != nil {
+		return nil, fmt.Errorf("获取工作区失败: %w", err)
+	}
+	if ws == nil {
+		return nil, fmt.Errorf("工作区 %s 不存在", workspace)
+	}
+	return ws, nil
+}
+
+// loadHistory 加载对话的全部轮次作为生成历史
+// 图片从存储下载；无法读取的图片用文本说明代替（保留思考签名），不影响继续对话。
+// 模型不接受没有片段的轮次，这类轮次同样用文本说明代替
+func (s *Service) loadHistory(ctx context.Context, conversationID int64) ([]generator.Turn, error) {
+	dbTurns, err := s.conversationRepo.ListTurns(ctx, conversationID)
+	if err != nil {
+		return nil, err
+	}
+
+	history := make([]generator.Turn, 0, len(dbTurns))
+	for _, turn := range dbTurns {
+		role := generator.RoleUser
+		if turn.Role == repository.TurnRoleModel {
+			role = generator.RoleModel
+		}
+
+		parts := make([]generator.Part, 0, len(turn.Parts))
+		for _, part := range turn.Parts {
+			switch generator.PartType(part.Type) {
+			case generator.PartTypeText:
+				parts = append(parts, generator.Part{
+					Type:             generator.PartTypeText,
+					Text:             part.Text,
+					ThoughtSignature: part.ThoughtSignature,
+				})
+			case generator.PartTypeImage:
+				imageData, err := storage.ReadAll(ctx, s.store, part.Path)
+				if err != nil {
+					log.Printf("加载对话 %d 的历史图片失败，已用文本代替 (path: %s): %v", conversationID, part.Path, err)
+					parts = append(parts, generator.Part{
+						Type:             generator.PartTypeText,
+						Text:             missingImageText,
+						ThoughtSignature: part.ThoughtSignature,
+					})
+					continue
+				}
+				mimeType := part.MimeType
+				if mimeType == "" {
+					mimeType = s.detectMimeType(part.Path)
+				}
+				parts = append(parts, generator.Part{
+					Type:             generator.PartTypeImage,
+					Data:             imageData,
+					MimeType:         mimeType,
+					ThoughtSignature: part.ThoughtSignature,
+				})
+			}
+		}
+		if len(parts) == 0 {
+			parts = append(parts, generator.Part{Type: generator.PartTypeText, Text: emptyTurnText})
+		}
+		history = append(history, generator.Turn{Role: role, Parts: parts})
+	}
+
+	return history, nil
+}
+
+// messagesHistory 将请求中的对话历史转换为生成历史
+// 只回放文本消息，图片消息（URL）无法直接发送给模型
+func messagesHistory(messages []model.Message) []generator.Turn {
+	history := make([]generator.Turn, 0, len(messages))
+	for _, m := range messages {
+		if m.Type != model.MessageTypeText || m.Content == "" {
+			continue
+		}
+		role := generator.RoleUser
+		if m.Role == "assistant" {
+			role = generator.RoleModel
+		}
+		history = append(history, generator.Turn{
+			Role:  role,
+			Parts: []generator.Part{{Type: generator.PartTypeText, Text: m.Content}},
+		})
+	}
+	return history
+}
+
+// recordConversation 将本轮的用户输入和模型输出追加到对话中，返回对话 ID
+// 新对话在这里创建；记录失败不影响已保存的生成结果，只记录日志并返回 0
+func (s *Service) recordConversation(ctx context.Context, gen *generation, modelParts []repository.TurnPart) int64 {
+	userParts := []repository.TurnPart{{Type: "text", Text: gen.req.Prompt}}
+	for _, path := range gen.req.Images {
+		userParts = append(userParts, repository.TurnPart{
+			Type:     "image",
+			Path:     path,
+			MimeType: s.detectMimeType(path),
+		})
+	}
+
+	// 跳过空白文本片段和未成功保存的图片
+	parts := make([]repository.TurnPart, 0, len(modelParts))
+	for _, part := range modelParts {
+		if (part.Type == "text" && part.Text == "") || (part.Type == "image" && part.Path == "") {
+			continue
+		}
+		parts = append(parts, part)
+	}
+
+	conv := gen.conversation
+	if conv == nil {
+		var err error
+		conv, err = s.conversationRepo.Create(ctx, &repository.Conversation{
+			WorkspaceID: gen.workspace.ID,
+			Title:       conversationTitle(gen.req.Prompt),
+			Model:       gen.genReq.Options.Model,
+		})
+		if err != nil {
+			log.Printf("创建对话失败: %v", err)
+			return 0
+		}
+	}
+
+	err := s.conversationRepo.AppendTurns(ctx, conv.ID, []*repository.ConversationTurn{
+		{Role: repository.TurnRoleUser, Parts: userParts},
+		{Role: repository.TurnRoleModel, Parts: parts},
+	})
+	if err != nil {
+		log.Printf("保存对话 %d 的轮次失败: %v", conv.ID, err)
+		return 0
+	}
+	return conv.ID
+}
+
+// conversationTitle 根据第一轮提示词生成会话标题
+func conversationTitle(prompt string) string {
+	runes := []rune(prompt)
+	if len(runes) > conversationTitleLength {
+		return string(runes[:conversationTitleLength]) + "..."
+	}
+	return string(runes)
+}
+
+// convertConversation 将数据库对话记录转换为响应格式
+func (s *Service) convertConversation(conv *repository.Conversation) model.ConversationInfo {
+	return model.ConversationInfo{
+		ID:        conv.ID,
+		Title:     conv.Title,
+		Model:     conv.Model,
+		TurnCount: conv.TurnCount,
+		CreatedAt: s.formatTime(conv.CreatedAt),
+		UpdatedAt: s.formatTime(conv.UpdatedAt),
+	}
+}
@@ -0,0 +1,200 @@
+package image
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/guixu633/agent/backend/internal/generator"
+	"github.com/guixu633/agent/backend/internal/model"
+	"github.com/guixu633/agent/backend/internal/service/budget"
+)
+
+var (
+	// ErrCapabilityMismatch 请求使用了模型不支持的能力
+	ErrCapabilityMismatch = errors.New("模型不支持该能力")
+	// ErrInvalidParams 生成参数不合法
+	ErrInvalidParams = errors.New("生成参数不合法")
+	// ErrConversationNotFound 对话不存在
+	ErrConversationNotFound = errors.New("对话不存在")
+	// ErrConversationMismatch 对话不属于请求的工作区
+	ErrConversationMismatch = errors.New("对话与工作区不匹配")
+	// ErrRunNotFound 模型调用记录不存在
+	ErrRunNotFound = errors.New("模型调用记录不存在")
+	// ErrImageNotFound 图片记录或存储中的文件不存在
+	ErrImageNotFound = errors.New("图片不存在")
+	// ErrImageExists 工作区中已有同名图片（上传时指定拒绝同名图片，或重命名为已有的文件名）
+	ErrImageExists = errors.New("工作区中已有同名图片")
+	// ErrInvalidConflictPolicy 不支持的同名图片处理方式
+	ErrInvalidConflictPolicy = errors.New("同名图片处理方式必须为 rename、reject 或 replace")
+	// ErrInvalidListQuery 图片列表的分页、排序或过滤参数不合法
+	ErrInvalidListQuery = errors.New("图片列表查询参数不合法")
+	// ErrInvalidSearchQuery 搜索词或分页参数不合法
+	ErrInvalidSearchQuery = errors.New("图片搜索参数不合法")
+	// ErrInvalidTags 标签名称或数量不合法
+	ErrInvalidTags = errors.New("标签参数不合法")
+
+	// errNoContent 模型未返回任何内容
+	errNoContent = errors.New("模型未返回任何内容")
+)
+
+// 模型拒绝生成或上游调用失败的错误
+var (
+	// ErrBlockedBySafety 输入或输出被安全策略拦截
+	ErrBlockedBySafety = errors.New("内容被安全策略拦截")
+	// ErrRecitation 输出与受保护的材料过于相似而被拦截
+	ErrRecitation = errors.New("内容因引用受保护的材料被拦截")
+	// ErrMaxTokens 输出达到最大 token 数，没有生成任何内容
+	ErrMaxTokens = errors.New("输出超出最大 token 数")
+	// ErrQuotaExceeded 模型供应商的配额已用尽
+	ErrQuotaExceeded = generator.ErrQuotaExceeded
+	// ErrUpstreamUnavailable 模型服务暂时不可用
+	ErrUpstreamUnavailable = generator.ErrUpstreamUnavailable
+	// ErrBudgetExceeded 工作区的用量预算已用尽（与供应商配额无关）
+	ErrBudgetExceeded = budget.ErrBudgetExceeded
+)
+
+// 生成失败的业务错误码（前三位与 HTTP 状态码一致）
+const (
+	CodeBlockedBySafety     = 42201
+	CodeRecitation          = 42202
+	CodeMaxTokens           = 42203
+	CodeQuotaExceeded       = 42901
+	CodeBudgetExceeded      = 42902
+	CodeUpstreamUnavailable = 50301
+)
+
+// GenerationError 模型拒绝生成的详细原因
+type GenerationError struct {
+	Err      error  // 错误类型: ErrBlockedBySafety | ErrRecitation | ErrMaxTokens
+	Reason   string // 模型返回的拦截原因或结束原因，如 "SAFETY"
+	Category string // 触发拦截的危害类别（安全拦截时有效，可能为空）
+	Message  string // 模型返回的原因说明（可选）
+}
+
+func (e *GenerationError) Error() string {
+	msg := fmt.Sprintf("%s (原因: %s", e.Err.Error(), e.Reason)
+	if e.Category != "" {
+		msg += ", 类别: " + e.Category
+	}
+	msg += ")"
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	return msg
+}
+
+func (e *GenerationError) Unwrap() error {
+	return e.Err
+}
+
+// IsInvalidRequest 判断错误是否由请求参数不合法引起（应返回 400）
+func IsInvalidRequest(err error) bool {
+	return errors.Is(err, generator.ErrUnknownModel) ||
+		errors.Is(err, ErrCapabilityMismatch) ||
+		errors.Is(err, ErrInvalidParams) ||
+		errors.Is(err, ErrConversationNotFound) ||
+		errors.Is(err, ErrConversationMismatch) ||
+		errors.Is(err, ErrInvalidConflictPolicy) ||
+		errors.Is(err, ErrInvalidListQuery) ||
+		errors.Is(err, ErrInvalidSearchQuery) ||
+		errors.Is(err, ErrInvalidTags)
+}
+
+// GenerationFailure 返回生成失败错误对应的 HTTP 状态码和业务错误码
+// 不是模型拒绝生成或上游调用失败时 ok 为 false
+func GenerationFailure(err error) (httpStatus int, code int, ok bool) {
+	switch {
+	case errors.Is(err, ErrBlockedBySafety):
+		return http.StatusUnprocessableEntity, CodeBlockedBySafety, true
+	case errors.Is(err, ErrRecitation):
+		return http.StatusUnprocessableEntity, CodeRecitation, true
+	case errors.Is(err, ErrMaxTokens):
+		return http.StatusUnprocessableEntity, CodeMaxTokens, true
+	case errors.Is(err, ErrQuotaExceeded):
+		return http.StatusTooManyRequests, CodeQuotaExceeded, true
+	case errors.Is(err, ErrBudgetExceeded):
+		return http.StatusTooManyRequests, CodeBudgetExceeded, true
+	case errors.Is(err, ErrUpstreamUnavailable):
+		return http.StatusServiceUnavailable, CodeUpstreamUnavailable, true
+	}
+	return 0, 0, false
+}
+
+// FailureDetail 返回模型拒绝生成的详细原因，不是 GenerationError 时返回 nil
+func FailureDetail(err error) *model.GenerateFailure {
+	var genErr *GenerationError
+	if !errors.As(err, &genErr) {
+		return nil
+	}
+	return &model.GenerateFailure{
+		Reason:   genErr.Reason,
+		Category: genErr.Category,
+		Message:  genErr.Message,
+	}
+}
+
+// BudgetDetail 返回预算用尽的详细信息，不是预算用尽错误时返回 nil
+func BudgetDetail(err error) *model.BudgetWarning {
+	var exceeded *budget.ExceededError
+	if !errors.As(err, &exceeded) {
+		return nil
+	}
+	return exceeded.Detail()
+}
+
+// checkResponse 检查模型响应
+// 输入被拦截，或所有候选结果都没有内容时，根据拦截原因和结束原因返回对应的错误
+func checkResponse(resp *generator.Response) error {
+	if feedback := resp.PromptFeedback; feedback != nil && feedback.BlockReason != "" {
+		return &GenerationError{
+			Err:      ErrBlockedBySafety,
+			Reason:   feedback.BlockReason,
+			Category: blockedCategory(feedback.SafetyRatings),
+			Message:  feedback.BlockReasonMessage,
+		}
+	}
+	if !resp.Empty() {
+		return nil
+	}
+
+	for _, candidate := range resp.Candidates {
+		var kind error
+		switch candidate.FinishReason {
+		case "SAFETY", "IMAGE_SAFETY", "PROHIBITED_CONTENT", "IMAGE_PROHIBITED_CONTENT", "BLOCKLIST", "SPII":
+			kind = ErrBlockedBySafety
+		case "RECITATION", "IMAGE_RECITATION":
+			kind = ErrRecitation
+		case "MAX_TOKENS":
+			kind = ErrMaxTokens
+		default:
+			continue
+		}
+		genErr := &GenerationError{
+			Err:     kind,
+			Reason:  candidate.FinishReason,
+			Message: candidate.FinishMessage,
+		}
+		if kind == ErrBlockedBySafety {
+			genErr.Category = blockedCategory(candidate.SafetyRatings)
+		}
+		return genErr
+	}
+	return errNoContent
+}
+
+// blockedCategory 返回触发拦截的危害类别
+// 没有明确标记拦截的评级时，取概率为 HIGH 的第一个类别
+func blockedCategory(ratings []generator.SafetyRating) string {
+	for _, rating := range ratings {
+		if rating.Blocked {
+			return rating.Category
+		}
+	}
+	for _, rating := range ratings {
+		if rating.Probability == "HIGH" {
+			return rating.Category
+		}
+	}
+	return ""
+}
@@ -0,0 +1,176 @@
+package image
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/guixu633/agent/backend/internal/model"
+	"github.com/guixu633/agent/backend/internal/repository"
+)
+
+const (
+	defaultListLimit = 50
+	maxListLimit     = 200
+)
+
+// listCursor 分页游标的内容（JSON 经 base64 编码后返回给客户端）
+// 记录生成游标时的排序方式，防止与其他排序方式混用
+type listCursor struct {
+	Sort  string `json:"s"`
+	Order string `json:"o"`
+	repository.ImageCursor
+}
+
+// ListWorkspaceImages 分页列出工作区的图片（从数据库读取）
+func (s *Service) ListWorkspaceImages(ctx context.Context, req *model.ListWorkspaceImagesRequest) (*model.ListWorkspaceImagesResponse, error) {
+	opts, err := s.listOptions(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// 多查询一条，判断是否还有下一页
+	limit := opts.Limit
+	opts.Limit = limit + 1
+	dbImages, err := s.imageRepo.ListByWorkspaceName(ctx, req.Workspace, opts)
+	if err != nil {
+		return nil, fmt.Errorf("列出工作区图片失败: %w", err)
+	}
+
+	var nextCursor string
+	if len(dbImages) > limit {
+		dbImages = dbImages[:limit]
+		nextCursor, err = encodeListCursor(listCursor{
+			Sort:        opts.Sort,
+			Order:       req.Order,
+			ImageCursor: *repository.NewImageCursor(dbImages[limit-1], opts.Sort),
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// 转换为 model 格式
+	// 注意：Prompt, RefImages, MessageList 不在列表中返回，需要通过 GetImageDetail 接口获取
+	images := make([]model.ImageInfo, 0, len(dbImages))
+	for _, dbImage := range dbImages {
+		info, err := s.imageInfo(ctx, dbImage)
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, info)
+	}
+	infos := make([]*model.ImageInfo, 0, len(images))
+	for i := range images {
+		infos = append(infos, &images[i])
+	}
+	if err := s.fillImageTags(ctx, infos); err != nil {
+		return nil, err
+	}
+
+	return &model.ListWorkspaceImagesResponse{
+		Images:     images,
+		NextCursor: nextCursor,
+	}, nil
+}
+
+// listOptions 校验列表请求并转换为查询条件（会填充请求中的默认排序方式）
+func (s *Service) listOptions(req *model.ListWorkspaceImagesRequest) (repository.ImageListOptions, error) {
+	if req.Sort == "" {
+		req.Sort = repository.ImageSortCreated
+	}
+	if req.Order == "" {
+		req.Order = "desc"
+	}
+
+	opts := repository.ImageListOptions{
+		Sort:       req.Sort,
+		Desc:       req.Order == "desc",
+		Limit:      req.Limit,
+		SourceType: req.SourceType,
+		MimeType:   req.MimeType,
+		MinSize:    req.MinSize,
+		MaxSize:    req.MaxSize,
+	}
+	switch req.Sort {
+	case repository.ImageSortCreated, repository.ImageSortUpdated, repository.ImageSortName, repository.ImageSortSize:
+	default:
+		return opts, fmt.Errorf("%w: 排序字段必须为 created、updated、name 或 size", ErrInvalidListQuery)
+	}
+	if req.Order != "desc" && req.Order != "asc" {
+		return opts, fmt.Errorf("%w: 排序方向必须为 desc 或 asc", ErrInvalidListQuery)
+	}
+	if opts.Limit < 0 {
+		return opts, fmt.Errorf("%w: 每页数量不能为负数", ErrInvalidListQuery)
+	}
+	if opts.Limit == 0 {
+		opts.Limit = defaultListLimit
+	}
+	opts.Limit = min(opts.Limit, maxListLimit)
+
+	if opts.MinSize < 0 || opts.MaxSize < 0 || (opts.MaxSize > 0 && opts.MinSize > opts.MaxSize) {
+		return opts, fmt.Errorf("%w: 文件大小范围不合法", ErrInvalidListQuery)
+	}
+
+	var err error
+	if opts.Tags, err = normalizeTags(req.Tags); err != nil {
+		return opts, err
+	}
+	if opts.CreatedAfter, err = parseListTime(req.CreatedAfter); err != nil {
+		return opts, err
+	}
+	if opts.CreatedBefore, err = parseListTime(req.CreatedBefore); err != nil {
+		return opts, err
+	}
+
+	if req.Cursor != "" {
+		cursor, err := decodeListCursor(req.Cursor)
+		if err != nil {
+			return opts, err
+		}
+		if cursor.Sort != req.Sort || cursor.Order != req.Order {
+			return opts, fmt.Errorf("%w: 游标与排序方式不匹配", ErrInvalidListQuery)
+		}
+		opts.After = &cursor.ImageCursor
+	}
+	return opts, nil
+}
+
+// parseListTime 解析时间过滤条件（RFC 3339 格式或 YYYY-MM-DD），转换为数据库中的时区，为空时返回零值
+func parseListTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.In(dbLocation), nil
+	}
+	t, err := time.ParseInLocation(time.DateOnly, value, dbLocation)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: 时间格式必须为 RFC 3339 或 YYYY-MM-DD: %s", ErrInvalidListQuery, value)
+	}
+	return t, nil
+}
+
+// encodeListCursor 编码分页游标
+func encodeListCursor(cursor listCursor) (string, error) {
+	data, err := json.Marshal(cursor)
+	if err != nil {
+		return "", fmt.Errorf("编码分页游标失败: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// decodeListCursor 解码分页游标，并校验游标值与其中记录的排序方式匹配
+func decodeListCursor(value string) (*listCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("%w: 分页游标格式错误", ErrInvalidListQuery)
+	}
+	var cursor listCursor
+	if err := json.Unmarshal(data, &cursor); err != nil || cursor.ID == 0 || !cursor.Valid(cursor.Sort) {
+		return nil, fmt.Errorf("%w: 分页游标格式错误", ErrInvalidListQuery)
+	}
+	return &cursor, nil
+}
@@ -0,0 +1,214 @@
+package image
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/guixu633/agent/backend/internal/config"
+	"github.com/guixu633/agent/backend/internal/generator"
+	"github.com/guixu633/agent/backend/internal/model"
+	"github.com/guixu633/agent/backend/internal/repository"
+	"github.com/guixu633/agent/backend/internal/service/budget"
+)
+
+// runPart 审计记录中的响应片段（图片只记录类型和大小，不内联数据）
+type runPart struct {
+	Type     string `json:"type"`
+	Text     string `json:"text,omitempty"`
+	MimeType string `json:"mime_type,omitempty"`
+	Size     int    `json:"size,omitempty"`
+}
+
+// runCandidate 审计记录中的一个候选结果
+type runCandidate struct {
+	Index int       `json:"index"`
+	Parts []runPart `json:"parts"`
+}
+
+// runFinishReason 候选结果的结束原因
+type runFinishReason struct {
+	Index         int    `json:"index"`
+	FinishReason  string `json:"finish_reason"`
+	FinishMessage string `json:"finish_message,omitempty"`
+}
+
+// runSafetyRatings 候选结果的安全评级
+type runSafetyRatings struct {
+	Index   int                      `json:"index"`
+	Ratings []generator.SafetyRating `json:"ratings"`
+}
+
+// runGroundingMetadata 候选结果的联网搜索引用信息
+type runGroundingMetadata struct {
+	Index    int             `json:"index"`
+	Metadata json.RawMessage `json:"metadata"`
+}
+
+// recordRun 记录一次模型调用的审计信息，返回本次调用的记录
+// 预算检查时已预占记录的更新该记录，否则创建新记录
+// resp 可以为 nil（调用失败时）；记录失败不影响生成流程，只记录日志，返回的记录 ID 为预占的记录 ID 或 0
+func (s *Service) recordRun(ctx context.Context, gen *generation, resp *generator.Response, latency time.Duration, genErr error) *repository.GenerationRun {
+	run := &repository.GenerationRun{
+		ID:           gen.runID,
+		WorkspaceID:  gen.workspace.ID,
+		Model:        gen.genReq.Options.Model,
+		Status:       repository.RunStatusSucceeded,
+		Prompt:       gen.req.Prompt,
+		RefImages:    gen.req.Images,
+		HistoryTurns: len(gen.genReq.History),
+		LatencyMs:    latency.Milliseconds(),
+	}
+	if genErr != nil {
+		run.Status = repository.RunStatusFailed
+		run.Error = genErr.Error()
+	}
+
+	var err error
+	if run.Config, err = json.Marshal(gen.genReq.Options); err != nil {
+		log.Printf("序列化生成配置失败: %v", err)
+	}
+
+	if resp != nil {
+		imageCount := 0
+		candidates := make([]runCandidate, 0, len(resp.Candidates))
+		finishReasons := make([]runFinishReason, 0)
+		safetyRatings := make([]runSafetyRatings, 0)
+		groundingMetadata := make([]runGroundingMetadata, 0)
+		for _, c := range resp.Candidates {
+			parts := make([]runPart, 0, len(c.Parts))
+			for _, part := range c.Parts {
+				if part.Type == generator.PartTypeImage {
+					imageCount++
+				}
+				parts = append(parts, runPart{
+					Type:     string(part.Type),
+					Text:     part.Text,
+					MimeType: part.MimeType,
+					Size:     len(part.Data),
+				})
+			}
+			candidates = append(candidates, runCandidate{Index: c.Index, Parts: parts})
+
+			if c.FinishReason != "" {
+				finishReasons = append(finishReasons, runFinishReason{Index: c.Index, FinishReason: c.FinishReason, FinishMessage: c.FinishMessage})
+			}
+			if len(c.SafetyRatings) > 0 {
+				safetyRatings = append(safetyRatings, runSafetyRatings{Index: c.Index, Ratings: c.SafetyRatings})
+			}
+			if len(c.GroundingMetadata) > 0 {
+				groundingMetadata = append(groundingMetadata, runGroundingMetadata{Index: c.Index, Metadata: c.GroundingMetadata})
+			}
+		}
+
+		run.Response, _ = json.Marshal(candidates)
+		run.FinishReasons, _ = json.Marshal(finishReasons)
+		run.SafetyRatings, _ = json.Marshal(safetyRatings)
+		run.GroundingMetadata, _ = json.Marshal(groundingMetadata)
+		if resp.PromptFeedback != nil {
+			run.PromptFeedback, _ = json.Marshal(resp.PromptFeedback)
+		}
+		if resp.Usage != nil {
+			run.PromptTokens = resp.Usage.PromptTokens
+			run.CandidatesTokens = resp.Usage.CandidatesTokens
+			run.ThoughtsTokens = resp.Usage.ThoughtsTokens
+			run.TotalTokens = resp.Usage.TotalTokens
+		}
+		run.ImageCount = imageCount
+		run.Cost = estimateCost(gen.pricing, run.PromptTokens, run.CandidatesTokens, run.ThoughtsTokens, imageCount)
+		run.ModelVersion = resp.ModelVersion
+	}
+
+	// 调用被取消（如客户端断开）时仍需要写入记录
+	ctx = context.WithoutCancel(ctx)
+	var saved *repository.GenerationRun
+	if run.ID != 0 {
+		saved, err = s.runRepo.Finish(ctx, run)
+	} else {
+		saved, err = s.runRepo.Create(ctx, run)
+	}
+	if err != nil {
+		log.Printf("保存模型调用审计记录失败: %v", err)
+		return run
+	}
+	return saved
+}
+
+// budgetWarnings 计入本次调用的用量后，返回达到预算软限制的提醒
+func budgetWarnings(gen *generation, run *repository.GenerationRun) []model.BudgetWarning {
+	return gen.budget.Warnings(budget.Usage{
+		Succeeded: run.Status == repository.RunStatusSucceeded,
+		Tokens:    int64(run.TotalTokens),
+		Cost:      run.Cost,
+	})
+}
+
+// GetGenerationRun 获取模型调用审计记录（包含生成并保存的图片）
+func (s *Service) GetGenerationRun(ctx context.Context, id int64) (*model.GetGenerationRunResponse, error) {
+	run, err := s.runRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if run == nil {
+		return nil, ErrRunNotFound
+	}
+
+	dbImages, err := s.imageRepo.ListByGenerationRun(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("获取生成的图片失败: %w", err)
+	}
+	images := make([]model.ImageInfo, 0, len(dbImages))
+	for _, dbImage := range dbImages {
+		info, err := s.imageInfo(ctx, dbImage)
+		if err != nil {
+			return nil, err
+		}
+		info.CandidateIndex = dbImage.CandidateIndex
+		images = append(images, info)
+	}
+
+	refImages := run.RefImages
+	if refImages == nil {
+		refImages = []string{}
+	}
+
+	return &model.GetGenerationRunResponse{
+		Run: model.GenerationRun{
+			ID:                run.ID,
+			Model:             run.Model,
+			Status:            run.Status,
+			Config:            run.Config,
+			Prompt:            run.Prompt,
+			RefImages:         refImages,
+			HistoryTurns:      run.HistoryTurns,
+			Response:          run.Response,
+			FinishReasons:     run.FinishReasons,
+			SafetyRatings:     run.SafetyRatings,
+			PromptFeedback:    run.PromptFeedback,
+			GroundingMetadata: run.GroundingMetadata,
+			ModelVersion:      run.ModelVersion,
+			Usage: model.TokenUsage{
+				PromptTokens:     run.PromptTokens,
+				CandidatesTokens: run.CandidatesTokens,
+				ThoughtsTokens:   run.ThoughtsTokens,
+				TotalTokens:      run.TotalTokens,
+			},
+			ImageCount: run.ImageCount,
+			Cost:       run.Cost,
+			LatencyMs:  run.LatencyMs,
+			Error:      run.Error,
+			Images:     images,
+			CreatedAt:  s.formatTime(run.CreatedAt),
+		},
+	}, nil
+}
+
+// estimateCost 按价格表估算一次调用的成本（美元）
+func estimateCost(pricing config.ModelPricing, promptTokens, candidatesTokens, thoughtsTokens, imageCount int) float64 {
+	return float64(promptTokens)/1e6*pricing.PromptPerMillion +
+		float64(candidatesTokens)/1e6*pricing.CandidatesPerMillion +
+		float64(thoughtsTokens)/1e6*pricing.ThoughtsPerMillion +
+		float64(imageCount)*pricing.PerImage
+}
@@ -0,0 +1,228 @@
+package image
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/guixu633/agent/backend/internal/model"
+	"github.com/guixu633/agent/backend/internal/repository"
+)
+
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+
+	// snippetContext 片段中第一处匹配之前保留的字符数
+	snippetContext = 20
+	// snippetLength 片段的最大字符数（不含省略号）
+	snippetLength = 80
+)
+
+// SearchImages 在工作区中按文件名、提示词和对话文本全文搜索图片，返回按相关度排序的结果和匹配片段
+func (s *Service) SearchImages(ctx context.Context, req *model.SearchImagesRequest) (*model.SearchImagesResponse, error) {
+	terms := searchQueryTerms(req.Query)
+	if len(terms) == 0 {
+		return nil, fmt.Errorf("%w: 搜索词不能只包含标点符号", ErrInvalidSearchQuery)
+	}
+	if req.Limit < 0 || req.Offset < 0 {
+		return nil, fmt.Errorf("%w: 每页数量和偏移量不能为负数", ErrInvalidSearchQuery)
+	}
+	limit := req.Limit
+	if limit == 0 {
+		limit = defaultSearchLimit
+	}
+	limit = min(limit, maxSearchLimit)
+
+	// 多查询一条，判断是否还有更多结果
+	dbResults, err := s.imageRepo.Search(ctx, req.Workspace, terms, limit+1, req.Offset)
+	if err != nil {
+		return nil, fmt.Errorf("搜索图片失败: %w", err)
+	}
+	hasMore := len(dbResults) > limit
+	if hasMore {
+		dbResults = dbResults[:limit]
+	}
+
+	results := make([]model.ImageSearchResult, 0, len(dbResults))
+	for _, dbResult := range dbResults {
+		info, err := s.imageInfo(ctx, dbResult.Image)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, model.ImageSearchResult{
+			ImageInfo:  info,
+			Score:      dbResult.Rank,
+			Highlights: searchHighlights(dbResult.Image, terms),
+		})
+	}
+	infos := make([]*model.ImageInfo, 0, len(results))
+	for i := range results {
+		infos = append(infos, &results[i].ImageInfo)
+	}
+	if err := s.fillImageTags(ctx, infos); err != nil {
+		return nil, err
+	}
+
+	return &model.SearchImagesResponse{
+		Results: results,
+		HasMore: hasMore,
+	}, nil
+}
+
+// searchHighlights 生成文件名、提示词和第一条匹配的对话文本中的匹配片段
+func searchHighlights(img *repository.Image, terms []string) []model.SearchHighlight {
+	highlights := make([]model.SearchHighlight, 0)
+	if snippet, ok := highlightSnippet(img.Name, terms); ok {
+		highlights = append(highlights, model.SearchHighlight{Field: "name", Snippet: snippet})
+	}
+	if snippet, ok := highlightSnippet(img.Prompt, terms); ok {
+		highlights = append(highlights, model.SearchHighlight{Field: "prompt", Snippet: snippet})
+	}
+	for _, msg := range img.MessageList {
+		if msg.Type != string(model.MessageTypeText) {
+			continue
+		}
+		if snippet, ok := highlightSnippet(msg.Content, terms); ok {
+			highlights = append(highlights, model.SearchHighlight{Field: "message", Snippet: snippet})
+			break
+		}
+	}
+	return highlights
+}
+
+// isSearchCJK 是否为按单字和二元组切分的中日韩字符
+// 范围与迁移 014_add_image_search 中的 image_search_tokens 保持一致
+func isSearchCJK(r rune) bool {
+	return (r >= 0x3040 && r <= 0x30FF) || // 平假名、片假名
+		(r >= 0x3400 && r <= 0x4DBF) || // CJK 扩展 A
+		(r >= 0x4E00 && r <= 0x9FFF) || // CJK 统一汉字
+		(r >= 0xAC00 && r <= 0xD7AF) || // 韩文音节
+		(r >= 0xF900 && r <= 0xFAFF) || // CJK 兼容汉字
+		(r >= 0x20000 && r <= 0x2FFFF) // CJK 扩展 B 及之后
+}
+
+// isSearchSeparator 是否为分隔符（标点符号和空白），r 为转换为小写后的字符
+// 范围与迁移 014_add_image_search 中的 image_search_tokens 保持一致
+func isSearchSeparator(r rune) bool {
+	if r < 0x80 {
+		return !(r >= '0' && r <= '9') && !(r >= 'a' && r <= 'z')
+	}
+	return r <= 0xBF || // Latin-1 控制字符和符号
+		(r >= 0x2000 && r <= 0x206F) || // 通用标点
+		(r >= 0x3000 && r <= 0x303F) || // CJK 符号和标点
+		(r >= 0xFF00 && r <= 0xFF0F) || (r >= 0xFF1A && r <= 0xFF20) || // 全角标点
+		(r >= 0xFF3B && r <= 0xFF40) || (r >= 0xFF5B && r <= 0xFF65)
+}
+
+// searchQueryTerms 按与索引相同的规则切分搜索词，返回去重后的词元
+// 索引中的中日韩文本同时包含单字和相邻两字的二元组：连续两个及以上的中日韩字符取二元组（要求全部匹配，近似短语匹配），
+// 单独一个字时取单字；其他字母数字按连续的字母数字切分并转为小写
+func searchQueryTerms(query string) []string {
+	terms := make([]string, 0)
+	add := func(term string) {
+		if term != "" && !slices.Contains(terms, term) {
+			terms = append(terms, term)
+		}
+	}
+
+	var word strings.Builder
+	var run []rune // 连续的中日韩字符
+	flushRun := func() {
+		if len(run) == 1 {
+			add(string(run))
+		}
+		for i := 1; i < len(run); i++ {
+			add(string(run[i-1 : i+1]))
+		}
+		run = run[:0]
+	}
+	flushWord := func() {
+		add(word.String())
+		word.Reset()
+	}
+
+	for _, r := range strings.ToLower(query) {
+		switch {
+		case isSearchCJK(r):
+			flushWord()
+			run = append(run, r)
+		case isSearchSeparator(r):
+			flushWord()
+			flushRun()
+		default:
+			flushRun()
+			word.WriteRune(r)
+		}
+	}
+	flushWord()
+	flushRun()
+	return terms
+}
+
+// highlightSnippet 在文本中查找词元，返回截取的包含匹配内容的片段（匹配部分用 <mark></mark> 标记）
+// 中日韩词元按子串匹配，其他词元需要是完整的词（与索引的切分方式一致）；没有匹配时返回 false
+func highlightSnippet(text string, terms []string) (string, bool) {
+	runes := []rune(text)
+	lower := make([]rune, len(runes))
+	for i, r := range runes {
+		lower[i] = unicode.ToLower(r)
+	}
+	// isWordRune 是否为非中日韩词元中的字符
+	isWordRune := func(i int) bool {
+		return i >= 0 && i < len(lower) && !isSearchCJK(lower[i]) && !isSearchSeparator(lower[i])
+	}
+
+	marked := make([]bool, len(runes))
+	first := -1
+	for _, term := range terms {
+		termRunes := []rune(term)
+		cjk := isSearchCJK(termRunes[0])
+		for i := 0; i+len(termRunes) <= len(lower); i++ {
+			if !slices.Equal(lower[i:i+len(termRunes)], termRunes) {
+				continue
+			}
+			if !cjk && (isWordRune(i-1) || isWordRune(i+len(termRunes))) {
+				continue
+			}
+			for j := i; j < i+len(termRunes); j++ {
+				marked[j] = true
+			}
+			if first < 0 || i < first {
+				first = i
+			}
+		}
+	}
+	if first < 0 {
+		return "", false
+	}
+
+	// 以第一处匹配为准截取片段，靠近末尾时向前补足长度
+	start := max(first-snippetContext, 0)
+	end := min(start+snippetLength, len(runes))
+	start = max(end-snippetLength, 0)
+
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("…")
+	}
+	for i := start; i < end; {
+		j := i
+		for j < end && marked[j] == marked[i] {
+			j++
+		}
+		segment := html.EscapeString(string(runes[i:j]))
+		if marked[i] {
+			segment = "<mark>" + segment + "</mark>"
+		}
+		b.WriteString(segment)
+		i = j
+	}
+	if end < len(runes) {
+		b.WriteString("…")
+	}
+	return b.String(), true
+}
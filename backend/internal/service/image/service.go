@@ -1,47 +1,95 @@
 package image
 
 import (
-	"bytes"
 	"context"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log"
 	"mime"
 	"path/filepath"
+	"slices"
 	"strings"
 	"time"
 
+	"github.com/guixu633/agent/backend/internal/config"
+	"github.com/guixu633/agent/backend/internal/generator"
 	"github.com/guixu633/agent/backend/internal/model"
-	"github.com/guixu633/agent/backend/internal/oss"
 	"github.com/guixu633/agent/backend/internal/repository"
+	"github.com/guixu633/agent/backend/internal/service/budget"
+	"github.com/guixu633/agent/backend/internal/storage"
 	"github.com/guixu633/agent/backend/pkg/thumbnail"
-	"google.golang.org/genai"
-)
-
-const (
-	DefaultModel = "gemini-3-pro-image-preview"
 )
 
 // Service 图片服务
 type Service struct {
-	genaiClient   *genai.Client
-	ossClient     *oss.Client
-	imageRepo     repository.ImageRepository
-	workspaceRepo repository.WorkspaceRepository
+	registry         *generator.Registry
+	store            storage.BlobStore // 图片存储
+	layout           storage.Layout    // 图片在存储中的路径布局
+	urlTTL           time.Duration     // 签名访问 URL 的有效期（为 0 时返回公开 URL）
+	imageRepo        repository.ImageRepository
+	workspaceRepo    repository.WorkspaceRepository
+	conversationRepo repository.ConversationRepository
+	runRepo          repository.GenerationRunRepository
+	storageOpRepo    repository.StorageOpRepository // 待删除的文件（由后台任务执行）
+	budgetService    *budget.Service                // 工作区预算检查（为 nil 时不限制）
+}
+
+// Deps 图片服务的依赖（未设置的可选依赖为零值）
+type Deps struct {
+	Registry         *generator.Registry
+	Store            storage.BlobStore // 图片存储
+	Layout           storage.Layout    // 图片在存储中的路径布局
+	URLTTL           time.Duration     // 签名访问 URL 的有效期（为 0 时返回公开 URL）
+	ImageRepo        repository.ImageRepository
+	WorkspaceRepo    repository.WorkspaceRepository
+	ConversationRepo repository.ConversationRepository
+	RunRepo          repository.GenerationRunRepository
+	StorageOpRepo    repository.StorageOpRepository // 待删除的文件（由后台任务执行）
+	BudgetService    *budget.Service                // 工作区预算检查（为 nil 时不限制）
 }
 
 // NewService 创建图片服务实例
-func NewService(genaiClient *genai.Client, ossClient *oss.Client, imageRepo repository.ImageRepository, workspaceRepo repository.WorkspaceRepository) *Service {
+func NewService(deps Deps) *Service {
 	return &Service{
-		genaiClient:   genaiClient,
-		ossClient:     ossClient,
-		imageRepo:     imageRepo,
-		workspaceRepo: workspaceRepo,
+		registry:         deps.Registry,
+		store:            deps.Store,
+		layout:           deps.Layout,
+		urlTTL:           deps.URLTTL,
+		imageRepo:        deps.ImageRepo,
+		workspaceRepo:    deps.WorkspaceRepo,
+		conversationRepo: deps.ConversationRepo,
+		runRepo:          deps.RunRepo,
+		storageOpRepo:    deps.StorageOpRepo,
+		budgetService:    deps.BudgetService,
 	}
 }
 
-// UploadImage 上传图片到 OSS 并保存到数据库
-func (s *Service) UploadImage(ctx context.Context, file io.Reader, filename string, workspace string) (*model.ImageUploadResponse, error) {
+// 上传时工作区中已有同名图片的处理方式
+const (
+	ConflictRename  = "rename"  // 自动添加序号，如 cat (2).png（默认）
+	ConflictReject  = "reject"  // 拒绝上传
+	ConflictReplace = "replace" // 用新内容替换已有图片（保留图片 ID 和文件名）
+)
+
+// maxUploadAttempts 上传时查找可用文件名或存储路径的最大尝试次数
+const maxUploadAttempts = 100
+
+// UploadImage 上传图片到存储并保存到数据库
+// onConflict 指定工作区中已有同名图片时的处理方式（为空时自动添加序号）
+// 文件只写入不存在的存储路径（条件写入），不会覆盖已有图片的文件；同名冲突以数据库记录为准，
+// 并发上传同名图片导致创建记录失败时按处理方式重新处理
+func (s *Service) UploadImage(ctx context.Context, file io.Reader, filename string, workspace string, onConflict string) (*model.ImageUploadResponse, error) {
+	if onConflict == "" {
+		onConflict = ConflictRename
+	}
+	if !slices.Contains([]string{ConflictRename, ConflictReject, ConflictReplace}, onConflict) {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidConflictPolicy, onConflict)
+	}
+
 	// 获取或创建工作区
 	ws, err := s.workspaceRepo.GetByName(ctx, workspace)
 	if err != nil {
@@ -57,76 +105,205 @@ func (s *Service) UploadImage(ctx context.Context, file io.Reader, filename stri
 		return nil, fmt.Errorf("读取图片数据失败: %w", err)
 	}
 
-	// 上传原图到 OSS
-	path, err := s.ossClient.UploadImage(bytes.NewReader(imageData), filename, workspace)
+	// 工作区中已有相同内容的图片时复用已有文件，文件名也相同时直接返回已有图片
+	contentHash := fmt.Sprintf("%x", sha256.Sum256(imageData))
+	duplicates, err := s.imageRepo.ListByContentHash(ctx, ws.ID, contentHash)
 	if err != nil {
-		return nil, fmt.Errorf("上传图片失败: %w", err)
+		return nil, fmt.Errorf("查询相同内容的图片失败: %w", err)
+	}
+	for _, dbImage := range duplicates {
+		if dbImage.Name == filename {
+			return s.uploadResponse(ctx, dbImage, true)
+		}
 	}
 
-	// 生成并上传缩略图
-	thumbnailPath, thumbnailURL, err := s.uploadThumbnail(ctx, imageData, filename, workspace)
+	img := &repository.Image{
+		WorkspaceID: ws.ID,
+		Size:        int64(len(imageData)),
+		MimeType:    s.detectMimeTypeFromFilename(filename),
+		SourceType:  "upload",
+		ContentHash: contentHash,
+	}
+	// storeFresh 不复用已有文件，将上传内容写入新路径
+	storeFresh := func() error {
+		img.MimeType = s.detectMimeTypeFromFilename(filename)
+		img.OSSPath, img.ThumbnailPath, err = s.storeUpload(ctx, workspace, filename, imageData)
+		return err
+	}
+	deduplicated := len(duplicates) > 0
+	if deduplicated {
+		// 保存记录时确认共享的文件仍被引用（存储操作任务不会同时删除），否则改为写入新文件
+		source := duplicates[0]
+		img.OSSPath = source.OSSPath
+		img.ThumbnailPath = source.ThumbnailPath
+		img.MimeType = source.MimeType
+	} else if err := storeFresh(); err != nil {
+		return nil, err
+	}
+	// discard 删除本次上传的文件（回滚，共享的已有文件不删除）
+	discard := func() {
+		if !deduplicated {
+			s.deleteObjects(ctx, img.OSSPath, img.ThumbnailPath)
+		}
+	}
+
+	name := filename
+	for attempt, n := 1, 1; attempt <= maxUploadAttempts; attempt++ {
+		existing, err := s.imageRepo.GetByName(ctx, ws.ID, name)
+		if err != nil {
+			discard()
+			return nil, fmt.Errorf("查询同名图片失败: %w", err)
+		}
+		if existing != nil {
+			switch onConflict {
+			case ConflictReject:
+				discard()
+				return nil, fmt.Errorf("%w: %s", ErrImageExists, name)
+			case ConflictReplace:
+				resp, err := s.replaceImage(ctx, existing, img, deduplicated, discard)
+				if deduplicated && errors.Is(err, repository.ErrSharedObjectGone) {
+					// 共享的文件已被删除，改为写入新文件后重试
+					deduplicated = false
+					if err := storeFresh(); err != nil {
+						return nil, err
+					}
+					continue
+				}
+				return resp, err
+			}
+			n++
+			name = numberedName(filename, n)
+			continue
+		}
+
+		// 保存到数据库
+		img.Name = name
+		var dbImage *repository.Image
+		if deduplicated {
+			dbImage, err = s.imageRepo.CreateShared(ctx, img)
+		} else {
+			dbImage, err = s.imageRepo.Create(ctx, img)
+		}
+		if errors.Is(err, repository.ErrImageNameExists) {
+			// 并发上传了同名图片，重新查询后按处理方式处理
+			continue
+		}
+		if deduplicated && errors.Is(err, repository.ErrSharedObjectGone) {
+			// 共享的文件已被删除，改为写入新文件后重试
+			deduplicated = false
+			if err := storeFresh(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err != nil {
+			// 如果数据库保存失败，删除已上传的文件（回滚）
+			discard()
+			return nil, fmt.Errorf("保存图片记录到数据库失败: %w", err)
+		}
+		return s.uploadResponse(ctx, dbImage, deduplicated)
+	}
+
+	discard()
+	return nil, fmt.Errorf("保存图片记录到数据库失败: 尝试 %d 次后仍有同名图片", maxUploadAttempts)
+}
+
+// storeUpload 将上传的图片和缩略图写入新的存储路径，返回原图和缩略图路径
+// 路径已被占用时自动添加序号，缩略图生成或上传失败不影响主流程（缩略图路径为空）
+func (s *Service) storeUpload(ctx context.Context, workspace, filename string, imageData []byte) (string, string, error) {
+	path, err := s.putNewImage(ctx, workspace, filename, imageData)
 	if err != nil {
-		// 缩略图生成失败不影响主流程，只记录错误
-		thumbnailPath = ""
-		thumbnailURL = ""
+		return "", "", fmt.Errorf("上传图片失败: %w", err)
 	}
 
-	// 获取访问 URL
-	url := s.ossClient.GetImageURL(path)
+	thumbnailData, err := thumbnail.GenerateThumbnail(imageData, s.detectMimeTypeFromFilename(filename))
+	if err != nil {
+		log.Printf("生成缩略图失败 (path: %s): %v", path, err)
+		return path, "", nil
+	}
+	thumbnailPath, err := s.putNewImage(ctx, workspace, thumbnail.GetThumbnailFilename(filepath.Base(path)), thumbnailData)
+	if err != nil {
+		log.Printf("上传缩略图失败 (path: %s): %v", path, err)
+		return path, "", nil
+	}
+	return path, thumbnailPath, nil
+}
 
-	// 检测 MIME 类型
-	mimeType := s.detectMimeTypeFromFilename(filename)
+// replaceImage 用上传的内容替换已有同名图片（保留图片 ID、文件名和生成信息）
+// 新内容写入新路径后更新记录，在同一事务中登记删除不再被引用的旧文件；
+// 复用已有文件时共享的文件已不再被引用则返回 repository.ErrSharedObjectGone
+func (s *Service) replaceImage(ctx context.Context, existing *repository.Image, img *repository.Image, deduplicated bool, discard func()) (*model.ImageUploadResponse, error) {
+	updates := map[string]interface{}{
+		"oss_path":       img.OSSPath,
+		"thumbnail_path": img.ThumbnailPath,
+		"size":           img.Size,
+		"mime_type":      img.MimeType,
+		"content_hash":   img.ContentHash,
+	}
+	update := s.imageRepo.UpdateWithStorageOps
+	if deduplicated {
+		update = s.imageRepo.ReplaceShared
+	}
+	dbImage, err := update(ctx, existing.ID, updates, []string{existing.OSSPath, existing.ThumbnailPath})
+	if err != nil {
+		discard()
+		return nil, fmt.Errorf("替换图片记录失败: %w", err)
+	}
 
-	// 保存到数据库
-	dbImage, err := s.imageRepo.Create(ctx, &repository.Image{
-		WorkspaceID:   ws.ID,
-		Name:          filename,
-		OSSPath:       path,
-		OSSUrl:        url,
-		ThumbnailPath: thumbnailPath,
-		ThumbnailUrl:  thumbnailURL,
-		Size:          int64(len(imageData)),
-		MimeType:      mimeType,
-		SourceType:    "upload",
-	})
+	resp, err := s.uploadResponse(ctx, dbImage, deduplicated)
 	if err != nil {
-		// 如果数据库保存失败，删除 OSS 文件（回滚）
-		s.ossClient.DeleteImage(path)
-		if thumbnailPath != "" {
-			s.ossClient.DeleteImage(thumbnailPath)
-		}
-		return nil, fmt.Errorf("保存图片记录到数据库失败: %w", err)
+		return nil, err
+	}
+	resp.Replaced = true
+	return resp, nil
+}
+
+// numberedName 返回添加序号后的文件名，如 cat.png 的第 2 个为 cat (2).png（n <= 1 时返回原文件名）
+func numberedName(filename string, n int) string {
+	if n <= 1 {
+		return filename
+	}
+	ext := filepath.Ext(filename)
+	return fmt.Sprintf("%s (%d)%s", strings.TrimSuffix(filename, ext), n, ext)
+}
+
+// uploadResponse 转换为上传响应
+func (s *Service) uploadResponse(ctx context.Context, dbImage *repository.Image, deduplicated bool) (*model.ImageUploadResponse, error) {
+	url, err := s.imageURL(ctx, dbImage.OSSPath)
+	if err != nil {
+		return nil, err
 	}
 
 	return &model.ImageUploadResponse{
-		Path: dbImage.OSSPath,
-		URL:  dbImage.OSSUrl,
+		ID:           dbImage.ID,
+		Name:         dbImage.Name,
+		Path:         dbImage.OSSPath,
+		URL:          url,
+		Deduplicated: deduplicated,
 	}, nil
 }
 
 // uploadThumbnail 生成并上传缩略图
-// 返回缩略图路径和 URL
-func (s *Service) uploadThumbnail(_ context.Context, imageData []byte, filename string, workspace string) (string, string, error) {
+// filename 为原图的文件名；缩略图写入不存在的路径（已被占用时添加序号），返回缩略图路径
+func (s *Service) uploadThumbnail(ctx context.Context, imageData []byte, filename string, workspace string) (string, error) {
 	// 检测 MIME 类型
 	mimeType := s.detectMimeTypeFromFilename(filename)
 
 	// 生成缩略图
 	thumbnailData, err := thumbnail.GenerateThumbnail(imageData, mimeType)
 	if err != nil {
-		return "", "", fmt.Errorf("生成缩略图失败: %w", err)
+		return "", fmt.Errorf("生成缩略图失败: %w", err)
 	}
 
 	// 获取缩略图文件名
 	thumbnailFilename := thumbnail.GetThumbnailFilename(filename)
 
 	// 上传缩略图
-	thumbnailPath, err := s.ossClient.UploadImage(bytes.NewReader(thumbnailData), thumbnailFilename, workspace)
+	thumbnailPath, err := s.putNewImage(ctx, workspace, thumbnailFilename, thumbnailData)
 	if err != nil {
-		return "", "", fmt.Errorf("上传缩略图失败: %w", err)
+		return "", fmt.Errorf("上传缩略图失败: %w", err)
 	}
-
-	thumbnailURL := s.ossClient.GetImageURL(thumbnailPath)
-	return thumbnailPath, thumbnailURL, nil
+	return thumbnailPath, nil
 }
 
 // detectMimeTypeFromFilename 根据文件名检测 MIME 类型
@@ -140,100 +317,111 @@ func (s *Service) detectMimeTypeFromFilename(filename string) string {
 	return mimeType
 }
 
-// GenerateImage 生成图片
-func (s *Service) GenerateImage(ctx context.Context, req *model.ImageGenerateRequest) (*model.ImageGenerateResponse, error) {
-	// 构建请求内容
-	contents := []*genai.Content{
-		genai.NewContentFromText(req.Prompt, genai.RoleUser),
-	}
+// generation 一次生成调用所需的上下文
+type generation struct {
+	req          *model.ImageGenerateRequest
+	genReq       *generator.Request
+	generator    generator.ImageGenerator
+	workspace    *repository.Workspace
+	conversation *repository.Conversation // 继续的对话（新对话时为 nil）
+	params       json.RawMessage          // 实际使用的生成参数（保存到图片记录中）
+	pricing      config.ModelPricing      // 模型价格（用于估算调用成本）
+	runID        int64                    // 模型调用记录 ID（预占或记录后设置，记录失败时为 0）
+	budget       *budget.Status           // 生成前检查的工作区预算（未启用预算检查时为 nil）
+}
 
-	// 添加输入图片（从 OSS 获取）
-	for _, imagePath := range req.Images {
-		// 从 OSS 下载图片数据（Gemini API 需要二进制数据）
-		// 注意：如果未来 Gemini API 支持 URL，可以将 useURL 参数改为 true
-		_, imageData, err := s.ossClient.GetImageURLOrDownload(imagePath, false)
-		if err != nil {
-			return nil, fmt.Errorf("从 OSS 获取图片失败 (path: %s): %w", imagePath, err)
-		}
+// storedImage 已上传到存储的生成图片
+type storedImage struct {
+	filename      string
+	path          string
+	url           string // 访问 URL（只用于本次响应，不保存到数据库）
+	thumbnailPath string
+	thumbnailURL  string
+	size          int64
+	mimeType      string
+}
 
-		// 使用二进制数据
-		mimeType := s.detectMimeType(imagePath)
-		contents = append(contents, genai.NewContentFromBytes(imageData, mimeType, genai.RoleUser))
+// GenerateImage 生成图片
+func (s *Service) GenerateImage(ctx context.Context, req *model.ImageGenerateRequest) (*model.ImageGenerateResponse, error) {
+	gen, err := s.prepareGeneration(ctx, req)
+	if err != nil {
+		return nil, err
 	}
 
-	// 配置 Google Search Retrieval 工具（仅在启用联网搜索时添加）
-	var config *genai.GenerateContentConfig
-	if req.EnableWebSearch {
-		config = &genai.GenerateContentConfig{
-			Tools: []*genai.Tool{
-				{
-					GoogleSearch: &genai.GoogleSearch{},
-				},
-			},
-		}
+	// 调用图片生成器，无论成功与否都记录本次调用
+	start := time.Now()
+	resp, err := gen.generator.Generate(ctx, gen.genReq)
+	if err != nil {
+		err = fmt.Errorf("生成内容失败: %w", err)
+	} else {
+		err = checkResponse(resp)
 	}
-
-	// 调用 Gemini API
-	resp, err := s.genaiClient.Models.GenerateContent(ctx, DefaultModel, contents, config)
+	run := s.recordRun(ctx, gen, resp, time.Since(start), err)
+	gen.runID = run.ID
 	if err != nil {
-		return nil, fmt.Errorf("调用 Gemini API 失败: %w", err)
+		return nil, err
 	}
 
-	// 准备 LLM 交互详情（用于后续保存）- 暂时禁用
-	// llmDetail := map[string]interface{}{
-	// 	"request": map[string]interface{}{
-	// 		"prompt": req.Prompt,
-	// 		"images": req.Images,
-	// 		"config": config,
-	// 		// "contents": contents, // 包含具体的 prompt 和 image data (image data 可能会很大)
-	// 	},
-	// 	"response": resp,
-	// }
-
-	// 解析响应
+	// 解析响应：逐个保存候选结果
 	result := &model.ImageGenerateResponse{
-		Parts: make([]model.GeneratePart, 0),
+		Candidates: make([]model.GenerateCandidate, 0, len(resp.Candidates)),
+		RunID:      gen.runID,
+		Warnings:   budgetWarnings(gen, run),
 	}
-
-	if len(resp.Candidates) == 0 || len(resp.Candidates[0].Content.Parts) == 0 {
-		return nil, fmt.Errorf("模型未返回任何内容")
+	var modelTurn []repository.TurnPart
+	for _, candidate := range resp.Candidates {
+		parts, turnParts, err := s.saveCandidate(ctx, gen, candidate)
+		if err != nil {
+			return nil, err
+		}
+		result.Candidates = append(result.Candidates, model.GenerateCandidate{
+			Index: candidate.Index,
+			Parts: parts,
+		})
+		// 对话中只记录第一个候选结果
+		if modelTurn == nil {
+			modelTurn = turnParts
+		}
 	}
+	result.Parts = result.Candidates[0].Parts
 
-	// 使用请求中的 workspace，如果没有则使用 "default"
-	workspace := req.Workspace
-	if workspace == "" {
-		workspace = "default"
-	}
+	result.ConversationID = s.recordConversation(ctx, gen, modelTurn)
+	return result, nil
+}
 
-	// 获取或创建工作区
-	ws, err := s.workspaceRepo.GetByName(ctx, workspace)
-	if err != nil {
-		return nil, fmt.Errorf("获取工作区失败: %w", err)
-	}
-	if ws == nil {
-		return nil, fmt.Errorf("工作区 %s 不存在", workspace)
-	}
+// saveCandidate 上传一个候选结果中的图片并保存数据库记录
+// 返回按原始顺序排列的结果片段，以及用于记录到对话中的片段
+func (s *Service) saveCandidate(ctx context.Context, gen *generation, candidate generator.Candidate) ([]model.GeneratePart, []repository.TurnPart, error) {
+	resultParts := make([]model.GeneratePart, 0)
 
 	// 构建模型返回的对话历史（用于保存到数据库）
 	// 注意：目前只记录文本消息，图片消息的记录能力已预留（见 repository.Message 结构体）
 	messageList := make([]repository.Message, 0)
-	// 存储待上传的图片数据及其在 result.Parts 中的位置索引
+	// 存储待上传的图片数据及其在 resultParts 中的位置索引
 	type pendingImage struct {
 		data           []byte
 		mimeType       string
-		resultPartsIdx int // 在 result.Parts 中的位置索引
+		resultPartsIdx int // 在 resultParts 中的位置索引
+		modelTurnIdx   int // 在 modelTurn 中的位置索引
 		// messageListIdx int // 预留：在 messageList 中的位置索引（如需记录图片消息时启用）
 	}
 	pendingImages := make([]pendingImage, 0)
+	// 本轮模型输出（用于记录到对话中，图片路径在上传后填充）
+	modelTurn := make([]repository.TurnPart, 0, len(candidate.Parts))
 
-	// 第一遍：遍历所有 parts，按原始顺序构建 messageList 和 result.Parts
-	for _, part := range resp.Candidates[0].Content.Parts {
+	// 第一遍：遍历所有 parts，按原始顺序构建 messageList 和 resultParts
+	for _, part := range candidate.Parts {
 		// 1. 处理文本
-		if text := strings.TrimSpace(part.Text); text != "" {
-			result.Parts = append(result.Parts, model.GeneratePart{
+		if text := strings.TrimSpace(part.Text); part.Type == generator.PartTypeText && text != "" {
+			resultParts = append(resultParts, model.GeneratePart{
 				Type: "text",
 				Text: text,
 			})
+			modelTurn = append(modelTurn, repository.TurnPart{
+				Type:             "text",
+				Text:             text,
+				ThoughtSignature: part.ThoughtSignature,
+			})
 			// 添加到对话历史（只记录文本）
 			messageList = append(messageList, repository.Message{
 				Role:    "assistant",
@@ -242,9 +430,14 @@ func (s *Service) GenerateImage(ctx context.Context, req *model.ImageGenerateReq
 			})
 		}
 
-		// 2. 处理图片：添加占位符到 result.Parts，记录索引
-		if part.InlineData != nil {
-			resultPartsIdx := len(result.Parts)
+		// 2. 处理图片：添加占位符到 resultParts，记录索引
+		if part.Type == generator.PartTypeImage {
+			resultPartsIdx := len(resultParts)
+			modelTurn = append(modelTurn, repository.TurnPart{
+				Type:             "image",
+				MimeType:         part.MimeType,
+				ThoughtSignature: part.ThoughtSignature,
+			})
 
 			// 预留：如需记录图片消息到 messageList，取消以下注释
 			// messageListIdx := len(messageList)
@@ -254,92 +447,372 @@ func (s *Service) GenerateImage(ctx context.Context, req *model.ImageGenerateReq
 			// 	URL:  "", // 稍后填充
 			// })
 
-			// 添加占位符到 result.Parts
-			result.Parts = append(result.Parts, model.GeneratePart{
+			// 添加占位符到 resultParts
+			resultParts = append(resultParts, model.GeneratePart{
 				Type: "image",
 				Image: &model.GeneratedImage{
-					MimeType: part.InlineData.MIMEType,
+					MimeType: part.MimeType,
 				},
 			})
 
 			pendingImages = append(pendingImages, pendingImage{
-				data:           part.InlineData.Data,
-				mimeType:       part.InlineData.MIMEType,
+				data:           part.Data,
+				mimeType:       part.MimeType,
 				resultPartsIdx: resultPartsIdx,
+				modelTurnIdx:   len(modelTurn) - 1,
 				// messageListIdx: messageListIdx, // 预留
 			})
 		}
 	}
 
-	// 第二遍：处理所有图片，上传到 OSS
+	// 第二遍：处理所有图片，上传到存储
 	for _, pending := range pendingImages {
-		imageData := pending.data
-		mimeType := pending.mimeType
-
-		// 根据 MIME 类型确定文件扩展名
-		ext := s.getExtensionFromMimeType(mimeType)
-		filename := fmt.Sprintf("generated-%d%s", time.Now().UnixNano(), ext)
-
-		// 上传原图到 OSS
-		path, err := s.ossClient.UploadImage(bytes.NewReader(imageData), filename, workspace)
-		if err != nil {
-			return nil, fmt.Errorf("上传生成的图片到 OSS 失败: %w", err)
-		}
-
-		// 生成并上传缩略图
-		thumbnailPath, thumbnailURL, err := s.uploadThumbnail(ctx, imageData, filename, workspace)
+		stored, err := s.storeGeneratedImage(ctx, gen.workspace.Name, pending.data, pending.mimeType)
 		if err != nil {
-			// 缩略图生成失败不影响主流程
-			thumbnailPath = ""
-			thumbnailURL = ""
+			return nil, nil, err
 		}
 
-		// 获取访问 URL
-		url := s.ossClient.GetImageURL(path)
-
 		// 预留：如需记录图片消息到 messageList，取消以下注释
 		// messageList[pending.messageListIdx] = repository.Message{
 		// 	Role: "assistant",
 		// 	Type: "image",
-		// 	URL:  url,
+		// 	URL:  stored.url,
 		// }
 
-		// 更新 result.Parts 中对应位置的内容
-		result.Parts[pending.resultPartsIdx] = model.GeneratePart{
-			Type: "image",
-			Image: &model.GeneratedImage{
-				MimeType: mimeType,
-				Path:     path,
-				URL:      url,
-			},
+		// 更新 resultParts 中对应位置的内容
+		resultParts[pending.resultPartsIdx] = model.GeneratePart{
+			Type:  "image",
+			Image: stored.generatedImage(),
 		}
+		modelTurn[pending.modelTurnIdx].Path = stored.path
 
 		// 保存到数据库（目前 messageList 只包含文本消息）
-		_, err = s.imageRepo.Create(ctx, &repository.Image{
-			WorkspaceID:   ws.ID,
-			Name:          filename,
-			OSSPath:       path,
-			OSSUrl:        url,
-			ThumbnailPath: thumbnailPath,
-			ThumbnailUrl:  thumbnailURL,
-			Size:          int64(len(imageData)),
-			MimeType:      mimeType,
-			SourceType:    "generate",
-			Prompt:        req.Prompt,
-			RefImages:     req.Images,
-			MessageList:   messageList, // 目前只包含文本消息
+		if err := s.saveGeneratedImage(ctx, gen, stored, candidate.Index, messageList); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return resultParts, modelTurn, nil
+}
+
+// ValidateRequest 校验生成请求的模型及其能力，返回实际使用的模型名称
+// 不访问存储，用于异步任务提交时提前拒绝非法请求
+func (s *Service) ValidateRequest(ctx context.Context, req *model.ImageGenerateRequest) (string, error) {
+	conv, err := s.getConversation(ctx, req.ConversationID)
+	if err != nil {
+		return "", err
+	}
+	modelConfig, _, err := s.resolveModel(req, conv)
+	if err != nil {
+		return "", err
+	}
+	if _, err := s.buildOptions(modelConfig, req); err != nil {
+		return "", err
+	}
+	return modelConfig.Name, nil
+}
+
+// resolveModel 解析请求使用的模型：优先使用请求指定的模型，继续对话时沿用会话的模型
+func (s *Service) resolveModel(req *model.ImageGenerateRequest, conv *repository.Conversation) (config.ModelConfig, generator.ImageGenerator, error) {
+	name := req.Model
+	if name == "" && conv != nil {
+		name = conv.Model
+	}
+	return s.registry.Resolve(name)
+}
+
+// prepareGeneration 校验请求并准备生成所需的上下文（模型、工作区、对话历史、参考图片）
+func (s *Service) prepareGeneration(ctx context.Context, req *model.ImageGenerateRequest) (*generation, error) {
+	conv, err := s.getConversation(ctx, req.ConversationID)
+	if err != nil {
+		return nil, err
+	}
+
+	// 校验模型及其能力
+	modelConfig, imageGenerator, err := s.resolveModel(req, conv)
+	if err != nil {
+		return nil, err
+	}
+	options, err := s.buildOptions(modelConfig, req)
+	if err != nil {
+		return nil, err
+	}
+
+	// 获取工作区
+	ws, err := s.resolveWorkspace(ctx, req.Workspace, conv)
+	if err != nil {
+		return nil, err
+	}
+
+	// 构建生成请求
+	genReq := &generator.Request{
+		Prompt:  req.Prompt,
+		Images:  make([]generator.ReferenceImage, 0, len(req.Images)),
+		Options: options,
+	}
+
+	// 添加对话历史：继续对话时回放已保存的轮次，否则使用请求中的文本历史
+	if conv != nil {
+		genReq.History, err = s.loadHistory(ctx, conv.ID)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		genReq.History = messagesHistory(req.Messages)
+	}
+
+	// 添加输入图片（从存储下载，Gemini API 需要二进制数据）
+	for _, imagePath := range req.Images {
+		imageData, err := storage.ReadAll(ctx, s.store, imagePath)
+		if err != nil {
+			return nil, fmt.Errorf("从存储获取图片失败 (path: %s): %w", imagePath, err)
+		}
+
+		genReq.Images = append(genReq.Images, generator.ReferenceImage{
+			Data:     imageData,
+			MimeType: s.detectMimeType(imagePath),
+		})
+	}
+
+	// 记录实际使用的生成参数，便于复现
+	params, err := json.Marshal(model.GenerationParams{
+		AspectRatio:        options.AspectRatio,
+		ImageSize:          options.ImageSize,
+		CandidateCount:     options.CandidateCount,
+		Temperature:        options.Temperature,
+		Seed:               options.Seed,
+		ResponseModalities: options.ResponseModalities,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("序列化生成参数失败: %w", err)
+	}
+
+	gen := &generation{
+		req:          req,
+		genReq:       genReq,
+		generator:    imageGenerator,
+		workspace:    ws,
+		conversation: conv,
+		params:       params,
+		pricing:      modelConfig.Pricing,
+	}
+
+	// 检查工作区预算并预占本次调用（准备完成后、调用模型之前，之后的调用结果都会更新预占的记录）
+	if s.budgetService != nil {
+		gen.budget, err = s.budgetService.Reserve(ctx, &repository.GenerationRun{
+			WorkspaceID:  ws.ID,
+			Model:        options.Model,
+			Prompt:       req.Prompt,
+			RefImages:    req.Images,
+			HistoryTurns: len(genReq.History),
 		})
 		if err != nil {
-			// 如果数据库保存失败，删除 OSS 文件（回滚）
-			s.ossClient.DeleteImage(path)
-			if thumbnailPath != "" {
-				s.ossClient.DeleteImage(thumbnailPath)
-			}
-			return nil, fmt.Errorf("保存生成的图片记录到数据库失败: %w", err)
+			return nil, err
 		}
+		gen.runID = gen.budget.RunID
 	}
+	return gen, nil
+}
 
-	return result, nil
+// storeGeneratedImage 将生成的图片及其缩略图上传到存储
+func (s *Service) storeGeneratedImage(ctx context.Context, workspace string, imageData []byte, mimeType string) (*storedImage, error) {
+	// 根据 MIME 类型确定文件扩展名
+	ext := s.getExtensionFromMimeType(mimeType)
+	filename := fmt.Sprintf("generated-%d%s", time.Now().UnixNano(), ext)
+
+	// 上传原图（写入不存在的路径，不覆盖其他图片的文件）
+	path, err := s.putNewImage(ctx, workspace, filename, imageData)
+	if err != nil {
+		return nil, fmt.Errorf("上传生成的图片失败: %w", err)
+	}
+	filename = filepath.Base(path)
+
+	// 生成并上传缩略图
+	thumbnailPath, err := s.uploadThumbnail(ctx, imageData, filename, workspace)
+	if err != nil {
+		// 缩略图生成失败不影响主流程
+		thumbnailPath = ""
+	}
+
+	stored := &storedImage{
+		filename:      filename,
+		path:          path,
+		thumbnailPath: thumbnailPath,
+		size:          int64(len(imageData)),
+		mimeType:      mimeType,
+	}
+	if stored.url, stored.thumbnailURL, err = s.imageURLs(ctx, path, thumbnailPath); err != nil {
+		s.removeStoredImage(ctx, stored)
+		return nil, err
+	}
+	return stored, nil
+}
+
+// saveGeneratedImage 保存生成图片的数据库记录，失败时删除已上传的文件
+func (s *Service) saveGeneratedImage(ctx context.Context, gen *generation, stored *storedImage, candidateIndex int, messageList []repository.Message) error {
+	record := &repository.Image{
+		WorkspaceID:      gen.workspace.ID,
+		Name:             stored.filename,
+		OSSPath:          stored.path,
+		ThumbnailPath:    stored.thumbnailPath,
+		Size:             stored.size,
+		MimeType:         stored.mimeType,
+		SourceType:       "generate",
+		Prompt:           gen.req.Prompt,
+		RefImages:        gen.req.Images,
+		MessageList:      messageList, // 目前只包含文本消息
+		Model:            gen.genReq.Options.Model,
+		GenerationParams: gen.params,
+		CandidateIndex:   candidateIndex,
+	}
+	if gen.runID != 0 {
+		record.GenerationRunID = &gen.runID
+	}
+	// 工作区中已有同名图片时添加序号
+	var err error
+	for n := 1; n <= maxUploadAttempts; n++ {
+		record.Name = numberedName(stored.filename, n)
+		if _, err = s.imageRepo.Create(ctx, record); !errors.Is(err, repository.ErrImageNameExists) {
+			break
+		}
+	}
+	if err != nil {
+		// 如果数据库保存失败，删除已上传的文件（回滚）
+		s.removeStoredImage(ctx, stored)
+		return fmt.Errorf("保存生成的图片记录到数据库失败: %w", err)
+	}
+	return nil
+}
+
+// removeStoredImage 删除已上传的生成图片及其缩略图（尽力而为）
+func (s *Service) removeStoredImage(ctx context.Context, stored *storedImage) {
+	s.deleteObjects(ctx, stored.path, stored.thumbnailPath)
+}
+
+// generatedImage 转换为响应中的图片信息
+func (stored *storedImage) generatedImage() *model.GeneratedImage {
+	return &model.GeneratedImage{
+		MimeType:     stored.mimeType,
+		Path:         stored.path,
+		URL:          stored.url,
+		ThumbnailURL: stored.thumbnailURL,
+	}
+}
+
+// buildOptions 根据模型配置校验请求并生成选项
+// 请求未指定的参数使用模型的默认配置
+func (s *Service) buildOptions(modelConfig config.ModelConfig, req *model.ImageGenerateRequest) (generator.Options, error) {
+	capabilities := modelConfig.Capabilities
+	if !capabilities.ImageOutput {
+		return generator.Options{}, fmt.Errorf("%w: 模型 %s 不支持生成图片", ErrCapabilityMismatch, modelConfig.Name)
+	}
+
+	enableWebSearch := modelConfig.Defaults.EnableWebSearch
+	if req.EnableWebSearch != nil {
+		enableWebSearch = *req.EnableWebSearch
+	}
+	if enableWebSearch && !capabilities.WebSearch {
+		return generator.Options{}, fmt.Errorf("%w: 模型 %s 不支持联网搜索", ErrCapabilityMismatch, modelConfig.Name)
+	}
+
+	if capabilities.MaxReferenceImages > 0 && len(req.Images) > capabilities.MaxReferenceImages {
+		return generator.Options{}, fmt.Errorf("%w: 模型 %s 最多支持 %d 张参考图片", ErrCapabilityMismatch, modelConfig.Name, capabilities.MaxReferenceImages)
+	}
+
+	params := req.GenerationParams
+	if params.AspectRatio != "" && !slices.Contains(capabilities.AspectRatios, params.AspectRatio) {
+		return generator.Options{}, fmt.Errorf("%w: 模型 %s 不支持宽高比 %s", ErrCapabilityMismatch, modelConfig.Name, params.AspectRatio)
+	}
+	if params.ImageSize != "" && !slices.Contains(capabilities.ImageSizes, params.ImageSize) {
+		return generator.Options{}, fmt.Errorf("%w: 模型 %s 不支持分辨率 %s", ErrCapabilityMismatch, modelConfig.Name, params.ImageSize)
+	}
+
+	if params.CandidateCount < 0 {
+		return generator.Options{}, fmt.Errorf("%w: 候选结果数量不能为负数", ErrInvalidParams)
+	}
+	maxCandidates := max(capabilities.MaxCandidates, 1)
+	if params.CandidateCount > maxCandidates {
+		return generator.Options{}, fmt.Errorf("%w: 模型 %s 最多支持 %d 个候选结果", ErrCapabilityMismatch, modelConfig.Name, maxCandidates)
+	}
+
+	if params.Temperature != nil && (*params.Temperature < 0 || *params.Temperature > 2) {
+		return generator.Options{}, fmt.Errorf("%w: 采样温度必须在 0 到 2 之间", ErrInvalidParams)
+	}
+
+	modalities := make([]string, 0, len(params.ResponseModalities))
+	for _, modality := range params.ResponseModalities {
+		modality = strings.ToUpper(modality)
+		if modality != generator.ModalityText && modality != generator.ModalityImage {
+			return generator.Options{}, fmt.Errorf("%w: 不支持的响应模态 %s", ErrInvalidParams, modality)
+		}
+		if !slices.Contains(modalities, modality) {
+			modalities = append(modalities, modality)
+		}
+	}
+	if len(modalities) == 0 {
+		modalities = nil
+	}
+
+	return generator.Options{
+		Model:              modelConfig.Name,
+		EnableWebSearch:    enableWebSearch,
+		AspectRatio:        params.AspectRatio,
+		ImageSize:          params.ImageSize,
+		CandidateCount:     params.CandidateCount,
+		Temperature:        params.Temperature,
+		Seed:               params.Seed,
+		ResponseModalities: modalities,
+	}, nil
+}
+
+// ListModels 列出可用的模型
+func (s *Service) ListModels(_ context.Context) *model.ListModelsResponse {
+	models := make([]model.ModelInfo, 0)
+	for _, m := range s.registry.Models() {
+		models = append(models, model.ModelInfo{
+			Name:        m.Name,
+			DisplayName: m.DisplayName,
+			Provider:    m.Provider,
+			Capabilities: model.ModelCapabilities{
+				ImageOutput:        m.Capabilities.ImageOutput,
+				WebSearch:          m.Capabilities.WebSearch,
+				MaxReferenceImages: m.Capabilities.MaxReferenceImages,
+				AspectRatios:       m.Capabilities.AspectRatios,
+				ImageSizes:         m.Capabilities.ImageSizes,
+				MaxCandidates:      max(m.Capabilities.MaxCandidates, 1),
+			},
+			Defaults: model.ModelDefaults{
+				EnableWebSearch: m.Defaults.EnableWebSearch,
+			},
+		})
+	}
+
+	return &model.ListModelsResponse{
+		Default: s.registry.Default(),
+		Models:  models,
+	}
+}
+
+// ProviderStats 返回各模型供应商的调用计数和熔断器状态
+func (s *Service) ProviderStats(_ context.Context) *model.ProviderStatsResponse {
+	providers := make([]model.ProviderStats, 0)
+	for _, p := range s.registry.Stats() {
+		providers = append(providers, model.ProviderStats{
+			Provider:     p.Provider,
+			Calls:        p.Calls,
+			Attempts:     p.Attempts,
+			Successes:    p.Successes,
+			Failures:     p.Failures,
+			Retries:      p.Retries,
+			Timeouts:     p.Timeouts,
+			Rejected:     p.Rejected,
+			BreakerState: p.BreakerState,
+		})
+	}
+
+	return &model.ProviderStatsResponse{
+		Providers: providers,
+	}
 }
 
 // parseBase64Image 解析 base64 图片数据
@@ -396,35 +869,6 @@ func (s *Service) getExtensionFromMimeType(mimeType string) string {
 	return exts[0]
 }
 
-// ListWorkspaceImages 列出工作区的所有图片（从数据库读取）
-func (s *Service) ListWorkspaceImages(ctx context.Context, workspace string) (*model.ListWorkspaceImagesResponse, error) {
-	// 从数据库获取图片列表
-	dbImages, err := s.imageRepo.ListByWorkspaceName(ctx, workspace)
-	if err != nil {
-		return nil, fmt.Errorf("列出工作区图片失败: %w", err)
-	}
-
-	// 转换为 model 格式
-	// 注意：Prompt, RefImages, MessageList 不在列表中返回，需要通过 GetImageDetail 接口获取
-	images := make([]model.ImageInfo, 0, len(dbImages))
-	for _, dbImage := range dbImages {
-		images = append(images, model.ImageInfo{
-			ID:           dbImage.ID,
-			Path:         dbImage.OSSPath,
-			URL:          dbImage.OSSUrl,
-			ThumbnailURL: dbImage.ThumbnailUrl,
-			Name:         dbImage.Name,
-			Size:         dbImage.Size,
-			Updated:      s.formatTime(dbImage.UpdatedAt),
-			SourceType:   dbImage.SourceType,
-		})
-	}
-
-	return &model.ListWorkspaceImagesResponse{
-		Images: images,
-	}, nil
-}
-
 // GetImageDetail 获取图片详情（包含 message_list）
 func (s *Service) GetImageDetail(ctx context.Context, id int64) (*model.GetImageDetailResponse, error) {
 	dbImage, err := s.imageRepo.GetByID(ctx, id)
@@ -435,20 +879,42 @@ func (s *Service) GetImageDetail(ctx context.Context, id int64) (*model.GetImage
 		return nil, fmt.Errorf("图片不存在")
 	}
 
+	info, err := s.imageInfo(ctx, dbImage)
+	if err != nil {
+		return nil, err
+	}
+	info.Prompt = dbImage.Prompt
+	info.RefImages = dbImage.RefImages
+	info.MessageList = s.convertMessageList(dbImage.MessageList) // 详情接口返回 message_list
+	info.Model = dbImage.Model
+	info.GenerationParams = s.convertGenerationParams(dbImage.GenerationParams)
+	info.CandidateIndex = dbImage.CandidateIndex
+	info.GenerationRunID = derefInt64(dbImage.GenerationRunID)
+	if err := s.fillImageTags(ctx, []*model.ImageInfo{&info}); err != nil {
+		return nil, err
+	}
+
 	return &model.GetImageDetailResponse{
-		Image: model.ImageInfo{
-			ID:           dbImage.ID,
-			Path:         dbImage.OSSPath,
-			URL:          dbImage.OSSUrl,
-			ThumbnailURL: dbImage.ThumbnailUrl,
-			Name:         dbImage.Name,
-			Size:         dbImage.Size,
-			Updated:      s.formatTime(dbImage.UpdatedAt),
-			SourceType:   dbImage.SourceType,
-			Prompt:       dbImage.Prompt,
-			RefImages:    dbImage.RefImages,
-			MessageList:  s.convertMessageList(dbImage.MessageList), // 详情接口返回 message_list
-		},
+		Image: info,
+	}, nil
+}
+
+// imageInfo 将图片记录转换为响应中的基本图片信息
+// 原图和缩略图的访问 URL 在每次读取时生成（私有存储桶使用签名 URL）
+func (s *Service) imageInfo(ctx context.Context, dbImage *repository.Image) (model.ImageInfo, error) {
+	url, thumbnailURL, err := s.imageURLs(ctx, dbImage.OSSPath, dbImage.ThumbnailPath)
+	if err != nil {
+		return model.ImageInfo{}, err
+	}
+	return model.ImageInfo{
+		ID:           dbImage.ID,
+		Path:         dbImage.OSSPath,
+		URL:          url,
+		ThumbnailURL: thumbnailURL,
+		Name:         dbImage.Name,
+		Size:         dbImage.Size,
+		Updated:      s.formatTime(dbImage.UpdatedAt),
+		SourceType:   dbImage.SourceType,
 	}, nil
 }
 
@@ -469,6 +935,30 @@ func (s *Service) convertMessageList(repoMessages []repository.Message) []model.
 	return messages
 }
 
+// convertGenerationParams 解析图片记录中的生成参数，没有记录时返回 nil
+func (s *Service) convertGenerationParams(raw json.RawMessage) *model.GenerationParams {
+	if len(raw) == 0 {
+		return nil
+	}
+	var params model.GenerationParams
+	if err := json.Unmarshal(raw, &params); err != nil {
+		return nil
+	}
+	return &params
+}
+
+// derefInt64 返回指针指向的值，nil 时返回 0
+func derefInt64(v *int64) int64 {
+	if v == nil {
+		return 0
+	}
+	return *v
+}
+
+// dbLocation 数据库中时间（TIMESTAMP，不带时区）的实际时区，见 formatTime
+// 使用 FixedZone 避免依赖系统 tzdata
+var dbLocation = time.FixedZone("Asia/Shanghai", 8*3600)
+
 // formatTime 格式化时间，修正时区问题
 func (s *Service) formatTime(t time.Time) string {
 	// 数据库字段是 TIMESTAMP (无时区)，lib/pq 读取时默认为 UTC
@@ -477,57 +967,52 @@ func (s *Service) formatTime(t time.Time) string {
 	// 如果直接 Format，前端会认为是 18:00 UTC = 02:00 CST (+1天)，导致“多了8小时”
 	// 所以我们需要将时间值的时区解释修正为 Asia/Shanghai，即把 18:00 UTC 视为 18:00 CST
 
-	// 使用 FixedZone 避免依赖系统 tzdata
-	loc := time.FixedZone("Asia/Shanghai", 8*3600)
-
 	// 构造一个新的时间对象，保持年月日时分秒不变，但时区改为 CST
-	tInLocation := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), loc)
+	tInLocation := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), dbLocation)
 
 	return tInLocation.Format(time.RFC3339)
 }
 
-// DeleteImage 删除图片（同时删除 OSS 文件和数据库记录）
-// 优先删除数据库记录后立即返回，OSS 文件异步删除
-func (s *Service) DeleteImage(ctx context.Context, path string) error {
+// DeleteImage 删除图片（同时删除存储中的文件和数据库记录）
+// 删除数据库记录时在同一事务中登记待删除的文件，由后台任务删除（失败时重试），接口立即返回
+// 内容相同的图片共享文件，只有最后一条引用被删除时才删除文件
+func (s *Service) DeleteImage(ctx context.Context, req *model.DeleteImageRequest) error {
 	// 从数据库获取图片信息
-	dbImage, err := s.imageRepo.GetByOSSPath(ctx, path)
+	dbImage, err := s.findImage(ctx, req.ID, req.Path)
 	if err != nil {
-		return fmt.Errorf("获取图片记录失败: %w", err)
+		return err
 	}
-	if dbImage == nil {
-		return fmt.Errorf("图片记录不存在")
-	}
-
-	// 保存需要删除的 OSS 路径
-	ossPath := path
-	thumbnailPath := dbImage.ThumbnailPath
 
-	// 优先删除数据库记录
-	err = s.imageRepo.Delete(ctx, dbImage.ID)
+	// 删除数据库记录并登记删除原图和缩略图
+	err = s.imageRepo.DeleteWithStorageOps(ctx, dbImage.ID, []string{dbImage.OSSPath, dbImage.ThumbnailPath})
 	if err != nil {
 		return fmt.Errorf("删除图片记录失败: %w", err)
 	}
 
-	// 异步删除 OSS 文件（不阻塞返回）
-	go func() {
-		// 删除 OSS 中的原图
-		if err := s.ossClient.DeleteImage(ossPath); err != nil {
-			// 仅记录日志，不影响主流程
-			fmt.Printf("异步删除 OSS 图片失败 (path: %s): %v\n", ossPath, err)
-		}
-
-		// 删除缩略图（如果存在）
-		if thumbnailPath != "" {
-			if err := s.ossClient.DeleteImage(thumbnailPath); err != nil {
-				fmt.Printf("异步删除 OSS 缩略图失败 (path: %s): %v\n", thumbnailPath, err)
-			}
-		}
-	}()
-
 	return nil
 }
 
-// RenameImage 重命名图片（同时更新 OSS 和数据库）
+// findImage 根据路径（和可选的 ID）获取图片记录
+// 内容相同的图片共享路径，未指定 ID 时返回该路径最早创建的记录
+func (s *Service) findImage(ctx context.Context, id int64, path string) (*repository.Image, error) {
+	var dbImage *repository.Image
+	var err error
+	if id != 0 {
+		dbImage, err = s.imageRepo.GetByID(ctx, id)
+	} else {
+		dbImage, err = s.imageRepo.GetByOSSPath(ctx, path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("获取图片记录失败: %w", err)
+	}
+	if dbImage == nil || dbImage.OSSPath != path {
+		return nil, fmt.Errorf("图片记录不存在")
+	}
+	return dbImage, nil
+}
+
+// RenameImage 重命名图片（同时更新存储和数据库）
+// 先将原图和缩略图复制到新路径，更新记录时在同一事务中登记删除旧文件
 func (s *Service) RenameImage(ctx context.Context, req *model.RenameImageRequest) (*model.RenameImageResponse, error) {
 	// 验证新文件名
 	if req.NewName == "" {
@@ -535,77 +1020,75 @@ func (s *Service) RenameImage(ctx context.Context, req *model.RenameImageRequest
 	}
 
 	// 从数据库获取图片信息
-	dbImage, err := s.imageRepo.GetByOSSPath(ctx, req.Path)
+	dbImage, err := s.findImage(ctx, req.ID, req.Path)
 	if err != nil {
-		return nil, fmt.Errorf("获取图片记录失败: %w", err)
+		return nil, err
 	}
-	if dbImage == nil {
-		return nil, fmt.Errorf("图片记录不存在")
+
+	newPath := s.layout.ImageKey(req.Workspace, req.NewName)
+	if newPath == dbImage.OSSPath {
+		return nil, fmt.Errorf("新文件名与原文件名相同")
 	}
 
-	// 重命名 OSS 中的原图
-	newPath, err := s.ossClient.RenameImage(req.Path, req.NewName, req.Workspace)
+	// 新文件名已被其他图片使用时拒绝，避免覆盖其他图片的文件
+	existing, err := s.imageRepo.GetByName(ctx, dbImage.WorkspaceID, req.NewName)
 	if err != nil {
-		return nil, fmt.Errorf("重命名 OSS 图片失败: %w", err)
+		return nil, fmt.Errorf("查询同名图片失败: %w", err)
+	}
+	if existing != nil {
+		return nil, fmt.Errorf("%w: %s", ErrImageExists, req.NewName)
 	}
-	newUrl := s.ossClient.GetImageURL(newPath)
 
-	// 重命名缩略图（如果存在）
+	// 复制原图到新路径（只在目标路径没有文件时写入，并发重命名或共享文件的记录占用该路径时不覆盖）
+	if err := s.copyNewObject(ctx, dbImage.OSSPath, newPath); err != nil {
+		if errors.Is(err, storage.ErrExists) {
+			return nil, fmt.Errorf("%w: %s", ErrImageExists, req.NewName)
+		}
+		return nil, fmt.Errorf("重命名图片文件失败: %w", err)
+	}
+
+	// 复制缩略图（如果存在）
 	var newThumbnailPath string
-	var newThumbnailUrl string
 	if dbImage.ThumbnailPath != "" {
-		oldFilename := dbImage.Name
-		newThumbnailFilename := thumbnail.GetThumbnailFilename(req.NewName)
-		oldThumbnailPath := dbImage.ThumbnailPath
-
-		// 重命名缩略图
-		newThumbnailPath, err = s.ossClient.RenameImage(oldThumbnailPath, newThumbnailFilename, req.Workspace)
-		if err != nil {
-			// 如果缩略图重命名失败，回滚原图重命名
-			s.ossClient.RenameImage(newPath, oldFilename, req.Workspace)
+		newThumbnailPath = s.layout.ImageKey(req.Workspace, thumbnail.GetThumbnailFilename(req.NewName))
+		if err := s.copyNewObject(ctx, dbImage.ThumbnailPath, newThumbnailPath); err != nil {
+			// 如果缩略图复制失败，删除已复制的原图
+			s.cleanupObjects(ctx, newPath)
+			if errors.Is(err, storage.ErrExists) {
+				return nil, fmt.Errorf("%w: %s", ErrImageExists, req.NewName)
+			}
 			return nil, fmt.Errorf("重命名缩略图失败: %w", err)
 		}
-		newThumbnailUrl = s.ossClient.GetImageURL(newThumbnailPath)
 	}
 
 	// 更新数据库记录
 	updates := map[string]interface{}{
 		"name":     req.NewName,
 		"oss_path": newPath,
-		"oss_url":  newUrl,
 	}
 	if newThumbnailPath != "" {
 		updates["thumbnail_path"] = newThumbnailPath
-		updates["thumbnail_url"] = newThumbnailUrl
 	}
 
-	updatedImage, err := s.imageRepo.Update(ctx, dbImage.ID, updates)
+	updatedImage, err := s.imageRepo.UpdateWithStorageOps(ctx, dbImage.ID, updates, []string{dbImage.OSSPath, dbImage.ThumbnailPath})
 	if err != nil {
-		// 如果数据库更新失败，回滚 OSS 重命名
-		s.ossClient.RenameImage(newPath, dbImage.Name, req.Workspace)
-		if newThumbnailPath != "" {
-			oldThumbnailFilename := thumbnail.GetThumbnailFilename(dbImage.Name)
-			s.ossClient.RenameImage(newThumbnailPath, oldThumbnailFilename, req.Workspace)
+		// 如果数据库更新失败，删除已复制的新文件（旧文件保持不变）
+		s.cleanupObjects(ctx, newPath, newThumbnailPath)
+		if errors.Is(err, repository.ErrImageNameExists) {
+			return nil, fmt.Errorf("%w: %s", ErrImageExists, req.NewName)
 		}
 		return nil, fmt.Errorf("更新图片记录失败: %w", err)
 	}
 
-	// 如果缩略图路径也改变了，需要更新数据库中的缩略图路径
-	// 注意：这里简化处理，如果需要可以扩展 Update 方法支持更多字段
+	info, err := s.imageInfo(ctx, updatedImage)
+	if err != nil {
+		return nil, err
+	}
+	info.Prompt = updatedImage.Prompt
+	info.RefImages = updatedImage.RefImages
+	info.MessageList = s.convertMessageList(updatedImage.MessageList)
 
 	return &model.RenameImageResponse{
-		Image: model.ImageInfo{
-			ID:           updatedImage.ID,
-			Path:         updatedImage.OSSPath,
-			URL:          updatedImage.OSSUrl,
-			ThumbnailURL: updatedImage.ThumbnailUrl,
-			Name:         updatedImage.Name,
-			Size:         updatedImage.Size,
-			Updated:      s.formatTime(updatedImage.UpdatedAt),
-			SourceType:   updatedImage.SourceType,
-			Prompt:       updatedImage.Prompt,
-			RefImages:    updatedImage.RefImages,
-			MessageList:  s.convertMessageList(updatedImage.MessageList),
-		},
+		Image: info,
 	}, nil
 }
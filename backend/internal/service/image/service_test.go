@@ -1,72 +1,1673 @@
 package image
 
 import (
+	"bytes"
+	"cmp"
 	"context"
-	"os"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	stdimage "image"
+	"image/png"
+	"io"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/guixu633/agent/backend/internal/config"
+	"github.com/guixu633/agent/backend/internal/generator"
 	"github.com/guixu633/agent/backend/internal/model"
+	"github.com/guixu633/agent/backend/internal/repository"
+	"github.com/guixu633/agent/backend/internal/service/budget"
+	"github.com/guixu633/agent/backend/internal/storage"
 	"github.com/stretchr/testify/assert"
-	"google.golang.org/genai"
 )
 
 func TestGenerateImage(t *testing.T) {
-	// 注意：此测试需要 OSS 客户端、数据库和 GCP 凭证，暂时跳过
-	// TODO: 添加 mock 或集成测试环境
-	t.Skip("需要 OSS 客户端、数据库和 GCP 凭证，暂时跳过")
-
-	// 初始化 Gemini 客户端
-	genaiClient, err := initTestClient()
-	if err != nil {
-		t.Skipf("跳过测试: %v", err)
-		return
+	workspaceRepo := &fakeWorkspaceRepository{
+		workspaces: []*repository.Workspace{{ID: 1, Name: "test"}},
 	}
 
-	// 注意：完整测试需要初始化以下依赖：
-	// - ossClient: OSS 客户端
-	// - imageRepo: 图片仓库
-	// - workspaceRepo: 工作区仓库
-	// service := NewService(genaiClient, ossClient, imageRepo, workspaceRepo)
-	_ = genaiClient // 暂时忽略未使用的变量
-
-	// 测试纯文本生成
+	// 纯文本结果不需要访问 OSS，可以完全离线运行
 	t.Run("纯文本提示词生成", func(t *testing.T) {
+		gen := &generator.FakeGenerator{
+			Parts: []generator.Part{
+				{Type: generator.PartTypeText, Text: "  第一段  "},
+				{Type: generator.PartTypeText, Text: "   "},
+				{Type: generator.PartTypeText, Text: "第二段"},
+			},
+		}
+		service := NewService(Deps{Registry: newTestRegistry(t, gen), ImageRepo: &fakeImageRepository{}, WorkspaceRepo: workspaceRepo, ConversationRepo: &fakeConversationRepository{}, RunRepo: &fakeGenerationRunRepository{}})
+
+		enableWebSearch := true
 		req := &model.ImageGenerateRequest{
-			Prompt:    "一只可爱的羊毛毡小猫咪",
+			Prompt:          "一只可爱的羊毛毡小猫咪",
+			Workspace:       "test",
+			EnableWebSearch: &enableWebSearch,
+		}
+		resp, err := service.GenerateImage(context.Background(), req)
+		assert.NoError(t, err)
+		assert.Equal(t, []model.GeneratePart{
+			{Type: "text", Text: "第一段"},
+			{Type: "text", Text: "第二段"},
+		}, resp.Parts)
+
+		requests := gen.Requests()
+		assert.Len(t, requests, 1)
+		assert.Equal(t, req.Prompt, requests[0].Prompt)
+		assert.Equal(t, "fake-search", requests[0].Options.Model)
+		assert.True(t, requests[0].Options.EnableWebSearch)
+	})
+
+	t.Run("模型未返回内容", func(t *testing.T) {
+		gen := &generator.FakeGenerator{Parts: []generator.Part{}}
+		service := NewService(Deps{Registry: newTestRegistry(t, gen), ImageRepo: &fakeImageRepository{}, WorkspaceRepo: workspaceRepo, ConversationRepo: &fakeConversationRepository{}, RunRepo: &fakeGenerationRunRepository{}})
+
+		_, err := service.GenerateImage(context.Background(), &model.ImageGenerateRequest{Prompt: "x", Workspace: "test"})
+		assert.EqualError(t, err, "模型未返回任何内容")
+	})
+
+	t.Run("生成器返回错误", func(t *testing.T) {
+		upstream := errors.New("upstream unavailable")
+		service := NewService(Deps{Registry: newTestRegistry(t, &generator.FakeGenerator{Err: upstream}), ImageRepo: &fakeImageRepository{}, WorkspaceRepo: workspaceRepo, ConversationRepo: &fakeConversationRepository{}, RunRepo: &fakeGenerationRunRepository{}})
+
+		_, err := service.GenerateImage(context.Background(), &model.ImageGenerateRequest{Prompt: "x", Workspace: "test"})
+		assert.ErrorIs(t, err, upstream)
+	})
+
+	t.Run("工作区不存在", func(t *testing.T) {
+		service := NewService(Deps{Registry: newTestRegistry(t, generator.NewFakeGenerator()), ImageRepo: &fakeImageRepository{}, WorkspaceRepo: workspaceRepo, ConversationRepo: &fakeConversationRepository{}, RunRepo: &fakeGenerationRunRepository{}})
+
+		_, err := service.GenerateImage(context.Background(), &model.ImageGenerateRequest{Prompt: "x", Workspace: "missing"})
+		assert.EqualError(t, err, "工作区 missing 不存在")
+	})
+}
+
+func TestGenerateImageStream(t *testing.T) {
+	workspaceRepo := &fakeWorkspaceRepository{
+		workspaces: []*repository.Workspace{{ID: 1, Name: "test"}},
+	}
+	gen := &generator.FakeGenerator{
+		Parts: []generator.Part{
+			{Type: generator.PartTypeText, Text: "你好，"},
+			{Type: generator.PartTypeText, Text: "这是一只猫 "},
+		},
+	}
+	service := NewService(Deps{Registry: newTestRegistry(t, gen), ImageRepo: &fakeImageRepository{}, WorkspaceRepo: workspaceRepo, ConversationRepo: &fakeConversationRepository{}, RunRepo: &fakeGenerationRunRepository{}})
+
+	events := make([]*model.GenerateStreamEvent, 0)
+	err := service.GenerateImageStream(context.Background(), &model.ImageGenerateRequest{Prompt: "猫", Workspace: "test"},
+		func(event *model.GenerateStreamEvent) error {
+			events = append(events, event)
+			return nil
+		})
+	assert.NoError(t, err)
+	assert.Equal(t, []*model.GenerateStreamEvent{
+		{Type: model.StreamEventText, Index: 0, Text: "你好，"},
+		{Type: model.StreamEventText, Index: 0, Text: "这是一只猫 "},
+		{Type: model.StreamEventDone, Result: &model.ImageGenerateResponse{
+			Parts: []model.GeneratePart{{Type: "text", Text: "你好，这是一只猫"}},
+			Candidates: []model.GenerateCandidate{
+				{Index: 0, Parts: []model.GeneratePart{{Type: "text", Text: "你好，这是一只猫"}}},
+			},
+			RunID:          1,
+			ConversationID: 1,
+		}},
+	}, events)
+
+	t.Run("回调返回错误时终止生成", func(t *testing.T) {
+		stop := errors.New("client gone")
+		err := service.GenerateImageStream(context.Background(), &model.ImageGenerateRequest{Prompt: "猫", Workspace: "test"},
+			func(event *model.GenerateStreamEvent) error {
+				return stop
+			})
+		assert.ErrorIs(t, err, stop)
+	})
+}
+
+func TestConversation(t *testing.T) {
+	workspaceRepo := &fakeWorkspaceRepository{
+		workspaces: []*repository.Workspace{{ID: 1, Name: "test"}, {ID: 2, Name: "other"}},
+	}
+	gen := &generator.FakeGenerator{
+		Parts: []generator.Part{
+			{Type: generator.PartTypeText, Text: "一只橘猫", ThoughtSignature: []byte("sig")},
+		},
+	}
+	conversationRepo := &fakeConversationRepository{}
+	service := NewService(Deps{Registry: newTestRegistry(t, gen), ImageRepo: &fakeImageRepository{}, WorkspaceRepo: workspaceRepo, ConversationRepo: conversationRepo, RunRepo: &fakeGenerationRunRepository{}})
+	ctx := context.Background()
+
+	// 第一轮：创建新对话，使用请求中的模型
+	first, err := service.GenerateImage(ctx, &model.ImageGenerateRequest{Prompt: "画一只猫", Workspace: "test", Model: "fake-image"})
+	assert.NoError(t, err)
+	assert.NotZero(t, first.ConversationID)
+
+	// 第二轮：回放历史，沿用会话的模型
+	second, err := service.ContinueConversation(ctx, first.ConversationID, &model.ContinueConversationRequest{Prompt: "把猫改成黑色"})
+	assert.NoError(t, err)
+	assert.Equal(t, first.ConversationID, second.ConversationID)
+
+	requests := gen.Requests()
+	assert.Len(t, requests, 2)
+	assert.Empty(t, requests[0].History)
+	assert.Equal(t, "fake-image", requests[1].Options.Model)
+	assert.Equal(t, "把猫改成黑色", requests[1].Prompt)
+	assert.Equal(t, []generator.Turn{
+		{Role: generator.RoleUser, Parts: []generator.Part{{Type: generator.PartTypeText, Text: "画一只猫"}}},
+		{Role: generator.RoleModel, Parts: []generator.Part{{Type: generator.PartTypeText, Text: "一只橘猫", ThoughtSignature: []byte("sig")}}},
+	}, requests[1].History)
+
+	detail, err := service.GetConversation(ctx, first.ConversationID)
+	assert.NoError(t, err)
+	assert.Equal(t, "画一只猫", detail.Conversation.Title)
+	assert.Equal(t, 4, detail.Conversation.TurnCount)
+	assert.Len(t, detail.Turns, 4)
+	assert.Equal(t, "model", detail.Turns[3].Role)
+
+	t.Run("请求中的文本历史", func(t *testing.T) {
+		_, err := service.GenerateImage(ctx, &model.ImageGenerateRequest{
+			Prompt:    "继续",
 			Workspace: "test",
+			Messages: []model.Message{
+				{Role: "user", Type: model.MessageTypeText, Content: "你好"},
+				{Role: "assistant", Type: model.MessageTypeImage, URL: "https://example.com/a.png"},
+				{Role: "assistant", Type: model.MessageTypeText, Content: "你好！"},
+			},
+		})
+		assert.NoError(t, err)
+		history := gen.Requests()[2].History
+		assert.Len(t, history, 2)
+		assert.Equal(t, generator.RoleModel, history[1].Role)
+	})
+
+	t.Run("对话不存在", func(t *testing.T) {
+		_, err := service.ContinueConversation(ctx, 999, &model.ContinueConversationRequest{Prompt: "x"})
+		assert.ErrorIs(t, err, ErrConversationNotFound)
+		_, err = service.GetConversation(ctx, 999)
+		assert.ErrorIs(t, err, ErrConversationNotFound)
+	})
+
+	t.Run("对话不属于请求的工作区", func(t *testing.T) {
+		_, err := service.GenerateImage(ctx, &model.ImageGenerateRequest{Prompt: "x", Workspace: "other", ConversationID: first.ConversationID})
+		assert.ErrorIs(t, err, ErrConversationMismatch)
+		assert.True(t, IsInvalidRequest(err))
+	})
+}
+
+func TestLoadHistory(t *testing.T) {
+	store, err := storage.NewLocalStore(t.TempDir(), "/files")
+	assert.NoError(t, err)
+	ctx := context.Background()
+	assert.NoError(t, store.Put(ctx, "image/test/cat.png", strings.NewReader("cat")))
+
+	conversationRepo := &fakeConversationRepository{turns: []*repository.ConversationTurn{
+		{ConversationID: 1, TurnIndex: 0, Role: repository.TurnRoleUser, Parts: []repository.TurnPart{
+			{Type: "text", Text: "画一只猫"},
+			{Type: "image", Path: "image/test/cat.png", MimeType: "image/png"},
+		}},
+		// 模型生成的图片已被删除
+		{ConversationID: 1, TurnIndex: 1, Role: repository.TurnRoleModel, Parts: []repository.TurnPart{
+			{Type: "image", Path: "image/test/gone.png", MimeType: "image/png", ThoughtSignature: []byte("sig")},
+		}},
+		{ConversationID: 1, TurnIndex: 2, Role: repository.TurnRoleUser, Parts: []repository.TurnPart{{Type: "text", Text: "再画一只"}}},
+		// 模型没有返回内容
+		{ConversationID: 1, TurnIndex: 3, Role: repository.TurnRoleModel, Parts: []repository.TurnPart{}},
+	}}
+	service := NewService(Deps{Registry: newTestRegistry(t, generator.NewFakeGenerator()), Store: store, Layout: storage.NewLayout(""), ImageRepo: &fakeImageRepository{}, WorkspaceRepo: &fakeWorkspaceRepository{}, ConversationRepo: conversationRepo, RunRepo: &fakeGenerationRunRepository{}})
+
+	history, err := service.loadHistory(ctx, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, []generator.Turn{
+		{Role: generator.RoleUser, Parts: []generator.Part{
+			{Type: generator.PartTypeText, Text: "画一只猫"},
+			{Type: generator.PartTypeImage, Data: []byte("cat"), MimeType: "image/png"},
+		}},
+		{Role: generator.RoleModel, Parts: []generator.Part{{Type: generator.PartTypeText, Text: missingImageText, ThoughtSignature: []byte("sig")}}},
+		{Role: generator.RoleUser, Parts: []generator.Part{{Type: generator.PartTypeText, Text: "再画一只"}}},
+		{Role: generator.RoleModel, Parts: []generator.Part{{Type: generator.PartTypeText, Text: emptyTurnText}}},
+	}, history)
+}
+
+func TestGenerationRun(t *testing.T) {
+	workspaceRepo := &fakeWorkspaceRepository{
+		workspaces: []*repository.Workspace{{ID: 1, Name: "test"}},
+	}
+	imageRepo := &fakeImageRepository{}
+	runRepo := &fakeGenerationRunRepository{}
+	gen := &generator.FakeGenerator{
+		Parts: []generator.Part{{Type: generator.PartTypeText, Text: "一只猫"}},
+	}
+	service := NewService(Deps{Registry: newTestRegistry(t, gen), ImageRepo: imageRepo, WorkspaceRepo: workspaceRepo, ConversationRepo: &fakeConversationRepository{}, RunRepo: runRepo})
+	ctx := context.Background()
+
+	resp, err := service.GenerateImage(ctx, &model.ImageGenerateRequest{Prompt: "猫", Workspace: "test"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), resp.RunID)
+
+	detail, err := service.GetGenerationRun(ctx, resp.RunID)
+	assert.NoError(t, err)
+	run := detail.Run
+	assert.Equal(t, repository.RunStatusSucceeded, run.Status)
+	assert.Equal(t, "fake-search", run.Model)
+	assert.Equal(t, "猫", run.Prompt)
+	assert.Equal(t, []string{}, run.RefImages)
+	assert.JSONEq(t, `[{"index":0,"parts":[{"type":"text","text":"一只猫"}]}]`, string(run.Response))
+	assert.JSONEq(t, `[{"index":0,"finish_reason":"STOP"}]`, string(run.FinishReasons))
+	assert.Equal(t, model.TokenUsage{PromptTokens: 1, CandidatesTokens: 3, TotalTokens: 4}, run.Usage)
+	assert.Zero(t, run.ImageCount)
+	assert.InDelta(t, (1*2+3*12)/1e6, run.Cost, 1e-12)
+	assert.Empty(t, run.Error)
+
+	t.Run("生成失败时也记录调用", func(t *testing.T) {
+		upstream := errors.New("upstream unavailable")
+		service := NewService(Deps{Registry: newTestRegistry(t, &generator.FakeGenerator{Err: upstream}), ImageRepo: imageRepo, WorkspaceRepo: workspaceRepo, ConversationRepo: &fakeConversationRepository{}, RunRepo: runRepo})
+
+		_, err := service.GenerateImage(ctx, &model.ImageGenerateRequest{Prompt: "狗", Workspace: "test"})
+		assert.ErrorIs(t, err, upstream)
+
+		failed := runRepo.runs[len(runRepo.runs)-1]
+		assert.Equal(t, repository.RunStatusFailed, failed.Status)
+		assert.Equal(t, "狗", failed.Prompt)
+		assert.Contains(t, failed.Error, "upstream unavailable")
+	})
+
+	t.Run("调用记录不存在", func(t *testing.T) {
+		_, err := service.GetGenerationRun(ctx, 999)
+		assert.ErrorIs(t, err, ErrRunNotFound)
+	})
+}
+
+func TestImageStorage(t *testing.T) {
+	store, err := storage.NewLocalStore(t.TempDir(), "/files")
+	assert.NoError(t, err)
+	workspaceRepo := &fakeWorkspaceRepository{
+		workspaces: []*repository.Workspace{{ID: 1, Name: "test"}},
+	}
+	gen := generator.NewFakeGenerator()
+	service := NewService(Deps{Registry: newTestRegistry(t, gen), Store: store, Layout: storage.NewLayout(""), ImageRepo: &fakeImageRepository{}, WorkspaceRepo: workspaceRepo, ConversationRepo: &fakeConversationRepository{}, RunRepo: &fakeGenerationRunRepository{}})
+	ctx := context.Background()
+
+	var buf bytes.Buffer
+	assert.NoError(t, png.Encode(&buf, stdimage.NewRGBA(stdimage.Rect(0, 0, 8, 8))))
+	refData := buf.Bytes()
+
+	upload, err := service.UploadImage(ctx, bytes.NewReader(refData), "ref.png", "test", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "image/test/ref.png", upload.Path)
+	assert.Equal(t, "/files/image/test/ref.png", upload.URL)
+
+	// 参考图片从存储中读取
+	resp, err := service.GenerateImage(ctx, &model.ImageGenerateRequest{Prompt: "猫", Workspace: "test", Images: []string{upload.Path}})
+	assert.NoError(t, err)
+	assert.Equal(t, refData, gen.Requests()[0].Images[0].Data)
+
+	generated := resp.Parts[1].Image
+	assert.True(t, strings.HasPrefix(generated.Path, "image/test/generated-"))
+	assert.Equal(t, "/files/"+generated.Path, generated.URL)
+	assert.NotEmpty(t, generated.ThumbnailURL)
+	data, err := storage.ReadAll(ctx, store, generated.Path)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, data)
+
+	// 原图和缩略图都已保存
+	objects, err := store.List(ctx, "image/test/")
+	assert.NoError(t, err)
+	assert.Len(t, objects, 4)
+
+	t.Run("参考图片不存在", func(t *testing.T) {
+		_, err := service.GenerateImage(ctx, &model.ImageGenerateRequest{Prompt: "猫", Workspace: "test", Images: []string{"image/test/missing.png"}})
+		assert.ErrorIs(t, err, storage.ErrNotFound)
+	})
+
+	t.Run("不覆盖已有文件", func(t *testing.T) {
+		assert.NoError(t, store.Put(ctx, "image/test/x_thumb.png", strings.NewReader("other")))
+		thumbnailPath, err := service.uploadThumbnail(ctx, refData, "x.png", "test")
+		assert.NoError(t, err)
+		assert.Equal(t, "image/test/x_thumb (2).png", thumbnailPath)
+		data, err := storage.ReadAll(ctx, store, "image/test/x_thumb.png")
+		assert.NoError(t, err)
+		assert.Equal(t, "other", string(data))
+	})
+}
+
+func TestSignedImageURLs(t *testing.T) {
+	local, err := storage.NewLocalStore(t.TempDir(), "/files")
+	assert.NoError(t, err)
+	store := &fakeSigningStore{LocalStore: local}
+	workspaceRepo := &fakeWorkspaceRepository{
+		workspaces: []*repository.Workspace{{ID: 1, Name: "test"}},
+	}
+	imageRepo := &fakeImageRepository{}
+	service := NewService(Deps{Registry: newTestRegistry(t, generator.NewFakeGenerator()), Store: store, Layout: storage.NewLayout(""), URLTTL: 10 * time.Minute, ImageRepo: imageRepo, WorkspaceRepo: workspaceRepo, ConversationRepo: &fakeConversationRepository{}, RunRepo: &fakeGenerationRunRepository{}})
+	ctx := context.Background()
+
+	var buf bytes.Buffer
+	assert.NoError(t, png.Encode(&buf, stdimage.NewRGBA(stdimage.Rect(0, 0, 8, 8))))
+	upload, err := service.UploadImage(ctx, bytes.NewReader(buf.Bytes()), "cat.png", "test", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "/files/image/test/cat.png?signed=600", upload.URL)
+
+	// 数据库只保存路径
+	assert.Equal(t, "image/test/cat.png", imageRepo.images[0].OSSPath)
+	assert.Equal(t, "image/test/cat_thumb.png", imageRepo.images[0].ThumbnailPath)
+
+	// 每次读取都重新签名
+	list, err := service.ListWorkspaceImages(ctx, &model.ListWorkspaceImagesRequest{Workspace: "test"})
+	assert.NoError(t, err)
+	assert.Len(t, list.Images, 1)
+	assert.Equal(t, "/files/image/test/cat.png?signed=600", list.Images[0].URL)
+	assert.Equal(t, "/files/image/test/cat_thumb.png?signed=600", list.Images[0].ThumbnailURL)
+
+	detail, err := service.GetImageDetail(ctx, list.Images[0].ID)
+	assert.NoError(t, err)
+	assert.Equal(t, list.Images[0].URL, detail.Image.URL)
+	assert.Equal(t, list.Images[0].ThumbnailURL, detail.Image.ThumbnailURL)
+	// 上传 1 次，列表和详情各 2 次（原图和缩略图）
+	assert.Equal(t, 5, store.signed)
+
+	t.Run("签名失败", func(t *testing.T) {
+		store.err = errors.New("credentials expired")
+		_, err := service.ListWorkspaceImages(ctx, &model.ListWorkspaceImagesRequest{Workspace: "test"})
+		assert.ErrorContains(t, err, "credentials expired")
+	})
+}
+
+func TestListWorkspaceImages(t *testing.T) {
+	imageRepo := &fakeImageRepository{}
+	created := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	for i, name := range []string{"b.png", "a.png", "d.png", "c.png", "e.png"} {
+		sourceType := "upload"
+		if i%2 == 1 {
+			sourceType = "generate"
+		}
+		imageRepo.images = append(imageRepo.images, &repository.Image{
+			ID:         int64(i + 1),
+			Name:       name,
+			OSSPath:    "image/test/" + name,
+			Size:       int64(100 * (5 - i)),
+			SourceType: sourceType,
+			CreatedAt:  created.Add(time.Duration(i) * time.Hour),
+		})
+	}
+	store, err := storage.NewLocalStore(t.TempDir(), "/files")
+	assert.NoError(t, err)
+	service := NewService(Deps{Registry: newTestRegistry(t, generator.NewFakeGenerator()), Store: store, Layout: storage.NewLayout(""), ImageRepo: imageRepo, WorkspaceRepo: &fakeWorkspaceRepository{}, ConversationRepo: &fakeConversationRepository{}, RunRepo: &fakeGenerationRunRepository{}})
+	ctx := context.Background()
+
+	// listAll 按游标翻页直到最后一页，返回所有图片的文件名和页数
+	listAll := func(req model.ListWorkspaceImagesRequest) ([]string, int) {
+		names := make([]string, 0)
+		pages := 0
+		for {
+			resp, err := service.ListWorkspaceImages(ctx, &req)
+			assert.NoError(t, err)
+			pages++
+			for _, img := range resp.Images {
+				names = append(names, img.Name)
+			}
+			if resp.NextCursor == "" {
+				return names, pages
+			}
+			req.Cursor = resp.NextCursor
+		}
+	}
+
+	t.Run("默认按创建时间倒序", func(t *testing.T) {
+		names, pages := listAll(model.ListWorkspaceImagesRequest{Workspace: "test", Limit: 2})
+		assert.Equal(t, []string{"e.png", "c.png", "d.png", "a.png", "b.png"}, names)
+		assert.Equal(t, 3, pages)
+	})
+
+	t.Run("按文件名正序", func(t *testing.T) {
+		names, pages := listAll(model.ListWorkspaceImagesRequest{Workspace: "test", Limit: 5, Sort: "name", Order: "asc"})
+		assert.Equal(t, []string{"a.png", "b.png", "c.png", "d.png", "e.png"}, names)
+		assert.Equal(t, 1, pages)
+	})
+
+	t.Run("过滤", func(t *testing.T) {
+		names, _ := listAll(model.ListWorkspaceImagesRequest{Workspace: "test", Limit: 1, Sort: "size", SourceType: "generate"})
+		assert.Equal(t, []string{"a.png", "c.png"}, names)
+	})
+
+	t.Run("参数不合法", func(t *testing.T) {
+		resp, err := service.ListWorkspaceImages(ctx, &model.ListWorkspaceImagesRequest{Workspace: "test", Limit: 2})
+		assert.NoError(t, err)
+
+		for _, req := range []model.ListWorkspaceImagesRequest{
+			{Workspace: "test", Sort: "random"},
+			{Workspace: "test", Order: "up"},
+			{Workspace: "test", MinSize: 500, MaxSize: 100},
+			{Workspace: "test", CreatedAfter: "last week"},
+			{Workspace: "test", Cursor: "not-a-cursor"},
+			{Workspace: "test", Cursor: resp.NextCursor, Sort: "name"}, // 游标与排序方式不匹配
+			// 游标值被篡改
+			{Workspace: "test", Cursor: tamperedCursor(`{"s":"created","o":"desc","v":"yesterday","id":1}`)},
+			{Workspace: "test", Cursor: tamperedCursor(`{"s":"created","o":"desc","v":"0000-01-01 00:00:00","id":1}`)},
+			{Workspace: "test", Cursor: tamperedCursor(`{"s":"size","o":"desc","v":"1; DROP","id":1}`), Sort: "size"},
+			{Workspace: "test", Cursor: tamperedCursor(`{"s":"name","o":"desc","v":"a\u0000","id":1}`), Sort: "name"},
+		} {
+			_, err := service.ListWorkspaceImages(ctx, &req)
+			assert.ErrorIs(t, err, ErrInvalidListQuery, req)
+			assert.True(t, IsInvalidRequest(err))
+		}
+	})
+}
+
+// tamperedCursor 将 JSON 编码为分页游标
+func tamperedCursor(data string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(data))
+}
+
+func TestParseListTime(t *testing.T) {
+	// 数据库中的时间按北京时间保存
+	parsed, err := parseListTime("2026-10-01T00:00:00Z")
+	assert.NoError(t, err)
+	assert.Equal(t, "2026-10-01 08:00:00", parsed.Format(time.DateTime))
+
+	parsed, err = parseListTime("2026-10-01")
+	assert.NoError(t, err)
+	assert.Equal(t, "2026-10-01 00:00:00", parsed.Format(time.DateTime))
+
+	parsed, err = parseListTime("")
+	assert.NoError(t, err)
+	assert.True(t, parsed.IsZero())
+}
+
+func TestImageTags(t *testing.T) {
+	imageRepo := &fakeImageRepository{images: []*repository.Image{
+		{ID: 1, WorkspaceID: 1, Name: "a.png", OSSPath: "image/test/a.png"},
+		{ID: 2, WorkspaceID: 1, Name: "b.png", OSSPath: "image/test/b.png"},
+		{ID: 3, WorkspaceID: 1, Name: "c.png", OSSPath: "image/test/c.png"},
+		{ID: 4, WorkspaceID: 2, Name: "other.png", OSSPath: "image/other/other.png"},
+	}}
+	workspaceRepo := &fakeWorkspaceRepository{
+		workspaces: []*repository.Workspace{{ID: 1, Name: "test"}, {ID: 2, Name: "other"}},
+	}
+	store, err := storage.NewLocalStore(t.TempDir(), "/files")
+	assert.NoError(t, err)
+	service := NewService(Deps{Registry: newTestRegistry(t, generator.NewFakeGenerator()), Store: store, Layout: storage.NewLayout(""), ImageRepo: imageRepo, WorkspaceRepo: workspaceRepo, ConversationRepo: &fakeConversationRepository{}, RunRepo: &fakeGenerationRunRepository{}})
+	ctx := context.Background()
+
+	t.Run("批量添加标签", func(t *testing.T) {
+		resp, err := service.AddTags(ctx, &model.TagImagesRequest{Workspace: "test", ImageIDs: []int64{2, 1, 2}, Tags: []string{" 猫 ", "风景", "猫"}})
+		assert.NoError(t, err)
+		assert.Equal(t, []model.ImageTags{
+			{ID: 1, Tags: []string{"猫", "风景"}},
+			{ID: 2, Tags: []string{"猫", "风景"}},
+		}, resp.Images)
+
+		_, err = service.AddTags(ctx, &model.TagImagesRequest{Workspace: "test", ImageIDs: []int64{3}, Tags: []string{"猫"}})
+		assert.NoError(t, err)
+
+		tags, err := service.ListTags(ctx, "test")
+		assert.NoError(t, err)
+		assert.Equal(t, []model.TagInfo{{Name: "猫", Count: 3}, {Name: "风景", Count: 2}}, tags.Tags)
+	})
+
+	t.Run("按标签过滤图片列表", func(t *testing.T) {
+		resp, err := service.ListWorkspaceImages(ctx, &model.ListWorkspaceImagesRequest{Workspace: "test", Sort: "name", Order: "asc", Tags: []string{"猫", "风景"}})
+		assert.NoError(t, err)
+		if assert.Len(t, resp.Images, 2) {
+			assert.Equal(t, "a.png", resp.Images[0].Name)
+			assert.Equal(t, []string{"猫", "风景"}, resp.Images[0].Tags)
+		}
+
+		detail, err := service.GetImageDetail(ctx, 3)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"猫"}, detail.Image.Tags)
+	})
+
+	t.Run("移除标签", func(t *testing.T) {
+		resp, err := service.RemoveTags(ctx, &model.TagImagesRequest{Workspace: "test", ImageIDs: []int64{1, 3}, Tags: []string{"猫"}})
+		assert.NoError(t, err)
+		assert.Equal(t, []model.ImageTags{
+			{ID: 1, Tags: []string{"风景"}},
+			{ID: 3, Tags: []string{}},
+		}, resp.Images)
+
+		tags, err := service.ListTags(ctx, "test")
+		assert.NoError(t, err)
+		assert.Equal(t, []model.TagInfo{{Name: "风景", Count: 2}, {Name: "猫", Count: 1}}, tags.Tags)
+	})
+
+	t.Run("图片不属于该工作区", func(t *testing.T) {
+		_, err := service.AddTags(ctx, &model.TagImagesRequest{Workspace: "test", ImageIDs: []int64{1, 4}, Tags: []string{"猫"}})
+		assert.ErrorIs(t, err, ErrImageNotFound)
+		assert.Equal(t, []string{"风景"}, imageRepo.tags[1])
+	})
+
+	t.Run("标签不合法", func(t *testing.T) {
+		for _, tags := range [][]string{
+			{" ", ""},
+			{strings.Repeat("长", maxTagLength+1)},
+			{"a\nb"},
+		} {
+			_, err := service.AddTags(ctx, &model.TagImagesRequest{Workspace: "test", ImageIDs: []int64{1}, Tags: tags})
+			assert.ErrorIs(t, err, ErrInvalidTags, tags)
+			assert.True(t, IsInvalidRequest(err))
 		}
+	})
+}
+
+func TestSearchImages(t *testing.T) {
+	imageRepo := &fakeImageRepository{images: []*repository.Image{
+		{ID: 1, Name: "garden.png", OSSPath: "image/test/garden.png", SourceType: "generate", Prompt: "一只橘色的小猫在花园里晒太阳"},
+		{ID: 2, Name: "小猫.png", OSSPath: "image/test/cat.png", SourceType: "upload"},
+		{ID: 3, Name: "dog.png", OSSPath: "image/test/dog.png", SourceType: "generate", Prompt: "画一只狗", MessageList: []repository.Message{
+			{Role: "user", Type: "text", Content: "画一只狗"},
+			{Role: "assistant", Type: "image", URL: "image/test/dog.png"},
+			{Role: "user", Type: "text", Content: "再加一只小猫"},
+		}},
+	}}
+	store, err := storage.NewLocalStore(t.TempDir(), "/files")
+	assert.NoError(t, err)
+	service := NewService(Deps{Registry: newTestRegistry(t, generator.NewFakeGenerator()), Store: store, Layout: storage.NewLayout(""), ImageRepo: imageRepo, WorkspaceRepo: &fakeWorkspaceRepository{}, ConversationRepo: &fakeConversationRepository{}, RunRepo: &fakeGenerationRunRepository{}})
+	ctx := context.Background()
+
+	resp, err := service.SearchImages(ctx, &model.SearchImagesRequest{Workspace: "test", Query: "小猫"})
+	assert.NoError(t, err)
+	assert.False(t, resp.HasMore)
+	if assert.Len(t, resp.Results, 3) {
+		// 文件名匹配的结果排在前面
+		assert.Equal(t, int64(2), resp.Results[0].ID)
+		assert.Equal(t, []model.SearchHighlight{{Field: "name", Snippet: "<mark>小猫</mark>.png"}}, resp.Results[0].Highlights)
+		assert.Equal(t, []model.SearchHighlight{{Field: "prompt", Snippet: "一只橘色的<mark>小猫</mark>在花园里晒太阳"}}, resp.Results[1].Highlights)
+		assert.Equal(t, []model.SearchHighlight{{Field: "message", Snippet: "再加一只<mark>小猫</mark>"}}, resp.Results[2].Highlights)
+		assert.NotEmpty(t, resp.Results[0].URL)
+	}
+
+	resp, err = service.SearchImages(ctx, &model.SearchImagesRequest{Workspace: "test", Query: "小猫", Limit: 1, Offset: 1})
+	assert.NoError(t, err)
+	assert.True(t, resp.HasMore)
+	if assert.Len(t, resp.Results, 1) {
+		assert.Equal(t, int64(1), resp.Results[0].ID)
+	}
+
+	for _, req := range []model.SearchImagesRequest{
+		{Workspace: "test", Query: "，。！"},
+		{Workspace: "test", Query: "小猫", Limit: -1},
+	} {
+		_, err := service.SearchImages(ctx, &req)
+		assert.ErrorIs(t, err, ErrInvalidSearchQuery)
+		assert.True(t, IsInvalidRequest(err))
+	}
+}
+
+func TestSearchQueryTerms(t *testing.T) {
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{query: "小猫咪", want: []string{"小猫", "猫咪"}},
+		{query: "猫", want: []string{"猫"}},
+		{query: "Cat 猫，cat", want: []string{"cat", "猫"}},
+		{query: "一只橘猫 in the garden！", want: []string{"一只", "只橘", "橘猫", "in", "the", "garden"}},
+		{query: "gemini-2.5-flash", want: []string{"gemini", "2", "5", "flash"}},
+		{query: "猫cat狗", want: []string{"猫", "cat", "狗"}},
+		{query: "ねこ", want: []string{"ねこ"}},
+		{query: "，。！ - ", want: []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			assert.Equal(t, tt.want, searchQueryTerms(tt.query))
+		})
+	}
+}
+
+func TestHighlightSnippet(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		terms []string
+		want  string
+	}{
+		{name: "中文二元组", text: "一只橘色的小猫咪", terms: []string{"小猫", "猫咪"}, want: "一只橘色的<mark>小猫咪</mark>"},
+		{name: "英文按完整的词匹配", text: "A Category of cats, one CAT", terms: []string{"cat"}, want: "A Category of cats, one <mark>CAT</mark>"},
+		{name: "HTML 转义", text: "<b>cat</b>", terms: []string{"cat"}, want: "&lt;b&gt;<mark>cat</mark>&lt;/b&gt;"},
+		{name: "没有匹配", text: "一只狗", terms: []string{"小猫"}, want: ""},
+		{
+			name:  "截取片段",
+			text:  strings.Repeat("前", 30) + "小猫" + strings.Repeat("后", 100),
+			terms: []string{"小猫"},
+			want:  "…" + strings.Repeat("前", 20) + "<mark>小猫</mark>" + strings.Repeat("后", 58) + "…",
+		},
+		{
+			name:  "靠近末尾时向前补足长度",
+			text:  strings.Repeat("前", 100) + "小猫",
+			terms: []string{"小猫"},
+			want:  "…" + strings.Repeat("前", 78) + "<mark>小猫</mark>",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			snippet, ok := highlightSnippet(tt.text, tt.terms)
+			assert.Equal(t, tt.want != "", ok)
+			assert.Equal(t, tt.want, snippet)
+		})
+	}
+}
+
+func TestOpenImage(t *testing.T) {
+	store, err := storage.NewLocalStore(t.TempDir(), "/files")
+	assert.NoError(t, err)
+	workspaceRepo := &fakeWorkspaceRepository{
+		workspaces: []*repository.Workspace{{ID: 1, Name: "test"}},
+	}
+	imageRepo := &fakeImageRepository{}
+	service := NewService(Deps{Registry: newTestRegistry(t, generator.NewFakeGenerator()), Store: store, Layout: storage.NewLayout(""), ImageRepo: imageRepo, WorkspaceRepo: workspaceRepo, ConversationRepo: &fakeConversationRepository{}, RunRepo: &fakeGenerationRunRepository{}})
+	ctx := context.Background()
 
-		// 需要完整初始化 service 才能运行
-		// resp, err := service.GenerateImage(context.Background(), req)
-		// assert.NoError(t, err)
-		// assert.NotNil(t, resp)
+	var buf bytes.Buffer
+	assert.NoError(t, png.Encode(&buf, stdimage.NewRGBA(stdimage.Rect(0, 0, 8, 8))))
+	_, err = service.UploadImage(ctx, bytes.NewReader(buf.Bytes()), "cat.png", "test", "")
+	assert.NoError(t, err)
 
-		// 打印结果
-		// for i, part := range resp.Parts {
-		// 	t.Logf("Part %d (%s):", i, part.Type)
-		// 	if part.Type == "text" {
-		// 		t.Logf("  Text: %s", part.Text)
-		// 	} else if part.Type == "image" {
-		// 		t.Logf("  Image: %s, Path: %s, URL: %s", part.Image.MimeType, part.Image.Path, part.Image.URL)
-		// 	}
-		// }
+	content, err := service.OpenImage(ctx, 1)
+	assert.NoError(t, err)
+	defer content.Content.Close()
+	assert.Equal(t, "cat.png", content.Name)
+	assert.Equal(t, "image/png", content.MimeType)
+	assert.Equal(t, int64(buf.Len()), content.Size)
+	assert.NotEmpty(t, content.ETag)
+	data, err := io.ReadAll(content.Content)
+	assert.NoError(t, err)
+	assert.Equal(t, buf.Bytes(), data)
 
-		// 占位断言，确保测试框架正常
-		assert.NotNil(t, req)
+	thumb, err := service.OpenThumbnail(ctx, 1)
+	assert.NoError(t, err)
+	thumb.Content.Close()
+	assert.Equal(t, "cat_thumb.png", thumb.Name)
+	assert.NotEqual(t, content.ETag, thumb.ETag)
+
+	t.Run("图片不存在", func(t *testing.T) {
+		_, err := service.OpenImage(ctx, 99)
+		assert.ErrorIs(t, err, ErrImageNotFound)
+
+		// 存储中的文件已被删除
+		assert.NoError(t, store.Delete(ctx, "image/test/cat.png"))
+		_, err = service.OpenImage(ctx, 1)
+		assert.ErrorIs(t, err, ErrImageNotFound)
+
+		// 没有缩略图
+		imageRepo.images[0].ThumbnailPath = ""
+		_, err = service.OpenThumbnail(ctx, 1)
+		assert.ErrorIs(t, err, ErrImageNotFound)
 	})
 }
 
-func initTestClient() (*genai.Client, error) {
-	configPath := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS")
-	if configPath == "" {
-		configPath = "../../../configs/gcp/gcp.json"
+func TestDeleteAndRenameImage(t *testing.T) {
+	store, err := storage.NewLocalStore(t.TempDir(), "/files")
+	assert.NoError(t, err)
+	workspaceRepo := &fakeWorkspaceRepository{
+		workspaces: []*repository.Workspace{{ID: 1, Name: "test"}},
 	}
+	imageRepo := &fakeImageRepository{}
+	storageOpRepo := &fakeStorageOpRepository{}
+	service := NewService(Deps{Registry: newTestRegistry(t, generator.NewFakeGenerator()), Store: store, Layout: storage.NewLayout(""), ImageRepo: imageRepo, WorkspaceRepo: workspaceRepo, ConversationRepo: &fakeConversationRepository{}, RunRepo: &fakeGenerationRunRepository{}, StorageOpRepo: storageOpRepo})
+	ctx := context.Background()
 
-	os.Setenv("GOOGLE_APPLICATION_CREDENTIALS", configPath)
+	var buf bytes.Buffer
+	assert.NoError(t, png.Encode(&buf, stdimage.NewRGBA(stdimage.Rect(0, 0, 8, 8))))
+	_, err = service.UploadImage(ctx, bytes.NewReader(buf.Bytes()), "cat.png", "test", "")
+	assert.NoError(t, err)
 
-	return genai.NewClient(context.Background(), &genai.ClientConfig{
-		Backend:  genai.BackendVertexAI,
-		Project:  "startup-x-465606",
-		Location: "global",
+	t.Run("重命名", func(t *testing.T) {
+		resp, err := service.RenameImage(ctx, &model.RenameImageRequest{Path: "image/test/cat.png", NewName: "dog.png", Workspace: "test"})
+		assert.NoError(t, err)
+		assert.Equal(t, "image/test/dog.png", resp.Image.Path)
+		assert.Equal(t, "image/test/dog_thumb.png", imageRepo.images[0].ThumbnailPath)
+
+		// 新文件已复制，旧文件在更新记录的同一事务中登记删除
+		_, err = store.Stat(ctx, "image/test/dog_thumb.png")
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"image/test/cat.png", "image/test/cat_thumb.png"}, imageRepo.storageOps)
+		assert.Empty(t, storageOpRepo.keys)
 	})
+
+	t.Run("更新记录失败时登记删除新文件", func(t *testing.T) {
+		imageRepo.storageOps = nil
+		imageRepo.updateErr = errors.New("connection reset")
+		defer func() { imageRepo.updateErr = nil }()
+
+		_, err := service.RenameImage(ctx, &model.RenameImageRequest{Path: "image/test/dog.png", NewName: "bird.png", Workspace: "test"})
+		assert.ErrorContains(t, err, "connection reset")
+		assert.Equal(t, "image/test/dog.png", imageRepo.images[0].OSSPath)
+		assert.Empty(t, imageRepo.storageOps)
+		assert.Equal(t, []string{"image/test/bird.png", "image/test/bird_thumb.png"}, storageOpRepo.keys)
+	})
+
+	t.Run("新文件名与原文件名相同", func(t *testing.T) {
+		_, err := service.RenameImage(ctx, &model.RenameImageRequest{Path: "image/test/dog.png", NewName: "dog.png", Workspace: "test"})
+		assert.EqualError(t, err, "新文件名与原文件名相同")
+	})
+
+	t.Run("重命名为已有的文件名", func(t *testing.T) {
+		var other bytes.Buffer
+		assert.NoError(t, png.Encode(&other, stdimage.NewRGBA(stdimage.Rect(0, 0, 16, 16))))
+		_, err := service.UploadImage(ctx, bytes.NewReader(other.Bytes()), "fish.png", "test", "")
+		assert.NoError(t, err)
+		defer func() { imageRepo.images = imageRepo.images[:1] }()
+
+		imageRepo.storageOps = nil
+		_, err = service.RenameImage(ctx, &model.RenameImageRequest{Path: "image/test/dog.png", NewName: "fish.png", Workspace: "test"})
+		assert.ErrorIs(t, err, ErrImageExists)
+		assert.Equal(t, "image/test/dog.png", imageRepo.images[0].OSSPath)
+		assert.Empty(t, imageRepo.storageOps)
+
+		// 另一张图片的文件没有被覆盖
+		data, err := storage.ReadAll(ctx, store, "image/test/fish.png")
+		assert.NoError(t, err)
+		assert.Equal(t, other.Bytes(), data)
+	})
+
+	t.Run("目标路径已有文件", func(t *testing.T) {
+		// 上一次失败的重命名残留的文件尚未被后台任务删除（也可能是并发重命名刚写入的文件）
+		assert.NoError(t, store.Put(ctx, "image/test/bird.png", strings.NewReader("other")))
+
+		_, err := service.RenameImage(ctx, &model.RenameImageRequest{Path: "image/test/dog.png", NewName: "bird.png", Workspace: "test"})
+		assert.ErrorIs(t, err, ErrImageExists)
+		assert.Equal(t, "image/test/dog.png", imageRepo.images[0].OSSPath)
+
+		data, err := storage.ReadAll(ctx, store, "image/test/bird.png")
+		assert.NoError(t, err)
+		assert.Equal(t, "other", string(data))
+	})
+
+	t.Run("删除", func(t *testing.T) {
+		imageRepo.storageOps = nil
+		assert.NoError(t, service.DeleteImage(ctx, &model.DeleteImageRequest{Path: "image/test/dog.png"}))
+		assert.Empty(t, imageRepo.images)
+		assert.Equal(t, []string{"image/test/dog.png", "image/test/dog_thumb.png"}, imageRepo.storageOps)
+
+		// 文件由后台任务删除
+		_, err := store.Stat(ctx, "image/test/dog.png")
+		assert.NoError(t, err)
+
+		assert.EqualError(t, service.DeleteImage(ctx, &model.DeleteImageRequest{Path: "image/test/dog.png"}), "图片记录不存在")
+	})
+}
+
+func TestUploadImageDeduplication(t *testing.T) {
+	store, err := storage.NewLocalStore(t.TempDir(), "/files")
+	assert.NoError(t, err)
+	workspaceRepo := &fakeWorkspaceRepository{
+		workspaces: []*repository.Workspace{{ID: 1, Name: "test"}},
+	}
+	imageRepo := &fakeImageRepository{}
+	service := NewService(Deps{Registry: newTestRegistry(t, generator.NewFakeGenerator()), Store: store, Layout: storage.NewLayout(""), ImageRepo: imageRepo, WorkspaceRepo: workspaceRepo, ConversationRepo: &fakeConversationRepository{}, RunRepo: &fakeGenerationRunRepository{}, StorageOpRepo: &fakeStorageOpRepository{}})
+	ctx := context.Background()
+
+	var buf bytes.Buffer
+	assert.NoError(t, png.Encode(&buf, stdimage.NewRGBA(stdimage.Rect(0, 0, 8, 8))))
+	first, err := service.UploadImage(ctx, bytes.NewReader(buf.Bytes()), "cat.png", "test", "")
+	assert.NoError(t, err)
+	assert.False(t, first.Deduplicated)
+	assert.Equal(t, fmt.Sprintf("%x", sha256.Sum256(buf.Bytes())), imageRepo.images[0].ContentHash)
+
+	// 文件名和内容都相同时返回已有图片
+	again, err := service.UploadImage(ctx, bytes.NewReader(buf.Bytes()), "cat.png", "test", "")
+	assert.NoError(t, err)
+	assert.True(t, again.Deduplicated)
+	assert.Equal(t, first.ID, again.ID)
+	assert.Len(t, imageRepo.images, 1)
+
+	// 内容相同、文件名不同时创建共享文件的新记录
+	copied, err := service.UploadImage(ctx, bytes.NewReader(buf.Bytes()), "kitten.png", "test", "")
+	assert.NoError(t, err)
+	assert.True(t, copied.Deduplicated)
+	assert.NotEqual(t, first.ID, copied.ID)
+	assert.Equal(t, first.Path, copied.Path)
+	assert.Len(t, imageRepo.images, 2)
+	assert.Equal(t, "kitten.png", imageRepo.images[1].Name)
+	assert.Equal(t, imageRepo.images[0].ThumbnailPath, imageRepo.images[1].ThumbnailPath)
+
+	objects, err := store.List(ctx, "image/test/")
+	assert.NoError(t, err)
+	assert.Len(t, objects, 2) // 原图和缩略图各一份
+
+	// 共享路径的图片通过 ID 指定要删除的记录
+	assert.NoError(t, service.DeleteImage(ctx, &model.DeleteImageRequest{Path: copied.Path, ID: copied.ID}))
+	assert.Len(t, imageRepo.images, 1)
+	assert.Equal(t, "cat.png", imageRepo.images[0].Name)
+
+	t.Run("ID 与路径不匹配", func(t *testing.T) {
+		err := service.DeleteImage(ctx, &model.DeleteImageRequest{Path: "image/test/other.png", ID: first.ID})
+		assert.EqualError(t, err, "图片记录不存在")
+	})
+
+	t.Run("共享的文件已被删除", func(t *testing.T) {
+		// 查询到相同内容的图片后，该图片被删除且存储操作任务删除了文件
+		imageRepo.beforeShare = func() {
+			source := imageRepo.images[0]
+			imageRepo.images = imageRepo.images[:0]
+			assert.NoError(t, store.Delete(ctx, source.OSSPath))
+			assert.NoError(t, store.Delete(ctx, source.ThumbnailPath))
+		}
+		resp, err := service.UploadImage(ctx, bytes.NewReader(buf.Bytes()), "puppy.png", "test", "")
+		assert.NoError(t, err)
+		assert.False(t, resp.Deduplicated)
+		assert.Equal(t, "image/test/puppy.png", resp.Path)
+		stored, err := storage.ReadAll(ctx, store, resp.Path)
+		assert.NoError(t, err)
+		assert.Equal(t, buf.Bytes(), stored)
+	})
+}
+
+func TestUploadImageConflict(t *testing.T) {
+	store, err := storage.NewLocalStore(t.TempDir(), "/files")
+	assert.NoError(t, err)
+	workspaceRepo := &fakeWorkspaceRepository{
+		workspaces: []*repository.Workspace{{ID: 1, Name: "test"}},
+	}
+	imageRepo := &fakeImageRepository{}
+	service := NewService(Deps{Registry: newTestRegistry(t, generator.NewFakeGenerator()), Store: store, Layout: storage.NewLayout(""), ImageRepo: imageRepo, WorkspaceRepo: workspaceRepo, ConversationRepo: &fakeConversationRepository{}, RunRepo: &fakeGenerationRunRepository{}, StorageOpRepo: &fakeStorageOpRepository{}})
+	ctx := context.Background()
+
+	// 每次生成内容不同的图片
+	size := 8
+	newPNG := func() []byte {
+		size++
+		var buf bytes.Buffer
+		assert.NoError(t, png.Encode(&buf, stdimage.NewRGBA(stdimage.Rect(0, 0, size, size))))
+		return buf.Bytes()
+	}
+	listKeys := func() []string {
+		objects, err := store.List(ctx, "image/test/")
+		assert.NoError(t, err)
+		keys := make([]string, 0, len(objects))
+		for _, object := range objects {
+			keys = append(keys, object.Key)
+		}
+		return keys
+	}
+
+	first, err := service.UploadImage(ctx, bytes.NewReader(newPNG()), "cat.png", "test", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "cat.png", first.Name)
+	assert.Equal(t, "image/test/cat.png", first.Path)
+
+	t.Run("默认自动添加序号", func(t *testing.T) {
+		resp, err := service.UploadImage(ctx, bytes.NewReader(newPNG()), "cat.png", "test", "")
+		assert.NoError(t, err)
+		assert.Equal(t, "cat (2).png", resp.Name)
+		assert.Equal(t, "image/test/cat (2).png", resp.Path)
+		assert.Equal(t, "image/test/cat (2)_thumb.png", imageRepo.images[1].ThumbnailPath)
+	})
+
+	t.Run("拒绝同名图片", func(t *testing.T) {
+		before := listKeys()
+		_, err := service.UploadImage(ctx, bytes.NewReader(newPNG()), "cat.png", "test", ConflictReject)
+		assert.ErrorIs(t, err, ErrImageExists)
+		assert.Len(t, imageRepo.images, 2)
+		assert.ElementsMatch(t, before, listKeys()) // 已上传的文件被回滚
+	})
+
+	t.Run("替换同名图片", func(t *testing.T) {
+		data := newPNG()
+		resp, err := service.UploadImage(ctx, bytes.NewReader(data), "cat.png", "test", ConflictReplace)
+		assert.NoError(t, err)
+		assert.True(t, resp.Replaced)
+		assert.Equal(t, first.ID, resp.ID)
+		assert.Equal(t, "cat.png", resp.Name)
+
+		// 新内容写入未被占用的路径，旧文件在更新记录的同一事务中登记删除
+		assert.Equal(t, "image/test/cat (3).png", resp.Path)
+		assert.Equal(t, fmt.Sprintf("%x", sha256.Sum256(data)), imageRepo.images[0].ContentHash)
+		assert.Equal(t, []string{"image/test/cat.png", "image/test/cat_thumb.png"}, imageRepo.storageOps)
+		stored, err := storage.ReadAll(ctx, store, resp.Path)
+		assert.NoError(t, err)
+		assert.Equal(t, data, stored)
+	})
+
+	t.Run("并发上传同名图片", func(t *testing.T) {
+		imageRepo.beforeCreate = func() {
+			imageRepo.images = append(imageRepo.images, &repository.Image{ID: 100, WorkspaceID: 1, Name: "dog.png", OSSPath: "image/test/other.png"})
+		}
+		resp, err := service.UploadImage(ctx, bytes.NewReader(newPNG()), "dog.png", "test", "")
+		assert.NoError(t, err)
+		assert.Equal(t, "dog (2).png", resp.Name)
+		assert.Equal(t, "image/test/dog.png", resp.Path)
+	})
+
+	t.Run("处理方式不合法", func(t *testing.T) {
+		_, err := service.UploadImage(ctx, bytes.NewReader(newPNG()), "cat.png", "test", "overwrite")
+		assert.ErrorIs(t, err, ErrInvalidConflictPolicy)
+		assert.True(t, IsInvalidRequest(err))
+	})
+}
+
+func TestGenerateImageBudget(t *testing.T) {
+	workspaceRepo := &fakeWorkspaceRepository{
+		workspaces: []*repository.Workspace{{ID: 1, Name: "test"}},
+	}
+	runRepo := &fakeGenerationRunRepository{}
+	budgetRepo := &fakeBudgetRepository{budgets: []*repository.Budget{
+		{WorkspaceID: 1, Period: repository.BudgetPeriodDaily, Metric: repository.BudgetMetricRuns, Limit: 2, WarnRatio: 0.5},
+	}}
+	gen := &generator.FakeGenerator{
+		Parts: []generator.Part{{Type: generator.PartTypeText, Text: "一只猫"}},
+	}
+	budgetService := budget.NewService(budgetRepo, workspaceRepo, runRepo)
+	service := NewService(Deps{Registry: newTestRegistry(t, gen), ImageRepo: &fakeImageRepository{}, WorkspaceRepo: workspaceRepo, ConversationRepo: &fakeConversationRepository{}, RunRepo: runRepo, BudgetService: budgetService})
+	ctx := context.Background()
+	req := &model.ImageGenerateRequest{Prompt: "猫", Workspace: "test"}
+
+	// 计入本次生成后达到软限制
+	resp, err := service.GenerateImage(ctx, req)
+	assert.NoError(t, err)
+	assert.Len(t, resp.Warnings, 1)
+	assert.Equal(t, float64(1), resp.Warnings[0].Used)
+	assert.Equal(t, 0.5, resp.Warnings[0].Ratio)
+	assert.Equal(t, "今日生成次数已使用 50%（1 / 2）", resp.Warnings[0].Message)
+	// 生成前预占的调用记录在调用结束后更新
+	assert.Len(t, runRepo.runs, 1)
+	assert.Equal(t, runRepo.runs[0].ID, resp.RunID)
+	assert.Equal(t, repository.RunStatusSucceeded, runRepo.runs[0].Status)
+
+	// 达到硬限制的这次生成仍然成功，提醒后续生成将被拒绝
+	resp, err = service.GenerateImage(ctx, req)
+	assert.NoError(t, err)
+	assert.Len(t, resp.Warnings, 1)
+	assert.Contains(t, resp.Warnings[0].Message, "已达到上限")
+
+	// 预算用尽后不再调用模型
+	_, err = service.GenerateImage(ctx, req)
+	assert.ErrorIs(t, err, ErrBudgetExceeded)
+	assert.NotErrorIs(t, err, ErrQuotaExceeded)
+	status, code, ok := GenerationFailure(err)
+	assert.True(t, ok)
+	assert.Equal(t, 429, status)
+	assert.Equal(t, CodeBudgetExceeded, code)
+	assert.Equal(t, &model.BudgetWarning{
+		Period:  repository.BudgetPeriodDaily,
+		Metric:  repository.BudgetMetricRuns,
+		Limit:   2,
+		Used:    2,
+		Ratio:   1,
+		Message: err.Error(),
+	}, BudgetDetail(err))
+	assert.Len(t, gen.Requests(), 2)
+	assert.Len(t, runRepo.runs, 2)
+
+	t.Run("失败的调用不计入生成次数", func(t *testing.T) {
+		runRepo := &fakeGenerationRunRepository{runs: []*repository.GenerationRun{{ID: 1, WorkspaceID: 1, Status: repository.RunStatusFailed}}}
+		budgetService := budget.NewService(budgetRepo, workspaceRepo, runRepo)
+		service := NewService(Deps{Registry: newTestRegistry(t, gen), ImageRepo: &fakeImageRepository{}, WorkspaceRepo: workspaceRepo, ConversationRepo: &fakeConversationRepository{}, RunRepo: runRepo, BudgetService: budgetService})
+
+		_, err := service.GenerateImage(ctx, req)
+		assert.NoError(t, err)
+	})
+}
+
+func TestGenerationFailure(t *testing.T) {
+	workspaceRepo := &fakeWorkspaceRepository{
+		workspaces: []*repository.Workspace{{ID: 1, Name: "test"}},
+	}
+
+	tests := []struct {
+		name        string
+		gen         *generator.FakeGenerator
+		wantErr     error
+		wantCode    int
+		wantFailure *model.GenerateFailure
+	}{
+		{
+			name: "输入被安全策略拦截",
+			gen: &generator.FakeGenerator{PromptFeedback: &generator.PromptFeedback{
+				BlockReason: "SAFETY",
+				SafetyRatings: []generator.SafetyRating{
+					{Category: "HARM_CATEGORY_HARASSMENT", Probability: "LOW"},
+					{Category: "HARM_CATEGORY_DANGEROUS_CONTENT", Probability: "HIGH", Blocked: true},
+				},
+			}},
+			wantErr:     ErrBlockedBySafety,
+			wantCode:    CodeBlockedBySafety,
+			wantFailure: &model.GenerateFailure{Reason: "SAFETY", Category: "HARM_CATEGORY_DANGEROUS_CONTENT"},
+		},
+		{
+			name: "输出被安全策略拦截",
+			gen: &generator.FakeGenerator{
+				Parts:         []generator.Part{},
+				FinishReason:  "IMAGE_SAFETY",
+				SafetyRatings: []generator.SafetyRating{{Category: "HARM_CATEGORY_SEXUALLY_EXPLICIT", Probability: "HIGH"}},
+			},
+			wantErr:     ErrBlockedBySafety,
+			wantCode:    CodeBlockedBySafety,
+			wantFailure: &model.GenerateFailure{Reason: "IMAGE_SAFETY", Category: "HARM_CATEGORY_SEXUALLY_EXPLICIT"},
+		},
+		{
+			name:        "引用受保护的材料",
+			gen:         &generator.FakeGenerator{Parts: []generator.Part{}, FinishReason: "RECITATION"},
+			wantErr:     ErrRecitation,
+			wantCode:    CodeRecitation,
+			wantFailure: &model.GenerateFailure{Reason: "RECITATION"},
+		},
+		{
+			name:        "超出最大 token 数",
+			gen:         &generator.FakeGenerator{Parts: []generator.Part{}, FinishReason: "MAX_TOKENS"},
+			wantErr:     ErrMaxTokens,
+			wantCode:    CodeMaxTokens,
+			wantFailure: &model.GenerateFailure{Reason: "MAX_TOKENS"},
+		},
+		{
+			name:     "上游配额用尽",
+			gen:      &generator.FakeGenerator{Err: fmt.Errorf("%w: 429", generator.ErrQuotaExceeded)},
+			wantErr:  ErrQuotaExceeded,
+			wantCode: CodeQuotaExceeded,
+		},
+		{
+			name:     "上游服务不可用",
+			gen:      &generator.FakeGenerator{Err: fmt.Errorf("%w: 503", generator.ErrUpstreamUnavailable)},
+			wantErr:  ErrUpstreamUnavailable,
+			wantCode: CodeUpstreamUnavailable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := NewService(Deps{Registry: newTestRegistry(t, tt.gen), ImageRepo: &fakeImageRepository{}, WorkspaceRepo: workspaceRepo, ConversationRepo: &fakeConversationRepository{}, RunRepo: &fakeGenerationRunRepository{}})
+
+			_, err := service.GenerateImage(context.Background(), &model.ImageGenerateRequest{Prompt: "x", Workspace: "test"})
+			assert.ErrorIs(t, err, tt.wantErr)
+			assert.False(t, IsInvalidRequest(err))
+			_, code, ok := GenerationFailure(err)
+			assert.True(t, ok)
+			assert.Equal(t, tt.wantCode, code)
+			assert.Equal(t, tt.wantFailure, FailureDetail(err))
+
+			// 流式接口返回相同的错误
+			err = service.GenerateImageStream(context.Background(), &model.ImageGenerateRequest{Prompt: "x", Workspace: "test"},
+				func(event *model.GenerateStreamEvent) error { return nil })
+			assert.ErrorIs(t, err, tt.wantErr)
+		})
+	}
+
+	t.Run("未返回内容且没有拦截原因", func(t *testing.T) {
+		service := NewService(Deps{Registry: newTestRegistry(t, &generator.FakeGenerator{Parts: []generator.Part{}}), ImageRepo: &fakeImageRepository{}, WorkspaceRepo: workspaceRepo, ConversationRepo: &fakeConversationRepository{}, RunRepo: &fakeGenerationRunRepository{}})
+
+		_, err := service.GenerateImage(context.Background(), &model.ImageGenerateRequest{Prompt: "x", Workspace: "test"})
+		_, _, ok := GenerationFailure(err)
+		assert.False(t, ok)
+	})
+}
+
+func TestGenerationParams(t *testing.T) {
+	workspaceRepo := &fakeWorkspaceRepository{
+		workspaces: []*repository.Workspace{{ID: 1, Name: "test"}},
+	}
+	gen := &generator.FakeGenerator{
+		Parts: []generator.Part{{Type: generator.PartTypeText, Text: "候选"}},
+	}
+	service := NewService(Deps{Registry: newTestRegistry(t, gen), ImageRepo: &fakeImageRepository{}, WorkspaceRepo: workspaceRepo, ConversationRepo: &fakeConversationRepository{}, RunRepo: &fakeGenerationRunRepository{}})
+
+	temperature := float32(0.5)
+	seed := int32(42)
+	resp, err := service.GenerateImage(context.Background(), &model.ImageGenerateRequest{
+		Prompt:    "猫",
+		Workspace: "test",
+		GenerationParams: model.GenerationParams{
+			AspectRatio:        "16:9",
+			ImageSize:          "2K",
+			CandidateCount:     2,
+			Temperature:        &temperature,
+			Seed:               &seed,
+			ResponseModalities: []string{"text", "IMAGE", "TEXT"},
+		},
+	})
+	assert.NoError(t, err)
+
+	// 所有候选结果都应返回，parts 保持为第一个候选结果
+	assert.Equal(t, []model.GenerateCandidate{
+		{Index: 0, Parts: []model.GeneratePart{{Type: "text", Text: "候选"}}},
+		{Index: 1, Parts: []model.GeneratePart{{Type: "text", Text: "候选"}}},
+	}, resp.Candidates)
+	assert.Equal(t, resp.Candidates[0].Parts, resp.Parts)
+
+	requests := gen.Requests()
+	assert.Len(t, requests, 1)
+	assert.Equal(t, generator.Options{
+		Model:              "fake-search",
+		AspectRatio:        "16:9",
+		ImageSize:          "2K",
+		CandidateCount:     2,
+		Temperature:        &temperature,
+		Seed:               &seed,
+		ResponseModalities: []string{"TEXT", "IMAGE"},
+	}, requests[0].Options)
+}
+
+func TestGenerateImageModelValidation(t *testing.T) {
+	gen := generator.NewFakeGenerator()
+	service := NewService(Deps{Registry: newTestRegistry(t, gen), ImageRepo: &fakeImageRepository{}, WorkspaceRepo: &fakeWorkspaceRepository{}, ConversationRepo: &fakeConversationRepository{}, RunRepo: &fakeGenerationRunRepository{}})
+	enableWebSearch := true
+	temperature := float32(2.5)
+
+	tests := []struct {
+		name    string
+		req     *model.ImageGenerateRequest
+		wantErr error
+	}{
+		{
+			name:    "未知模型",
+			req:     &model.ImageGenerateRequest{Prompt: "x", Model: "unknown"},
+			wantErr: generator.ErrUnknownModel,
+		},
+		{
+			name:    "模型不支持生成图片",
+			req:     &model.ImageGenerateRequest{Prompt: "x", Model: "fake-text"},
+			wantErr: ErrCapabilityMismatch,
+		},
+		{
+			name:    "模型不支持联网搜索",
+			req:     &model.ImageGenerateRequest{Prompt: "x", Model: "fake-image", EnableWebSearch: &enableWebSearch},
+			wantErr: ErrCapabilityMismatch,
+		},
+		{
+			name:    "参考图片数量超出限制",
+			req:     &model.ImageGenerateRequest{Prompt: "x", Model: "fake-image", Images: []string{"a.png", "b.png", "c.png"}},
+			wantErr: ErrCapabilityMismatch,
+		},
+		{
+			name:    "模型不支持该宽高比",
+			req:     &model.ImageGenerateRequest{Prompt: "x", GenerationParams: model.GenerationParams{AspectRatio: "21:9"}},
+			wantErr: ErrCapabilityMismatch,
+		},
+		{
+			name:    "模型不支持指定分辨率",
+			req:     &model.ImageGenerateRequest{Prompt: "x", Model: "fake-image", GenerationParams: model.GenerationParams{ImageSize: "1K"}},
+			wantErr: ErrCapabilityMismatch,
+		},
+		{
+			name:    "候选结果数量超出限制",
+			req:     &model.ImageGenerateRequest{Prompt: "x", GenerationParams: model.GenerationParams{CandidateCount: 3}},
+			wantErr: ErrCapabilityMismatch,
+		},
+		{
+			name:    "采样温度超出范围",
+			req:     &model.ImageGenerateRequest{Prompt: "x", GenerationParams: model.GenerationParams{Temperature: &temperature}},
+			wantErr: ErrInvalidParams,
+		},
+		{
+			name:    "不支持的响应模态",
+			req:     &model.ImageGenerateRequest{Prompt: "x", GenerationParams: model.GenerationParams{ResponseModalities: []string{"AUDIO"}}},
+			wantErr: ErrInvalidParams,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := service.GenerateImage(context.Background(), tt.req)
+			assert.ErrorIs(t, err, tt.wantErr)
+			assert.True(t, IsInvalidRequest(err))
+		})
+	}
+	assert.Empty(t, gen.Requests(), "校验失败时不应调用模型")
+}
+
+// newTestRegistry 创建使用 fake 供应商的模型注册表
+// 默认模型 fake-search 支持联网搜索、指定宽高比和分辨率、最多 2 个候选结果并配置了价格，
+// fake-image 不支持联网搜索且最多 2 张参考图片，fake-text 不支持生成图片
+func newTestRegistry(t *testing.T, gen generator.ImageGenerator) *generator.Registry {
+	registry, err := generator.NewRegistry(config.ModelsConfig{
+		Default: "fake-search",
+		Items: []config.ModelConfig{
+			{Name: "fake-search", Provider: "fake", Capabilities: config.ModelCapabilities{
+				ImageOutput:   true,
+				WebSearch:     true,
+				AspectRatios:  []string{"1:1", "16:9"},
+				ImageSizes:    []string{"1K", "2K"},
+				MaxCandidates: 2,
+			}, Pricing: config.ModelPricing{PromptPerMillion: 2, CandidatesPerMillion: 12, PerImage: 0.1}},
+			{Name: "fake-image", Provider: "fake", Capabilities: config.ModelCapabilities{ImageOutput: true, MaxReferenceImages: 2}},
+			{Name: "fake-text", Provider: "fake"},
+		},
+	}, map[string]generator.ImageGenerator{"fake": gen})
+	if err != nil {
+		t.Fatalf("创建模型注册表失败: %v", err)
+	}
+	return registry
+}
+
+// fakeWorkspaceRepository 内存中的工作区仓库（仅实现测试用到的方法）
+type fakeWorkspaceRepository struct {
+	repository.WorkspaceRepository
+	workspaces []*repository.Workspace
+}
+
+func (r *fakeWorkspaceRepository) GetByName(_ context.Context, name string) (*repository.Workspace, error) {
+	for _, ws := range r.workspaces {
+		if ws.Name == name {
+			return ws, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *fakeWorkspaceRepository) GetByID(_ context.Context, id int64) (*repository.Workspace, error) {
+	for _, ws := range r.workspaces {
+		if ws.ID == id {
+			return ws, nil
+		}
+	}
+	return nil, nil
+}
+
+// fakeImageRepository 内存中的图片仓库（仅实现测试用到的方法）
+type fakeImageRepository struct {
+	repository.ImageRepository
+	images       []*repository.Image
+	storageOps   []string // 在修改记录的同一事务中登记删除的文件
+	updateErr    error
+	beforeCreate func()             // 创建记录前调用（模拟并发上传）
+	beforeShare  func()             // 创建共享文件的记录前调用（模拟并发删除）
+	tags         map[int64][]string // 图片 ID 到标签（按名称排序）
+}
+
+func (r *fakeImageRepository) Create(_ context.Context, img *repository.Image) (*repository.Image, error) {
+	if r.beforeCreate != nil {
+		r.beforeCreate()
+		r.beforeCreate = nil
+	}
+	for _, existing := range r.images {
+		if existing.WorkspaceID == img.WorkspaceID && existing.Name == img.Name {
+			return nil, fmt.Errorf("创建图片记录失败: %w", repository.ErrImageNameExists)
+		}
+	}
+	created := *img
+	created.ID = int64(len(r.images) + 1)
+	r.images = append(r.images, &created)
+	return &created, nil
+}
+
+// CreateShared 共享的文件不再被任何记录引用时返回 ErrSharedObjectGone
+func (r *fakeImageRepository) CreateShared(ctx context.Context, img *repository.Image) (*repository.Image, error) {
+	if err := r.checkShared(img.OSSPath, img.ThumbnailPath); err != nil {
+		return nil, err
+	}
+	return r.Create(ctx, img)
+}
+
+func (r *fakeImageRepository) ReplaceShared(ctx context.Context, id int64, updates map[string]interface{}, keys []string) (*repository.Image, error) {
+	thumbnailPath, _ := updates["thumbnail_path"].(string)
+	if err := r.checkShared(updates["oss_path"].(string), thumbnailPath); err != nil {
+		return nil, err
+	}
+	return r.UpdateWithStorageOps(ctx, id, updates, keys)
+}
+
+// checkShared 检查共享的文件路径是否仍被记录引用
+func (r *fakeImageRepository) checkShared(paths ...string) error {
+	if r.beforeShare != nil {
+		r.beforeShare()
+		r.beforeShare = nil
+	}
+	for _, path := range paths {
+		if path != "" && !slices.ContainsFunc(r.images, func(img *repository.Image) bool {
+			return img.OSSPath == path || img.ThumbnailPath == path
+		}) {
+			return fmt.Errorf("%w: %s", repository.ErrSharedObjectGone, path)
+		}
+	}
+	return nil
+}
+
+func (r *fakeImageRepository) GetByID(_ context.Context, id int64) (*repository.Image, error) {
+	for _, img := range r.images {
+		if img.ID == id {
+			return img, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *fakeImageRepository) GetByOSSPath(_ context.Context, ossPath string) (*repository.Image, error) {
+	for _, img := range r.images {
+		if img.OSSPath == ossPath {
+			return img, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *fakeImageRepository) GetByName(_ context.Context, workspaceID int64, name string) (*repository.Image, error) {
+	for _, img := range r.images {
+		if img.WorkspaceID == workspaceID && img.Name == name {
+			return img, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *fakeImageRepository) UpdateWithStorageOps(_ context.Context, id int64, updates map[string]interface{}, keys []string) (*repository.Image, error) {
+	if r.updateErr != nil {
+		return nil, r.updateErr
+	}
+	for _, img := range r.images {
+		if img.ID == id {
+			if name, ok := updates["name"].(string); ok {
+				img.Name = name
+			}
+			img.OSSPath = updates["oss_path"].(string)
+			if thumbnailPath, ok := updates["thumbnail_path"].(string); ok {
+				img.ThumbnailPath = thumbnailPath
+			}
+			if contentHash, ok := updates["content_hash"].(string); ok {
+				img.ContentHash = contentHash
+			}
+			r.storageOps = append(r.storageOps, keys...)
+			return img, nil
+		}
+	}
+	return nil, fmt.Errorf("图片不存在")
+}
+
+func (r *fakeImageRepository) DeleteWithStorageOps(_ context.Context, id int64, keys []string) error {
+	for i, img := range r.images {
+		if img.ID == id {
+			r.images = append(r.images[:i], r.images[i+1:]...)
+			r.storageOps = append(r.storageOps, keys...)
+			return nil
+		}
+	}
+	return fmt.Errorf("图片不存在")
+}
+
+func (r *fakeImageRepository) ListByContentHash(_ context.Context, workspaceID int64, contentHash string) ([]*repository.Image, error) {
+	images := make([]*repository.Image, 0)
+	for _, img := range r.images {
+		if img.WorkspaceID == workspaceID && img.ContentHash == contentHash {
+			images = append(images, img)
+		}
+	}
+	return images, nil
+}
+
+// Search 测试中只有一个工作区，返回文件名、提示词或对话文本包含所有词元的图片（文件名匹配时相关度更高）
+func (r *fakeImageRepository) Search(_ context.Context, _ string, terms []string, limit, offset int) ([]*repository.ImageSearchResult, error) {
+	results := make([]*repository.ImageSearchResult, 0)
+	for _, img := range r.images {
+		text := img.Name + " " + img.Prompt
+		for _, msg := range img.MessageList {
+			text += " " + msg.Content
+		}
+		text = strings.ToLower(text)
+		if !slices.ContainsFunc(terms, func(term string) bool { return !strings.Contains(text, term) }) {
+			rank := 0.1
+			if strings.Contains(strings.ToLower(img.Name), terms[0]) {
+				rank = 1
+			}
+			results = append(results, &repository.ImageSearchResult{Image: img, Rank: rank})
+		}
+	}
+	slices.SortStableFunc(results, func(a, b *repository.ImageSearchResult) int {
+		return cmp.Compare(b.Rank, a.Rank)
+	})
+	results = results[min(offset, len(results)):]
+	return results[:min(limit, len(results))], nil
+}
+
+// AddTags 为属于该工作区的图片添加标签
+func (r *fakeImageRepository) AddTags(_ context.Context, workspaceID int64, imageIDs []int64, tags []string) error {
+	return r.updateTags(workspaceID, imageIDs, func(current []string) []string {
+		return slices.Compact(slices.Sorted(slices.Values(append(current, tags...))))
+	})
+}
+
+// RemoveTags 移除属于该工作区的图片的标签
+func (r *fakeImageRepository) RemoveTags(_ context.Context, workspaceID int64, imageIDs []int64, tags []string) error {
+	return r.updateTags(workspaceID, imageIDs, func(current []string) []string {
+		return slices.DeleteFunc(current, func(tag string) bool { return slices.Contains(tags, tag) })
+	})
+}
+
+func (r *fakeImageRepository) updateTags(workspaceID int64, imageIDs []int64, update func(current []string) []string) error {
+	for _, id := range imageIDs {
+		if !slices.ContainsFunc(r.images, func(img *repository.Image) bool { return img.ID == id && img.WorkspaceID == workspaceID }) {
+			return repository.ErrTagImageNotFound
+		}
+	}
+	if r.tags == nil {
+		r.tags = make(map[int64][]string)
+	}
+	for _, id := range imageIDs {
+		r.tags[id] = update(r.tags[id])
+		if len(r.tags[id]) == 0 {
+			delete(r.tags, id)
+		}
+	}
+	return nil
+}
+
+// ListTags 统计工作区中图片的标签数量
+func (r *fakeImageRepository) ListTags(_ context.Context, workspaceID int64) ([]*repository.TagCount, error) {
+	counts := make(map[string]int64)
+	for _, img := range r.images {
+		if img.WorkspaceID != workspaceID {
+			continue
+		}
+		for _, tag := range r.tags[img.ID] {
+			counts[tag]++
+		}
+	}
+	tags := make([]*repository.TagCount, 0, len(counts))
+	for name, count := range counts {
+		tags = append(tags, &repository.TagCount{Name: name, Count: count})
+	}
+	slices.SortFunc(tags, func(a, b *repository.TagCount) int {
+		if c := cmp.Compare(b.Count, a.Count); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Name, b.Name)
+	})
+	return tags, nil
+}
+
+func (r *fakeImageRepository) ListTagsByImages(_ context.Context, imageIDs []int64) (map[int64][]string, error) {
+	tags := make(map[int64][]string)
+	for _, id := range imageIDs {
+		if len(r.tags[id]) > 0 {
+			tags[id] = slices.Clone(r.tags[id])
+		}
+	}
+	return tags, nil
+}
+
+// ListByWorkspaceName 测试中只有一个工作区，按排序方式和游标返回图片（只支持按来源类型和标签过滤）
+func (r *fakeImageRepository) ListByWorkspaceName(_ context.Context, _ string, opts repository.ImageListOptions) ([]*repository.Image, error) {
+	sorted := slices.SortedFunc(slices.Values(r.images), func(a, b *repository.Image) int {
+		var c int
+		switch opts.Sort {
+		case repository.ImageSortName:
+			c = strings.Compare(a.Name, b.Name)
+		case repository.ImageSortSize:
+			c = cmp.Compare(a.Size, b.Size)
+		default:
+			c = a.CreatedAt.Compare(b.CreatedAt)
+		}
+		if c == 0 {
+			c = cmp.Compare(a.ID, b.ID)
+		}
+		if opts.Desc {
+			c = -c
+		}
+		return c
+	})
+
+	images := make([]*repository.Image, 0)
+	started := opts.After == nil
+	for _, img := range sorted {
+		if !started {
+			started = img.ID == opts.After.ID
+			continue
+		}
+		hasTags := !slices.ContainsFunc(opts.Tags, func(tag string) bool { return !slices.Contains(r.tags[img.ID], tag) })
+		if (opts.SourceType == "" || img.SourceType == opts.SourceType) && hasTags && len(images) < opts.Limit {
+			images = append(images, img)
+		}
+	}
+	return images, nil
+}
+
+func (r *fakeImageRepository) ListByGenerationRun(_ context.Context, runID int64) ([]*repository.Image, error) {
+	images := make([]*repository.Image, 0)
+	for _, img := range r.images {
+		if img.GenerationRunID != nil && *img.GenerationRunID == runID {
+			images = append(images, img)
+		}
+	}
+	return images, nil
+}
+
+// fakeStorageOpRepository 记录登记删除的文件
+type fakeStorageOpRepository struct {
+	repository.StorageOpRepository
+	keys []string
+}
+
+func (r *fakeStorageOpRepository) Enqueue(_ context.Context, keys ...string) error {
+	r.keys = append(r.keys, keys...)
+	return nil
+}
+
+// fakeSigningStore 支持签名 URL 的本地存储，签名 URL 中带上有效期（秒）
+type fakeSigningStore struct {
+	*storage.LocalStore
+	signed int   // 签名次数
+	err    error // 签名返回的错误
+}
+
+func (s *fakeSigningStore) SignURL(_ context.Context, key string, ttl time.Duration) (string, error) {
+	if s.err != nil {
+		return "", s.err
+	}
+	s.signed++
+	return fmt.Sprintf("%s?signed=%d", s.URL(key), int(ttl.Seconds())), nil
+}
+
+// fakeGenerationRunRepository 内存中的模型调用记录仓库（仅实现测试用到的方法）
+type fakeGenerationRunRepository struct {
+	repository.GenerationRunRepository
+	runs []*repository.GenerationRun
+}
+
+func (r *fakeGenerationRunRepository) Create(_ context.Context, run *repository.GenerationRun) (*repository.GenerationRun, error) {
+	created := *run
+	created.ID = int64(len(r.runs) + 1)
+	r.runs = append(r.runs, &created)
+	return &created, nil
+}
+
+func (r *fakeGenerationRunRepository) Reserve(ctx context.Context, run *repository.GenerationRun, admit func(usageSince repository.UsageSinceFunc) error) (*repository.GenerationRun, error) {
+	if err := admit(func(since string) (*repository.UsageTotals, error) {
+		return r.UsageSince(ctx, run.WorkspaceID, since)
+	}); err != nil {
+		return nil, err
+	}
+	pending := *run
+	pending.Status = repository.RunStatusPending
+	return r.Create(ctx, &pending)
+}
+
+func (r *fakeGenerationRunRepository) Finish(_ context.Context, run *repository.GenerationRun) (*repository.GenerationRun, error) {
+	for i, existing := range r.runs {
+		if existing.ID == run.ID && existing.Status == repository.RunStatusPending {
+			finished := *run
+			r.runs[i] = &finished
+			return &finished, nil
+		}
+	}
+	return nil, fmt.Errorf("调用记录 %d 不存在或已结束", run.ID)
+}
+
+func (r *fakeGenerationRunRepository) GetByID(_ context.Context, id int64) (*repository.GenerationRun, error) {
+	for _, run := range r.runs {
+		if run.ID == id {
+			return run, nil
+		}
+	}
+	return nil, nil
+}
+
+// UsageSince 汇总工作区的所有调用（测试中忽略日期，进行中的调用计入生成次数）
+func (r *fakeGenerationRunRepository) UsageSince(_ context.Context, workspaceID int64, _ string) (*repository.UsageTotals, error) {
+	totals := &repository.UsageTotals{}
+	for _, run := range r.runs {
+		if run.WorkspaceID != workspaceID {
+			continue
+		}
+		if run.Status == repository.RunStatusSucceeded || run.Status == repository.RunStatusPending {
+			totals.SucceededRuns++
+		}
+		totals.TotalTokens += int64(run.TotalTokens)
+		totals.Cost += run.Cost
+	}
+	return totals, nil
+}
+
+// fakeBudgetRepository 内存中的预算仓库（仅实现测试用到的方法）
+type fakeBudgetRepository struct {
+	repository.BudgetRepository
+	budgets []*repository.Budget
+}
+
+func (r *fakeBudgetRepository) ListByWorkspace(_ context.Context, workspaceID int64) ([]*repository.Budget, error) {
+	budgets := make([]*repository.Budget, 0)
+	for _, b := range r.budgets {
+		if b.WorkspaceID == workspaceID {
+			budgets = append(budgets, b)
+		}
+	}
+	return budgets, nil
+}
+
+// fakeConversationRepository 内存中的对话仓库（仅实现测试用到的方法）
+type fakeConversationRepository struct {
+	repository.ConversationRepository
+	conversations []*repository.Conversation
+	turns         []*repository.ConversationTurn
+}
+
+func (r *fakeConversationRepository) Create(_ context.Context, conv *repository.Conversation) (*repository.Conversation, error) {
+	created := *conv
+	created.ID = int64(len(r.conversations) + 1)
+	r.conversations = append(r.conversations, &created)
+	return &created, nil
+}
+
+func (r *fakeConversationRepository) GetByID(_ context.Context, id int64) (*repository.Conversation, error) {
+	for _, conv := range r.conversations {
+		if conv.ID == id {
+			result := *conv
+			turns, _ := r.ListTurns(context.Background(), id)
+			result.TurnCount = len(turns)
+			return &result, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *fakeConversationRepository) ListTurns(_ context.Context, conversationID int64) ([]*repository.ConversationTurn, error) {
+	turns := make([]*repository.ConversationTurn, 0)
+	for _, turn := range r.turns {
+		if turn.ConversationID == conversationID {
+			turns = append(turns, turn)
+		}
+	}
+	return turns, nil
+}
+
+func (r *fakeConversationRepository) AppendTurns(ctx context.Context, conversationID int64, turns []*repository.ConversationTurn) error {
+	existing, _ := r.ListTurns(ctx, conversationID)
+	for i, turn := range turns {
+		appended := *turn
+		appended.ConversationID = conversationID
+		appended.TurnIndex = len(existing) + i
+		r.turns = append(r.turns, &appended)
+	}
+	return nil
 }
@@ -0,0 +1,85 @@
+package image
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/guixu633/agent/backend/internal/storage"
+)
+
+// putNewImage 将图片写入工作区目录中不存在的路径，返回对象路径
+// 路径已被占用时依次尝试添加序号的文件名（如 cat (2).png），不会覆盖已有文件
+func (s *Service) putNewImage(ctx context.Context, workspace, filename string, data []byte) (string, error) {
+	for n := 1; n <= maxUploadAttempts; n++ {
+		key := s.layout.ImageKey(workspace, numberedName(filename, n))
+		err := s.store.PutIfAbsent(ctx, key, bytes.NewReader(data))
+		if err == nil {
+			return key, nil
+		}
+		if !errors.Is(err, storage.ErrExists) {
+			return "", err
+		}
+	}
+	return "", fmt.Errorf("尝试 %d 次后仍未找到可用的存储路径", maxUploadAttempts)
+}
+
+// copyNewObject 复制文件到新路径，目标路径已有文件时返回 storage.ErrExists（不覆盖其他图片的文件）
+// 优先在存储端条件复制，存储不支持时才读出文件后条件写入
+func (s *Service) copyNewObject(ctx context.Context, src, dst string) error {
+	err := s.store.CopyIfAbsent(ctx, src, dst)
+	if !errors.Is(err, storage.ErrNotSupported) {
+		return err
+	}
+	data, err := storage.ReadAll(ctx, s.store, src)
+	if err != nil {
+		return err
+	}
+	return s.store.PutIfAbsent(ctx, dst, bytes.NewReader(data))
+}
+
+// cleanupObjects 登记删除不再需要的文件，由后台任务删除（失败时重试）
+// 后台任务删除前会确认文件没有被图片记录引用；登记失败时只记录日志，残留文件由一致性巡检清理
+func (s *Service) cleanupObjects(ctx context.Context, paths ...string) {
+	if err := s.storageOpRepo.Enqueue(context.WithoutCancel(ctx), paths...); err != nil {
+		log.Printf("登记待删除文件失败 (paths: %v): %v", paths, err)
+	}
+}
+
+// deleteObjects 删除已上传的文件（用于回滚，尽力而为，空路径会被跳过）
+// 请求被取消时仍然执行删除
+func (s *Service) deleteObjects(ctx context.Context, paths ...string) {
+	ctx = context.WithoutCancel(ctx)
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		if err := s.store.Delete(ctx, path); err != nil {
+			log.Printf("删除文件失败 (path: %s): %v", path, err)
+		}
+	}
+}
+
+// imageURL 返回对象的访问 URL（配置了有效期时生成签名 URL），路径为空时返回空字符串
+func (s *Service) imageURL(ctx context.Context, path string) (string, error) {
+	url, err := storage.AccessURL(ctx, s.store, path, s.urlTTL)
+	if err != nil {
+		return "", fmt.Errorf("获取图片访问 URL 失败: %w", err)
+	}
+	return url, nil
+}
+
+// imageURLs 返回原图和缩略图的访问 URL
+func (s *Service) imageURLs(ctx context.Context, path, thumbnailPath string) (string, string, error) {
+	url, err := s.imageURL(ctx, path)
+	if err != nil {
+		return "", "", err
+	}
+	thumbnailURL, err := s.imageURL(ctx, thumbnailPath)
+	if err != nil {
+		return "", "", err
+	}
+	return url, thumbnailURL, nil
+}
@@ -0,0 +1,154 @@
+package image
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/guixu633/agent/backend/internal/generator"
+	"github.com/guixu633/agent/backend/internal/model"
+	"github.com/guixu633/agent/backend/internal/repository"
+)
+
+// StreamHandler 流式生成事件回调，返回错误会终止生成（如客户端已断开）
+type StreamHandler func(event *model.GenerateStreamEvent) error
+
+// GenerateImageStream 流式生成图片
+// 文本片段到达时立即推送；图片片段到达时先上传到存储再推送（携带路径、URL 和缩略图）；
+// 所有片段接收完毕后保存数据库记录、记录对话轮次并推送汇总结果。
+// ctx 取消时上游调用随之取消，已上传但未保存记录的图片会被删除。
+func (s *Service) GenerateImageStream(ctx context.Context, req *model.ImageGenerateRequest, emit StreamHandler) error {
+	gen, err := s.prepareGeneration(ctx, req)
+	if err != nil {
+		return err
+	}
+
+	// 已上传到存储、等待保存数据库记录的图片
+	type pendingImage struct {
+		stored         *storedImage
+		candidate      int // 所属的候选序号
+		resultPartsIdx int // 在候选结果中的位置索引
+	}
+	pendingImages := make([]pendingImage, 0)
+	cleanup := func() {
+		for _, pending := range pendingImages {
+			s.removeStoredImage(ctx, pending.stored)
+		}
+	}
+
+	// 第一遍：片段到达时推送文本、上传图片
+	streamed := &generator.Response{}
+	start := time.Now()
+	resp, err := gen.generator.GenerateStream(ctx, gen.genReq, func(candidate int, part generator.Part) error {
+		parts := streamed.Candidate(candidate).Parts
+		index := len(parts)
+		if part.Type == generator.PartTypeText && index > 0 && parts[index-1].Type == generator.PartTypeText {
+			index--
+		}
+		streamed.AppendPart(candidate, part)
+
+		switch part.Type {
+		case generator.PartTypeText:
+			if part.Text == "" {
+				return nil
+			}
+			return emit(&model.GenerateStreamEvent{
+				Type:      model.StreamEventText,
+				Candidate: candidate,
+				Index:     index,
+				Text:      part.Text,
+			})
+		case generator.PartTypeImage:
+			stored, err := s.storeGeneratedImage(ctx, gen.workspace.Name, part.Data, part.MimeType)
+			if err != nil {
+				return err
+			}
+			pendingImages = append(pendingImages, pendingImage{stored: stored, candidate: candidate, resultPartsIdx: index})
+			return emit(&model.GenerateStreamEvent{
+				Type:      model.StreamEventImage,
+				Candidate: candidate,
+				Index:     index,
+				Image:     stored.generatedImage(),
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		err = fmt.Errorf("生成内容失败: %w", err)
+	} else {
+		err = checkResponse(resp)
+	}
+	// 失败时汇总结果不可用，使用已收到的片段记录本次调用
+	if resp == nil {
+		resp = streamed
+	}
+	run := s.recordRun(ctx, gen, resp, time.Since(start), err)
+	gen.runID = run.ID
+	if err != nil {
+		cleanup()
+		return err
+	}
+
+	// 构建汇总结果和对话历史（与非流式接口保持一致，只记录文本消息）
+	result := &model.ImageGenerateResponse{
+		Candidates: make([]model.GenerateCandidate, len(streamed.Candidates)),
+		RunID:      gen.runID,
+		Warnings:   budgetWarnings(gen, run),
+	}
+	// 以下均按 streamed.Candidates 中的位置索引
+	messageLists := make([][]repository.Message, len(streamed.Candidates))
+	modelTurns := make([][]repository.TurnPart, len(streamed.Candidates))
+	positions := make(map[int]int) // 候选序号 -> 位置索引
+	for i, candidate := range streamed.Candidates {
+		parts := make([]model.GeneratePart, len(candidate.Parts))
+		messageList := make([]repository.Message, 0)
+		modelTurn := make([]repository.TurnPart, len(candidate.Parts))
+		for j, part := range candidate.Parts {
+			modelTurn[j] = repository.TurnPart{
+				Type:             string(part.Type),
+				MimeType:         part.MimeType,
+				ThoughtSignature: part.ThoughtSignature,
+			}
+			if part.Type == generator.PartTypeText {
+				text := strings.TrimSpace(part.Text)
+				parts[j] = model.GeneratePart{Type: "text", Text: text}
+				modelTurn[j].Text = text
+				if text != "" {
+					messageList = append(messageList, repository.Message{
+						Role:    "assistant",
+						Type:    "text",
+						Content: text,
+					})
+				}
+			}
+		}
+		result.Candidates[i] = model.GenerateCandidate{Index: candidate.Index, Parts: parts}
+		messageLists[i] = messageList
+		modelTurns[i] = modelTurn
+		positions[candidate.Index] = i
+	}
+
+	// 第二遍：保存所有图片的数据库记录
+	for i, pending := range pendingImages {
+		pos := positions[pending.candidate]
+		result.Candidates[pos].Parts[pending.resultPartsIdx] = model.GeneratePart{
+			Type:  "image",
+			Image: pending.stored.generatedImage(),
+		}
+		modelTurns[pos][pending.resultPartsIdx].Path = pending.stored.path
+		if err := s.saveGeneratedImage(ctx, gen, pending.stored, pending.candidate, messageLists[pos]); err != nil {
+			pendingImages = pendingImages[i+1:]
+			cleanup()
+			return err
+		}
+	}
+
+	// 对话中只记录第一个候选结果
+	result.Parts = result.Candidates[0].Parts
+	result.ConversationID = s.recordConversation(ctx, gen, modelTurns[0])
+	return emit(&model.GenerateStreamEvent{
+		Type:   model.StreamEventDone,
+		Result: result,
+	})
+}
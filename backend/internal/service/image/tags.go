@@ -0,0 +1,135 @@
+package image
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/guixu633/agent/backend/internal/model"
+	"github.com/guixu633/agent/backend/internal/repository"
+)
+
+const (
+	maxTagLength    = 50  // 标签名称的最大字符数
+	maxTagsPerCall  = 20  // 一次请求最多添加或移除的标签数
+	maxImagesPerTag = 200 // 一次请求最多修改的图片数
+)
+
+// AddTags 为工作区中的一张或多张图片添加标签
+func (s *Service) AddTags(ctx context.Context, req *model.TagImagesRequest) (*model.TagImagesResponse, error) {
+	return s.updateTags(ctx, req, s.imageRepo.AddTags)
+}
+
+// RemoveTags 移除工作区中一张或多张图片的标签
+func (s *Service) RemoveTags(ctx context.Context, req *model.TagImagesRequest) (*model.TagImagesResponse, error) {
+	return s.updateTags(ctx, req, s.imageRepo.RemoveTags)
+}
+
+// updateTags 校验请求后添加或移除标签，返回各图片修改后的标签
+func (s *Service) updateTags(ctx context.Context, req *model.TagImagesRequest, update func(ctx context.Context, workspaceID int64, imageIDs []int64, tags []string) error) (*model.TagImagesResponse, error) {
+	tags, err := normalizeTags(req.Tags)
+	if err != nil {
+		return nil, err
+	}
+	if len(tags) == 0 {
+		return nil, fmt.Errorf("%w: 标签不能为空", ErrInvalidTags)
+	}
+	if len(tags) > maxTagsPerCall {
+		return nil, fmt.Errorf("%w: 一次最多修改 %d 个标签", ErrInvalidTags, maxTagsPerCall)
+	}
+	imageIDs := slices.Compact(slices.Sorted(slices.Values(req.ImageIDs)))
+	if len(imageIDs) > maxImagesPerTag {
+		return nil, fmt.Errorf("%w: 一次最多修改 %d 张图片", ErrInvalidTags, maxImagesPerTag)
+	}
+
+	ws, err := s.workspaceRepo.GetByName(ctx, req.Workspace)
+	if err != nil {
+		return nil, fmt.Errorf("获取工作区失败: %w", err)
+	}
+	if ws == nil {
+		return nil, fmt.Errorf("工作区 %s 不存在", req.Workspace)
+	}
+
+	if err := update(ctx, ws.ID, imageIDs, tags); err != nil {
+		if errors.Is(err, repository.ErrTagImageNotFound) {
+			return nil, fmt.Errorf("%w: %v", ErrImageNotFound, err)
+		}
+		return nil, fmt.Errorf("修改图片标签失败: %w", err)
+	}
+
+	imageTags, err := s.imageRepo.ListTagsByImages(ctx, imageIDs)
+	if err != nil {
+		return nil, err
+	}
+	images := make([]model.ImageTags, 0, len(imageIDs))
+	for _, id := range imageIDs {
+		images = append(images, model.ImageTags{
+			ID:   id,
+			Tags: append([]string{}, imageTags[id]...),
+		})
+	}
+	return &model.TagImagesResponse{Images: images}, nil
+}
+
+// ListTags 列出工作区中正在使用的标签及图片数量
+func (s *Service) ListTags(ctx context.Context, workspace string) (*model.ListTagsResponse, error) {
+	ws, err := s.workspaceRepo.GetByName(ctx, workspace)
+	if err != nil {
+		return nil, fmt.Errorf("获取工作区失败: %w", err)
+	}
+	if ws == nil {
+		return nil, fmt.Errorf("工作区 %s 不存在", workspace)
+	}
+
+	dbTags, err := s.imageRepo.ListTags(ctx, ws.ID)
+	if err != nil {
+		return nil, err
+	}
+	tags := make([]model.TagInfo, 0, len(dbTags))
+	for _, tag := range dbTags {
+		tags = append(tags, model.TagInfo{Name: tag.Name, Count: tag.Count})
+	}
+	return &model.ListTagsResponse{Tags: tags}, nil
+}
+
+// normalizeTags 去除标签两端的空白并去重（保持原有顺序），校验名称长度和字符
+func normalizeTags(tags []string) ([]string, error) {
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || slices.Contains(normalized, tag) {
+			continue
+		}
+		if utf8.RuneCountInString(tag) > maxTagLength {
+			return nil, fmt.Errorf("%w: 标签不能超过 %d 个字符: %s", ErrInvalidTags, maxTagLength, tag)
+		}
+		if strings.ContainsFunc(tag, unicode.IsControl) {
+			return nil, fmt.Errorf("%w: 标签不能包含控制字符: %q", ErrInvalidTags, tag)
+		}
+		normalized = append(normalized, tag)
+	}
+	return normalized, nil
+}
+
+// fillImageTags 批量查询图片的标签并填充到图片信息中
+func (s *Service) fillImageTags(ctx context.Context, images []*model.ImageInfo) error {
+	if len(images) == 0 {
+		return nil
+	}
+	ids := make([]int64, 0, len(images))
+	for _, img := range images {
+		ids = append(ids, img.ID)
+	}
+	tags, err := s.imageRepo.ListTagsByImages(ctx, ids)
+	if err != nil {
+		return err
+	}
+	for _, img := range images {
+		img.Tags = tags[img.ID]
+	}
+	return nil
+}
@@ -0,0 +1,365 @@
+package job
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/guixu633/agent/backend/internal/config"
+	"github.com/guixu633/agent/backend/internal/model"
+	"github.com/guixu633/agent/backend/internal/repository"
+	"github.com/guixu633/agent/backend/internal/service/image"
+)
+
+var (
+	// ErrJobNotFound 任务不存在
+	ErrJobNotFound = errors.New("任务不存在")
+	// ErrJobFinished 任务已结束，无法取消
+	ErrJobFinished = errors.New("任务已结束")
+)
+
+// Service 异步生成任务服务
+// 任务持久化在 generation_jobs 表中，调度器按提交顺序领取排队任务，
+// 在总并发（jobs.workers）和模型并发（max_concurrency）限制内调用 image.Service 执行。
+// 多个服务实例可以同时调度：每个任务只会被一个实例领取，运行期间定期刷新心跳，心跳超时的任务重新排队
+type Service struct {
+	imageService  *image.Service
+	jobRepo       repository.JobRepository
+	workspaceRepo repository.WorkspaceRepository
+
+	instanceID        string // 本实例的标识，记录在领取的任务中
+	pollInterval      time.Duration
+	heartbeatInterval time.Duration
+	heartbeatTimeout  time.Duration
+	workerSlots       chan struct{}            // 总并发槽位
+	modelSlots        map[string]chan struct{} // 各模型并发槽位（未配置上限的模型不限制）
+	notify            chan struct{}            // 唤醒调度器
+
+	mu      sync.Mutex
+	running map[int64]context.CancelFunc // 本进程中运行中的任务
+}
+
+// NewService 创建异步生成任务服务实例
+func NewService(imageService *image.Service, jobRepo repository.JobRepository, workspaceRepo repository.WorkspaceRepository, jobsConfig config.JobsConfig, modelsConfig config.ModelsConfig) *Service {
+	modelSlots := make(map[string]chan struct{})
+	for _, m := range modelsConfig.Items {
+		if m.MaxConcurrency > 0 {
+			modelSlots[m.Name] = make(chan struct{}, m.MaxConcurrency)
+		}
+	}
+
+	return &Service{
+		imageService:      imageService,
+		jobRepo:           jobRepo,
+		workspaceRepo:     workspaceRepo,
+		instanceID:        newInstanceID(),
+		pollInterval:      time.Duration(jobsConfig.PollInterval) * time.Second,
+		heartbeatInterval: time.Duration(jobsConfig.HeartbeatInterval) * time.Second,
+		heartbeatTimeout:  time.Duration(jobsConfig.HeartbeatTimeout) * time.Second,
+		workerSlots:       make(chan struct{}, jobsConfig.Workers),
+		modelSlots:        modelSlots,
+		notify:            make(chan struct{}, 1),
+		running:           make(map[int64]context.CancelFunc),
+	}
+}
+
+// newInstanceID 生成服务实例标识（主机名、进程 ID 和随机后缀）
+func newInstanceID() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	return fmt.Sprintf("%s-%d-%x", hostname, os.Getpid(), suffix)
+}
+
+// Start 启动调度器和心跳
+// 启动前先将心跳超时（领取的实例已退出，如服务重启）的任务重新排队，其他实例仍在运行的任务不受影响
+func (s *Service) Start(ctx context.Context) error {
+	requeued, err := s.jobRepo.RequeueStale(ctx, s.heartbeatTimeout)
+	if err != nil {
+		return err
+	}
+	if requeued > 0 {
+		log.Printf("已重新排队 %d 个被中断的生成任务", requeued)
+	}
+
+	go s.loop(ctx)
+	go s.heartbeat(ctx)
+	s.wake()
+	return nil
+}
+
+// CreateJob 提交生成任务，立即返回任务信息
+func (s *Service) CreateJob(ctx context.Context, req *model.ImageGenerateRequest) (*model.CreateJobResponse, error) {
+	// 提前校验模型及其能力，避免非法请求进入队列
+	modelName, err := s.imageService.ValidateRequest(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	// 使用请求中的 workspace，如果没有则使用 "default"
+	workspace := req.Workspace
+	if workspace == "" {
+		workspace = "default"
+	}
+	ws, err := s.workspaceRepo.GetByName(ctx, workspace)
+	if err != nil {
+		return nil, fmt.Errorf("获取工作区失败: %w", err)
+	}
+	if ws == nil {
+		return nil, fmt.Errorf("工作区 %s 不存在", workspace)
+	}
+
+	// 固定实际使用的模型，避免默认模型配置变更影响排队中的任务
+	req.Model = modelName
+	request, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("序列化生成请求失败: %w", err)
+	}
+
+	dbJob, err := s.jobRepo.Create(ctx, &repository.Job{
+		WorkspaceID: ws.ID,
+		Model:       modelName,
+		Request:     request,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("创建生成任务失败: %w", err)
+	}
+
+	s.wake()
+
+	return &model.CreateJobResponse{
+		Job: s.convertJob(dbJob),
+	}, nil
+}
+
+// GetJob 获取生成任务状态和结果
+func (s *Service) GetJob(ctx context.Context, id int64) (*model.GetJobResponse, error) {
+	dbJob, err := s.jobRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("获取生成任务失败: %w", err)
+	}
+	if dbJob == nil {
+		return nil, ErrJobNotFound
+	}
+
+	return &model.GetJobResponse{
+		Job: s.convertJob(dbJob),
+	}, nil
+}
+
+// CancelJob 取消排队中或运行中的任务
+func (s *Service) CancelJob(ctx context.Context, id int64) error {
+	dbJob, err := s.jobRepo.GetByID(ctx, id)
+	if err != nil {
+		return fmt.Errorf("获取生成任务失败: %w", err)
+	}
+	if dbJob == nil {
+		return ErrJobNotFound
+	}
+
+	cancelled, err := s.jobRepo.Cancel(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !cancelled {
+		return ErrJobFinished
+	}
+
+	// 如果任务正在本进程中运行，取消上游调用
+	s.mu.Lock()
+	cancel, ok := s.running[id]
+	s.mu.Unlock()
+	if ok {
+		cancel()
+	}
+
+	return nil
+}
+
+// wake 唤醒调度器（不阻塞）
+func (s *Service) wake() {
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+// loop 调度循环：有新任务、任务结束或定时轮询时尝试调度
+func (s *Service) loop(ctx context.Context) {
+	ticker := time.NewTicker(s.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.notify:
+		case <-ticker.C:
+		}
+		s.dispatch(ctx)
+	}
+}
+
+// dispatch 按提交顺序领取并运行排队中的任务，直到没有空闲槽位或排队任务
+// 领取时排除已达到并发上限的模型，避免最早的任务都属于这些模型时其他模型的任务一直无法调度
+func (s *Service) dispatch(ctx context.Context) {
+	for tryAcquire(s.workerSlots) {
+		dbJob, err := s.jobRepo.ClaimNext(ctx, s.instanceID, s.saturatedModels())
+		if err != nil {
+			log.Printf("领取排队任务失败: %v", err)
+		}
+		if dbJob == nil {
+			release(s.workerSlots)
+			return
+		}
+
+		// 只有调度协程占用模型槽位，领取时已排除达到并发上限的模型，这里一定能获取到槽位
+		modelSlot := s.modelSlots[dbJob.Model]
+		if modelSlot != nil {
+			modelSlot <- struct{}{}
+		}
+		go s.run(ctx, dbJob, modelSlot)
+	}
+}
+
+// heartbeat 定期刷新本实例运行中任务的心跳，并将其他实例退出后遗留的任务重新排队
+func (s *Service) heartbeat(ctx context.Context) {
+	ticker := time.NewTicker(s.heartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		s.mu.Lock()
+		ids := slices.Collect(maps.Keys(s.running))
+		s.mu.Unlock()
+		if err := s.jobRepo.Heartbeat(ctx, s.instanceID, ids); err != nil {
+			log.Printf("刷新任务心跳失败: %v", err)
+		}
+
+		requeued, err := s.jobRepo.RequeueStale(ctx, s.heartbeatTimeout)
+		if err != nil {
+			log.Printf("恢复中断任务失败: %v", err)
+			continue
+		}
+		if requeued > 0 {
+			log.Printf("已重新排队 %d 个心跳超时的生成任务", requeued)
+			s.wake()
+		}
+	}
+}
+
+// saturatedModels 返回已达到并发上限的模型
+func (s *Service) saturatedModels() []string {
+	models := make([]string, 0)
+	for name, slot := range s.modelSlots {
+		if len(slot) == cap(slot) {
+			models = append(models, name)
+		}
+	}
+	return models
+}
+
+// run 执行一个任务并记录结果
+func (s *Service) run(ctx context.Context, dbJob *repository.Job, modelSlot chan struct{}) {
+	jobCtx, cancel := context.WithCancel(ctx)
+	s.mu.Lock()
+	s.running[dbJob.ID] = cancel
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.running, dbJob.ID)
+		s.mu.Unlock()
+		cancel()
+		release(modelSlot)
+		release(s.workerSlots)
+		s.wake()
+	}()
+
+	var req model.ImageGenerateRequest
+	var result json.RawMessage
+	err := json.Unmarshal(dbJob.Request, &req)
+	if err != nil {
+		err = fmt.Errorf("解析生成请求失败: %w", err)
+	} else {
+		var resp *model.ImageGenerateResponse
+		resp, err = s.imageService.GenerateImage(jobCtx, &req)
+		if err == nil {
+			result, err = json.Marshal(resp)
+		}
+	}
+
+	status, errMsg := repository.JobStatusSucceeded, ""
+	if err != nil {
+		status, errMsg = repository.JobStatusFailed, err.Error()
+	}
+
+	// 使用独立的 context 记录结果，避免任务被取消后无法写入
+	// 任务已被取消时 MarkFinished 不会覆盖 cancelled 状态
+	if err := s.jobRepo.MarkFinished(context.Background(), dbJob.ID, s.instanceID, status, result, errMsg); err != nil {
+		log.Printf("记录任务 %d 结果失败: %v", dbJob.ID, err)
+	}
+}
+
+// convertJob 将数据库任务记录转换为响应格式
+func (s *Service) convertJob(dbJob *repository.Job) model.GenerationJob {
+	job := model.GenerationJob{
+		ID:        dbJob.ID,
+		Status:    dbJob.Status,
+		Model:     dbJob.Model,
+		Error:     dbJob.Error,
+		CreatedAt: dbJob.CreatedAt.Format(time.RFC3339),
+	}
+
+	var req model.ImageGenerateRequest
+	if err := json.Unmarshal(dbJob.Request, &req); err == nil {
+		job.Prompt = req.Prompt
+	}
+	if len(dbJob.Result) > 0 {
+		var resp model.ImageGenerateResponse
+		if err := json.Unmarshal(dbJob.Result, &resp); err == nil {
+			job.Parts = resp.Parts
+		}
+	}
+	if dbJob.StartedAt != nil {
+		job.StartedAt = dbJob.StartedAt.Format(time.RFC3339)
+	}
+	if dbJob.FinishedAt != nil {
+		job.FinishedAt = dbJob.FinishedAt.Format(time.RFC3339)
+	}
+
+	return job
+}
+
+// tryAcquire 尝试获取一个槽位（不阻塞）
+func tryAcquire(slots chan struct{}) bool {
+	select {
+	case slots <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// release 释放一个槽位，slots 为 nil 时忽略
+func release(slots chan struct{}) {
+	if slots != nil {
+		<-slots
+	}
+}
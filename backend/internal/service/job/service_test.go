@@ -0,0 +1,303 @@
+package job
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/guixu633/agent/backend/internal/config"
+	"github.com/guixu633/agent/backend/internal/generator"
+	"github.com/guixu633/agent/backend/internal/model"
+	"github.com/guixu633/agent/backend/internal/repository"
+	"github.com/guixu633/agent/backend/internal/service/image"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJobLifecycle(t *testing.T) {
+	modelsConfig := config.ModelsConfig{
+		Default: "fake",
+		Items: []config.ModelConfig{
+			{Name: "fake", Provider: "fake", Capabilities: config.ModelCapabilities{ImageOutput: true}, MaxConcurrency: 1},
+		},
+	}
+	gen := &generator.FakeGenerator{
+		Parts: []generator.Part{{Type: generator.PartTypeText, Text: "完成"}},
+	}
+	registry, err := generator.NewRegistry(modelsConfig, map[string]generator.ImageGenerator{"fake": gen})
+	assert.NoError(t, err)
+
+	workspaceRepo := &fakeWorkspaceRepository{workspace: &repository.Workspace{ID: 1, Name: "default"}}
+	imgService := image.NewService(image.Deps{Registry: registry, WorkspaceRepo: workspaceRepo, ConversationRepo: &fakeConversationRepository{}, RunRepo: &fakeGenerationRunRepository{}})
+	jobRepo := newFakeJobRepository()
+	service := NewService(imgService, jobRepo, workspaceRepo, config.JobsConfig{Workers: 2, PollInterval: 1, HeartbeatInterval: 1, HeartbeatTimeout: 60}, modelsConfig)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	assert.NoError(t, service.Start(ctx))
+
+	created, err := service.CreateJob(ctx, &model.ImageGenerateRequest{Prompt: "猫"})
+	assert.NoError(t, err)
+	assert.Equal(t, repository.JobStatusQueued, created.Job.Status)
+	assert.Equal(t, "fake", created.Job.Model)
+
+	assert.Eventually(t, func() bool {
+		resp, err := service.GetJob(ctx, created.Job.ID)
+		return err == nil && resp.Job.Status == repository.JobStatusSucceeded
+	}, 2*time.Second, 10*time.Millisecond)
+
+	resp, err := service.GetJob(ctx, created.Job.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, []model.GeneratePart{{Type: "text", Text: "完成"}}, resp.Job.Parts)
+
+	assert.ErrorIs(t, service.CancelJob(ctx, created.Job.ID), ErrJobFinished)
+	assert.ErrorIs(t, service.CancelJob(ctx, 999), ErrJobNotFound)
+}
+
+func TestDispatchSkipsSaturatedModels(t *testing.T) {
+	modelsConfig := config.ModelsConfig{
+		Default: "slow",
+		Items: []config.ModelConfig{
+			{Name: "slow", Provider: "fake", Capabilities: config.ModelCapabilities{ImageOutput: true}, MaxConcurrency: 1},
+			{Name: "fast", Provider: "fake", Capabilities: config.ModelCapabilities{ImageOutput: true}, MaxConcurrency: 1},
+		},
+	}
+	gen := &generator.FakeGenerator{
+		Parts: []generator.Part{{Type: generator.PartTypeText, Text: "完成"}},
+	}
+	registry, err := generator.NewRegistry(modelsConfig, map[string]generator.ImageGenerator{"fake": gen})
+	assert.NoError(t, err)
+
+	workspaceRepo := &fakeWorkspaceRepository{workspace: &repository.Workspace{ID: 1, Name: "default"}}
+	imgService := image.NewService(image.Deps{Registry: registry, WorkspaceRepo: workspaceRepo, ConversationRepo: &fakeConversationRepository{}, RunRepo: &fakeGenerationRunRepository{}})
+	jobRepo := newFakeJobRepository()
+	service := NewService(imgService, jobRepo, workspaceRepo, config.JobsConfig{Workers: 1, PollInterval: 1}, modelsConfig)
+	ctx := context.Background()
+
+	// slow 模型已达到并发上限，最早的一页任务都属于 slow
+	service.modelSlots["slow"] <- struct{}{}
+	for range cap(service.workerSlots)*4 + 1 {
+		_, err := jobRepo.Create(ctx, &repository.Job{Model: "slow", Request: json.RawMessage(`{"prompt":"猫","model":"slow"}`)})
+		assert.NoError(t, err)
+	}
+	fast, err := jobRepo.Create(ctx, &repository.Job{Model: "fast", Request: json.RawMessage(`{"prompt":"狗","model":"fast"}`)})
+	assert.NoError(t, err)
+
+	service.dispatch(ctx)
+	assert.Eventually(t, func() bool {
+		job, err := jobRepo.GetByID(ctx, fast.ID)
+		return err == nil && job.Status == repository.JobStatusSucceeded
+	}, 2*time.Second, 10*time.Millisecond)
+
+	assert.Equal(t, cap(service.workerSlots)*4+1, jobRepo.queued())
+}
+
+func TestRequeueStaleJobs(t *testing.T) {
+	modelsConfig := config.ModelsConfig{
+		Default: "fake",
+		Items:   []config.ModelConfig{{Name: "fake", Provider: "fake", Capabilities: config.ModelCapabilities{ImageOutput: true}}},
+	}
+	gen := &generator.FakeGenerator{
+		Parts: []generator.Part{{Type: generator.PartTypeText, Text: "完成"}},
+	}
+	registry, err := generator.NewRegistry(modelsConfig, map[string]generator.ImageGenerator{"fake": gen})
+	assert.NoError(t, err)
+	workspaceRepo := &fakeWorkspaceRepository{workspace: &repository.Workspace{ID: 1, Name: "default"}}
+	imgService := image.NewService(image.Deps{Registry: registry, WorkspaceRepo: workspaceRepo, ConversationRepo: &fakeConversationRepository{}, RunRepo: &fakeGenerationRunRepository{}})
+	jobRepo := newFakeJobRepository()
+	service := NewService(imgService, jobRepo, workspaceRepo, config.JobsConfig{Workers: 1, PollInterval: 1, HeartbeatInterval: 1, HeartbeatTimeout: 60}, modelsConfig)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// 其他实例正在运行的任务（心跳未超时）和已退出实例遗留的任务（心跳超时）
+	stale := time.Now().Add(-time.Hour)
+	live, err := jobRepo.Create(ctx, &repository.Job{Model: "fake", Request: json.RawMessage(`{"prompt":"猫"}`)})
+	assert.NoError(t, err)
+	orphaned, err := jobRepo.Create(ctx, &repository.Job{Model: "fake", Request: json.RawMessage(`{"prompt":"狗"}`)})
+	assert.NoError(t, err)
+	_, err = jobRepo.ClaimNext(ctx, "other", nil)
+	assert.NoError(t, err)
+	_, err = jobRepo.ClaimNext(ctx, "crashed", nil)
+	assert.NoError(t, err)
+	jobRepo.jobs[orphaned.ID].HeartbeatAt = &stale
+
+	assert.NoError(t, service.Start(ctx))
+	assert.Eventually(t, func() bool {
+		job, err := jobRepo.GetByID(ctx, orphaned.ID)
+		return err == nil && job.Status == repository.JobStatusSucceeded && job.ClaimedBy == service.instanceID
+	}, 2*time.Second, 10*time.Millisecond)
+
+	job, err := jobRepo.GetByID(ctx, live.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, repository.JobStatusRunning, job.Status)
+	assert.Equal(t, "other", job.ClaimedBy)
+
+	// 其他实例完成任务时不会覆盖本实例重新领取后的结果
+	assert.NoError(t, jobRepo.MarkFinished(ctx, orphaned.ID, "crashed", repository.JobStatusFailed, nil, "中断"))
+	job, err = jobRepo.GetByID(ctx, orphaned.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, repository.JobStatusSucceeded, job.Status)
+}
+
+// fakeWorkspaceRepository 只包含一个工作区的内存仓库
+type fakeWorkspaceRepository struct {
+	repository.WorkspaceRepository
+	workspace *repository.Workspace
+}
+
+func (r *fakeWorkspaceRepository) GetByName(_ context.Context, name string) (*repository.Workspace, error) {
+	if name == r.workspace.Name {
+		return r.workspace, nil
+	}
+	return nil, nil
+}
+
+// fakeConversationRepository 只接受写入的对话仓库
+type fakeConversationRepository struct {
+	repository.ConversationRepository
+}
+
+func (r *fakeConversationRepository) Create(_ context.Context, conv *repository.Conversation) (*repository.Conversation, error) {
+	created := *conv
+	created.ID = 1
+	return &created, nil
+}
+
+func (r *fakeConversationRepository) AppendTurns(_ context.Context, _ int64, _ []*repository.ConversationTurn) error {
+	return nil
+}
+
+// fakeGenerationRunRepository 只接受写入的模型调用记录仓库
+type fakeGenerationRunRepository struct {
+	repository.GenerationRunRepository
+}
+
+func (r *fakeGenerationRunRepository) Create(_ context.Context, run *repository.GenerationRun) (*repository.GenerationRun, error) {
+	created := *run
+	created.ID = 1
+	return &created, nil
+}
+
+// fakeJobRepository 内存中的任务仓库
+type fakeJobRepository struct {
+	mu   sync.Mutex
+	jobs map[int64]*repository.Job
+}
+
+func newFakeJobRepository() *fakeJobRepository {
+	return &fakeJobRepository{jobs: make(map[int64]*repository.Job)}
+}
+
+func (r *fakeJobRepository) Create(_ context.Context, job *repository.Job) (*repository.Job, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	created := *job
+	created.ID = int64(len(r.jobs) + 1)
+	created.Status = repository.JobStatusQueued
+	created.CreatedAt = time.Now()
+	r.jobs[created.ID] = &created
+	result := created
+	return &result, nil
+}
+
+func (r *fakeJobRepository) GetByID(_ context.Context, id int64) (*repository.Job, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	job, ok := r.jobs[id]
+	if !ok {
+		return nil, nil
+	}
+	result := *job
+	return &result, nil
+}
+
+func (r *fakeJobRepository) ClaimNext(_ context.Context, claimedBy string, excludeModels []string) (*repository.Job, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for id := int64(1); id <= int64(len(r.jobs)); id++ {
+		if job := r.jobs[id]; job.Status == repository.JobStatusQueued && !slices.Contains(excludeModels, job.Model) {
+			now := time.Now()
+			job.Status = repository.JobStatusRunning
+			job.ClaimedBy = claimedBy
+			job.HeartbeatAt = &now
+			result := *job
+			return &result, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *fakeJobRepository) Heartbeat(_ context.Context, claimedBy string, ids []int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	for _, id := range ids {
+		if job := r.jobs[id]; job.Status == repository.JobStatusRunning && job.ClaimedBy == claimedBy {
+			job.HeartbeatAt = &now
+		}
+	}
+	return nil
+}
+
+func (r *fakeJobRepository) transition(id int64, to string, from ...string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	job, ok := r.jobs[id]
+	if !ok {
+		return false
+	}
+	for _, status := range from {
+		if job.Status == status {
+			job.Status = to
+			return true
+		}
+	}
+	return false
+}
+
+func (r *fakeJobRepository) MarkFinished(_ context.Context, id int64, claimedBy string, status string, result json.RawMessage, errMsg string) error {
+	r.mu.Lock()
+	claimed := r.jobs[id].ClaimedBy == claimedBy
+	r.mu.Unlock()
+	if claimed && r.transition(id, status, repository.JobStatusRunning) {
+		r.mu.Lock()
+		r.jobs[id].Result = result
+		r.jobs[id].Error = errMsg
+		r.mu.Unlock()
+	}
+	return nil
+}
+
+func (r *fakeJobRepository) Cancel(_ context.Context, id int64) (bool, error) {
+	return r.transition(id, repository.JobStatusCancelled, repository.JobStatusQueued, repository.JobStatusRunning), nil
+}
+
+func (r *fakeJobRepository) RequeueStale(_ context.Context, timeout time.Duration) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var requeued int64
+	for _, job := range r.jobs {
+		if job.Status == repository.JobStatusRunning && (job.HeartbeatAt == nil || time.Since(*job.HeartbeatAt) > timeout) {
+			job.Status = repository.JobStatusQueued
+			job.ClaimedBy = ""
+			job.HeartbeatAt = nil
+			requeued++
+		}
+	}
+	return requeued, nil
+}
+
+// queued 返回排队中的任务数
+func (r *fakeJobRepository) queued() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	count := 0
+	for _, job := range r.jobs {
+		if job.Status == repository.JobStatusQueued {
+			count++
+		}
+	}
+	return count
+}
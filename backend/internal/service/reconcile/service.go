@@ -0,0 +1,314 @@
+package reconcile
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/guixu633/agent/backend/internal/config"
+	"github.com/guixu633/agent/backend/internal/repository"
+	"github.com/guixu633/agent/backend/internal/storage"
+	"github.com/guixu633/agent/backend/pkg/thumbnail"
+)
+
+// maxPutAttempts 写入缩略图时尝试的路径数（路径已被占用时添加序号）
+const maxPutAttempts = 10
+
+// 不一致问题类型
+const (
+	IssueOrphanObject     = "orphan_object"     // 存储中有文件但没有对应的图片记录
+	IssueMissingObject    = "missing_object"    // 图片记录对应的原图文件不存在
+	IssueMissingThumbnail = "missing_thumbnail" // 原图存在但缺少缩略图
+)
+
+// Issue 一条不一致问题
+type Issue struct {
+	Kind      string `json:"kind"`
+	Workspace string `json:"workspace"`
+	Path      string `json:"path"`               // 相关的对象路径
+	ImageID   int64  `json:"image_id,omitempty"` // 相关的图片记录（孤立文件为 0）
+	Repaired  bool   `json:"repaired"`
+	Error     string `json:"error,omitempty"` // 修复失败的原因
+}
+
+// Report 一次巡检的结果
+type Report struct {
+	DryRun     bool      `json:"dry_run"`
+	Workspaces int       `json:"workspaces"` // 检查的工作区数
+	Objects    int       `json:"objects"`    // 检查的文件数
+	Images     int       `json:"images"`     // 检查的图片记录数
+	Issues     []Issue   `json:"issues"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+}
+
+// Count 返回指定类型的问题数量
+func (r *Report) Count(kind string) int {
+	count := 0
+	for _, issue := range r.Issues {
+		if issue.Kind == kind {
+			count++
+		}
+	}
+	return count
+}
+
+// Failed 返回修复失败的问题数量
+func (r *Report) Failed() int {
+	count := 0
+	for _, issue := range r.Issues {
+		if issue.Error != "" {
+			count++
+		}
+	}
+	return count
+}
+
+// Options 巡检参数
+type Options struct {
+	Workspace string // 只检查指定工作区，为空时检查所有工作区
+	DryRun    bool   // 只报告不修复
+}
+
+// Service 存储与 images 表的一致性巡检服务
+// 修复方式：登记删除孤立文件；删除原图丢失的图片记录（及其缩略图）；从原图重新生成缺失的缩略图。
+// 文件都通过待执行存储操作删除，由存储操作任务在路径锁内确认没有被引用后再删除，
+// 避免巡检期间被去重上传或重命名引用的文件被误删
+type Service struct {
+	store            storage.BlobStore
+	layout           storage.Layout
+	imageRepo        repository.ImageRepository
+	workspaceRepo    repository.WorkspaceRepository
+	conversationRepo repository.ConversationRepository
+	storageOpRepo    repository.StorageOpRepository
+
+	interval time.Duration
+	dryRun   bool
+	minAge   time.Duration
+	now      func() time.Time
+}
+
+// NewService 创建一致性巡检服务实例
+func NewService(store storage.BlobStore, layout storage.Layout, imageRepo repository.ImageRepository, workspaceRepo repository.WorkspaceRepository, conversationRepo repository.ConversationRepository, storageOpRepo repository.StorageOpRepository, reconcileConfig config.ReconcileConfig) *Service {
+	return &Service{
+		store:            store,
+		layout:           layout,
+		imageRepo:        imageRepo,
+		workspaceRepo:    workspaceRepo,
+		conversationRepo: conversationRepo,
+		storageOpRepo:    storageOpRepo,
+		interval:         time.Duration(reconcileConfig.Interval) * time.Second,
+		dryRun:           reconcileConfig.DryRun,
+		minAge:           time.Duration(reconcileConfig.MinAge) * time.Second,
+		now:              time.Now,
+	}
+}
+
+// Start 启动定期巡检（按配置的间隔在后台运行，ctx 取消时停止）
+func (s *Service) Start(ctx context.Context) {
+	go s.loop(ctx)
+}
+
+// loop 定期执行巡检，只记录日志
+func (s *Service) loop(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		report, err := s.Run(ctx, Options{DryRun: s.dryRun})
+		if err != nil {
+			log.Printf("存储一致性巡检失败: %v", err)
+			continue
+		}
+		if len(report.Issues) > 0 {
+			log.Printf("存储一致性巡检完成: 孤立文件 %d 个，原图丢失 %d 个，缺少缩略图 %d 个，修复失败 %d 个 (dry_run: %t)",
+				report.Count(IssueOrphanObject), report.Count(IssueMissingObject), report.Count(IssueMissingThumbnail), report.Failed(), report.DryRun)
+		}
+	}
+}
+
+// Run 执行一次巡检
+// 单个问题修复失败时记录在 Issue.Error 中并继续，只有列出工作区、文件或图片记录失败时返回错误
+func (s *Service) Run(ctx context.Context, opts Options) (*Report, error) {
+	report := &Report{DryRun: opts.DryRun, Issues: make([]Issue, 0), StartedAt: s.now()}
+
+	var workspaces []*repository.Workspace
+	if opts.Workspace != "" {
+		ws, err := s.workspaceRepo.GetByName(ctx, opts.Workspace)
+		if err != nil {
+			return nil, fmt.Errorf("获取工作区失败: %w", err)
+		}
+		if ws == nil {
+			return nil, fmt.Errorf("工作区 %s 不存在", opts.Workspace)
+		}
+		workspaces = []*repository.Workspace{ws}
+	} else {
+		var err error
+		workspaces, err = s.workspaceRepo.List(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("列出工作区失败: %w", err)
+		}
+	}
+
+	for _, ws := range workspaces {
+		if err := s.reconcileWorkspace(ctx, ws, opts.DryRun, report); err != nil {
+			return report, err
+		}
+		report.Workspaces++
+	}
+	report.FinishedAt = s.now()
+	return report, nil
+}
+
+// reconcileWorkspace 比对一个工作区目录下的文件和图片记录
+func (s *Service) reconcileWorkspace(ctx context.Context, ws *repository.Workspace, dryRun bool, report *Report) error {
+	objects, err := s.store.List(ctx, s.layout.WorkspacePrefix(ws.Name))
+	if err != nil {
+		return fmt.Errorf("列出工作区 %s 的文件失败: %w", ws.Name, err)
+	}
+	images, err := s.imageRepo.ListByWorkspace(ctx, ws.ID)
+	if err != nil {
+		return fmt.Errorf("列出工作区 %s 的图片失败: %w", ws.Name, err)
+	}
+	// 对话历史引用的文件（图片记录可能已被删除或重命名）
+	conversationPaths, err := s.conversationRepo.ListImagePaths(ctx, s.layout.WorkspacePrefix(ws.Name))
+	if err != nil {
+		return fmt.Errorf("列出工作区 %s 的对话图片失败: %w", ws.Name, err)
+	}
+	report.Objects += len(objects)
+	report.Images += len(images)
+
+	existing := make(map[string]bool, len(objects))
+	for _, object := range objects {
+		existing[object.Key] = true
+	}
+	referenced := map[string]bool{s.layout.WorkspaceMarker(ws.Name): true}
+	for _, path := range conversationPaths {
+		referenced[path] = true
+	}
+	for _, img := range images {
+		referenced[img.OSSPath] = true
+		if img.ThumbnailPath != "" {
+			referenced[img.ThumbnailPath] = true
+		}
+	}
+
+	// 没有记录的文件：跳过刚上传不久的文件（上传和写入记录之间存在时间差）
+	for _, object := range objects {
+		if referenced[object.Key] || s.now().Sub(object.LastModified) < s.minAge {
+			continue
+		}
+		issue := Issue{Kind: IssueOrphanObject, Workspace: ws.Name, Path: object.Key}
+		if !dryRun {
+			s.repair(&issue, s.storageOpRepo.Enqueue(ctx, object.Key))
+		}
+		report.Issues = append(report.Issues, issue)
+	}
+
+	// 跳过最近修改过的记录（重命名时先移动文件再更新记录）
+	for _, img := range images {
+		if s.now().Sub(img.UpdatedAt) < s.minAge {
+			continue
+		}
+		if !existing[img.OSSPath] {
+			issue := Issue{Kind: IssueMissingObject, Workspace: ws.Name, Path: img.OSSPath, ImageID: img.ID}
+			if !dryRun {
+				s.repair(&issue, s.deleteImage(ctx, img))
+			}
+			report.Issues = append(report.Issues, issue)
+			continue
+		}
+		if img.ThumbnailPath == "" || !existing[img.ThumbnailPath] {
+			issue := Issue{Kind: IssueMissingThumbnail, Workspace: ws.Name, Path: img.OSSPath, ImageID: img.ID}
+			if !dryRun {
+				s.repair(&issue, s.regenerateThumbnail(ctx, ws.Name, img))
+			}
+			report.Issues = append(report.Issues, issue)
+		}
+	}
+	return nil
+}
+
+// repair 记录修复结果
+func (s *Service) repair(issue *Issue, err error) {
+	if err != nil {
+		issue.Error = err.Error()
+		log.Printf("修复存储不一致失败 (kind: %s, path: %s): %v", issue.Kind, issue.Path, err)
+		return
+	}
+	issue.Repaired = true
+}
+
+// deleteImage 删除原图已丢失的图片记录
+// 缩略图可能被内容相同的其他记录共享，在同一事务中登记不再被引用的缩略图，由存储操作任务删除
+func (s *Service) deleteImage(ctx context.Context, img *repository.Image) error {
+	if err := s.imageRepo.DeleteWithStorageOps(ctx, img.ID, []string{img.ThumbnailPath}); err != nil {
+		return fmt.Errorf("删除图片记录失败: %w", err)
+	}
+	return nil
+}
+
+// regenerateThumbnail 从原图重新生成缩略图并更新图片记录
+// 缩略图写入不存在的路径，记录中的路径（或按命名规则的路径）已有文件时改用添加序号的路径，不覆盖其他图片的文件
+func (s *Service) regenerateThumbnail(ctx context.Context, workspace string, img *repository.Image) error {
+	data, err := storage.ReadAll(ctx, s.store, img.OSSPath)
+	if err != nil {
+		return fmt.Errorf("读取原图失败: %w", err)
+	}
+
+	thumbnailData, err := thumbnail.GenerateThumbnail(data, img.MimeType)
+	if err != nil {
+		return fmt.Errorf("生成缩略图失败: %w", err)
+	}
+
+	thumbnailPath := img.ThumbnailPath
+	if thumbnailPath == "" {
+		thumbnailPath = s.thumbnailKey(workspace, img)
+	}
+	thumbnailPath, err = s.putNewObject(ctx, thumbnailPath, thumbnailData)
+	if err != nil {
+		return fmt.Errorf("上传缩略图失败: %w", err)
+	}
+	if thumbnailPath != img.ThumbnailPath {
+		if _, err := s.imageRepo.Update(ctx, img.ID, map[string]interface{}{"thumbnail_path": thumbnailPath}); err != nil {
+			return errors.Join(fmt.Errorf("更新缩略图路径失败: %w", err), s.storageOpRepo.Enqueue(ctx, thumbnailPath))
+		}
+	}
+	return nil
+}
+
+// putNewObject 将数据写入不存在的路径，返回对象路径
+// 路径已被占用时依次尝试添加序号的文件名（如 cat_thumb (2).png）
+func (s *Service) putNewObject(ctx context.Context, key string, data []byte) (string, error) {
+	ext := path.Ext(key)
+	for n := 1; n <= maxPutAttempts; n++ {
+		candidate := key
+		if n > 1 {
+			candidate = fmt.Sprintf("%s (%d)%s", strings.TrimSuffix(key, ext), n, ext)
+		}
+		err := s.store.PutIfAbsent(ctx, candidate, bytes.NewReader(data))
+		if err == nil {
+			return candidate, nil
+		}
+		if !errors.Is(err, storage.ErrExists) {
+			return "", err
+		}
+	}
+	return "", fmt.Errorf("尝试 %d 次后仍未找到可用的存储路径", maxPutAttempts)
+}
+
+// thumbnailKey 返回图片缩略图按命名规则的对象路径
+func (s *Service) thumbnailKey(workspace string, img *repository.Image) string {
+	return s.layout.ImageKey(workspace, thumbnail.GetThumbnailFilename(path.Base(img.OSSPath)))
+}
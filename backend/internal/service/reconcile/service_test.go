@@ -0,0 +1,335 @@
+package reconcile
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/guixu633/agent/backend/internal/config"
+	"github.com/guixu633/agent/backend/internal/repository"
+	"github.com/guixu633/agent/backend/internal/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReconcile(t *testing.T) {
+	store, err := storage.NewLocalStore(t.TempDir(), "/files")
+	assert.NoError(t, err)
+	ctx := context.Background()
+
+	var buf bytes.Buffer
+	assert.NoError(t, png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 200, 100))))
+	for _, key := range []string{
+		"image/test/.keep",
+		"image/test/a.png", "image/test/a_thumb.png", // 正常
+		"image/test/b.png",       // 记录中没有缩略图路径
+		"image/test/c.png",       // 记录中的缩略图文件丢失
+		"image/test/d_thumb.png", // 原图丢失，残留缩略图
+		"image/test/orphan.png",  // 没有记录
+		"image/test/fresh.png",   // 没有记录，但刚上传
+	} {
+		assert.NoError(t, store.Put(ctx, key, bytes.NewReader(buf.Bytes())))
+	}
+
+	now := time.Now().Add(2 * time.Hour)
+	fresh := filepath.Join(store.Root(), "image", "test", "fresh.png")
+	assert.NoError(t, os.Chtimes(fresh, now, now))
+
+	old := now.Add(-2 * time.Hour)
+	imageRepo := &fakeImageRepository{images: []*repository.Image{
+		{ID: 1, OSSPath: "image/test/a.png", ThumbnailPath: "image/test/a_thumb.png", MimeType: "image/png", UpdatedAt: old},
+		{ID: 2, OSSPath: "image/test/b.png", MimeType: "image/png", UpdatedAt: old},
+		{ID: 3, OSSPath: "image/test/c.png", ThumbnailPath: "image/test/c_thumb.png", MimeType: "image/png", UpdatedAt: old},
+		{ID: 4, OSSPath: "image/test/d.png", ThumbnailPath: "image/test/d_thumb.png", MimeType: "image/png", UpdatedAt: old},
+		{ID: 5, OSSPath: "image/test/e.png", MimeType: "image/png", UpdatedAt: now}, // 刚重命名，文件尚未就位
+	}}
+	workspaceRepo := &fakeWorkspaceRepository{workspaces: []*repository.Workspace{{ID: 7, Name: "test"}}}
+	storageOpRepo := &fakeStorageOpRepository{}
+	service := NewService(store, storage.Layout{}, imageRepo, workspaceRepo, &fakeConversationRepository{}, storageOpRepo, config.ReconcileConfig{MinAge: 3600})
+	service.now = func() time.Time { return now }
+
+	issueKinds := func(report *Report) map[string]string {
+		kinds := make(map[string]string)
+		for _, issue := range report.Issues {
+			kinds[issue.Path] = issue.Kind
+		}
+		return kinds
+	}
+	expected := map[string]string{
+		"image/test/orphan.png": IssueOrphanObject,
+		"image/test/b.png":      IssueMissingThumbnail,
+		"image/test/c.png":      IssueMissingThumbnail,
+		"image/test/d.png":      IssueMissingObject,
+	}
+
+	t.Run("只报告不修复", func(t *testing.T) {
+		report, err := service.Run(ctx, Options{DryRun: true})
+		assert.NoError(t, err)
+		assert.True(t, report.DryRun)
+		assert.Equal(t, 1, report.Workspaces)
+		assert.Equal(t, 8, report.Objects)
+		assert.Equal(t, 5, report.Images)
+		assert.Equal(t, expected, issueKinds(report))
+		for _, issue := range report.Issues {
+			assert.False(t, issue.Repaired)
+		}
+
+		objects, err := store.List(ctx, "image/test/")
+		assert.NoError(t, err)
+		assert.Len(t, objects, 8)
+		assert.Empty(t, imageRepo.deleted)
+		assert.Empty(t, imageRepo.updated)
+	})
+
+	t.Run("修复", func(t *testing.T) {
+		report, err := service.Run(ctx, Options{Workspace: "test"})
+		assert.NoError(t, err)
+		assert.Equal(t, expected, issueKinds(report))
+		assert.Zero(t, report.Failed())
+		for _, issue := range report.Issues {
+			assert.True(t, issue.Repaired, issue.Path)
+		}
+
+		// 孤立文件和原图丢失的记录残留的缩略图登记到存储操作，删除原图丢失的记录，重新生成缩略图
+		assert.Equal(t, []string{"image/test/orphan.png"}, storageOpRepo.keys)
+		assert.Equal(t, []string{"image/test/d_thumb.png"}, imageRepo.storageOps)
+		// 模拟存储操作任务删除登记的文件
+		for _, key := range append(storageOpRepo.keys, imageRepo.storageOps...) {
+			assert.NoError(t, store.Delete(ctx, key))
+		}
+		objects, err := store.List(ctx, "image/test/")
+		assert.NoError(t, err)
+		keys := make([]string, 0, len(objects))
+		for _, object := range objects {
+			keys = append(keys, object.Key)
+		}
+		assert.ElementsMatch(t, []string{
+			"image/test/.keep",
+			"image/test/a.png", "image/test/a_thumb.png",
+			"image/test/b.png", "image/test/b_thumb.png",
+			"image/test/c.png", "image/test/c_thumb.png",
+			"image/test/fresh.png",
+		}, keys)
+		assert.Equal(t, []int64{4}, imageRepo.deleted)
+		assert.Equal(t, map[int64]string{2: "image/test/b_thumb.png"}, imageRepo.updated)
+
+		thumbnail, err := storage.ReadAll(ctx, store, "image/test/b_thumb.png")
+		assert.NoError(t, err)
+		decoded, err := png.Decode(bytes.NewReader(thumbnail))
+		assert.NoError(t, err)
+		assert.Equal(t, 100, decoded.Bounds().Dx())
+	})
+
+	t.Run("修复失败时记录原因", func(t *testing.T) {
+		assert.NoError(t, store.Put(ctx, "image/test/broken.png", strings.NewReader("not an image")))
+		imageRepo.images = append(imageRepo.images, &repository.Image{ID: 6, OSSPath: "image/test/broken.png", MimeType: "image/png", UpdatedAt: old})
+
+		report, err := service.Run(ctx, Options{})
+		assert.NoError(t, err)
+		assert.Len(t, report.Issues, 1)
+		assert.Equal(t, IssueMissingThumbnail, report.Issues[0].Kind)
+		assert.False(t, report.Issues[0].Repaired)
+		assert.Contains(t, report.Issues[0].Error, "生成缩略图失败")
+		assert.Equal(t, 1, report.Failed())
+	})
+
+	t.Run("工作区不存在", func(t *testing.T) {
+		_, err := service.Run(ctx, Options{Workspace: "missing"})
+		assert.EqualError(t, err, "工作区 missing 不存在")
+	})
+}
+
+func TestReconcileSharedThumbnail(t *testing.T) {
+	store, err := storage.NewLocalStore(t.TempDir(), "/files")
+	assert.NoError(t, err)
+	ctx := context.Background()
+	assert.NoError(t, store.Put(ctx, "image/test/shared_thumb.png", strings.NewReader("thumbnail")))
+
+	// 内容相同的两条记录共享原图和缩略图，原图已丢失
+	now := time.Now()
+	old := now.Add(-2 * time.Hour)
+	imageRepo := &fakeImageRepository{images: []*repository.Image{
+		{ID: 1, OSSPath: "image/test/shared.png", ThumbnailPath: "image/test/shared_thumb.png", UpdatedAt: old},
+		{ID: 2, OSSPath: "image/test/shared.png", ThumbnailPath: "image/test/shared_thumb.png", UpdatedAt: now}, // 刚修改，本次跳过
+	}}
+	workspaceRepo := &fakeWorkspaceRepository{workspaces: []*repository.Workspace{{ID: 7, Name: "test"}}}
+	storageOpRepo := &fakeStorageOpRepository{}
+	service := NewService(store, storage.Layout{}, imageRepo, workspaceRepo, &fakeConversationRepository{}, storageOpRepo, config.ReconcileConfig{MinAge: 3600})
+	service.now = func() time.Time { return now }
+
+	report, err := service.Run(ctx, Options{})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, report.Count(IssueMissingObject))
+	assert.Zero(t, report.Failed())
+	assert.Equal(t, []int64{1}, imageRepo.deleted)
+
+	// 缩略图仍被另一条记录引用，不删除也不登记
+	assert.Empty(t, imageRepo.storageOps)
+	_, err = store.Stat(ctx, "image/test/shared_thumb.png")
+	assert.NoError(t, err)
+
+	// 最后一条引用被删除时登记删除缩略图
+	service.now = func() time.Time { return now.Add(2 * time.Hour) }
+	_, err = service.Run(ctx, Options{})
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{1, 2}, imageRepo.deleted)
+	assert.Equal(t, []string{"image/test/shared_thumb.png"}, imageRepo.storageOps)
+}
+
+func TestReconcileConversationImages(t *testing.T) {
+	store, err := storage.NewLocalStore(t.TempDir(), "/files")
+	assert.NoError(t, err)
+	ctx := context.Background()
+	for _, key := range []string{"image/test/history.png", "image/test/orphan.png"} {
+		assert.NoError(t, store.Put(ctx, key, strings.NewReader("data")))
+	}
+
+	// 图片记录已删除，但对话历史仍引用 history.png
+	conversationRepo := &fakeConversationRepository{paths: []string{"image/test/history.png", "image/other/a.png"}}
+	workspaceRepo := &fakeWorkspaceRepository{workspaces: []*repository.Workspace{{ID: 7, Name: "test"}}}
+	storageOpRepo := &fakeStorageOpRepository{}
+	service := NewService(store, storage.Layout{}, &fakeImageRepository{}, workspaceRepo, conversationRepo, storageOpRepo, config.ReconcileConfig{MinAge: 3600})
+	service.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+
+	report, err := service.Run(ctx, Options{})
+	assert.NoError(t, err)
+	assert.Len(t, report.Issues, 1)
+	assert.Equal(t, "image/test/orphan.png", report.Issues[0].Path)
+	assert.True(t, report.Issues[0].Repaired)
+	assert.Equal(t, []string{"image/test/orphan.png"}, storageOpRepo.keys)
+
+	data, err := storage.ReadAll(ctx, store, "image/test/history.png")
+	assert.NoError(t, err)
+	assert.Equal(t, "data", string(data))
+}
+
+func TestReconcileThumbnailConflict(t *testing.T) {
+	store, err := storage.NewLocalStore(t.TempDir(), "/files")
+	assert.NoError(t, err)
+	ctx := context.Background()
+
+	var buf bytes.Buffer
+	assert.NoError(t, png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 20, 20))))
+	for _, key := range []string{"image/test/g.png", "image/test/h.png"} {
+		assert.NoError(t, store.Put(ctx, key, bytes.NewReader(buf.Bytes())))
+	}
+	// 按命名规则的缩略图路径已被其他图片使用
+	assert.NoError(t, store.Put(ctx, "image/test/g_thumb.png", strings.NewReader("other")))
+
+	old := time.Now().Add(-2 * time.Hour)
+	imageRepo := &fakeImageRepository{images: []*repository.Image{
+		{ID: 1, OSSPath: "image/test/g.png", MimeType: "image/png", UpdatedAt: old},
+		{ID: 2, OSSPath: "image/test/h.png", ThumbnailPath: "image/test/g_thumb.png", MimeType: "image/png", UpdatedAt: old},
+	}}
+	workspaceRepo := &fakeWorkspaceRepository{workspaces: []*repository.Workspace{{ID: 7, Name: "test"}}}
+	service := NewService(store, storage.Layout{}, imageRepo, workspaceRepo, &fakeConversationRepository{}, &fakeStorageOpRepository{}, config.ReconcileConfig{MinAge: 3600})
+
+	report, err := service.Run(ctx, Options{})
+	assert.NoError(t, err)
+	assert.Zero(t, report.Failed())
+	assert.Equal(t, map[int64]string{1: "image/test/g_thumb (2).png"}, imageRepo.updated)
+
+	data, err := storage.ReadAll(ctx, store, "image/test/g_thumb.png")
+	assert.NoError(t, err)
+	assert.Equal(t, "other", string(data))
+	_, err = storage.ReadAll(ctx, store, "image/test/g_thumb (2).png")
+	assert.NoError(t, err)
+}
+
+type fakeWorkspaceRepository struct {
+	repository.WorkspaceRepository
+	workspaces []*repository.Workspace
+}
+
+func (r *fakeWorkspaceRepository) GetByName(_ context.Context, name string) (*repository.Workspace, error) {
+	for _, ws := range r.workspaces {
+		if ws.Name == name {
+			return ws, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *fakeWorkspaceRepository) List(_ context.Context) ([]*repository.Workspace, error) {
+	return r.workspaces, nil
+}
+
+type fakeImageRepository struct {
+	repository.ImageRepository
+	images     []*repository.Image
+	deleted    []int64
+	updated    map[int64]string
+	storageOps []string // 删除记录时登记的不再被引用的文件
+}
+
+func (r *fakeImageRepository) ListByWorkspace(_ context.Context, _ int64) ([]*repository.Image, error) {
+	return r.images, nil
+}
+
+func (r *fakeImageRepository) DeleteWithStorageOps(_ context.Context, id int64, keys []string) error {
+	r.deleted = append(r.deleted, id)
+	images := r.images[:0]
+	for _, img := range r.images {
+		if img.ID != id {
+			images = append(images, img)
+		}
+	}
+	r.images = images
+
+	for _, key := range keys {
+		referenced := false
+		for _, img := range r.images {
+			referenced = referenced || img.OSSPath == key || img.ThumbnailPath == key
+		}
+		if key != "" && !referenced {
+			r.storageOps = append(r.storageOps, key)
+		}
+	}
+	return nil
+}
+
+func (r *fakeImageRepository) Update(_ context.Context, id int64, updates map[string]interface{}) (*repository.Image, error) {
+	if r.updated == nil {
+		r.updated = make(map[int64]string)
+	}
+	for _, img := range r.images {
+		if img.ID == id {
+			img.ThumbnailPath = updates["thumbnail_path"].(string)
+			r.updated[id] = img.ThumbnailPath
+			return img, nil
+		}
+	}
+	return nil, nil
+}
+
+// fakeConversationRepository 返回对话历史引用的图片路径
+type fakeConversationRepository struct {
+	repository.ConversationRepository
+	paths []string
+}
+
+func (r *fakeConversationRepository) ListImagePaths(_ context.Context, prefix string) ([]string, error) {
+	paths := make([]string, 0)
+	for _, path := range r.paths {
+		if strings.HasPrefix(path, prefix) {
+			paths = append(paths, path)
+		}
+	}
+	return paths, nil
+}
+
+// fakeStorageOpRepository 记录登记删除的文件
+type fakeStorageOpRepository struct {
+	repository.StorageOpRepository
+	keys []string
+}
+
+func (r *fakeStorageOpRepository) Enqueue(_ context.Context, keys ...string) error {
+	r.keys = append(r.keys, keys...)
+	return nil
+}
@@ -0,0 +1,202 @@
+package storageop
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/guixu633/agent/backend/internal/config"
+	"github.com/guixu633/agent/backend/internal/model"
+	"github.com/guixu633/agent/backend/internal/repository"
+	"github.com/guixu633/agent/backend/internal/storage"
+)
+
+const (
+	defaultListLimit = 100
+	maxListLimit     = 1000
+)
+
+var (
+	// ErrStorageOpNotFound 操作不存在或不处于失败状态
+	ErrStorageOpNotFound = errors.New("存储操作不存在或未失败")
+	// ErrInvalidStatus 不支持的状态过滤条件
+	ErrInvalidStatus = errors.New("状态必须为 pending 或 failed")
+)
+
+// Service 待执行存储操作服务
+// 删除图片记录时在同一事务中登记待删除的文件，后台任务按登记顺序执行，
+// 失败后按指数退避重试，超过最大尝试次数后标记为 failed，可通过管理接口查看和重新排队。
+// 多个服务实例可以同时处理：每批操作由一个实例领取（在租约时间内其他实例不会领取）
+type Service struct {
+	store         storage.BlobStore
+	storageOpRepo repository.StorageOpRepository
+	imageRepo     repository.ImageRepository
+
+	pollInterval   time.Duration
+	batchSize      int
+	maxAttempts    int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	lease          time.Duration
+}
+
+// NewService 创建待执行存储操作服务实例
+func NewService(store storage.BlobStore, storageOpRepo repository.StorageOpRepository, imageRepo repository.ImageRepository, storageOpsConfig config.StorageOpsConfig) *Service {
+	return &Service{
+		store:          store,
+		storageOpRepo:  storageOpRepo,
+		imageRepo:      imageRepo,
+		pollInterval:   time.Duration(storageOpsConfig.PollInterval) * time.Second,
+		batchSize:      storageOpsConfig.BatchSize,
+		maxAttempts:    storageOpsConfig.MaxAttempts,
+		initialBackoff: time.Duration(storageOpsConfig.InitialBackoff) * time.Second,
+		maxBackoff:     time.Duration(storageOpsConfig.MaxBackoff) * time.Second,
+		lease:          time.Duration(storageOpsConfig.Lease) * time.Second,
+	}
+}
+
+// Start 启动后台任务（ctx 取消时停止）
+func (s *Service) Start(ctx context.Context) {
+	go s.loop(ctx)
+}
+
+// loop 定期处理到达执行时间的操作
+func (s *Service) loop(ctx context.Context) {
+	ticker := time.NewTicker(s.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		s.ProcessDue(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ProcessDue 领取并执行一批到达执行时间的操作，返回执行成功的数量
+func (s *Service) ProcessDue(ctx context.Context) int {
+	ops, err := s.storageOpRepo.ClaimDue(ctx, s.batchSize, s.lease)
+	if err != nil {
+		log.Printf("获取待执行存储操作失败: %v", err)
+		return 0
+	}
+
+	done := 0
+	for _, op := range ops {
+		if ctx.Err() != nil {
+			break
+		}
+		if err := s.execute(ctx, op); err != nil {
+			s.recordFailure(ctx, op, err)
+			continue
+		}
+		if err := s.storageOpRepo.Complete(ctx, op.ID); err != nil {
+			log.Printf("删除已完成的存储操作失败 (id: %d): %v", op.ID, err)
+			continue
+		}
+		done++
+	}
+	return done
+}
+
+// execute 执行一个存储操作
+func (s *Service) execute(ctx context.Context, op *repository.StorageOp) error {
+	if op.Op != repository.StorageOpDelete {
+		return fmt.Errorf("不支持的存储操作: %s", op.Op)
+	}
+
+	// 登记后同一路径可能又上传了新图片（如删除后重新上传同名文件或上传内容相同的图片），此时不能删除
+	// 删除完成前持有路径锁，去重上传不会在确认引用后、删除前引用该文件
+	referenced, unlock, err := s.imageRepo.LockPath(ctx, op.ObjectKey)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if referenced {
+		return nil
+	}
+	return s.store.Delete(ctx, op.ObjectKey)
+}
+
+// recordFailure 记录失败原因，未超过最大尝试次数时按指数退避安排重试
+func (s *Service) recordFailure(ctx context.Context, op *repository.StorageOp, cause error) {
+	attempts := op.Attempts + 1
+	var err error
+	if attempts >= s.maxAttempts {
+		log.Printf("存储操作多次失败，不再重试 (id: %d, key: %s): %v", op.ID, op.ObjectKey, cause)
+		err = s.storageOpRepo.Fail(ctx, op.ID, cause.Error())
+	} else {
+		err = s.storageOpRepo.Retry(ctx, op.ID, cause.Error(), s.backoff(attempts))
+	}
+	if err != nil {
+		log.Printf("记录存储操作失败原因失败 (id: %d): %v", op.ID, err)
+	}
+}
+
+// backoff 返回第 attempts 次失败后的退避时间（每次翻倍，不超过上限）
+func (s *Service) backoff(attempts int) time.Duration {
+	delay := s.initialBackoff
+	for i := 1; i < attempts && delay < s.maxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, s.maxBackoff)
+}
+
+// ListOps 列出存储操作及各状态的数量
+func (s *Service) ListOps(ctx context.Context, req *model.ListStorageOpsRequest) (*model.ListStorageOpsResponse, error) {
+	switch req.Status {
+	case "", repository.StorageOpStatusPending, repository.StorageOpStatusFailed:
+	default:
+		return nil, ErrInvalidStatus
+	}
+	limit := req.Limit
+	if limit <= 0 {
+		limit = defaultListLimit
+	}
+	limit = min(limit, maxListLimit)
+
+	counts, err := s.storageOpRepo.CountByStatus(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ops, err := s.storageOpRepo.List(ctx, req.Status, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]model.StorageOp, 0, len(ops))
+	for _, op := range ops {
+		items = append(items, model.StorageOp{
+			ID:            op.ID,
+			Op:            op.Op,
+			ObjectKey:     op.ObjectKey,
+			Status:        op.Status,
+			Attempts:      op.Attempts,
+			LastError:     op.LastError,
+			NextAttemptAt: op.NextAttemptAt.Format(time.RFC3339),
+			CreatedAt:     op.CreatedAt.Format(time.RFC3339),
+		})
+	}
+	return &model.ListStorageOpsResponse{
+		Pending: counts[repository.StorageOpStatusPending],
+		Failed:  counts[repository.StorageOpStatusFailed],
+		Items:   items,
+	}, nil
+}
+
+// RetryOp 将失败的操作重新排队，下次轮询时执行
+func (s *Service) RetryOp(ctx context.Context, id int64) error {
+	ok, err := s.storageOpRepo.Requeue(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrStorageOpNotFound
+	}
+	return nil
+}
@@ -0,0 +1,179 @@
+package storageop
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/guixu633/agent/backend/internal/config"
+	"github.com/guixu633/agent/backend/internal/model"
+	"github.com/guixu633/agent/backend/internal/repository"
+	"github.com/guixu633/agent/backend/internal/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProcessDue(t *testing.T) {
+	store := &fakeBlobStore{}
+	storageOpRepo := &fakeStorageOpRepository{}
+	imageRepo := &fakeImageRepository{referenced: map[string]bool{"image/test/reused.png": true}}
+	service := NewService(store, storageOpRepo, imageRepo, config.StorageOpsConfig{BatchSize: 10, MaxAttempts: 3, InitialBackoff: 10, MaxBackoff: 15, Lease: 60})
+	ctx := context.Background()
+
+	assert.NoError(t, storageOpRepo.Enqueue(ctx, "image/test/cat.png", "image/test/reused.png", "image/test/locked.png"))
+
+	// 成功删除和已被新图片引用的文件都完成；失败的按退避时间重试
+	assert.Equal(t, 2, service.ProcessDue(ctx))
+	assert.Equal(t, []string{"image/test/cat.png"}, store.deleted)
+	assert.Len(t, storageOpRepo.ops, 1)
+	op := storageOpRepo.ops[0]
+	assert.Equal(t, "image/test/locked.png", op.ObjectKey)
+	assert.Equal(t, repository.StorageOpStatusPending, op.Status)
+	assert.Equal(t, 1, op.Attempts)
+	assert.Equal(t, "access denied", op.LastError)
+	assert.Equal(t, []time.Duration{10 * time.Second}, storageOpRepo.delays)
+	assert.Equal(t, []time.Duration{time.Minute}, storageOpRepo.leases)
+
+	// 退避时间翻倍但不超过上限，达到最大尝试次数后标记为失败
+	assert.Zero(t, service.ProcessDue(ctx))
+	assert.Zero(t, service.ProcessDue(ctx))
+	assert.Equal(t, []time.Duration{10 * time.Second, 15 * time.Second}, storageOpRepo.delays)
+	assert.Equal(t, repository.StorageOpStatusFailed, op.Status)
+	assert.Equal(t, 3, op.Attempts)
+
+	// 失败的操作不再执行，重新排队后再次执行
+	assert.Zero(t, service.ProcessDue(ctx))
+	assert.Equal(t, 3, op.Attempts)
+
+	resp, err := service.ListOps(ctx, &model.ListStorageOpsRequest{Status: "failed"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), resp.Pending)
+	assert.Equal(t, int64(1), resp.Failed)
+	assert.Len(t, resp.Items, 1)
+	assert.Equal(t, "image/test/locked.png", resp.Items[0].ObjectKey)
+
+	store.unlocked = true
+	assert.NoError(t, service.RetryOp(ctx, op.ID))
+	assert.Equal(t, 1, service.ProcessDue(ctx))
+	assert.Empty(t, storageOpRepo.ops)
+
+	t.Run("操作不存在", func(t *testing.T) {
+		assert.ErrorIs(t, service.RetryOp(ctx, op.ID), ErrStorageOpNotFound)
+	})
+
+	t.Run("状态不合法", func(t *testing.T) {
+		_, err := service.ListOps(ctx, &model.ListStorageOpsRequest{Status: "done"})
+		assert.ErrorIs(t, err, ErrInvalidStatus)
+	})
+}
+
+// fakeBlobStore 记录删除的对象，路径包含 locked 的对象删除失败
+type fakeBlobStore struct {
+	storage.BlobStore
+	deleted  []string
+	unlocked bool
+}
+
+func (s *fakeBlobStore) Delete(_ context.Context, key string) error {
+	if strings.Contains(key, "locked") && !s.unlocked {
+		return errors.New("access denied")
+	}
+	s.deleted = append(s.deleted, key)
+	return nil
+}
+
+// fakeImageRepository 记录被图片引用的对象路径
+type fakeImageRepository struct {
+	repository.ImageRepository
+	referenced map[string]bool
+}
+
+func (r *fakeImageRepository) LockPath(_ context.Context, path string) (bool, func(), error) {
+	return r.referenced[path], func() {}, nil
+}
+
+// fakeStorageOpRepository 内存中的存储操作仓库（退避时间立即到期）
+type fakeStorageOpRepository struct {
+	repository.StorageOpRepository
+	ops    []*repository.StorageOp
+	nextID int64
+	delays []time.Duration
+	leases []time.Duration // 领取操作时的租约时间
+}
+
+func (r *fakeStorageOpRepository) Enqueue(_ context.Context, keys ...string) error {
+	for _, key := range keys {
+		r.nextID++
+		r.ops = append(r.ops, &repository.StorageOp{ID: r.nextID, Op: repository.StorageOpDelete, ObjectKey: key, Status: repository.StorageOpStatusPending})
+	}
+	return nil
+}
+
+func (r *fakeStorageOpRepository) ClaimDue(_ context.Context, limit int, lease time.Duration) ([]*repository.StorageOp, error) {
+	r.leases = append(r.leases, lease)
+	return r.List(context.Background(), repository.StorageOpStatusPending, limit)
+}
+
+func (r *fakeStorageOpRepository) List(_ context.Context, status string, limit int) ([]*repository.StorageOp, error) {
+	ops := make([]*repository.StorageOp, 0)
+	for _, op := range r.ops {
+		if (status == "" || op.Status == status) && len(ops) < limit {
+			ops = append(ops, op)
+		}
+	}
+	return ops, nil
+}
+
+func (r *fakeStorageOpRepository) CountByStatus(_ context.Context) (map[string]int64, error) {
+	counts := make(map[string]int64)
+	for _, op := range r.ops {
+		counts[op.Status]++
+	}
+	return counts, nil
+}
+
+func (r *fakeStorageOpRepository) Complete(_ context.Context, id int64) error {
+	for i, op := range r.ops {
+		if op.ID == id {
+			r.ops = append(r.ops[:i], r.ops[i+1:]...)
+			return nil
+		}
+	}
+	return nil
+}
+
+func (r *fakeStorageOpRepository) Retry(_ context.Context, id int64, errMsg string, delay time.Duration) error {
+	r.delays = append(r.delays, delay)
+	op := r.get(id)
+	op.Attempts++
+	op.LastError = errMsg
+	return nil
+}
+
+func (r *fakeStorageOpRepository) Fail(_ context.Context, id int64, errMsg string) error {
+	op := r.get(id)
+	op.Attempts++
+	op.LastError = errMsg
+	op.Status = repository.StorageOpStatusFailed
+	return nil
+}
+
+func (r *fakeStorageOpRepository) Requeue(_ context.Context, id int64) (bool, error) {
+	op := r.get(id)
+	if op == nil || op.Status != repository.StorageOpStatusFailed {
+		return false, nil
+	}
+	op.Status = repository.StorageOpStatusPending
+	op.Attempts = 0
+	return true, nil
+}
+
+func (r *fakeStorageOpRepository) get(id int64) *repository.StorageOp {
+	for _, op := range r.ops {
+		if op.ID == id {
+			return op
+		}
+	}
+	return nil
+}
@@ -2,25 +2,41 @@ package workspace
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log"
+	"strings"
 	"time"
 
 	"github.com/guixu633/agent/backend/internal/model"
-	"github.com/guixu633/agent/backend/internal/oss"
 	"github.com/guixu633/agent/backend/internal/repository"
+	"github.com/guixu633/agent/backend/internal/storage"
 )
 
+// ErrDeleteIncomplete 工作区中有文件删除失败（工作区记录被保留）
+var ErrDeleteIncomplete = errors.New("部分工作区文件删除失败")
+
 // Service 工作区服务
 type Service struct {
-	ossClient        *oss.Client
-	workspaceRepo    repository.WorkspaceRepository
+	store         storage.BlobStore
+	layout        storage.Layout
+	workspaceRepo repository.WorkspaceRepository
+	runRepo       repository.GenerationRunRepository
+
+	now func() time.Time // 当前时间（Asia/Shanghai，用于确定用量报表的默认日期）
 }
 
 // NewService 创建工作区服务实例
-func NewService(ossClient *oss.Client, workspaceRepo repository.WorkspaceRepository) *Service {
+func NewService(store storage.BlobStore, layout storage.Layout, workspaceRepo repository.WorkspaceRepository, runRepo repository.GenerationRunRepository) *Service {
 	return &Service{
-		ossClient:     ossClient,
+		store:         store,
+		layout:        layout,
 		workspaceRepo: workspaceRepo,
+		runRepo:       runRepo,
+		now: func() time.Time {
+			// 与数据库连接时区保持一致，使用 FixedZone 避免依赖系统 tzdata
+			return time.Now().In(time.FixedZone("Asia/Shanghai", 8*3600))
+		},
 	}
 }
 
@@ -68,12 +84,12 @@ func (s *Service) CreateWorkspace(ctx context.Context, req *model.CreateWorkspac
 		return nil, fmt.Errorf("创建工作区失败: %w", err)
 	}
 
-	// 在 OSS 中创建工作区目录（用于存储文件）
-	err = s.ossClient.CreateWorkspace(req.Name)
+	// 在存储中创建工作区目录（写入空的目录标记文件）
+	err = s.store.Put(ctx, s.layout.WorkspaceMarker(req.Name), strings.NewReader(""))
 	if err != nil {
-		// 如果 OSS 创建失败，删除数据库记录（回滚）
+		// 如果创建目录失败，删除数据库记录（回滚）
 		s.workspaceRepo.Delete(ctx, dbWorkspace.ID)
-		return nil, fmt.Errorf("在 OSS 创建工作区目录失败: %w", err)
+		return nil, fmt.Errorf("在存储中创建工作区目录失败: %w", err)
 	}
 
 	return &model.CreateWorkspaceResponse{
@@ -139,33 +155,43 @@ func (s *Service) GetCurrentWorkspace(ctx context.Context) (*model.GetCurrentWor
 }
 
 // DeleteWorkspace 删除工作区
-func (s *Service) DeleteWorkspace(ctx context.Context, req *model.DeleteWorkspaceRequest) error {
+// 返回存储中文件的删除结果；有文件删除失败时保留工作区记录并返回 ErrDeleteIncomplete，可以重试删除
+func (s *Service) DeleteWorkspace(ctx context.Context, req *model.DeleteWorkspaceRequest) (*model.DeleteWorkspaceResponse, error) {
 	// 验证工作区名称
 	if req.Name == "" {
-		return fmt.Errorf("工作区名称不能为空")
+		return nil, fmt.Errorf("工作区名称不能为空")
 	}
 
 	// 获取工作区信息
 	ws, err := s.workspaceRepo.GetByName(ctx, req.Name)
 	if err != nil {
-		return fmt.Errorf("获取工作区失败: %w", err)
+		return nil, fmt.Errorf("获取工作区失败: %w", err)
 	}
 	if ws == nil {
-		return fmt.Errorf("工作区 %s 不存在", req.Name)
+		return nil, fmt.Errorf("工作区 %s 不存在", req.Name)
 	}
 
-	// 先删除 OSS 中的文件（级联删除会删除数据库中的图片记录）
-	err = s.ossClient.DeleteWorkspace(req.Name)
+	// 先删除存储中的文件（级联删除会删除数据库中的图片记录）
+	result, err := s.store.DeletePrefix(ctx, s.layout.WorkspacePrefix(req.Name), func(progress storage.DeleteResult) {
+		log.Printf("删除工作区 %s 的文件: 已删除 %d 个，失败 %d 个", req.Name, progress.Deleted, len(progress.Failed))
+	})
+	resp := &model.DeleteWorkspaceResponse{
+		DeletedObjects: result.Deleted,
+		FailedObjects:  len(result.Failed),
+		FailedKeys:     result.Failed,
+	}
 	if err != nil {
-		return fmt.Errorf("删除 OSS 工作区文件失败: %w", err)
+		return resp, fmt.Errorf("删除工作区文件失败: %w", err)
+	}
+	if len(result.Failed) > 0 {
+		return resp, fmt.Errorf("%w: %d 个文件删除失败", ErrDeleteIncomplete, len(result.Failed))
 	}
 
 	// 删除数据库记录（级联删除会删除关联的图片记录）
 	err = s.workspaceRepo.Delete(ctx, ws.ID)
 	if err != nil {
-		return fmt.Errorf("删除工作区记录失败: %w", err)
+		return resp, fmt.Errorf("删除工作区记录失败: %w", err)
 	}
 
-	return nil
+	return resp, nil
 }
-
@@ -0,0 +1,134 @@
+package workspace
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/guixu633/agent/backend/internal/model"
+	"github.com/guixu633/agent/backend/internal/repository"
+	"github.com/guixu633/agent/backend/internal/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetUsage(t *testing.T) {
+	day1 := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	day2 := time.Date(2025, 3, 2, 0, 0, 0, 0, time.UTC)
+	runRepo := &fakeGenerationRunRepository{rows: []*repository.UsageRow{
+		{Day: day1, Model: "gemini", Runs: 2, FailedRuns: 1, PromptTokens: 10, CandidatesTokens: 20, TotalTokens: 30, ImageCount: 1, Cost: 0.5},
+		{Day: day2, Model: "gemini", Runs: 1, PromptTokens: 5, CandidatesTokens: 5, ThoughtsTokens: 2, TotalTokens: 12, ImageCount: 2, Cost: 0.25},
+	}}
+	service := NewService(nil, storage.Layout{}, &fakeWorkspaceRepository{workspace: &repository.Workspace{ID: 7, Name: "test"}}, runRepo)
+	service.now = func() time.Time { return time.Date(2025, 3, 31, 23, 0, 0, 0, time.UTC) }
+	ctx := context.Background()
+
+	resp, err := service.GetUsage(ctx, &model.WorkspaceUsageRequest{Workspace: "test"})
+	assert.NoError(t, err)
+
+	// 默认统计最近 30 天（含今天）
+	assert.Equal(t, "2025-03-02", resp.From)
+	assert.Equal(t, "2025-03-31", resp.To)
+	assert.Equal(t, int64(7), runRepo.workspaceID)
+	assert.Equal(t, [2]string{"2025-03-02", "2025-03-31"}, runRepo.dateRange)
+
+	assert.Equal(t, "USD", resp.Currency)
+	assert.Len(t, resp.Items, 2)
+	assert.Equal(t, "2025-03-01", resp.Items[0].Date)
+	assert.Equal(t, "gemini", resp.Items[0].Model)
+	assert.Equal(t, model.UsageSummary{
+		Runs:             3,
+		FailedRuns:       1,
+		PromptTokens:     15,
+		CandidatesTokens: 25,
+		ThoughtsTokens:   2,
+		TotalTokens:      42,
+		ImageCount:       3,
+		Cost:             0.75,
+	}, resp.Total)
+
+	t.Run("日期范围不合法", func(t *testing.T) {
+		for _, req := range []*model.WorkspaceUsageRequest{
+			{Workspace: "test", From: "2025/03/01"},
+			{Workspace: "test", From: "2025-03-10", To: "2025-03-01"},
+			{Workspace: "test", From: "2023-01-01", To: "2025-03-01"},
+		} {
+			_, err := service.GetUsage(ctx, req)
+			assert.ErrorIs(t, err, ErrInvalidUsageRange)
+		}
+	})
+
+	t.Run("工作区不存在", func(t *testing.T) {
+		_, err := service.GetUsage(ctx, &model.WorkspaceUsageRequest{Workspace: "missing"})
+		assert.EqualError(t, err, "工作区 missing 不存在")
+	})
+}
+
+func TestDeleteWorkspace(t *testing.T) {
+	store := &fakeBlobStore{result: storage.DeleteResult{Deleted: 3, Failed: []string{"image/test/locked.png"}}}
+	workspaceRepo := &fakeWorkspaceRepository{workspace: &repository.Workspace{ID: 7, Name: "test"}}
+	service := NewService(store, storage.Layout{}, workspaceRepo, &fakeGenerationRunRepository{})
+	ctx := context.Background()
+
+	// 有文件删除失败时保留工作区记录
+	resp, err := service.DeleteWorkspace(ctx, &model.DeleteWorkspaceRequest{Name: "test"})
+	assert.ErrorIs(t, err, ErrDeleteIncomplete)
+	assert.Equal(t, "image/test/", store.prefix)
+	assert.Equal(t, 3, resp.DeletedObjects)
+	assert.Equal(t, 1, resp.FailedObjects)
+	assert.Equal(t, []string{"image/test/locked.png"}, resp.FailedKeys)
+	assert.Zero(t, workspaceRepo.deleted)
+
+	// 重试删除成功后删除工作区记录
+	store.result = storage.DeleteResult{Deleted: 1}
+	resp, err = service.DeleteWorkspace(ctx, &model.DeleteWorkspaceRequest{Name: "test"})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, resp.DeletedObjects)
+	assert.Equal(t, int64(7), workspaceRepo.deleted)
+}
+
+// fakeBlobStore 按前缀删除时返回固定结果的存储
+type fakeBlobStore struct {
+	storage.BlobStore
+	result storage.DeleteResult
+	prefix string
+}
+
+func (s *fakeBlobStore) DeletePrefix(_ context.Context, prefix string, progress storage.DeleteProgress) (*storage.DeleteResult, error) {
+	s.prefix = prefix
+	progress(s.result)
+	result := s.result
+	return &result, nil
+}
+
+// fakeWorkspaceRepository 只包含一个工作区的内存仓库
+type fakeWorkspaceRepository struct {
+	repository.WorkspaceRepository
+	workspace *repository.Workspace
+	deleted   int64 // 被删除的工作区 ID
+}
+
+func (r *fakeWorkspaceRepository) Delete(_ context.Context, id int64) error {
+	r.deleted = id
+	return nil
+}
+
+func (r *fakeWorkspaceRepository) GetByName(_ context.Context, name string) (*repository.Workspace, error) {
+	if name == r.workspace.Name {
+		return r.workspace, nil
+	}
+	return nil, nil
+}
+
+// fakeGenerationRunRepository 返回固定用量数据的仓库，记录查询参数
+type fakeGenerationRunRepository struct {
+	repository.GenerationRunRepository
+	rows        []*repository.UsageRow
+	workspaceID int64
+	dateRange   [2]string
+}
+
+func (r *fakeGenerationRunRepository) UsageByWorkspace(_ context.Context, workspaceID int64, from, to string) ([]*repository.UsageRow, error) {
+	r.workspaceID = workspaceID
+	r.dateRange = [2]string{from, to}
+	return r.rows, nil
+}
@@ -0,0 +1,112 @@
+package workspace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/guixu633/agent/backend/internal/model"
+)
+
+const (
+	// usageDateLayout 用量报表的日期格式
+	usageDateLayout = "2006-01-02"
+	// defaultUsageDays 未指定日期范围时统计的天数（含今天）
+	defaultUsageDays = 30
+	// maxUsageDays 一次最多统计的天数
+	maxUsageDays = 366
+)
+
+// ErrInvalidUsageRange 用量查询的日期范围不合法
+var ErrInvalidUsageRange = errors.New("日期范围不合法")
+
+// GetUsage 按天和模型汇总工作区的 token 用量和估算成本
+func (s *Service) GetUsage(ctx context.Context, req *model.WorkspaceUsageRequest) (*model.WorkspaceUsageResponse, error) {
+	from, to, err := usageRange(req.From, req.To, s.now())
+	if err != nil {
+		return nil, err
+	}
+
+	ws, err := s.workspaceRepo.GetByName(ctx, req.Workspace)
+	if err != nil {
+		return nil, fmt.Errorf("获取工作区失败: %w", err)
+	}
+	if ws == nil {
+		return nil, fmt.Errorf("工作区 %s 不存在", req.Workspace)
+	}
+
+	rows, err := s.runRepo.UsageByWorkspace(ctx, ws.ID, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]model.UsageItem, 0, len(rows))
+	var total model.UsageSummary
+	for _, row := range rows {
+		summary := model.UsageSummary{
+			Runs:             row.Runs,
+			FailedRuns:       row.FailedRuns,
+			PromptTokens:     row.PromptTokens,
+			CandidatesTokens: row.CandidatesTokens,
+			ThoughtsTokens:   row.ThoughtsTokens,
+			TotalTokens:      row.TotalTokens,
+			ImageCount:       row.ImageCount,
+			Cost:             row.Cost,
+		}
+		items = append(items, model.UsageItem{
+			Date:         row.Day.Format(usageDateLayout),
+			Model:        row.Model,
+			UsageSummary: summary,
+		})
+
+		total.Runs += summary.Runs
+		total.FailedRuns += summary.FailedRuns
+		total.PromptTokens += summary.PromptTokens
+		total.CandidatesTokens += summary.CandidatesTokens
+		total.ThoughtsTokens += summary.ThoughtsTokens
+		total.TotalTokens += summary.TotalTokens
+		total.ImageCount += summary.ImageCount
+		total.Cost += summary.Cost
+	}
+
+	return &model.WorkspaceUsageResponse{
+		Workspace: ws.Name,
+		From:      from,
+		To:        to,
+		Currency:  "USD",
+		Items:     items,
+		Total:     total,
+	}, nil
+}
+
+// usageRange 解析并校验用量查询的日期范围，返回 YYYY-MM-DD 格式的开始和结束日期（均包含）
+// 未指定结束日期时为今天，未指定开始日期时为结束日期前 29 天
+func usageRange(fromStr, toStr string, now time.Time) (string, string, error) {
+	to := now
+	if toStr != "" {
+		t, err := time.Parse(usageDateLayout, toStr)
+		if err != nil {
+			return "", "", fmt.Errorf("%w: 结束日期格式应为 YYYY-MM-DD", ErrInvalidUsageRange)
+		}
+		to = t
+	}
+	to = time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, time.UTC)
+
+	from := to.AddDate(0, 0, -(defaultUsageDays - 1))
+	if fromStr != "" {
+		t, err := time.Parse(usageDateLayout, fromStr)
+		if err != nil {
+			return "", "", fmt.Errorf("%w: 开始日期格式应为 YYYY-MM-DD", ErrInvalidUsageRange)
+		}
+		from = t
+	}
+
+	if from.After(to) {
+		return "", "", fmt.Errorf("%w: 开始日期不能晚于结束日期", ErrInvalidUsageRange)
+	}
+	if to.Sub(from) >= maxUsageDays*24*time.Hour {
+		return "", "", fmt.Errorf("%w: 最多查询 %d 天", ErrInvalidUsageRange, maxUsageDays)
+	}
+	return from.Format(usageDateLayout), to.Format(usageDateLayout), nil
+}
@@ -0,0 +1,306 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// tempFilePrefix 写入过程中的临时文件前缀（List 时跳过）
+const tempFilePrefix = ".upload-"
+
+// LocalStore 本地磁盘存储，对象路径对应 root 下的相对路径
+// 文件通过 HTTP 静态路由对外提供访问，URL 为 baseURL + "/" + 对象路径
+type LocalStore struct {
+	root    string
+	baseURL string
+}
+
+// NewLocalStore 创建本地磁盘存储，root 不存在时自动创建
+func NewLocalStore(root, baseURL string) (*LocalStore, error) {
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return nil, fmt.Errorf("解析存储目录失败: %w", err)
+	}
+	if err := os.MkdirAll(absRoot, 0o755); err != nil {
+		return nil, fmt.Errorf("创建存储目录失败: %w", err)
+	}
+	return &LocalStore{
+		root:    absRoot,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+	}, nil
+}
+
+// Root 返回存储根目录的绝对路径
+func (s *LocalStore) Root() string {
+	return s.root
+}
+
+// Put 写入对象：先写入同目录下的临时文件再重命名，避免读到写了一半的文件
+func (s *LocalStore) Put(ctx context.Context, key string, r io.Reader) error {
+	return s.put(ctx, key, r, false)
+}
+
+// PutIfAbsent 仅在对象不存在时写入
+// 临时文件通过硬链接放到目标路径，目标已存在时链接失败，不会覆盖
+func (s *LocalStore) PutIfAbsent(ctx context.Context, key string, r io.Reader) error {
+	return s.put(ctx, key, r, true)
+}
+
+// put 写入临时文件后放到目标路径
+func (s *LocalStore) put(ctx context.Context, key string, r io.Reader, ifAbsent bool) error {
+	filename, err := s.filePath(key)
+	if err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(filename)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("创建目录失败: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(dir, tempFilePrefix+"*")
+	if err != nil {
+		return fmt.Errorf("创建临时文件失败: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return fmt.Errorf("写入文件失败: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("写入文件失败: %w", err)
+	}
+
+	if ifAbsent {
+		if err := os.Link(tmp.Name(), filename); err != nil {
+			if errors.Is(err, fs.ErrExist) {
+				return fmt.Errorf("%w: %s", ErrExists, key)
+			}
+			return fmt.Errorf("保存文件失败: %w", err)
+		}
+		return nil
+	}
+	if err := os.Rename(tmp.Name(), filename); err != nil {
+		return fmt.Errorf("保存文件失败: %w", err)
+	}
+	return nil
+}
+
+// Get 读取对象
+func (s *LocalStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	return s.open(ctx, key)
+}
+
+// GetRange 读取对象的一部分
+func (s *LocalStore) GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	f, err := s.open(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("读取文件失败: %w", err)
+	}
+	if length < 0 {
+		return f, nil
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(f, length), f}, nil
+}
+
+// Stat 获取对象信息
+func (s *LocalStore) Stat(ctx context.Context, key string) (*Object, error) {
+	filename, err := s.filePath(key)
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(filename)
+	if errors.Is(err, fs.ErrNotExist) || (err == nil && info.IsDir()) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("获取文件信息失败: %w", err)
+	}
+	return &Object{Key: key, Size: info.Size(), LastModified: info.ModTime()}, nil
+}
+
+// open 打开对象对应的文件
+func (s *LocalStore) open(ctx context.Context, key string) (*os.File, error) {
+	filename, err := s.filePath(key)
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("打开文件失败: %w", err)
+	}
+	return f, nil
+}
+
+// Copy 复制对象
+func (s *LocalStore) Copy(ctx context.Context, srcKey, dstKey string) error {
+	src, err := s.Get(ctx, srcKey)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	return s.Put(ctx, dstKey, src)
+}
+
+// CopyIfAbsent 仅在目标对象不存在时复制（与 PutIfAbsent 相同，通过硬链接放到目标路径）
+func (s *LocalStore) CopyIfAbsent(ctx context.Context, srcKey, dstKey string) error {
+	src, err := s.Get(ctx, srcKey)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	return s.PutIfAbsent(ctx, dstKey, src)
+}
+
+// Delete 删除对象
+func (s *LocalStore) Delete(ctx context.Context, key string) error {
+	filename, err := s.filePath(key)
+	if err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if err := os.Remove(filename); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("删除文件失败: %w", err)
+	}
+	return nil
+}
+
+// DeletePrefix 删除路径以 prefix 开头的所有对象
+func (s *LocalStore) DeletePrefix(ctx context.Context, prefix string, progress DeleteProgress) (*DeleteResult, error) {
+	result := &DeleteResult{}
+	objects, err := s.List(ctx, prefix)
+	if err != nil {
+		return result, err
+	}
+
+	for start := 0; start < len(objects); start += DeleteBatchSize {
+		end := min(start+DeleteBatchSize, len(objects))
+		for _, object := range objects[start:end] {
+			if err := s.Delete(ctx, object.Key); err != nil {
+				if ctx.Err() != nil {
+					return result, ctx.Err()
+				}
+				result.Failed = append(result.Failed, object.Key)
+				continue
+			}
+			result.Deleted++
+		}
+		if progress != nil {
+			progress(*result)
+		}
+	}
+	return result, nil
+}
+
+// List 列出路径以 prefix 开头的所有对象
+func (s *LocalStore) List(ctx context.Context, prefix string) ([]Object, error) {
+	// 只需要遍历 prefix 所在的目录
+	dir := s.root
+	if i := strings.LastIndex(prefix, "/"); i >= 0 {
+		var err error
+		if dir, err = s.filePath(prefix[:i]); err != nil {
+			return nil, err
+		}
+	}
+
+	objects := make([]Object, 0)
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), tempFilePrefix) {
+			return nil
+		}
+
+		rel, err := filepath.Rel(s.root, p)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		objects = append(objects, Object{
+			Key:          key,
+			Size:         info.Size(),
+			LastModified: info.ModTime(),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("列出文件失败: %w", err)
+	}
+
+	sort.Slice(objects, func(i, j int) bool {
+		return objects[i].Key < objects[j].Key
+	})
+	return objects, nil
+}
+
+// URL 返回对象的访问 URL（对路径的每一段进行转义）
+func (s *LocalStore) URL(key string) string {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return s.baseURL + "/" + strings.Join(segments, "/")
+}
+
+// filePath 将对象路径转换为文件路径，拒绝包含 ".." 的路径
+func (s *LocalStore) filePath(key string) (string, error) {
+	key = strings.ReplaceAll(key, "\\", "/")
+	cleaned := path.Clean("/" + key)
+	if cleaned == "/" || slices.Contains(strings.Split(key, "/"), "..") {
+		return "", fmt.Errorf("非法的对象路径: %q", key)
+	}
+	return filepath.Join(s.root, filepath.FromSlash(cleaned)), nil
+}
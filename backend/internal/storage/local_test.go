@@ -0,0 +1,189 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocalStore(t *testing.T) {
+	store, err := NewLocalStore(t.TempDir(), "http://localhost:8080/files/")
+	assert.NoError(t, err)
+	ctx := context.Background()
+
+	assert.NoError(t, store.Put(ctx, "image/test/cat.png", strings.NewReader("cat")))
+	assert.NoError(t, store.Put(ctx, "image/test/dog.png", strings.NewReader("dog")))
+	assert.NoError(t, store.Put(ctx, "image/other/cat.png", strings.NewReader("other")))
+
+	t.Run("读取对象", func(t *testing.T) {
+		data, err := ReadAll(ctx, store, "image/test/cat.png")
+		assert.NoError(t, err)
+		assert.Equal(t, "cat", string(data))
+
+		_, err = store.Get(ctx, "image/test/missing.png")
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("读取部分内容和对象信息", func(t *testing.T) {
+		body, err := store.GetRange(ctx, "image/test/cat.png", 1, 1)
+		assert.NoError(t, err)
+		data, _ := io.ReadAll(body)
+		body.Close()
+		assert.Equal(t, "a", string(data))
+
+		object, err := store.Stat(ctx, "image/test/cat.png")
+		assert.NoError(t, err)
+		assert.Equal(t, int64(3), object.Size)
+		assert.False(t, object.LastModified.IsZero())
+
+		_, err = store.Stat(ctx, "image/test")
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("覆盖已有对象", func(t *testing.T) {
+		assert.NoError(t, store.Put(ctx, "image/test/dog.png", strings.NewReader("puppy")))
+		data, err := ReadAll(ctx, store, "image/test/dog.png")
+		assert.NoError(t, err)
+		assert.Equal(t, "puppy", string(data))
+	})
+
+	t.Run("条件写入", func(t *testing.T) {
+		err := store.PutIfAbsent(ctx, "image/test/cat.png", strings.NewReader("kitten"))
+		assert.ErrorIs(t, err, ErrExists)
+		data, err := ReadAll(ctx, store, "image/test/cat.png")
+		assert.NoError(t, err)
+		assert.Equal(t, "cat", string(data))
+
+		assert.NoError(t, store.PutIfAbsent(ctx, "image/new/fox.png", strings.NewReader("fox")))
+		data, err = ReadAll(ctx, store, "image/new/fox.png")
+		assert.NoError(t, err)
+		assert.Equal(t, "fox", string(data))
+		assert.NoError(t, store.Delete(ctx, "image/new/fox.png"))
+	})
+
+	t.Run("条件复制", func(t *testing.T) {
+		assert.ErrorIs(t, store.CopyIfAbsent(ctx, "image/test/cat.png", "image/test/dog.png"), ErrExists)
+		data, err := ReadAll(ctx, store, "image/test/dog.png")
+		assert.NoError(t, err)
+		assert.Equal(t, "puppy", string(data))
+
+		assert.ErrorIs(t, store.CopyIfAbsent(ctx, "image/test/missing.png", "image/new/x.png"), ErrNotFound)
+
+		assert.NoError(t, store.CopyIfAbsent(ctx, "image/test/cat.png", "image/new/cat.png"))
+		data, err = ReadAll(ctx, store, "image/new/cat.png")
+		assert.NoError(t, err)
+		assert.Equal(t, "cat", string(data))
+		assert.NoError(t, store.Delete(ctx, "image/new/cat.png"))
+	})
+
+	t.Run("按前缀列出对象", func(t *testing.T) {
+		objects, err := store.List(ctx, "image/test/")
+		assert.NoError(t, err)
+		assert.Len(t, objects, 2)
+		assert.Equal(t, "image/test/cat.png", objects[0].Key)
+		assert.Equal(t, int64(3), objects[0].Size)
+		assert.False(t, objects[0].LastModified.IsZero())
+		assert.Equal(t, "image/test/dog.png", objects[1].Key)
+
+		// 前缀不必是完整的目录
+		objects, err = store.List(ctx, "image/test/c")
+		assert.NoError(t, err)
+		assert.Len(t, objects, 1)
+
+		objects, err = store.List(ctx, "image/missing/")
+		assert.NoError(t, err)
+		assert.Empty(t, objects)
+	})
+
+	t.Run("复制和删除对象", func(t *testing.T) {
+		assert.NoError(t, store.Copy(ctx, "image/test/cat.png", "image/test/cat (2).png"))
+		body, err := store.Get(ctx, "image/test/cat (2).png")
+		assert.NoError(t, err)
+		data, _ := io.ReadAll(body)
+		body.Close()
+		assert.Equal(t, "cat", string(data))
+
+		assert.ErrorIs(t, store.Copy(ctx, "image/test/missing.png", "image/test/x.png"), ErrNotFound)
+
+		assert.NoError(t, store.Delete(ctx, "image/test/cat (2).png"))
+		assert.NoError(t, store.Delete(ctx, "image/test/cat (2).png"))
+		_, err = store.Get(ctx, "image/test/cat (2).png")
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("按前缀删除对象", func(t *testing.T) {
+		var progress []DeleteResult
+		result, err := store.DeletePrefix(ctx, "image/test/", func(r DeleteResult) {
+			progress = append(progress, r)
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, 2, result.Deleted)
+		assert.Empty(t, result.Failed)
+		assert.Len(t, progress, 1)
+
+		objects, err := store.List(ctx, "image/")
+		assert.NoError(t, err)
+		assert.Len(t, objects, 1)
+		assert.Equal(t, "image/other/cat.png", objects[0].Key)
+	})
+
+	t.Run("访问 URL", func(t *testing.T) {
+		assert.Equal(t, "http://localhost:8080/files/image/test/cat%20%282%29.png", store.URL("image/test/cat (2).png"))
+	})
+
+	t.Run("非法的对象路径", func(t *testing.T) {
+		for _, key := range []string{"", "/", "../secret", "image/../../secret"} {
+			assert.Error(t, store.Put(ctx, key, strings.NewReader("x")), key)
+		}
+	})
+}
+
+func TestLayout(t *testing.T) {
+	assert.Equal(t, "image/test/cat.png", Layout{}.ImageKey("test", "cat.png"))
+	layout := NewLayout("/assets/images/")
+	assert.Equal(t, "assets/images/test/cat.png", layout.ImageKey("test", "cat.png"))
+	assert.Equal(t, "assets/images/test/", layout.WorkspacePrefix("test"))
+	assert.Equal(t, "assets/images/test/.keep", layout.WorkspaceMarker("test"))
+}
+
+func TestObjectReader(t *testing.T) {
+	store, err := NewLocalStore(t.TempDir(), "/files")
+	assert.NoError(t, err)
+	ctx := context.Background()
+	assert.NoError(t, store.Put(ctx, "image/test/cat.png", strings.NewReader("0123456789")))
+	modTime := time.Date(2025, 3, 18, 10, 0, 0, 0, time.UTC)
+
+	serve := func(header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/image/raw/1", nil)
+		req.Header = header
+		rec := httptest.NewRecorder()
+		reader := NewObjectReader(ctx, store, "image/test/cat.png", 10)
+		defer reader.Close()
+		rec.Header().Set("ETag", `"v1"`)
+		http.ServeContent(rec, req, "cat.png", modTime, reader)
+		return rec
+	}
+
+	rec := serve(http.Header{})
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "0123456789", rec.Body.String())
+	assert.Equal(t, "Tue, 18 Mar 2025 10:00:00 GMT", rec.Header().Get("Last-Modified"))
+
+	rec = serve(http.Header{"Range": {"bytes=2-4"}})
+	assert.Equal(t, http.StatusPartialContent, rec.Code)
+	assert.Equal(t, "234", rec.Body.String())
+	assert.Equal(t, "bytes 2-4/10", rec.Header().Get("Content-Range"))
+
+	rec = serve(http.Header{"Range": {"bytes=-3"}})
+	assert.Equal(t, "789", rec.Body.String())
+
+	rec = serve(http.Header{"If-None-Match": {`"v1"`}})
+	assert.Equal(t, http.StatusNotModified, rec.Code)
+	assert.Empty(t, rec.Body.String())
+}
@@ -0,0 +1,212 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrNotFound 对象不存在
+	ErrNotFound = errors.New("对象不存在")
+	// ErrExists 对象已存在（条件写入失败）
+	ErrExists = errors.New("对象已存在")
+	// ErrNotSupported 存储不支持该操作（如部分兼容 S3 的存储不支持条件复制）
+	ErrNotSupported = errors.New("存储不支持该操作")
+)
+
+// Object 存储中的一个对象
+type Object struct {
+	Key          string    // 对象路径（相对于存储根目录）
+	Size         int64     // 大小（字节）
+	LastModified time.Time // 最后修改时间
+}
+
+// BlobStore 对象存储接口
+// 对象路径使用正斜杠分隔，如 "image/default/cat.png"
+type BlobStore interface {
+	// Put 写入对象，已存在时覆盖
+	Put(ctx context.Context, key string, r io.Reader) error
+	// PutIfAbsent 仅在对象不存在时写入（原子操作），已存在时返回 ErrExists
+	PutIfAbsent(ctx context.Context, key string, r io.Reader) error
+	// Get 读取对象，对象不存在时返回 ErrNotFound；调用方负责关闭返回的 ReadCloser
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// GetRange 读取对象从 offset 开始的 length 字节（length < 0 表示读到末尾），对象不存在时返回 ErrNotFound
+	GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error)
+	// Stat 获取对象的大小和修改时间，对象不存在时返回 ErrNotFound
+	Stat(ctx context.Context, key string) (*Object, error)
+	// Copy 复制对象，源对象不存在时返回 ErrNotFound
+	Copy(ctx context.Context, srcKey, dstKey string) error
+	// CopyIfAbsent 仅在目标对象不存在时复制（原子操作），目标已存在时返回 ErrExists，源对象不存在时返回 ErrNotFound
+	// 存储不支持条件复制时返回 ErrNotSupported
+	CopyIfAbsent(ctx context.Context, srcKey, dstKey string) error
+	// Delete 删除对象，对象不存在时不报错
+	Delete(ctx context.Context, key string) error
+	// DeletePrefix 逐页列出并分批删除路径以 prefix 开头的所有对象，每处理完一批调用一次 progress（可以为 nil）
+	// 单个对象删除失败时记录到结果中并继续；列出或请求失败时返回错误和已完成部分的结果
+	DeletePrefix(ctx context.Context, prefix string, progress DeleteProgress) (*DeleteResult, error)
+	// List 列出路径以 prefix 开头的所有对象（按路径排序）
+	List(ctx context.Context, prefix string) ([]Object, error)
+	// URL 返回对象的访问 URL
+	URL(key string) string
+}
+
+// DeleteBatchSize 批量删除时每批的对象数（OSS 和 S3 批量删除接口一次最多 1000 个）
+const DeleteBatchSize = 1000
+
+// DeleteResult 按前缀删除对象的结果
+type DeleteResult struct {
+	Deleted int      // 删除成功的对象数
+	Failed  []string // 删除失败的对象路径
+}
+
+// DeleteProgress 按前缀删除的进度回调，参数为截至当前批次的累计结果
+type DeleteProgress func(result DeleteResult)
+
+// URLSigner 支持生成带签名的临时访问 URL 的存储（用于私有存储桶）
+type URLSigner interface {
+	// SignURL 返回对象的临时访问 URL，ttl 后失效
+	SignURL(ctx context.Context, key string, ttl time.Duration) (string, error)
+}
+
+// AccessURL 返回对象的访问 URL
+// ttl 大于 0 且存储支持签名时返回带签名的临时 URL，否则返回 store.URL(key)；key 为空时返回空字符串
+func AccessURL(ctx context.Context, store BlobStore, key string, ttl time.Duration) (string, error) {
+	if key == "" {
+		return "", nil
+	}
+	if signer, ok := store.(URLSigner); ok && ttl > 0 {
+		url, err := signer.SignURL(ctx, key, ttl)
+		if err != nil {
+			return "", fmt.Errorf("生成签名 URL 失败: %w", err)
+		}
+		return url, nil
+	}
+	return store.URL(key), nil
+}
+
+// 存储后端类型
+const (
+	BackendOSS   = "oss"   // 阿里云 OSS
+	BackendLocal = "local" // 本地磁盘
+	BackendS3    = "s3"    // S3 兼容存储（AWS S3、MinIO、Cloudflare R2 等）
+)
+
+// DefaultImagePrefix 默认的图片根目录
+const DefaultImagePrefix = "image"
+
+// Layout 图片在存储中的路径布局: <prefix>/<workspace>/<filename>
+type Layout struct {
+	prefix string
+}
+
+// NewLayout 创建路径布局，prefix 为空时使用 "image"
+func NewLayout(prefix string) Layout {
+	prefix = strings.Trim(strings.ReplaceAll(prefix, "\\", "/"), "/")
+	if prefix == "" {
+		prefix = DefaultImagePrefix
+	}
+	return Layout{prefix: prefix}
+}
+
+// ImageKey 返回工作区中图片的对象路径
+func (l Layout) ImageKey(workspace, filename string) string {
+	return strings.ReplaceAll(fmt.Sprintf("%s/%s/%s", l.root(), workspace, filename), "\\", "/")
+}
+
+// WorkspacePrefix 返回工作区目录的路径前缀（以 "/" 结尾）
+func (l Layout) WorkspacePrefix(workspace string) string {
+	return strings.ReplaceAll(fmt.Sprintf("%s/%s/", l.root(), workspace), "\\", "/")
+}
+
+// WorkspaceMarker 返回工作区目录标记文件的路径（空对象，用于在对象存储中保留空目录）
+func (l Layout) WorkspaceMarker(workspace string) string {
+	return l.WorkspacePrefix(workspace) + ".keep"
+}
+
+// root 返回图片根目录（零值 Layout 使用默认值）
+func (l Layout) root() string {
+	if l.prefix == "" {
+		return DefaultImagePrefix
+	}
+	return l.prefix
+}
+
+// ObjectReader 按需读取对象内容的 io.ReadSeeker，可直接用于 http.ServeContent
+// Seek 不访问存储，Read 时才从当前位置打开对象：条件请求命中缓存时不会读取对象，范围请求只读取需要的部分
+type ObjectReader struct {
+	ctx    context.Context
+	store  BlobStore
+	key    string
+	size   int64
+	offset int64
+	body   io.ReadCloser
+}
+
+// NewObjectReader 创建对象读取器，size 为对象大小（通常来自 Stat）
+func NewObjectReader(ctx context.Context, store BlobStore, key string, size int64) *ObjectReader {
+	return &ObjectReader{ctx: ctx, store: store, key: key, size: size}
+}
+
+// Read 从当前位置读取对象内容
+func (r *ObjectReader) Read(p []byte) (int, error) {
+	if r.offset >= r.size {
+		return 0, io.EOF
+	}
+	if r.body == nil {
+		body, err := r.store.GetRange(r.ctx, r.key, r.offset, -1)
+		if err != nil {
+			return 0, err
+		}
+		r.body = body
+	}
+	n, err := r.body.Read(p)
+	r.offset += int64(n)
+	return n, err
+}
+
+// Seek 移动读取位置，位置改变时关闭已打开的对象
+func (r *ObjectReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.size
+	}
+	if offset < 0 {
+		return 0, fmt.Errorf("非法的读取位置: %d", offset)
+	}
+	if offset != r.offset {
+		r.Close()
+		r.offset = offset
+	}
+	return offset, nil
+}
+
+// Close 关闭已打开的对象
+func (r *ObjectReader) Close() error {
+	if r.body == nil {
+		return nil
+	}
+	err := r.body.Close()
+	r.body = nil
+	return err
+}
+
+// ReadAll 读取整个对象
+func ReadAll(ctx context.Context, store BlobStore, key string) ([]byte, error) {
+	body, err := store.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, fmt.Errorf("读取文件内容失败: %w", err)
+	}
+	return data, nil
+}
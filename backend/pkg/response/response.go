@@ -38,4 +38,11 @@ func ErrorWithStatus(c *gin.Context, httpStatus int, code int, message string) {
 	})
 }
 
-
+// ErrorWithData 带 HTTP 状态码和附加数据的错误响应
+func ErrorWithData(c *gin.Context, httpStatus int, code int, message string, data interface{}) {
+	c.JSON(httpStatus, Response{
+		Code:    code,
+		Message: message,
+		Data:    data,
+	})
+}
@@ -1,8 +1,8 @@
 import { useState, useRef, useEffect } from 'react';
-import { Edit, Trash2, RotateCcw, Settings, Send, Globe } from 'lucide-react';
+import { Edit, Trash2, RotateCcw, Settings, Send, Globe, Search, X } from 'lucide-react';
 import { imageService } from '@/services/image/imageService';
 import { workspaceService } from '@/services/workspace/workspaceService';
-import type { ImageGenerateResponse, ImageInfo } from '@/types/image';
+import type { ImageGenerateResponse, ImageInfo, ImageSearchResult, TagImagesResponse, TagInfo } from '@/types/image';
 import type { Workspace } from '@/types/workspace';
 import { formatDateTimeToBeijing } from '@/utils/date';
 import './ImageGenerator.css';
@@ -54,6 +54,18 @@ export function ImageGenerator() {
   // 图片列表相关状态
   const [workspaceImages, setWorkspaceImages] = useState<ImageInfo[]>([]);
   const [imagesLoading, setImagesLoading] = useState(false);
+  const [imagesNextCursor, setImagesNextCursor] = useState<string | undefined>();
+  const [loadingMoreImages, setLoadingMoreImages] = useState(false);
+
+  // 图片搜索相关状态（searchResults 为 null 时显示图片列表）
+  const [searchQuery, setSearchQuery] = useState('');
+  const [searchResults, setSearchResults] = useState<ImageSearchResult[] | null>(null);
+  const [searchLoading, setSearchLoading] = useState(false);
+
+  // 标签相关状态
+  const [workspaceTags, setWorkspaceTags] = useState<TagInfo[]>([]); // 工作区中正在使用的标签
+  const [activeTags, setActiveTags] = useState<string[]>([]); // 图片列表的标签过滤条件
+  const [tagInput, setTagInput] = useState('');
   const imageListRef = useRef<HTMLDivElement>(null);
   
   // 可拖动分隔线相关状态
@@ -196,7 +208,10 @@ export function ImageGenerator() {
   useEffect(() => {
     if (currentWorkspace && !isLoadingRef.current) {
       setSelectedImages([]); // 切换工作区时清空选中的图片
-      loadWorkspaceImages();
+      clearSearch();
+      setActiveTags([]);
+      loadWorkspaceImages([]);
+      loadWorkspaceTags();
     }
   }, [currentWorkspace]);
 
@@ -259,21 +274,153 @@ export function ImageGenerator() {
   };
 
   // 加载工作区图片列表
-  const loadWorkspaceImages = async () => {
+  const loadWorkspaceImages = async (tags: string[] = activeTags) => {
     if (!currentWorkspace) return;
     
     setImagesLoading(true);
     try {
-      const response = await imageService.listWorkspaceImages(currentWorkspace);
+      const response = await imageService.listWorkspaceImages(currentWorkspace, {
+        tag: tags,
+      });
       setWorkspaceImages(response.images);
+      setImagesNextCursor(response.next_cursor);
     } catch (err) {
       console.error('加载图片列表失败:', err);
       setWorkspaceImages([]);
+      setImagesNextCursor(undefined);
     } finally {
       setImagesLoading(false);
     }
   };
 
+  // 加载下一页图片，追加到列表末尾
+  const loadMoreWorkspaceImages = async () => {
+    if (!currentWorkspace || !imagesNextCursor) return;
+
+    setLoadingMoreImages(true);
+    try {
+      const response = await imageService.listWorkspaceImages(currentWorkspace, {
+        cursor: imagesNextCursor,
+        tag: activeTags,
+      });
+      setWorkspaceImages((prev) => {
+        // 翻页期间新增的图片可能导致重复，按 ID 去重
+        const ids = new Set(prev.map((img) => img.id));
+        return [...prev, ...response.images.filter((img) => !ids.has(img.id))];
+      });
+      setImagesNextCursor(response.next_cursor);
+    } catch (err) {
+      console.error('加载更多图片失败:', err);
+    } finally {
+      setLoadingMoreImages(false);
+    }
+  };
+
+  // 加载工作区的标签及图片数量
+  const loadWorkspaceTags = async () => {
+    if (!currentWorkspace) return;
+
+    try {
+      const response = await imageService.listTags(currentWorkspace);
+      setWorkspaceTags(response.tags);
+    } catch (err) {
+      console.error('加载标签列表失败:', err);
+      setWorkspaceTags([]);
+    }
+  };
+
+  // 切换图片列表的标签过滤条件（需要包含所有选中的标签）
+  const toggleTagFilter = (tag: string) => {
+    const tags = activeTags.includes(tag)
+      ? activeTags.filter((t) => t !== tag)
+      : [...activeTags, tag];
+    setActiveTags(tags);
+    loadWorkspaceImages(tags);
+  };
+
+  // 将修改后的标签更新到图片列表和选中的图片中
+  const applyTagUpdates = (response: TagImagesResponse) => {
+    const tagsById = new Map(response.images.map((img) => [img.id, img.tags]));
+    const update = (img: ImageInfo) =>
+      tagsById.has(img.id) ? { ...img, tags: tagsById.get(img.id) } : img;
+    setWorkspaceImages((prev) => prev.map(update));
+    setSelectedImages((prev) => prev.map(update));
+  };
+
+  // 为选中的图片添加标签
+  const handleAddTag = async (e: React.FormEvent) => {
+    e.preventDefault();
+    const tag = tagInput.trim();
+    if (!currentWorkspace || !tag || selectedImages.length === 0) return;
+
+    try {
+      const response = await imageService.addTags({
+        workspace: currentWorkspace,
+        image_ids: selectedImages.map((img) => img.id),
+        tags: [tag],
+      });
+      applyTagUpdates(response);
+      setTagInput('');
+      loadWorkspaceTags();
+    } catch (err) {
+      console.error('添加标签失败:', err);
+      setError(err instanceof Error ? err.message : '添加标签失败');
+    }
+  };
+
+  // 从选中的图片中移除标签
+  const handleRemoveTag = async (tag: string) => {
+    if (!currentWorkspace || selectedImages.length === 0) return;
+
+    try {
+      const response = await imageService.removeTags({
+        workspace: currentWorkspace,
+        image_ids: selectedImages.map((img) => img.id),
+        tags: [tag],
+      });
+      applyTagUpdates(response);
+      loadWorkspaceTags();
+      // 按该标签过滤时，移除后的图片不再满足过滤条件
+      if (activeTags.includes(tag)) {
+        loadWorkspaceImages();
+      }
+    } catch (err) {
+      console.error('移除标签失败:', err);
+      setError(err instanceof Error ? err.message : '移除标签失败');
+    }
+  };
+
+  // 选中的图片的所有标签
+  const selectedTags = [...new Set(selectedImages.flatMap((img) => img.tags ?? []))].sort();
+
+  // 搜索工作区图片
+  const handleSearch = async (e: React.FormEvent) => {
+    e.preventDefault();
+    const q = searchQuery.trim();
+    if (!currentWorkspace) return;
+    if (!q) {
+      clearSearch();
+      return;
+    }
+
+    setSearchLoading(true);
+    try {
+      const response = await imageService.searchImages(currentWorkspace, q);
+      setSearchResults(response.results);
+    } catch (err) {
+      console.error('搜索图片失败:', err);
+      setError(err instanceof Error ? err.message : '搜索图片失败');
+    } finally {
+      setSearchLoading(false);
+    }
+  };
+
+  // 清空搜索，恢复显示图片列表
+  const clearSearch = () => {
+    setSearchQuery('');
+    setSearchResults(null);
+  };
+
   // 选择/取消选择图片
   const handleSelectImage = (image: ImageInfo) => {
     setSelectedImages((prev) => {
@@ -910,11 +1057,116 @@ export function ImageGenerator() {
                 />
               </div>
 
-              {/* 图片列表 */}
-              {imagesLoading ? (
+              {/* 搜索框 */}
+              <form className="image-search-form" onSubmit={handleSearch}>
+                <Search size={14} className="image-search-icon" />
+                <input
+                  type="text"
+                  value={searchQuery}
+                  onChange={(e) => setSearchQuery(e.target.value)}
+                  placeholder="搜索文件名、提示词、对话"
+                  className="image-search-input"
+                />
+                {searchResults !== null && (
+                  <button
+                    type="button"
+                    onClick={clearSearch}
+                    className="image-search-clear"
+                    title="清空搜索"
+                  >
+                    <X size={14} />
+                  </button>
+                )}
+              </form>
+
+              {/* 标签过滤 */}
+              {searchResults === null && workspaceTags.length > 0 && (
+                <div className="image-tag-filter">
+                  {workspaceTags.map((tag) => (
+                    <button
+                      key={tag.name}
+                      type="button"
+                      onClick={() => toggleTagFilter(tag.name)}
+                      className={`image-tag-chip ${activeTags.includes(tag.name) ? 'active' : ''}`}
+                    >
+                      {tag.name}
+                      <span className="image-tag-count">{tag.count}</span>
+                    </button>
+                  ))}
+                </div>
+              )}
+
+              {/* 为选中的图片添加或移除标签 */}
+              {selectedImages.length > 0 && (
+                <div className="image-tag-editor">
+                  {selectedTags.map((tag) => (
+                    <span key={tag} className="image-tag-chip">
+                      {tag}
+                      <button
+                        type="button"
+                        onClick={() => handleRemoveTag(tag)}
+                        className="image-tag-remove"
+                        title="从选中的图片中移除"
+                      >
+                        <X size={10} />
+                      </button>
+                    </span>
+                  ))}
+                  <form onSubmit={handleAddTag} className="image-tag-form">
+                    <input
+                      type="text"
+                      value={tagInput}
+                      onChange={(e) => setTagInput(e.target.value)}
+                      placeholder={`为选中的 ${selectedImages.length} 张图片添加标签`}
+                      maxLength={50}
+                      className="image-tag-input"
+                    />
+                  </form>
+                </div>
+              )}
+
+              {/* 搜索结果 */}
+              {searchLoading ? (
+                <div className="image-list-loading">搜索中...</div>
+              ) : searchResults !== null ? (
+                searchResults.length === 0 ? (
+                  <div className="image-list-empty">没有找到匹配的图片</div>
+                ) : (
+                  <div className="image-search-results">
+                    {searchResults.map((result) => (
+                      <div
+                        key={result.id}
+                        className={`image-search-result ${isImageSelected(result) ? 'selected' : ''}`}
+                        onClick={() => handleSelectImage(result)}
+                      >
+                        <img
+                          src={result.thumbnail_url || result.url}
+                          alt={result.name}
+                          className="image-search-thumbnail"
+                        />
+                        <div className="image-search-info">
+                          <div className="image-search-name">{result.name}</div>
+                          {result.highlights
+                            .filter((highlight) => highlight.field !== 'name')
+                            .map((highlight) => (
+                              // 片段由服务端转义，只包含 <mark> 标签
+                              <div
+                                key={highlight.field}
+                                className="image-search-snippet"
+                                dangerouslySetInnerHTML={{ __html: highlight.snippet }}
+                              />
+                            ))}
+                        </div>
+                      </div>
+                    ))}
+                  </div>
+                )
+              ) : imagesLoading ? (
                 <div className="image-list-loading">加载中...</div>
               ) : workspaceImages.length === 0 ? (
-                <div className="image-list-empty">暂无图片，点击上方上传</div>
+                <div className="image-list-empty">
+                  {activeTags.length > 0 ? '没有包含所选标签的图片' : '暂无图片，点击上方上传'}
+                </div>
               ) : (
                 <div className="image-list-items">
                   {/* 对图片列表进行排序：选中的图片置顶，其余按原顺序（时间倒序） */}
@@ -983,6 +1235,16 @@ export function ImageGenerator() {
                       )}
                     </div>
                   ))}
+                  {imagesNextCursor && (
+                    <button
+                      type="button"
+                      onClick={loadMoreWorkspaceImages}
+                      disabled={loadingMoreImages}
+                      className="image-list-load-more"
+                    >
+                      {loadingMoreImages ? '加载中...' : '加载更多'}
+                    </button>
+                  )}
                 </div>
               )}
             </div>
@@ -4,6 +4,11 @@ import type {
   ImageGenerateResponse,
   ImageUploadResponse,
   ListWorkspaceImagesResponse,
+  ListWorkspaceImagesParams,
+  SearchImagesResponse,
+  TagImagesRequest,
+  TagImagesResponse,
+  ListTagsResponse,
   DeleteImageRequest,
   RenameImageRequest,
   RenameImageResponse,
@@ -107,17 +112,21 @@ class ImageService {
   }
 
   /**
-   * 列出工作区的所有图片
+   * 分页列出工作区的图片
    */
   async listWorkspaceImages(
-    workspace: string
+    workspace: string,
+    params: ListWorkspaceImagesParams = {}
   ): Promise<ListWorkspaceImagesResponse> {
     const response = await apiClient.get<ApiResponse<ListWorkspaceImagesResponse>>(
       '/image/list',
       {
         params: {
           workspace,
+          ...params,
         },
+        // 多个标签按 tag=a&tag=b 传递
+        paramsSerializer: { indexes: null },
       }
     );
 
@@ -128,6 +137,86 @@ class ImageService {
     return response.data.data!;
   }
 
+  /**
+   * 按文件名、提示词和对话文本全文搜索工作区的图片
+   */
+  async searchImages(
+    workspace: string,
+    q: string,
+    params: { limit?: number; offset?: number } = {}
+  ): Promise<SearchImagesResponse> {
+    const response = await apiClient.get<ApiResponse<SearchImagesResponse>>(
+      '/image/search',
+      {
+        params: {
+          workspace,
+          q,
+          ...params,
+        },
+      }
+    );
+
+    if (response.data.code !== 0) {
+      throw new Error(response.data.message || '搜索图片失败');
+    }
+
+    return response.data.data!;
+  }
+
+  /**
+   * 列出工作区中正在使用的标签及图片数量
+   */
+  async listTags(workspace: string): Promise<ListTagsResponse> {
+    const response = await apiClient.get<ApiResponse<ListTagsResponse>>(
+      '/image/tags',
+      {
+        params: {
+          workspace,
+        },
+      }
+    );
+
+    if (response.data.code !== 0) {
+      throw new Error(response.data.message || '获取标签列表失败');
+    }
+
+    return response.data.data!;
+  }
+
+  /**
+   * 为一张或多张图片添加标签
+   */
+  async addTags(request: TagImagesRequest): Promise<TagImagesResponse> {
+    const response = await apiClient.post<ApiResponse<TagImagesResponse>>(
+      '/image/tags',
+      request
+    );
+
+    if (response.data.code !== 0) {
+      throw new Error(response.data.message || '添加标签失败');
+    }
+
+    return response.data.data!;
+  }
+
+  /**
+   * 移除一张或多张图片的标签
+   */
+  async removeTags(request: TagImagesRequest): Promise<TagImagesResponse> {
+    const response = await apiClient.delete<ApiResponse<TagImagesResponse>>(
+      '/image/tags',
+      {
+        data: request,
+      }
+    );
+
+    if (response.data.code !== 0) {
+      throw new Error(response.data.message || '移除标签失败');
+    }
+
+    return response.data.data!;
+  }
+
   /**
    * 删除图片
    */
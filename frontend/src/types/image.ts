@@ -54,6 +54,7 @@ export interface ImageInfo {
   size: number; // 文件大小（字节）
   updated: string; // 最后更新时间（ISO 8601 格式）
   source_type: 'upload' | 'generate'; // 来源类型
+  tags?: string[]; // 标签（按名称排序）
   prompt?: string; // 生成时的提示词
   ref_images?: string[]; // 生成时的引用图片
   message_list?: Message[]; // 生成时的对话历史
@@ -62,6 +63,63 @@ export interface ImageInfo {
 // 列出工作区图片响应
 export interface ListWorkspaceImagesResponse {
   images: ImageInfo[];
+  next_cursor?: string; // 下一页游标，没有更多图片时为空
+}
+
+// 列出工作区图片的查询参数
+export interface ListWorkspaceImagesParams {
+  cursor?: string; // 分页游标（上一页返回的 next_cursor）
+  limit?: number; // 每页数量，默认 50，最大 200
+  sort?: 'created' | 'updated' | 'name' | 'size'; // 排序字段，默认 created
+  order?: 'asc' | 'desc'; // 排序方向，默认 desc
+  source_type?: 'upload' | 'generate'; // 来源类型
+  mime_type?: string; // MIME 类型
+  created_after?: string; // 创建时间下限（RFC 3339 或 YYYY-MM-DD）
+  created_before?: string; // 创建时间上限（不含）
+  min_size?: number; // 最小文件大小（字节）
+  max_size?: number; // 最大文件大小（字节）
+  tag?: string[]; // 标签（需要包含所有标签）
+}
+
+// 搜索结果中匹配的片段
+export interface SearchHighlight {
+  field: 'name' | 'prompt' | 'message'; // 匹配的字段
+  snippet: string; // 匹配部分用 <mark></mark> 标记，其余内容已做 HTML 转义
+}
+
+// 图片搜索结果
+export interface ImageSearchResult extends ImageInfo {
+  score: number; // 相关度，越大越相关
+  highlights: SearchHighlight[]; // 匹配的片段
+}
+
+// 全文搜索图片响应
+export interface SearchImagesResponse {
+  results: ImageSearchResult[];
+  has_more: boolean; // 是否还有更多结果
+}
+
+// 为图片添加或移除标签请求
+export interface TagImagesRequest {
+  workspace: string; // 工作区名称
+  image_ids: number[]; // 图片 ID 列表
+  tags: string[]; // 标签名称列表
+}
+
+// 为图片添加或移除标签响应
+export interface TagImagesResponse {
+  images: { id: number; tags: string[] }[]; // 各图片修改后的标签
+}
+
+// 标签信息
+export interface TagInfo {
+  name: string; // 标签名称
+  count: number; // 使用该标签的图片数量
+}
+
+// 列出工作区标签响应
+export interface ListTagsResponse {
+  tags: TagInfo[];
 }
 
 // 删除图片请求